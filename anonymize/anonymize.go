@@ -0,0 +1,271 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package anonymize rewrites the addresses, ports and AS numbers carried in
+// NetFlow v5, NetFlow v9 and IPFIX packets so captures can be shared or
+// replayed without exposing the network they came from. Addresses are
+// remapped between CIDR blocks or anonymized with keyed prefix-preserving
+// Crypto-PAn; ports and AS numbers can be zeroed.
+package anonymize
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/sflow"
+)
+
+// Field groups accepted in Rules.Scrub.
+const (
+	ScrubPorts = "ports"
+	ScrubAS    = "as"
+)
+
+// ErrMissingTemplate is returned for NetFlow v9 and IPFIX packets holding a
+// data set whose template hasn't been seen. Its addresses can't be located,
+// so the packet must not be forwarded.
+var ErrMissingTemplate = errors.New("data set template not seen yet, addresses can't be rewritten")
+
+// ErrUnsupported is returned for packets whose addresses can't be rewritten,
+// such as sFlow datagrams.
+var ErrUnsupported = errors.New("can't rewrite addresses of this packet")
+
+// cacheSize bounds the number of anonymized addresses remembered.
+const cacheSize = 1 << 16
+
+// portFields and asFields are the Information Elements zeroed by ScrubPorts
+// and ScrubAS. NetFlow v9 shares IPFIX's numbering for all of them.
+var (
+	portFields = []uint16{ipfix.SourceTransportPort, ipfix.DestinationTransportPort, 180, 181, 182, 183, 227, 228}
+	asFields   = []uint16{16, 17, 128, 129}
+)
+
+// Remap moves addresses in one CIDR block to another of the same family and
+// prefix length, keeping their host bits.
+type Remap struct {
+	From string
+	To   string
+}
+
+// Rules selects the rewrites an Anonymizer applies.
+type Rules struct {
+	// Key is a hex-encoded KeySize-byte Crypto-PAn key. When set, addresses
+	// not covered by Remap are anonymized; otherwise they are left alone.
+	Key string
+	// Remap lists CIDR block moves. The longest matching From wins, and
+	// remapped addresses are not anonymized.
+	Remap []Remap
+	// Scrub lists field groups to zero: ScrubPorts and ScrubAS.
+	Scrub []string
+}
+
+// remap is a parsed Remap.
+type remap struct {
+	from, to netip.Prefix
+}
+
+// Anonymizer applies Rules to addresses and packets. It is safe for
+// concurrent use.
+type Anonymizer struct {
+	cryptoPAn *CryptoPAn
+	remaps    []remap // longest From first
+	scrub     map[uint16]bool
+	decoder   *decode.Decoder
+
+	mu    sync.Mutex
+	cache map[netip.Addr]netip.Addr
+}
+
+// New returns an Anonymizer for rules.
+func New(rules Rules) (*Anonymizer, error) {
+	a := &Anonymizer{
+		scrub:   make(map[uint16]bool),
+		decoder: decode.NewDecoder(),
+		cache:   make(map[netip.Addr]netip.Addr),
+	}
+	if rules.Key != "" {
+		key, err := hex.DecodeString(rules.Key)
+		if err != nil {
+			return nil, fmt.Errorf("anonymization key must be %d hex digits: %w", KeySize*2, err)
+		}
+		if a.cryptoPAn, err = NewCryptoPAn(key); err != nil {
+			return nil, err
+		}
+	}
+	for i, r := range rules.Remap {
+		from, err := netip.ParsePrefix(r.From)
+		if err != nil {
+			return nil, fmt.Errorf("remap %d from: %w", i, err)
+		}
+		to, err := netip.ParsePrefix(r.To)
+		if err != nil {
+			return nil, fmt.Errorf("remap %d to: %w", i, err)
+		}
+		if from.Addr().Is4() != to.Addr().Is4() || from.Bits() != to.Bits() {
+			return nil, fmt.Errorf("remap %d: %s and %s must have the same address family and prefix length", i, from, to)
+		}
+		for _, m := range a.remaps {
+			if m.from == from.Masked() {
+				return nil, fmt.Errorf("remap %d: %s remapped twice", i, from)
+			}
+		}
+		a.remaps = append(a.remaps, remap{from: from.Masked(), to: to.Masked()})
+	}
+	slices.SortStableFunc(a.remaps, func(x, y remap) int { return cmp.Compare(y.from.Bits(), x.from.Bits()) })
+	for _, group := range rules.Scrub {
+		var fields []uint16
+		switch group {
+		case ScrubPorts:
+			fields = portFields
+		case ScrubAS:
+			fields = asFields
+		default:
+			return nil, fmt.Errorf("scrub must list %s or %s, got %q", ScrubPorts, ScrubAS, group)
+		}
+		for _, f := range fields {
+			a.scrub[f] = true
+		}
+	}
+	return a, nil
+}
+
+// Addr returns the address that replaces addr. The unspecified address,
+// which exporters send for fields a flow doesn't use, is kept.
+func (a *Anonymizer) Addr(addr netip.Addr) netip.Addr {
+	addr = addr.Unmap()
+	if addr.IsUnspecified() {
+		return addr
+	}
+	for _, m := range a.remaps {
+		if m.from.Contains(addr) {
+			return moveHost(addr, m.to)
+		}
+	}
+	if a.cryptoPAn == nil {
+		return addr
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if to, ok := a.cache[addr]; ok {
+		return to
+	}
+	to := a.cryptoPAn.Anonymize(addr)
+	if len(a.cache) >= cacheSize {
+		clear(a.cache)
+	}
+	a.cache[addr] = to
+	return to
+}
+
+// moveHost returns addr with its leading to.Bits() bits replaced by to's.
+func moveHost(addr netip.Addr, to netip.Prefix) netip.Addr {
+	b, prefix := addr.AsSlice(), to.Addr().AsSlice()
+	bits := to.Bits()
+	copy(b, prefix[:bits/8])
+	if rem := bits % 8; rem != 0 {
+		mask := byte(0xFF) << (8 - rem)
+		b[bits/8] = prefix[bits/8]&mask | b[bits/8]&^mask
+	}
+	moved, _ := netip.AddrFromSlice(b)
+	return moved
+}
+
+// Packet returns a rewritten copy of a NetFlow v5, NetFlow v9 or IPFIX packet
+// received from exporter. Templates are learned per exporter, so template
+// packets must pass through Packet before the data they describe.
+func (a *Anonymizer) Packet(exporter string, payload []byte) ([]byte, error) {
+	if sflow.HasSFlowHeader(payload) {
+		return nil, fmt.Errorf("sFlow: %w", ErrUnsupported)
+	}
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("payload too short for flow header: %d bytes", len(payload))
+	}
+	result := make([]byte, len(payload))
+	copy(result, payload)
+	if binary.BigEndian.Uint16(payload[0:2]) == netflowv5.Version {
+		if _, err := netflowv5.IsValidNetFlowV5(payload); err != nil {
+			return nil, err
+		}
+		a.NetFlowV5(result)
+		return result, nil
+	}
+	msg, err := a.decoder.Decode(exporter, result)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Message(msg); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Message rewrites the data records of a decoded NetFlow v9 or IPFIX message
+// in place. Records of every data set with a template are rewritten, but
+// ErrMissingTemplate is returned if any data set has none.
+func (a *Anonymizer) Message(msg *decode.Message) error {
+	for _, ds := range msg.DataSets {
+		for _, record := range ds.Records {
+			for _, v := range record {
+				a.value(v)
+			}
+		}
+	}
+	if msg.MissingTemplates() != 0 {
+		return ErrMissingTemplate
+	}
+	return nil
+}
+
+// value rewrites one decoded field in place. Address fields are recognised by
+// their IANA data type and length.
+func (a *Anonymizer) value(v decode.Value) {
+	if v.Field.EnterpriseNumber != 0 {
+		return
+	}
+	if a.scrub[v.Field.Type] {
+		clear(v.Data)
+		return
+	}
+	switch ipfix.ElementDataType(v.Field.Type) {
+	case "ipv4Address":
+		if len(v.Data) == 4 {
+			to := a.Addr(netip.AddrFrom4([4]byte(v.Data))).As4()
+			copy(v.Data, to[:])
+		}
+	case "ipv6Address":
+		if len(v.Data) == 16 {
+			to := a.Addr(netip.AddrFrom16([16]byte(v.Data))).As16()
+			copy(v.Data, to[:])
+		}
+	}
+}
+
+// NetFlowV5 rewrites the records of a validated NetFlow v5 packet in place:
+// the source, destination and next hop addresses, and the ports and AS
+// numbers selected by Scrub.
+func (a *Anonymizer) NetFlowV5(payload []byte) {
+	count := int(binary.BigEndian.Uint16(payload[2:4]))
+	for i := range count {
+		record := payload[netflowv5.HeaderSize+i*netflowv5.RecordSize:]
+		// srcaddr, dstaddr and nexthop lead the record
+		for _, off := range []int{0, 4, 8} {
+			to := a.Addr(netip.AddrFrom4([4]byte(record[off : off+4]))).As4()
+			copy(record[off:], to[:])
+		}
+		if a.scrub[ipfix.SourceTransportPort] {
+			clear(record[32:36])
+		}
+		if a.scrub[16] {
+			clear(record[40:44])
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package anonymize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/sflow"
+)
+
+var testKey = hex.EncodeToString(referenceKey)
+
+// fieldData decodes data after template and returns the bytes of field type
+// across its data records.
+func fieldData(t *testing.T, template, data []byte, fieldType uint16) [][]byte {
+	t.Helper()
+	d := decode.NewDecoder()
+	if _, err := d.Decode("", template); err != nil {
+		t.Fatalf("Decode template: %v", err)
+	}
+	msg, err := d.Decode("", data)
+	if err != nil {
+		t.Fatalf("Decode data: %v", err)
+	}
+	var values [][]byte
+	for _, ds := range msg.DataSets {
+		for _, record := range ds.Records {
+			for _, v := range record {
+				if v.Field.Type == fieldType {
+					values = append(values, v.Data)
+				}
+			}
+		}
+	}
+	if len(values) == 0 {
+		t.Fatalf("Got: no field %d Want: one per record", fieldType)
+	}
+	return values
+}
+
+func TestAddr(t *testing.T) {
+	t.Parallel()
+	a, err := New(Rules{
+		Key: testKey,
+		Remap: []Remap{
+			{From: "10.0.0.0/8", To: "172.0.0.0/8"},
+			{From: "10.1.0.0/16", To: "192.168.0.0/16"},
+			{From: "2001:db8::/32", To: "2001:db9::/32"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	tests := []struct {
+		name string
+		addr string
+		want string
+	}{
+		{name: "remapped", addr: "10.2.3.4", want: "172.2.3.4"},
+		{name: "longest match", addr: "10.1.3.4", want: "192.168.3.4"},
+		{name: "ipv6 remapped", addr: "2001:db8:1::1", want: "2001:db9:1::1"},
+		{name: "ipv4-mapped remapped", addr: "::ffff:10.2.3.4", want: "172.2.3.4"},
+		{name: "anonymized", addr: "128.11.68.132", want: "135.242.180.132"},
+		{name: "unspecified kept", addr: "0.0.0.0", want: "0.0.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := a.Addr(netip.MustParseAddr(tt.addr)); got.String() != tt.want {
+				t.Errorf("Got: %s Want: %s", got, tt.want)
+			}
+		})
+	}
+
+	plain, err := New(Rules{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := plain.Addr(netip.MustParseAddr("128.11.68.132")); got.String() != "128.11.68.132" {
+		t.Errorf("Got: %s without a key Want: address unchanged", got)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		rules Rules
+	}{
+		{name: "key not hex", rules: Rules{Key: "not hex"}},
+		{name: "key too short", rules: Rules{Key: testKey[:32]}},
+		{name: "bad prefix", rules: Rules{Remap: []Remap{{From: "10.0.0.0", To: "172.0.0.0/8"}}}},
+		{name: "prefix lengths differ", rules: Rules{Remap: []Remap{{From: "10.0.0.0/8", To: "172.16.0.0/12"}}}},
+		{name: "families differ", rules: Rules{Remap: []Remap{{From: "10.0.0.0/8", To: "2001:db8::/8"}}}},
+		{name: "remapped twice", rules: Rules{Remap: []Remap{{From: "10.0.0.0/8", To: "172.0.0.0/8"}, {From: "10.1.0.0/8", To: "11.0.0.0/8"}}}},
+		{name: "unknown scrub", rules: Rules{Scrub: []string{"macs"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := New(tt.rules); err == nil {
+				t.Error("Got: nil error Want: error")
+			}
+		})
+	}
+}
+
+func TestPacketNetFlow(t *testing.T) {
+	t.Parallel()
+	session := netflow.NewSession()
+	tmpl := netflow.GenerateTemplateNetflow(7, session)
+	tmplBuf := tmpl.ToBytes()
+	data, err := netflow.GenerateDataNetflow(5, 7, "10.0.0.0/8", "10.0.0.0/8", 443, session)
+	if err != nil {
+		t.Fatalf("GenerateDataNetflow: %v", err)
+	}
+	dataBuf := data.ToBytes()
+	template, payload := tmplBuf.Bytes(), dataBuf.Bytes()
+	recorded := bytes.Clone(payload)
+
+	a, err := New(Rules{Remap: []Remap{{From: "10.0.0.0/8", To: "172.0.0.0/8"}}, Scrub: []string{ScrubPorts}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := a.Packet("192.0.2.1:2055", payload); !errors.Is(err, ErrMissingTemplate) {
+		t.Errorf("Got: %v before the template Want: ErrMissingTemplate", err)
+	}
+	if _, err := a.Packet("192.0.2.1:2055", template); err != nil {
+		t.Fatalf("Packet template: %v", err)
+	}
+	result, err := a.Packet("192.0.2.1:2055", payload)
+	if err != nil {
+		t.Fatalf("Packet data: %v", err)
+	}
+
+	for _, field := range []uint16{netflow.IPV4_SRC_ADDR, netflow.IPV4_DST_ADDR} {
+		original := fieldData(t, template, payload, field)
+		for i, got := range fieldData(t, template, result, field) {
+			if got[0] != 172 || string(got[1:]) != string(original[i][1:]) {
+				t.Errorf("Got: field %d %v Want: %v moved to 172.0.0.0/8", field, got, original[i])
+			}
+		}
+	}
+	for _, field := range []uint16{netflow.L4_SRC_PORT, netflow.L4_DST_PORT} {
+		for _, got := range fieldData(t, template, result, field) {
+			if binary.BigEndian.Uint16(got) != 0 {
+				t.Errorf("Got: field %d %d Want: 0", field, binary.BigEndian.Uint16(got))
+			}
+		}
+	}
+	if !bytes.Equal(payload, recorded) {
+		t.Error("Got: payload modified Want: rewritten copy")
+	}
+}
+
+func TestPacketIPFIX(t *testing.T) {
+	t.Parallel()
+	seq := ipfix.NewIPFIXSequence()
+	tmpl := ipfix.GenerateTemplateIPFIX(8, seq)
+	tmplBuf, err := tmpl.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes: %v", err)
+	}
+	data, err := ipfix.GenerateDataIPFIX(4, 8, "2001:db8::/64", "2001:db8::/64", 443, seq)
+	if err != nil {
+		t.Fatalf("GenerateDataIPFIX: %v", err)
+	}
+	dataBuf, err := data.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes: %v", err)
+	}
+	template, payload := tmplBuf.Bytes(), dataBuf.Bytes()
+
+	a, err := New(Rules{Key: testKey})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := a.Packet("192.0.2.1:4739", template); err != nil {
+		t.Fatalf("Packet template: %v", err)
+	}
+	result, err := a.Packet("192.0.2.1:4739", payload)
+	if err != nil {
+		t.Fatalf("Packet data: %v", err)
+	}
+
+	c, err := NewCryptoPAn(referenceKey)
+	if err != nil {
+		t.Fatalf("NewCryptoPAn: %v", err)
+	}
+	for _, field := range []uint16{ipfix.SourceIPv6Address, ipfix.DestinationIPv6Address} {
+		original := fieldData(t, template, payload, field)
+		for i, got := range fieldData(t, template, result, field) {
+			want := c.Anonymize(netip.AddrFrom16([16]byte(original[i]))).As16()
+			if string(got) != string(want[:]) {
+				t.Errorf("Got: field %d %x Want: %x", field, got, want)
+			}
+		}
+	}
+	// Unused IPv4 fields stay zero
+	for _, got := range fieldData(t, template, result, ipfix.SourceIPv4Address) {
+		if binary.BigEndian.Uint32(got) != 0 {
+			t.Errorf("Got: sourceIPv4Address %x Want: 0", got)
+		}
+	}
+}
+
+func TestPacketNetFlowV5(t *testing.T) {
+	t.Parallel()
+	nf, err := netflowv5.GenerateNetflowV5(3, 1, "10.0.0.0/8", "10.0.0.0/8", 443, netflow.NewSession(), netflowv5.NewSequence())
+	if err != nil {
+		t.Fatalf("GenerateNetflowV5: %v", err)
+	}
+	buf, err := nf.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes: %v", err)
+	}
+	payload := buf.Bytes()
+
+	a, err := New(Rules{Remap: []Remap{{From: "10.0.0.0/8", To: "172.0.0.0/8"}}, Scrub: []string{ScrubPorts, ScrubAS}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	result, err := a.Packet("", payload)
+	if err != nil {
+		t.Fatalf("Packet: %v", err)
+	}
+	for i := range 3 {
+		record := result[netflowv5.HeaderSize+i*netflowv5.RecordSize:]
+		original := payload[netflowv5.HeaderSize+i*netflowv5.RecordSize:]
+		for _, off := range []int{0, 4} {
+			if record[off] != 172 || string(record[off+1:off+4]) != string(original[off+1:off+4]) {
+				t.Errorf("Got: record %d address %v Want: %v moved to 172.0.0.0/8", i, record[off:off+4], original[off:off+4])
+			}
+		}
+		if binary.BigEndian.Uint32(record[32:36]) != 0 || binary.BigEndian.Uint32(record[40:44]) != 0 {
+			t.Errorf("Got: record %d ports %x AS %x Want: zeroed", i, record[32:36], record[40:44])
+		}
+	}
+}
+
+func TestPacketSFlow(t *testing.T) {
+	t.Parallel()
+	dg, err := sflow.GenerateDatagram(2, 1, "10.0.0.0/8", "10.0.0.0/8", 443, netflow.NewSession(), sflow.NewAgent())
+	if err != nil {
+		t.Fatalf("GenerateDatagram: %v", err)
+	}
+	buf, err := dg.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes: %v", err)
+	}
+	a, err := New(Rules{Key: testKey})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := a.Packet("", buf.Bytes()); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Got: %v Want: ErrUnsupported", err)
+	}
+}
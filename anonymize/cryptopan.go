@@ -0,0 +1,74 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package anonymize
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"net/netip"
+)
+
+// KeySize is the length of a Crypto-PAn key: a 16-byte AES key followed by
+// 16 bytes that seed the padding.
+const KeySize = 32
+
+// CryptoPAn is the prefix-preserving address anonymization scheme of Xu et al.
+// Two addresses sharing an n-bit prefix map to addresses sharing an n-bit
+// prefix, and the same key always gives the same mapping, so anonymized
+// captures stay comparable across runs. IPv4 results match the reference
+// implementation; IPv6 extends it over 128 bits. It is safe for concurrent use.
+type CryptoPAn struct {
+	block cipher.Block
+	pad   [aes.BlockSize]byte
+}
+
+// NewCryptoPAn returns a CryptoPAn using a KeySize-byte key.
+func NewCryptoPAn(key []byte) (*CryptoPAn, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("crypto-pan key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, fmt.Errorf("crypto-pan cipher: %w", err)
+	}
+	c := &CryptoPAn{block: block}
+	block.Encrypt(c.pad[:], key[16:])
+	return c, nil
+}
+
+// Anonymize returns the anonymized form of addr. IPv4 addresses, including
+// IPv4-mapped IPv6 addresses, are anonymized over 32 bits.
+func (c *CryptoPAn) Anonymize(addr netip.Addr) netip.Addr {
+	if addr.Is4() || addr.Is4In6() {
+		a := addr.Unmap().As4()
+		c.anonymize(a[:])
+		return netip.AddrFrom4(a)
+	}
+	a := addr.As16()
+	c.anonymize(a[:])
+	return netip.AddrFrom16(a).WithZone(addr.Zone())
+}
+
+// anonymize replaces the address in addr with its anonymized form. Bit i of
+// the result is bit i of the address flipped by the first bit of the AES
+// encryption of the address's first i bits padded out with the pad.
+func (c *CryptoPAn) anonymize(addr []byte) {
+	var in, out [aes.BlockSize]byte
+	flips := make([]byte, len(addr))
+	for pos := range len(addr) * 8 {
+		full, rem := pos/8, pos%8
+		copy(in[:], addr[:full])
+		copy(in[full:], c.pad[full:])
+		if rem != 0 {
+			mask := byte(0xFF) << (8 - rem)
+			in[full] = addr[full]&mask | c.pad[full]&^mask
+		}
+		c.block.Encrypt(out[:], in[:])
+		flips[full] |= out[0] >> 7 << (7 - rem)
+	}
+	for i := range addr {
+		addr[i] ^= flips[i]
+	}
+}
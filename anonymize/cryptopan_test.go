@@ -0,0 +1,91 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package anonymize
+
+import (
+	"net/netip"
+	"testing"
+)
+
+// referenceKey is the key of the Crypto-PAn reference implementation's sample.
+var referenceKey = []byte{21, 34, 23, 141, 51, 164, 207, 128, 19, 10, 91, 22, 73, 144, 125, 16,
+	216, 152, 143, 131, 121, 121, 101, 39, 98, 87, 76, 45, 42, 132, 34, 2}
+
+func TestCryptoPAnReference(t *testing.T) {
+	t.Parallel()
+	c, err := NewCryptoPAn(referenceKey)
+	if err != nil {
+		t.Fatalf("NewCryptoPAn: %v", err)
+	}
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: "128.11.68.132", want: "135.242.180.132"},
+		{addr: "129.118.74.4", want: "134.136.186.123"},
+		{addr: "130.132.252.244", want: "133.68.164.234"},
+		{addr: "141.223.7.43", want: "141.167.8.160"},
+		{addr: "141.233.145.108", want: "141.129.237.235"},
+		{addr: "156.29.3.236", want: "147.225.12.42"},
+		{addr: "192.102.249.13", want: "252.138.62.131"},
+		{addr: "195.205.63.100", want: "255.186.223.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			t.Parallel()
+			if got := c.Anonymize(netip.MustParseAddr(tt.addr)); got.String() != tt.want {
+				t.Errorf("Got: %s Want: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCryptoPAnPrefixPreserving(t *testing.T) {
+	t.Parallel()
+	c, err := NewCryptoPAn(referenceKey)
+	if err != nil {
+		t.Fatalf("NewCryptoPAn: %v", err)
+	}
+	tests := []struct {
+		a, b   string
+		common int // leading bits a and b share
+	}{
+		{a: "10.1.2.3", b: "10.1.2.200", common: 24},
+		{a: "10.1.2.3", b: "10.129.2.3", common: 8},
+		{a: "2001:db8::1", b: "2001:db8::8000:0:0:1", common: 64},
+		{a: "2001:db8::1", b: "3001:db8::1", common: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			t.Parallel()
+			a, b := c.Anonymize(netip.MustParseAddr(tt.a)), c.Anonymize(netip.MustParseAddr(tt.b))
+			if got := commonBits(a, b); got != tt.common {
+				t.Errorf("Got: %s and %s share %d bits Want: %d", a, b, got, tt.common)
+			}
+		})
+	}
+}
+
+// commonBits returns the length of the longest prefix a and b share.
+func commonBits(a, b netip.Addr) int {
+	x, y := a.AsSlice(), b.AsSlice()
+	for i := range x {
+		for bit := range 8 {
+			mask := byte(0x80) >> bit
+			if x[i]&mask != y[i]&mask {
+				return i*8 + bit
+			}
+		}
+	}
+	return len(x) * 8
+}
+
+func TestNewCryptoPAnKeySize(t *testing.T) {
+	t.Parallel()
+	if _, err := NewCryptoPAn(referenceKey[:16]); err == nil {
+		t.Error("Got: nil error for 16-byte key Want: error")
+	}
+}
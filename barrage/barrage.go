@@ -7,14 +7,15 @@ package barrage
 import (
 	"context"
 	"log"
-	"net"
 	"sync"
 	"time"
 
 	"github.com/dmabry/flowgre/lifecycle"
+	"github.com/dmabry/flowgre/loadshape"
 	"github.com/dmabry/flowgre/models"
 	"github.com/dmabry/flowgre/netflow"
 	"github.com/dmabry/flowgre/stats"
+	"github.com/dmabry/flowgre/transport"
 	"github.com/dmabry/flowgre/utils"
 )
 
@@ -33,10 +34,14 @@ type workerConfig struct {
 	ctx              context.Context
 	server           string
 	port             int
+	dial             transport.Dialer
 	srcRange         string
 	dstRange         string
 	sourceID         int
-	delay            int
+	config           *models.Config
+	workers          int
+	shape            loadshape.Shape
+	limits           *runLimits
 	templateInterval int
 	wg               *sync.WaitGroup
 	statsChan        chan<- models.WorkerStat
@@ -47,6 +52,9 @@ type workerConfig struct {
 func worker(cfg *workerConfig) {
 	defer cfg.wg.Done()
 	label := cfg.gen.Label()
+	if cfg.config.Name != "" {
+		label = cfg.config.Name + " " + label
+	}
 	wStats := models.WorkerStat{
 		WorkerID:  cfg.id,
 		SourceID:  cfg.sourceID,
@@ -55,49 +63,50 @@ func worker(cfg *workerConfig) {
 		BytesSent: 0,
 	}
 
-	// Configure connection to use. It looks like a listener, but it will be used to send packet. Allows setting the source port.
 	srcPort, err := utils.RandomNum(sourcePortMin, sourcePortMax)
 	if err != nil {
 		log.Printf("%s [%2d] RandomNum failed: %v", label, cfg.id, err)
 		return
 	}
 
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: srcPort})
+	t, err := cfg.dial.Dial(cfg.server, cfg.port, srcPort)
 	if err != nil {
-		log.Printf("%s [%2d] Listen failed: %v", label, cfg.id, err)
+		log.Printf("%s [%2d] Transport failed: %v", label, cfg.id, err)
 		return
 	}
-	defer conn.Close()
+	defer t.Close()
 
-	// Convert given IP String to net.IP type
-	destIP := net.ParseIP(cfg.server)
 	// start new Session for this worker
 	session := netflow.NewSession()
 
-	// Generate and send first Template Flow(s)
+	// Generate and send first Template Flow(s); template-less protocols return nil
 	tBuf := cfg.gen.GenerateTemplate(cfg.sourceID, session)
-	_, err = utils.SendPacket(conn, &net.UDPAddr{IP: destIP, Port: cfg.port}, tBuf, false)
-	if err != nil {
-		log.Printf("%s [%2d] Issue sending initial packet: %v", label, cfg.id, err)
-		return
+	if tBuf != nil {
+		_, err = t.Send(tBuf)
+		if err != nil {
+			log.Printf("%s [%2d] Issue sending initial packet: %v", label, cfg.id, err)
+			return
+		}
 	}
 
-	// Generate and send Options Data (IPFIX only; returns nil for NetFlow)
+	// Generate and send Options Data; template-less protocols return nil
 	oBuf := cfg.gen.GenerateOptionsData(cfg.sourceID, session)
 	if oBuf != nil {
-		_, err = utils.SendPacket(conn, &net.UDPAddr{IP: destIP, Port: cfg.port}, oBuf, false)
+		_, err = t.Send(oBuf)
 		if err != nil {
 			log.Printf("%s [%2d] Issue sending options data packet: %v", label, cfg.id, err)
 			return
 		}
 	}
 
-	log.Printf("%s [%2d] Slinging packets at %s:%d with Source ID: %5d and delay of %dms\n",
-		label, cfg.id, cfg.server, cfg.port, cfg.sourceID, cfg.delay)
+	pace := newWorkerPacer(cfg.config, cfg.workers, cfg.shape)
+	log.Printf("%s [%2d] Slinging packets at %s:%d with Source ID: %5d and %s\n",
+		label, cfg.id, cfg.server, cfg.port, cfg.sourceID, paceDescription(cfg.config, cfg.workers, cfg.shape))
 
-	// Data limiter throttles flow packet generation.
-	dataLimiter := time.NewTicker(time.Millisecond * time.Duration(cfg.delay))
-	defer dataLimiter.Stop()
+	// Send timer fires when the pacer may allow the pending data packet to go out.
+	sendTimer := time.NewTimer(time.Hour)
+	sendTimer.Stop()
+	defer sendTimer.Stop()
 
 	// Template retransmission ticker — fires every templateInterval seconds.
 	// When templateInterval is 0, no ticker is created so templates are never retransmitted.
@@ -109,7 +118,37 @@ func worker(cfg *workerConfig) {
 		tmplChan = tmplTicker.C
 	}
 
+	// The next data packet is generated up front so bit-rate pacing knows its size.
+	// It is reserved against the run limits until it is sent or the worker exits.
+	var buf []byte
+	var flowCount int
+	reserved := false
+	defer func() {
+		if reserved {
+			cfg.limits.release(flowCount, false)
+		}
+	}()
 	for {
+		if !reserved {
+			flowCount, err = utils.RandomNum(5, 25)
+			if err != nil {
+				log.Printf("%s [%2d] RandomNum failed: %v", label, cfg.id, err)
+				return
+			}
+			if flowCount = cfg.limits.reserve(flowCount); flowCount == 0 {
+				log.Printf("%s [%2d] Exiting due to run limit\n", label, cfg.id)
+				return
+			}
+			reserved = true
+		}
+		if buf == nil {
+			buf, err = cfg.gen.GenerateData(flowCount, cfg.sourceID, cfg.srcRange, cfg.dstRange, session)
+			if err != nil {
+				log.Printf("%s [%2d] GenerateData failed: %v", label, cfg.id, err)
+				return
+			}
+			sendTimer.Reset(pace.Reserve(flowCount, len(buf)))
+		}
 		select {
 		case <-cfg.ctx.Done():
 			log.Printf("%s [%2d] Exiting due to signal\n", label, cfg.id)
@@ -117,34 +156,43 @@ func worker(cfg *workerConfig) {
 		case <-tmplChan:
 			// Regenerate template with current sequence number and export time
 			tmplBuf := cfg.gen.GenerateTemplateWithSeq(cfg.sourceID, session)
-			bytes, err := utils.SendPacket(conn, &net.UDPAddr{IP: destIP, Port: cfg.port}, tmplBuf, false)
+			if tmplBuf == nil {
+				continue
+			}
+			bytes, err := t.Send(tmplBuf)
 			if err != nil {
 				log.Printf("%s [%2d] Issue sending template packet: %v", label, cfg.id, err)
 				return
 			}
 			wStats.FlowsSent++
 			wStats.BytesSent += uint64(bytes)
-			cfg.statsChan <- wStats
-		case <-dataLimiter.C:
-			flowCount, err := utils.RandomNum(5, 25)
+			// Options data goes out with every template refresh
+			if oBuf := cfg.gen.GenerateOptionsData(cfg.sourceID, session); oBuf != nil {
+				bytes, err = t.Send(oBuf)
 				if err != nil {
-					log.Printf("%s [%2d] RandomNum failed: %v", label, cfg.id, err)
+					log.Printf("%s [%2d] Issue sending options data packet: %v", label, cfg.id, err)
 					return
 				}
-			buf, err := cfg.gen.GenerateData(flowCount, cfg.sourceID, cfg.srcRange, cfg.dstRange, session)
-			if err != nil {
-				log.Printf("%s [%2d] GenerateData failed: %v", label, cfg.id, err)
-				return
+				wStats.BytesSent += uint64(bytes)
+			}
+			cfg.statsChan <- wStats
+		case <-sendTimer.C:
+			if wait := pace.Wait(); wait > 0 {
+				sendTimer.Reset(wait)
+				continue
 			}
-			bytes, err := utils.SendPacket(conn, &net.UDPAddr{IP: destIP, Port: cfg.port}, buf, false)
+			bytes, err := t.Send(buf)
 			if err != nil {
 				log.Printf("%s [%2d] Issue sending data packet: %v", label, cfg.id, err)
 				return
 			}
+			buf = nil
 			wStats.FlowsSent += uint64(flowCount)
 			wStats.Cycles++
 			wStats.BytesSent += uint64(bytes)
 			cfg.statsChan <- wStats
+			cfg.limits.release(flowCount, true)
+			reserved = false
 		}
 	}
 }
@@ -155,15 +203,44 @@ type RunOpts struct {
 	Wg     *sync.WaitGroup
 	Stats  *stats.Collector
 	StopFn func() // calls Stop() on the stats collector
+	// Ctx is done when the parent context is cancelled or a run-length limit
+	// is reached. context.Cause(Ctx) reports ErrDurationReached,
+	// ErrMaxPacketsReached or ErrMaxFlowsReached for the latter.
+	Ctx context.Context
 }
 
 // StartCtx starts the barrage workers and stats collector, returning immediately.
 // The caller must call opts.Wg.Wait() to block until completion, and opts.StopFn()
 // to shut down the stats collector. This allows the caller to optionally start
 // a web server or other components that consume the stats collector.
-func StartCtx(ctx context.Context, config *models.Config, gen FlowGenerator) *RunOpts {
+//
+// The barrage stops on its own once config.Duration has elapsed or
+// config.MaxPackets data packets or config.MaxFlows flows have been sent.
+// Each worker sends over its own Transport from dial, or over UDP if dial is nil.
+func StartCtx(ctx context.Context, config *models.Config, gen FlowGenerator, dial transport.Dialer) *RunOpts {
+	if dial == nil {
+		dial = transport.Network{}
+	}
 	wg := &sync.WaitGroup{}
 
+	// Run-length limits cancel a context derived from the caller's
+	ctx, cancel := context.WithCancelCause(ctx)
+	stopTimer := func() bool { return false }
+	if config.Duration > 0 {
+		stopTimer = time.AfterFunc(config.Duration, func() { cancel(ErrDurationReached) }).Stop
+	}
+	limits := newRunLimits(config.MaxPackets, config.MaxFlows, cancel)
+
+	// The load shape is validated before StartCtx; a bad one here falls back to a constant rate
+	var shape loadshape.Shape
+	if config.LoadShape != "" {
+		var err error
+		shape, err = loadshape.Parse(config.LoadShape)
+		if err != nil {
+			log.Printf("Ignoring load shape: %v", err)
+		}
+	}
+
 	buffer := 20
 	// Start the StatsCollector
 	sc := &stats.Collector{
@@ -177,6 +254,7 @@ func StartCtx(ctx context.Context, config *models.Config, gen FlowGenerator) *Ru
 		BytesSent: 0,
 	}
 	sc.Config = config
+	sc.Shape = shape
 	wg.Add(1)
 	go sc.Run(wg, ctx)
 
@@ -184,10 +262,10 @@ func StartCtx(ctx context.Context, config *models.Config, gen FlowGenerator) *Ru
 	wg.Add(config.Workers)
 	for w := 1; w <= config.Workers; w++ {
 		sourceID, err := utils.RandomNum(sourceIDMin, sourceIDMax)
-			if err != nil {
-				log.Printf("Failed to generate source ID for worker %d: %v", w, err)
-				continue
-			}
+		if err != nil {
+			log.Printf("Failed to generate source ID for worker %d: %v", w, err)
+			continue
+		}
 		// Each worker gets its own generator with independent sequence counter
 		workerGen := gen.ForWorker()
 		go worker(&workerConfig{
@@ -195,10 +273,14 @@ func StartCtx(ctx context.Context, config *models.Config, gen FlowGenerator) *Ru
 			ctx:              ctx,
 			server:           config.Server,
 			port:             config.DstPort,
+			dial:             dial,
 			srcRange:         config.SrcRange,
 			dstRange:         config.DstRange,
 			sourceID:         sourceID,
-			delay:            config.Delay,
+			config:           config,
+			workers:          config.Workers,
+			shape:            shape,
+			limits:           limits,
 			templateInterval: config.TemplateInterval,
 			wg:               wg,
 			statsChan:        sc.StatsChan,
@@ -207,9 +289,14 @@ func StartCtx(ctx context.Context, config *models.Config, gen FlowGenerator) *Ru
 	}
 
 	return &RunOpts{
-		Wg:     wg,
-		Stats:  sc,
-		StopFn: func() { sc.Stop() },
+		Wg:    wg,
+		Stats: sc,
+		StopFn: func() {
+			sc.Stop()
+			stopTimer()
+			cancel(context.Canceled)
+		},
+		Ctx: ctx,
 	}
 }
 
@@ -221,7 +308,7 @@ func StartCtx(ctx context.Context, config *models.Config, gen FlowGenerator) *Ru
 // caller can optionally attach a web server. RunCtx retains the old behavior
 // for backward compatibility.
 func RunCtx(ctx context.Context, config *models.Config, gen FlowGenerator) {
-	opts := StartCtx(ctx, config, gen)
+	opts := StartCtx(ctx, config, gen, nil)
 	opts.Wg.Wait()
 	opts.StopFn()
 }
@@ -14,6 +14,8 @@ import (
 	"github.com/dmabry/flowgre/ipfix"
 	"github.com/dmabry/flowgre/models"
 	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/sflow"
 )
 
 // TestNetFlowGenerator produces valid NetFlow v9 packets.
@@ -77,6 +79,56 @@ func TestIPFIXGenerator(t *testing.T) {
 	}
 }
 
+// TestNetFlowV5Generator produces valid NetFlow v5 packets and no templates.
+func TestNetFlowV5Generator(t *testing.T) {
+	t.Parallel()
+	gen := NetFlowV5().ForWorker()
+	session := netflow.NewSession()
+
+	if gen.Label() != "NetFlow v5 Worker" {
+		t.Errorf("Label wrong: got %q, want %q", gen.Label(), "NetFlow v5 Worker")
+	}
+	if tBuf := gen.GenerateTemplate(42, session); tBuf != nil {
+		t.Errorf("GenerateTemplate should return nil for NetFlow v5, got %d bytes", len(tBuf))
+	}
+
+	dBuf, err := gen.GenerateData(10, 42, "10.0.0.0/8", "10.0.0.0/8", session)
+	if err != nil {
+		t.Fatalf("GenerateData error: %v", err)
+	}
+	ok, err := netflowv5.IsValidNetFlowV5(dBuf)
+	if err != nil || !ok {
+		t.Errorf("GenerateData produced invalid NetFlow v5: %v", err)
+	}
+
+	if _, err := gen.GenerateData(10, 42, "2001:db8::/32", "10.0.0.0/8", session); err == nil {
+		t.Error("expected error for IPv6 range")
+	}
+}
+
+// TestSFlowGenerator produces valid sFlow v5 datagrams and no templates.
+func TestSFlowGenerator(t *testing.T) {
+	t.Parallel()
+	gen := SFlow().ForWorker()
+	session := netflow.NewSession()
+
+	if gen.Label() != "sFlow Worker" {
+		t.Errorf("Label wrong: got %q, want %q", gen.Label(), "sFlow Worker")
+	}
+	if tBuf := gen.GenerateTemplate(42, session); tBuf != nil {
+		t.Errorf("GenerateTemplate should return nil for sFlow, got %d bytes", len(tBuf))
+	}
+
+	dBuf, err := gen.GenerateData(10, 42, "10.0.0.0/8", "10.0.0.0/8", session)
+	if err != nil {
+		t.Fatalf("GenerateData error: %v", err)
+	}
+	ok, err := sflow.IsValidSFlow(dBuf)
+	if err != nil || !ok {
+		t.Errorf("GenerateData produced invalid sFlow: %v", err)
+	}
+}
+
 // TestRunCtxStopsOnCancel verifies that RunCtx stops all workers
 // when the context is cancelled.
 func TestRunCtxStopsOnCancel(t *testing.T) {
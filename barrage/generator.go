@@ -8,6 +8,8 @@ import (
 
 	"github.com/dmabry/flowgre/ipfix"
 	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/sflow"
 )
 
 // FlowGenerator abstracts protocol-specific packet generation so that
@@ -16,12 +18,14 @@ type FlowGenerator interface {
 	// Label returns the human-readable protocol name used in log messages.
 	Label() string
 	// GenerateTemplate creates the initial template packet for a source ID.
+	// Returns nil if the protocol does not use templates.
 	GenerateTemplate(sourceID int, session *netflow.Session) []byte
 	// GenerateTemplateWithSeq creates a template packet with the current
 	// sequence number. Used for template retransmissions.
 	GenerateTemplateWithSeq(sourceID int, session *netflow.Session) []byte
-	// GenerateOptionsData creates an options data packet (IPFIX only).
-	// Returns nil if the protocol does not support options templates.
+	// GenerateOptionsData creates an options data packet. For NetFlow v9 it
+	// carries its options templates too. Returns nil if the protocol does not
+	// support options templates.
 	GenerateOptionsData(sourceID int, session *netflow.Session) []byte
 	// GenerateData creates a data packet with the given number of flows.
 	GenerateData(flowCount int, sourceID int, srcRange, dstRange string, session *netflow.Session) ([]byte, error)
@@ -49,8 +53,9 @@ func (g netflowGenerator) GenerateTemplateWithSeq(sourceID int, session *netflow
 }
 
 func (g netflowGenerator) GenerateOptionsData(sourceID int, session *netflow.Session) []byte {
-	// NetFlow v9 does not support options templates
-	return nil
+	oFlow := netflow.GenerateOptionsNetflow(sourceID, session)
+	buf := oFlow.ToBytes()
+	return buf.Bytes()
 }
 
 func (g netflowGenerator) GenerateData(flowCount int, sourceID int, srcRange, dstRange string, session *netflow.Session) ([]byte, error) {
@@ -67,20 +72,21 @@ func (g netflowGenerator) ForWorker() FlowGenerator { return g }
 
 // ipfixGenerator implements FlowGenerator for IPFIX (RFC 7011).
 type ipfixGenerator struct {
-	seq *ipfix.IPFIXSequence
+	seq     *ipfix.IPFIXSequence
+	profile ipfix.IPFIXFlowProfile
 }
 
 func (g ipfixGenerator) Label() string { return "IPFIX Worker" }
 
 func (g ipfixGenerator) GenerateTemplate(sourceID int, session *netflow.Session) []byte {
-	tFlow := ipfix.GenerateTemplateIPFIX(sourceID, g.seq)
+	tFlow := ipfix.GenerateTemplateIPFIX(sourceID, g.seq, g.profile)
 	buf, _ := tFlow.ToBytes()
 	return buf.Bytes()
 }
 
 func (g ipfixGenerator) GenerateTemplateWithSeq(sourceID int, session *netflow.Session) []byte {
 	// Regenerate template with current sequence number and export time
-	tFlow := ipfix.GenerateTemplateIPFIX(sourceID, g.seq)
+	tFlow := ipfix.GenerateTemplateIPFIX(sourceID, g.seq, g.profile)
 	buf, _ := tFlow.ToBytes()
 	return buf.Bytes()
 }
@@ -92,7 +98,7 @@ func (g ipfixGenerator) GenerateOptionsData(sourceID int, session *netflow.Sessi
 }
 
 func (g ipfixGenerator) GenerateData(flowCount int, sourceID int, srcRange, dstRange string, session *netflow.Session) ([]byte, error) {
-	flow, err := ipfix.GenerateDataIPFIX(flowCount, sourceID, srcRange, dstRange, 0, g.seq)
+	flow, err := ipfix.GenerateDataIPFIX(flowCount, sourceID, srcRange, dstRange, 0, g.seq, g.profile)
 	if err != nil {
 		return nil, fmt.Errorf("GenerateDataIPFIX failed: %w", err)
 	}
@@ -106,7 +112,7 @@ func (g ipfixGenerator) GenerateData(flowCount int, sourceID int, srcRange, dstR
 // ForWorker returns a new generator with its own IPFIXSequence.
 // Each worker must have an independent sequence per RFC 7011 §3.1.
 func (g ipfixGenerator) ForWorker() FlowGenerator {
-	return ipfixGenerator{seq: ipfix.NewIPFIXSequence()}
+	return ipfixGenerator{seq: ipfix.NewIPFIXSequence(), profile: g.profile}
 }
 
 // NetFlow returns a FlowGenerator for NetFlow v9.
@@ -119,7 +125,97 @@ func NetFlow(profile ...netflow.FlowProfile) FlowGenerator {
 	return netflowGenerator{profile: p}
 }
 
+// netflowV5Generator implements FlowGenerator for NetFlow v5.
+type netflowV5Generator struct {
+	seq *netflowv5.Sequence
+}
+
+func (g netflowV5Generator) Label() string { return "NetFlow v5 Worker" }
+
+// GenerateTemplate returns nil; NetFlow v5 is a fixed format without templates.
+func (g netflowV5Generator) GenerateTemplate(sourceID int, session *netflow.Session) []byte {
+	return nil
+}
+
+func (g netflowV5Generator) GenerateTemplateWithSeq(sourceID int, session *netflow.Session) []byte {
+	return nil
+}
+
+func (g netflowV5Generator) GenerateOptionsData(sourceID int, session *netflow.Session) []byte {
+	return nil
+}
+
+func (g netflowV5Generator) GenerateData(flowCount int, sourceID int, srcRange, dstRange string, session *netflow.Session) ([]byte, error) {
+	flow, err := netflowv5.GenerateNetflowV5(flowCount, sourceID, srcRange, dstRange, 0, session, g.seq)
+	if err != nil {
+		return nil, fmt.Errorf("GenerateNetflowV5 failed: %w", err)
+	}
+	buf, err := flow.ToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("NetFlow v5 ToBytes failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ForWorker returns a new generator with its own flow sequence counter.
+func (g netflowV5Generator) ForWorker() FlowGenerator {
+	return netflowV5Generator{seq: netflowv5.NewSequence()}
+}
+
+// NetFlowV5 returns a FlowGenerator for NetFlow v5.
+func NetFlowV5() FlowGenerator {
+	return netflowV5Generator{seq: netflowv5.NewSequence()}
+}
+
+// sflowGenerator implements FlowGenerator for sFlow v5.
+type sflowGenerator struct {
+	agent *sflow.Agent
+}
+
+func (g sflowGenerator) Label() string { return "sFlow Worker" }
+
+// GenerateTemplate returns nil; sFlow datagrams are self-describing.
+func (g sflowGenerator) GenerateTemplate(sourceID int, session *netflow.Session) []byte {
+	return nil
+}
+
+func (g sflowGenerator) GenerateTemplateWithSeq(sourceID int, session *netflow.Session) []byte {
+	return nil
+}
+
+func (g sflowGenerator) GenerateOptionsData(sourceID int, session *netflow.Session) []byte {
+	return nil
+}
+
+func (g sflowGenerator) GenerateData(flowCount int, sourceID int, srcRange, dstRange string, session *netflow.Session) ([]byte, error) {
+	dgram, err := sflow.GenerateDatagram(flowCount, sourceID, srcRange, dstRange, 0, session, g.agent)
+	if err != nil {
+		return nil, fmt.Errorf("GenerateDatagram failed: %w", err)
+	}
+	buf, err := dgram.ToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("sFlow ToBytes failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ForWorker returns a new generator with its own agent, so each worker
+// looks like a separate switch with independent sequence numbers.
+func (g sflowGenerator) ForWorker() FlowGenerator {
+	return sflowGenerator{agent: sflow.NewAgent()}
+}
+
+// SFlow returns a FlowGenerator for sFlow v5.
+func SFlow() FlowGenerator {
+	return sflowGenerator{agent: sflow.NewAgent()}
+}
+
 // IPFIX returns a FlowGenerator for IPFIX (RFC 7011).
-func IPFIX() FlowGenerator {
-	return ipfixGenerator{seq: ipfix.NewIPFIXSequence()}
+// Optionally accepts an IPFIXFlowProfile; defaults to GenericIPFIXProfile.
+func IPFIX(profile ...ipfix.IPFIXFlowProfile) FlowGenerator {
+	p := ipfix.IPFIXFlowProfile(&ipfix.GenericIPFIXProfile{})
+	if len(profile) > 0 && profile[0] != nil {
+		p = profile[0]
+	}
+	return ipfixGenerator{seq: ipfix.NewIPFIXSequence(), profile: p}
 }
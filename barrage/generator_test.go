@@ -112,7 +112,7 @@ func TestNetFlow_Profile_Label(t *testing.T) {
 	}
 }
 
-func TestNetFlow_Profile_NoOptionsData(t *testing.T) {
+func TestNetFlow_Profile_OptionsData(t *testing.T) {
 	t.Parallel()
 
 	gen := NetFlow()
@@ -120,7 +120,10 @@ func TestNetFlow_Profile_NoOptionsData(t *testing.T) {
 
 	session := netflow.NewSession()
 	result := ng.GenerateOptionsData(1, session)
-	if result != nil {
-		t.Error("NetFlow v9 should not support options data")
+	if result == nil {
+		t.Fatal("expected NetFlow v9 options data")
+	}
+	if ok, err := netflow.IsValidNetFlow(result, 9); !ok {
+		t.Errorf("options data packet is not valid NetFlow v9: %v", err)
 	}
 }
@@ -0,0 +1,102 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package barrage
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Stop causes reported by context.Cause(RunOpts.Ctx) when a run-length limit ends the barrage.
+var (
+	ErrDurationReached   = errors.New("duration reached")
+	ErrMaxPacketsReached = errors.New("packet limit reached")
+	ErrMaxFlowsReached   = errors.New("flow limit reached")
+)
+
+// runLimits enforces the packet and flow limits shared by all workers. Workers
+// reserve each data packet before pacing it and release the reservation once
+// it is sent or abandoned; abandoned packets are given back to the limits.
+// The barrage is cancelled when the last reservation that fits under a limit
+// is released, so no reserved packet is cut off.
+// A nil *runLimits imposes no limits.
+type runLimits struct {
+	maxPackets uint64 // 0 for no limit
+	maxFlows   uint64 // 0 for no limit
+	cancel     context.CancelCauseFunc
+
+	mu      sync.Mutex
+	packets uint64
+	flows   uint64
+	pending int
+	cause   error // set once a limit is reached
+}
+
+// newRunLimits returns limits that call cancel once reached, or nil if neither is set.
+func newRunLimits(maxPackets, maxFlows int, cancel context.CancelCauseFunc) *runLimits {
+	if maxPackets <= 0 && maxFlows <= 0 {
+		return nil
+	}
+	return &runLimits{
+		maxPackets: uint64(max(maxPackets, 0)),
+		maxFlows:   uint64(max(maxFlows, 0)),
+		cancel:     cancel,
+	}
+}
+
+// reserve reserves a data packet of up to flows flows and returns how many
+// flows it may carry. The final packet under the flow limit may carry fewer
+// flows than asked for. It returns 0 once a limit has been reached.
+func (l *runLimits) reserve(flows int) int {
+	if l == nil {
+		return flows
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cause != nil {
+		return 0
+	}
+	n := uint64(flows)
+	if l.maxFlows > 0 {
+		n = min(n, l.maxFlows-l.flows)
+	}
+	l.packets++
+	l.flows += n
+	l.pending++
+	l.cause = l.reached()
+	return int(n)
+}
+
+// release marks a reserved packet of flows flows as sent, or abandoned if sent
+// is false. An abandoned packet no longer counts toward the limits.
+func (l *runLimits) release(flows int, sent bool) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending--
+	if !sent {
+		l.packets--
+		l.flows -= uint64(flows)
+		l.cause = l.reached()
+	}
+	if l.cause != nil && l.pending == 0 {
+		l.cancel(l.cause)
+	}
+}
+
+// reached returns the limit the reserved packets and flows have reached, or
+// nil. Must be called with l.mu held.
+func (l *runLimits) reached() error {
+	switch {
+	case l.maxPackets > 0 && l.packets >= l.maxPackets:
+		return ErrMaxPacketsReached
+	case l.maxFlows > 0 && l.flows >= l.maxFlows:
+		return ErrMaxFlowsReached
+	default:
+		return nil
+	}
+}
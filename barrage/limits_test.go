@@ -0,0 +1,209 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package barrage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmabry/flowgre/models"
+	"github.com/dmabry/flowgre/pcap"
+	"github.com/dmabry/flowgre/transport"
+)
+
+func TestRunLimits(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		maxPackets int
+		maxFlows   int
+		reserve    []int
+		want       []int
+		cause      error
+	}{
+		{"packets", 2, 0, []int{10, 10, 10}, []int{10, 10, 0}, ErrMaxPacketsReached},
+		{"flows trims last packet", 0, 25, []int{10, 10, 10, 10}, []int{10, 10, 5, 0}, ErrMaxFlowsReached},
+		{"packets first", 2, 100, []int{10, 10, 10}, []int{10, 10, 0}, ErrMaxPacketsReached},
+		{"flows first", 5, 15, []int{10, 10, 10}, []int{10, 5, 0}, ErrMaxFlowsReached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancelCause(context.Background())
+			l := newRunLimits(tt.maxPackets, tt.maxFlows, cancel)
+			granted := 0
+			for i, flows := range tt.reserve {
+				if got := l.reserve(flows); got != tt.want[i] {
+					t.Errorf("reserve %d wrong! Got: %d Want: %d", i, got, tt.want[i])
+				} else if got > 0 {
+					granted++
+				}
+			}
+			// Cancelled only once every reserved packet is released
+			for i := 0; i < granted; i++ {
+				if ctx.Err() != nil {
+					t.Fatalf("cancelled with %d reservations pending", granted-i)
+				}
+				l.release(0, true)
+			}
+			if cause := context.Cause(ctx); !errors.Is(cause, tt.cause) {
+				t.Errorf("cause wrong! Got: %v Want: %v", cause, tt.cause)
+			}
+		})
+	}
+
+	if l := newRunLimits(0, 0, nil); l != nil {
+		t.Errorf("expected no limits, got %+v", l)
+	}
+	var none *runLimits
+	if got := none.reserve(7); got != 7 {
+		t.Errorf("nil limits reserve wrong! Got: %d Want: 7", got)
+	}
+	none.release(7, false)
+}
+
+func TestRunLimitsAbandoned(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	l := newRunLimits(2, 15, cancel)
+	if got := l.reserve(10); got != 10 {
+		t.Fatalf("reserve wrong! Got: %d Want: 10", got)
+	}
+	if got := l.reserve(10); got != 5 {
+		t.Fatalf("reserve wrong! Got: %d Want: 5", got)
+	}
+	// Abandoning the packet that reached the limit gives its flows back
+	l.release(5, false)
+	if got := l.reserve(10); got != 5 {
+		t.Errorf("reserve after abandon wrong! Got: %d Want: 5", got)
+	}
+	l.release(5, true)
+	if ctx.Err() != nil {
+		t.Fatalf("cancelled with a reservation pending")
+	}
+	l.release(10, true)
+	if cause := context.Cause(ctx); !errors.Is(cause, ErrMaxPacketsReached) {
+		t.Errorf("cause wrong! Got: %v Want: %v", cause, ErrMaxPacketsReached)
+	}
+}
+
+// startTestBarrage starts a barrage against a local UDP sink and waits for it to finish.
+func startTestBarrage(t *testing.T, config *models.Config) *RunOpts {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			if _, _, err := conn.ReadFromUDP(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	config.Server = "127.0.0.1"
+	config.DstPort = conn.LocalAddr().(*net.UDPAddr).Port
+	config.SrcRange = "10.0.0.0/8"
+	config.DstRange = "10.0.0.0/8"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	opts := StartCtx(ctx, config, NetFlow(), nil)
+	opts.Wg.Wait()
+	opts.StopFn()
+	return opts
+}
+
+func TestStartCtxMaxFlows(t *testing.T) {
+	t.Parallel()
+	opts := startTestBarrage(t, &models.Config{Workers: 3, PacketsPerSecond: 3000, MaxFlows: 1000})
+	if cause := context.Cause(opts.Ctx); !errors.Is(cause, ErrMaxFlowsReached) {
+		t.Errorf("cause wrong! Got: %v Want: %v", cause, ErrMaxFlowsReached)
+	}
+	if flows := opts.Stats.StatsTotals.FlowsSent; flows != 1000 {
+		t.Errorf("flows sent wrong! Got: %d Want: 1000", flows)
+	}
+}
+
+func TestStartCtxMaxPackets(t *testing.T) {
+	t.Parallel()
+	opts := startTestBarrage(t, &models.Config{Workers: 2, PacketsPerSecond: 2000, MaxPackets: 50})
+	if cause := context.Cause(opts.Ctx); !errors.Is(cause, ErrMaxPacketsReached) {
+		t.Errorf("cause wrong! Got: %v Want: %v", cause, ErrMaxPacketsReached)
+	}
+	if packets := opts.Stats.StatsTotals.Cycles; packets != 50 {
+		t.Errorf("packets sent wrong! Got: %d Want: 50", packets)
+	}
+}
+
+func TestStartCtxDuration(t *testing.T) {
+	t.Parallel()
+	start := time.Now()
+	opts := startTestBarrage(t, &models.Config{Workers: 1, Delay: 10, Duration: 300 * time.Millisecond})
+	if cause := context.Cause(opts.Ctx); !errors.Is(cause, ErrDurationReached) {
+		t.Errorf("cause wrong! Got: %v Want: %v", cause, ErrDurationReached)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("barrage ran too long! Got: %v Want: ~300ms", elapsed)
+	}
+}
+
+func TestStartCtxOutputOnly(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "barrage.pcapng")
+	sink, err := transport.OpenSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &models.Config{Server: "127.0.0.1", DstPort: 9995, SrcRange: "10.0.0.0/8", DstRange: "10.0.0.0/8",
+		Workers: 2, PacketsPerSecond: 2000, MaxPackets: 10}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	opts := StartCtx(ctx, config, NetFlow(), transport.Network{Output: transport.Output{Sink: sink, SinkOnly: true}})
+	opts.Wg.Wait()
+	opts.StopFn()
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcap.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One template and one options packet per worker, then the data packets
+	packets := 0
+	for {
+		frame, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := pcap.DecodeUDP(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Src.Addr().String() != "127.0.0.1" || d.Dst.String() != "127.0.0.1:9995" {
+			t.Errorf("packet %d endpoints wrong! Got: %s -> %s Want: 127.0.0.1 -> 127.0.0.1:9995", packets+1, d.Src, d.Dst)
+		}
+		packets++
+	}
+	if packets != 14 {
+		t.Errorf("packets written wrong! Got: %d Want: 14", packets)
+	}
+}
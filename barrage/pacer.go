@@ -0,0 +1,127 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package barrage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dmabry/flowgre/loadshape"
+	"github.com/dmabry/flowgre/models"
+	"github.com/dmabry/flowgre/stats"
+)
+
+// pacerBurstWindow is how much unused rate a pacer may bank. It lets workers
+// catch up after a late wakeup, which matters for sub-millisecond intervals
+// where timer resolution is coarser than the interval itself.
+const pacerBurstWindow = 10 * time.Millisecond
+
+// pacer is a token bucket that meters packets by a per-packet cost: flows,
+// packets or bits, depending on how the rate was configured.
+type pacer struct {
+	rate   float64         // tokens per second at 100% load
+	window float64         // seconds of rate that may be banked; 0 banks a single token
+	shape  loadshape.Shape // optional; scales rate over time
+	start  time.Time
+	tokens float64
+	last   time.Time
+	cost   func(flows, bytes int) float64
+}
+
+// newPacer returns a pacer refilling at rate tokens per second that banks up
+// to window seconds of rate. cost returns the tokens a packet consumes.
+func newPacer(rate float64, window time.Duration, cost func(flows, bytes int) float64) *pacer {
+	now := time.Now()
+	return &pacer{
+		rate:   rate,
+		window: window.Seconds(),
+		start:  now,
+		last:   now,
+		cost:   cost,
+	}
+}
+
+// newWorkerPacer returns the pacer for one of workers workers. A configured
+// flows, packets or bits per second target is split evenly across workers;
+// otherwise each worker sends one packet every config.Delay milliseconds.
+// A non-nil shape scales the rate over time.
+func newWorkerPacer(config *models.Config, workers int, shape loadshape.Shape) *pacer {
+	var p *pacer
+	target, unit := stats.RateTarget(config)
+	if target == 0 {
+		// One packet per delay, without banking, which is how the old ticker behaved
+		p = newPacer(1000/float64(max(config.Delay, 1)), 0, func(_, _ int) float64 { return 1 })
+	} else {
+		rate := target / float64(max(workers, 1))
+		switch unit {
+		case stats.UnitFlows:
+			p = newPacer(rate, pacerBurstWindow, func(flows, _ int) float64 { return float64(flows) })
+		case stats.UnitBits:
+			p = newPacer(rate, pacerBurstWindow, func(_, bytes int) float64 { return float64(bytes * 8) })
+		default:
+			p = newPacer(rate, pacerBurstWindow, func(_, _ int) float64 { return 1 })
+		}
+	}
+	p.shape = shape
+	return p
+}
+
+// rateAt returns the refill rate at now.
+func (p *pacer) rateAt(now time.Time) float64 {
+	if p.shape == nil {
+		return p.rate
+	}
+	return p.rate * p.shape.Percent(now.Sub(p.start)) / 100
+}
+
+// Reserve takes the tokens for a packet carrying flows flows in bytes bytes
+// and returns how long to wait before calling Wait. Tokens are taken up front
+// and the caller waits off any debt, so packets costing more than the burst
+// still go out at the target average rate.
+func (p *pacer) Reserve(flows, bytes int) time.Duration {
+	rate := p.refill(time.Now())
+	p.tokens -= p.cost(flows, bytes)
+	return p.wait(rate)
+}
+
+// Wait returns how long the reserved packet has left to wait, or 0 to send it
+// now. Waits are at most pacerBurstWindow long so the rate is re-evaluated as
+// they go, and a load shape raising it, such as a burst, cuts them short.
+func (p *pacer) Wait() time.Duration {
+	return p.wait(p.refill(time.Now()))
+}
+
+// refill adds the tokens earned since the last refill at the rate at now, and
+// returns that rate.
+func (p *pacer) refill(now time.Time) float64 {
+	rate := p.rateAt(now)
+	p.tokens = min(max(1, rate*p.window), p.tokens+now.Sub(p.last).Seconds()*rate)
+	p.last = now
+	return rate
+}
+
+// wait returns how long paying off the token debt takes at rate, capped at
+// pacerBurstWindow.
+func (p *pacer) wait(rate float64) time.Duration {
+	if p.tokens >= 0 {
+		return 0
+	}
+	if rate <= 0 {
+		return pacerBurstWindow
+	}
+	return min(time.Duration(-p.tokens/rate*float64(time.Second)), pacerBurstWindow)
+}
+
+// paceDescription describes how a worker is paced, for logging.
+func paceDescription(config *models.Config, workers int, shape loadshape.Shape) string {
+	target, unit := stats.RateTarget(config)
+	desc := fmt.Sprintf("target of %.1f %s", target/float64(max(workers, 1)), unit)
+	if target == 0 {
+		desc = fmt.Sprintf("delay of %dms", config.Delay)
+	}
+	if shape != nil {
+		desc += " shaped by " + shape.String()
+	}
+	return desc
+}
@@ -0,0 +1,152 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package barrage
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dmabry/flowgre/loadshape"
+	"github.com/dmabry/flowgre/models"
+)
+
+func TestPacerReserve(t *testing.T) {
+	t.Parallel()
+	// 1000 tokens/s, nothing banked: a 10 token packet must wait 10ms
+	p := newPacer(1000, 5*time.Millisecond, func(flows, _ int) float64 { return float64(flows) })
+	if d := p.Reserve(10, 0); d < 9*time.Millisecond || d > 10*time.Millisecond {
+		t.Errorf("first reserve wait wrong! Got: %v Want: ~10ms", d)
+	}
+	// The debt carries over to the next packet, waited off in slices
+	if d := p.Reserve(10, 0); d != pacerBurstWindow {
+		t.Errorf("second reserve wait wrong! Got: %v Want: %v", d, pacerBurstWindow)
+	}
+	if p.tokens > -19 || p.tokens < -20 {
+		t.Errorf("debt wrong! Got: %v Want: ~-20", p.tokens)
+	}
+
+	// Idle time banks at most burst tokens
+	p = newPacer(1000, 5*time.Millisecond, func(flows, _ int) float64 { return float64(flows) })
+	p.last = time.Now().Add(-time.Second)
+	if d := p.Reserve(5, 0); d != 0 {
+		t.Errorf("banked reserve should not wait, got %v", d)
+	}
+	if d := p.Reserve(1, 0); d <= 0 {
+		t.Errorf("burst should be exhausted, got wait %v", d)
+	}
+}
+
+func TestNewWorkerPacer(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		config models.Config
+		flows  int
+		bytes  int
+		rate   float64
+		cost   float64
+	}{
+		{"delay", models.Config{Delay: 100}, 10, 500, 10, 1},
+		{"flows", models.Config{Delay: 100, FlowsPerSecond: 40000}, 10, 500, 10000, 10},
+		{"packets", models.Config{Delay: 100, PacketsPerSecond: 400}, 10, 500, 100, 1},
+		{"bits", models.Config{Delay: 100, BitsPerSecond: 4_000_000}, 10, 500, 1_000_000, 4000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p := newWorkerPacer(&tt.config, 4, nil)
+			if p.rate != tt.rate {
+				t.Errorf("rate wrong! Got: %v Want: %v", p.rate, tt.rate)
+			}
+			if cost := p.cost(tt.flows, tt.bytes); cost != tt.cost {
+				t.Errorf("cost wrong! Got: %v Want: %v", cost, tt.cost)
+			}
+		})
+	}
+}
+
+func TestPacerShape(t *testing.T) {
+	t.Parallel()
+	shape := loadshape.Steps{Levels: []float64{50, 200}, Every: time.Minute}
+	p := newWorkerPacer(&models.Config{PacketsPerSecond: 4000}, 4, shape)
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+	}{
+		{0, 500},
+		{30 * time.Second, 500},
+		{time.Minute, 2000},
+		{time.Hour, 2000},
+	}
+	for _, tt := range tests {
+		if got := p.rateAt(p.start.Add(tt.elapsed)); got != tt.want {
+			t.Errorf("rate at %v wrong! Got: %v Want: %v", tt.elapsed, got, tt.want)
+		}
+	}
+
+	// At 50% a 1000 token/s pacer with nothing banked waits twice as long
+	p = newPacer(1000, 0, func(flows, _ int) float64 { return float64(flows) })
+	p.shape = loadshape.Ramp{From: 50, To: 50, Over: time.Minute}
+	if d := p.Reserve(4, 0); d < 7*time.Millisecond || d > 8*time.Millisecond {
+		t.Errorf("shaped reserve wait wrong! Got: %v Want: ~8ms", d)
+	}
+}
+
+// TestPacerBurstDuringWait checks that a burst starting while a packet waits
+// at the base rate lets it out early.
+func TestPacerBurstDuringWait(t *testing.T) {
+	t.Parallel()
+	// 10 packets/s waits 100ms for a packet at base load. A 30ms burst at
+	// 1000 packets/s starts 20ms into the wait.
+	p := newPacer(10, 0, func(_, _ int) float64 { return 1 })
+	p.shape = loadshape.Burst{Base: 100, Peak: 10000, Period: time.Hour, Length: 30 * time.Millisecond}
+	p.start = time.Now().Add(20*time.Millisecond - time.Hour)
+
+	start := time.Now()
+	for d := p.Reserve(1, 0); d > 0; d = p.Wait() {
+		time.Sleep(d)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > 60*time.Millisecond {
+		t.Errorf("packet sent at the wrong time! Got: %v Want: during the burst, 20-50ms", elapsed)
+	}
+}
+
+// TestStartCtxFlowsPerSecond checks that sub-millisecond pacing reaches its target.
+func TestStartCtxFlowsPerSecond(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			if _, _, err := conn.ReadFromUDP(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	config := &models.Config{
+		Server:         "127.0.0.1",
+		DstPort:        conn.LocalAddr().(*net.UDPAddr).Port,
+		SrcRange:       "10.0.0.0/8",
+		DstRange:       "10.0.0.0/8",
+		Workers:        2,
+		Delay:          100,
+		FlowsPerSecond: 30000, // ~1000 packets/s per worker, faster than -delay 1 allows
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	opts := StartCtx(ctx, config, NetFlow(), nil)
+	opts.Wg.Wait()
+	opts.StopFn()
+
+	flows := opts.Stats.StatsTotals.FlowsSent
+	if flows < 15000 || flows > 40000 {
+		t.Errorf("flows sent in 1s outside expected range! Got: %d Want: ~30000", flows)
+	}
+}
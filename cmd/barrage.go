@@ -5,17 +5,26 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/dmabry/flowgre/barrage"
 	flowgreconfig "github.com/dmabry/flowgre/config"
+	"github.com/dmabry/flowgre/ipfix"
 	"github.com/dmabry/flowgre/lifecycle"
 	"github.com/dmabry/flowgre/models"
 	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/profiles"
+	"github.com/dmabry/flowgre/stats"
+	"github.com/dmabry/flowgre/transport"
 	"github.com/dmabry/flowgre/web"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -34,11 +43,25 @@ type BarrageCommand struct {
 	webIP            *string
 	web              *bool
 	protocol         *string
+	transport        *string
+	transportCert    *string
+	transportKey     *string
+	transportCA      *string
+	serverName       *string
 	profile          *string
 	webUsername      *string
 	webPassword      *string
 	tlsCert          *string
 	tlsKey           *string
+	flowsPerSecond   *int
+	packetsPerSecond *int
+	bitsPerSecond    *int
+	loadShape        *string
+	duration         *time.Duration
+	maxPackets       *int
+	maxFlows         *int
+	output           *string
+	outputOnly       *bool
 }
 
 // ParseFlags parses command-line flags for the barrage mode.
@@ -50,17 +73,31 @@ func (c *BarrageCommand) ParseFlags(args []string) error {
 	c.dstRange = fs.String("dst-range", "10.0.0.0/8", "CIDR range for destination IPs (IPv4 or IPv6)")
 	c.workers = fs.Int("workers", 4, "number of workers to create. Unique sources per worker")
 	c.delay = fs.Int("delay", 100, "number of milliseconds between packets sent")
-	c.templateInterval = fs.Int("template-interval", 30, "seconds between template retransmissions (0 to disable)")
+	c.templateInterval = fs.Int("template-interval", 30, "seconds between template and options data retransmissions (0 to disable)")
 	c.configFile = fs.String("config", "", "Config file to use. Supersedes all given args")
 	c.webPort = fs.Int("web-port", 8080, "Port to bind the web server on")
 	c.webIP = fs.String("web-ip", "127.0.0.1", "IP address the web server will listen on (IPv4 or IPv6)")
 	c.web = fs.Bool("web", false, "Whether to use the web server or not")
-	c.protocol = fs.String("protocol", "netflow", "protocol to use: netflow or ipfix")
-	c.profile = fs.String("profile", "generic", "flow profile: generic, minimal, extended")
+	c.protocol = fs.String("protocol", "netflow", "protocol to use: netflow, netflow5, ipfix or sflow")
+	c.transport = fs.String("transport", "udp", "transport to send over: udp, or tcp or tls for ipfix")
+	c.transportCert = fs.String("transport-cert", "", "client certificate file for -transport tls")
+	c.transportKey = fs.String("transport-key", "", "client key file for -transport tls")
+	c.transportCA = fs.String("transport-ca", "", "CA file the collector certificate must chain to for -transport tls (default: system roots)")
+	c.serverName = fs.String("transport-server-name", "", "server name to send as SNI and verify for -transport tls (default: -server)")
+	c.profile = fs.String("profile", "generic", "flow profile for netflow or ipfix: generic, minimal, extended, biflow (ipfix only) or a profile defined in the config file")
 	c.webUsername = fs.String("web-username", "", "Web server username (default: env FLOWGRE_WEB_USERNAME or generated)")
 	c.webPassword = fs.String("web-password", "", "Web server password (default: env FLOWGRE_WEB_PASSWORD or generated)")
 	c.tlsCert = fs.String("tls-cert", "", "TLS certificate file for web server (required for non-loopback binding)")
 	c.tlsKey = fs.String("tls-key", "", "TLS key file for web server (required for non-loopback binding)")
+	c.flowsPerSecond = fs.Int("flows-per-second", 0, "target flows per second across all workers (overrides -delay)")
+	c.packetsPerSecond = fs.Int("packets-per-second", 0, "target packets per second across all workers (overrides -delay)")
+	c.bitsPerSecond = fs.Int("bits-per-second", 0, "target bits per second across all workers (overrides -delay)")
+	c.duration = fs.Duration("duration", 0, "stop after this long, e.g. 30s or 10m (0 runs until interrupted)")
+	c.maxPackets = fs.Int("max-packets", 0, "stop after sending this many data packets across all workers (0 for no limit)")
+	c.maxFlows = fs.Int("max-flows", 0, "stop after sending this many flows across all workers (0 for no limit)")
+	c.output = fs.String("output", "", "Also write packets of every target to a .pcap or .pcapng capture file, or a record database directory")
+	c.outputOnly = fs.Bool("output-only", false, "Only write packets to -output, without sending them")
+	c.loadShape = fs.String("load-shape", "", "vary the send rate over time: ramp:FROM:TO:OVER, steps:L1,L2,...:EVERY, burst:BASE:PEAK:PERIOD:LEN or sine:MIN:MAX:PERIOD (levels in percent)")
 	return fs.Parse(args)
 }
 
@@ -76,14 +113,90 @@ func resolveProfile(profile string) netflow.FlowProfile {
 	}
 }
 
+// resolveIPFIXProfile returns the IPFIXFlowProfile for the given profile string.
+func resolveIPFIXProfile(profile string) ipfix.IPFIXFlowProfile {
+	switch profile {
+	case "minimal":
+		return &ipfix.MinimalIPFIXProfile{}
+	case "extended":
+		return &ipfix.ExtendedIPFIXProfile{}
+	case "biflow":
+		return &ipfix.BiflowIPFIXProfile{}
+	default:
+		return &ipfix.GenericIPFIXProfile{}
+	}
+}
+
+// isBuiltinProfile reports whether profile names one of the built-in profiles.
+func isBuiltinProfile(profile string) bool {
+	switch profile {
+	case "generic", "minimal", "extended", "biflow":
+		return true
+	}
+	return false
+}
+
+// newGenerator returns the FlowGenerator for protocol. profile selects a
+// built-in profile or one of the custom profiles declared in the config file;
+// it is ignored by protocols without templates.
+func newGenerator(protocol, profile string, custom map[string]models.ProfileConfig) (barrage.FlowGenerator, error) {
+	switch protocol {
+	case "netflow5":
+		return barrage.NetFlowV5(), nil
+	case "sflow":
+		return barrage.SFlow(), nil
+	}
+
+	cfg, isCustom := custom[strings.ToLower(profile)]
+	if !isCustom && !isBuiltinProfile(profile) {
+		return nil, fmt.Errorf("unknown profile %q: must be generic, minimal, extended, biflow or a profile defined in the config file", profile)
+	}
+	if !isCustom && profile == "biflow" && protocol != "ipfix" {
+		return nil, fmt.Errorf("profile biflow is only available for ipfix")
+	}
+
+	if protocol == "ipfix" {
+		if !isCustom {
+			return barrage.IPFIX(resolveIPFIXProfile(profile)), nil
+		}
+		p, err := profiles.IPFIX(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile: %w", err)
+		}
+		return barrage.IPFIX(p), nil
+	}
+	if !isCustom {
+		return barrage.NetFlow(resolveProfile(profile)), nil
+	}
+	p, err := profiles.NetFlow(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile: %w", err)
+	}
+	return barrage.NetFlow(p), nil
+}
+
 // validateProtocol returns an error if the protocol is not supported.
 func validateProtocol(protocol string) error {
 	switch protocol {
-	case "netflow", "ipfix":
+	case "netflow", "netflow5", "ipfix", "sflow":
 		return nil
 	default:
-		return fmt.Errorf("unsupported protocol %q: must be netflow or ipfix", protocol)
+		return fmt.Errorf("unsupported protocol %q: must be netflow, netflow5, ipfix or sflow", protocol)
+	}
+}
+
+// validateIPv4Ranges returns an error if either CIDR range is not IPv4.
+func validateIPv4Ranges(ranges ...string) error {
+	for _, r := range ranges {
+		ip, _, err := net.ParseCIDR(r)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR range %q: %w", r, err)
+		}
+		if ip.To4() == nil {
+			return fmt.Errorf("netflow5 supports IPv4 ranges only, got %q", r)
+		}
 	}
+	return nil
 }
 
 // resolveCredentials returns the username and hashed password for the web server.
@@ -161,9 +274,63 @@ func validateWebBinding(webIP, cliUsername, cliPassword string) error {
 	return nil
 }
 
+// validateTarget validates a barrage target and returns its FlowGenerator.
+func validateTarget(cfg *models.Config, customProfiles map[string]models.ProfileConfig) (barrage.FlowGenerator, error) {
+	// Validate protocol
+	if err := validateProtocol(cfg.Protocol); err != nil {
+		return nil, err
+	}
+
+	// NetFlow v5 records only carry IPv4 addresses
+	if cfg.Protocol == "netflow5" {
+		if err := validateIPv4Ranges(cfg.SrcRange, cfg.DstRange); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := flowgreconfig.ValidateTransport(cfg.Transport, cfg.Protocol); err != nil {
+		return nil, err
+	}
+
+	// Select generator based on protocol, validating any custom profile
+	gen, err := newGenerator(cfg.Protocol, cfg.Profile, customProfiles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate template interval
+	if err := validateTemplateInterval(cfg.TemplateInterval); err != nil {
+		return nil, err
+	}
+
+	// Validate barrage configuration before starting any goroutines
+	if err := flowgreconfig.ValidateBarrage(cfg.Server, cfg.DstPort, cfg.SrcRange, cfg.DstRange, cfg.Workers, cfg.Delay, cfg.TemplateInterval); err != nil {
+		return nil, fmt.Errorf("validate barrage config: %w", err)
+	}
+	if err := flowgreconfig.ValidateRates(cfg.FlowsPerSecond, cfg.PacketsPerSecond, cfg.BitsPerSecond); err != nil {
+		return nil, fmt.Errorf("validate barrage config: %w", err)
+	}
+	if err := flowgreconfig.ValidateLoadShape(cfg.LoadShape); err != nil {
+		return nil, fmt.Errorf("validate barrage config: %w", err)
+	}
+	if err := flowgreconfig.ValidateLimits(cfg.Duration, cfg.MaxPackets, cfg.MaxFlows); err != nil {
+		return nil, fmt.Errorf("validate barrage config: %w", err)
+	}
+	return gen, nil
+}
+
+// targetPrefix returns the target name followed by a space for named targets, for logging.
+func targetPrefix(cfg *models.Config) string {
+	if cfg.Name == "" {
+		return ""
+	}
+	return cfg.Name + " "
+}
+
 // Execute runs the barrage mode with parsed flags.
-func (c *BarrageCommand) Execute() error {
-	var cfg *models.Config
+func (c *BarrageCommand) Execute() (retErr error) {
+	var targets []*models.Config
+	var customProfiles map[string]models.ProfileConfig
 
 	// Load configuration from file or CLI flags
 	if *c.configFile != "" {
@@ -172,12 +339,16 @@ func (c *BarrageCommand) Execute() error {
 			return fmt.Errorf("error reading config file: %w", err)
 		}
 		var err error
-		cfg, err = flowgreconfig.LoadBarrageConfig()
+		targets, err = flowgreconfig.LoadBarrageTargets()
 		if err != nil {
 			return fmt.Errorf("error loading barrage config: %w", err)
 		}
+		customProfiles, err = flowgreconfig.LoadProfiles()
+		if err != nil {
+			return fmt.Errorf("error loading profiles: %w", err)
+		}
 	} else {
-		cfg = &models.Config{
+		targets = []*models.Config{{
 			Server:           *c.server,
 			DstPort:          *c.port,
 			SrcRange:         *c.srcRange,
@@ -189,77 +360,133 @@ func (c *BarrageCommand) Execute() error {
 			WebPort:          *c.webPort,
 			Web:              *c.web,
 			Protocol:         *c.protocol,
+			Transport:        *c.transport,
 			WebUsername:      *c.webUsername,
 			WebPassword:      *c.webPassword,
-		}
+			FlowsPerSecond:   *c.flowsPerSecond,
+			PacketsPerSecond: *c.packetsPerSecond,
+			BitsPerSecond:    *c.bitsPerSecond,
+			LoadShape:        *c.loadShape,
+			Duration:         *c.duration,
+			MaxPackets:       *c.maxPackets,
+			MaxFlows:         *c.maxFlows,
+
+			TransportCert:       *c.transportCert,
+			TransportKey:        *c.transportKey,
+			TransportCA:         *c.transportCA,
+			TransportServerName: *c.serverName,
+		}}
 	}
 
-	// Validate protocol
-	if err := validateProtocol(cfg.Protocol); err != nil {
-		return err
-	}
-
-	// Validate template interval
-	if err := validateTemplateInterval(cfg.TemplateInterval); err != nil {
-		return err
-	}
-
-	// Validate barrage configuration before starting any goroutines
-	if err := flowgreconfig.ValidateBarrage(cfg.Server, cfg.DstPort, cfg.SrcRange, cfg.DstRange, cfg.Workers, cfg.Delay, cfg.TemplateInterval); err != nil {
-		return fmt.Errorf("validate barrage config: %w", err)
+	// Validate every target before starting any goroutines. The dashboard
+	// settings come from the target that enables it.
+	gens := make([]barrage.FlowGenerator, len(targets))
+	tlsConfigs := make([]*tls.Config, len(targets))
+	var webCfg *models.Config
+	for i, cfg := range targets {
+		if cfg.Profile == "" {
+			cfg.Profile = *c.profile
+		}
+		gen, err := validateTarget(cfg, customProfiles)
+		if err == nil {
+			tlsConfigs[i], err = transportTLS(cfg.Transport, transport.TLSOptions{
+				CertFile:   cfg.TransportCert,
+				KeyFile:    cfg.TransportKey,
+				CAFile:     cfg.TransportCA,
+				ServerName: cfg.TransportServerName,
+			})
+		}
+		if err != nil {
+			if cfg.Name != "" {
+				return fmt.Errorf("target %s: %w", cfg.Name, err)
+			}
+			return err
+		}
+		gens[i] = gen
+		if cfg.Web {
+			webCfg = cfg
+		}
 	}
 
 	// Validate web binding safety
-	if cfg.Web {
-		if err := validateWebBinding(cfg.WebIP, cfg.WebUsername, cfg.WebPassword); err != nil {
+	if webCfg != nil {
+		if err := validateWebBinding(webCfg.WebIP, webCfg.WebUsername, webCfg.WebPassword); err != nil {
 			return err
 		}
-		if err := flowgreconfig.ValidateWeb(effectiveWebIP(cfg.WebIP), cfg.WebPort); err != nil {
+		if err := flowgreconfig.ValidateWeb(effectiveWebIP(webCfg.WebIP), webCfg.WebPort); err != nil {
 			return fmt.Errorf("validate web config: %w", err)
 		}
 		// Validate TLS binding before starting workers
-		if err := web.ValidateWebBinding(effectiveWebIP(cfg.WebIP), *c.tlsCert, *c.tlsKey); err != nil {
+		if err := web.ValidateWebBinding(effectiveWebIP(webCfg.WebIP), *c.tlsCert, *c.tlsKey); err != nil {
 			return fmt.Errorf("validate web TLS: %w", err)
 		}
 	}
 
 	// Resolve credentials BEFORE starting workers so errors fail fast
 	var webUsername, webHashedPassword string
-	if cfg.Web {
+	if webCfg != nil {
 		var err error
-		webUsername, webHashedPassword, err = resolveCredentials(cfg.WebUsername, cfg.WebPassword)
+		webUsername, webHashedPassword, err = resolveCredentials(webCfg.WebUsername, webCfg.WebPassword)
 		if err != nil {
 			return fmt.Errorf("resolve web credentials: %w", err)
 		}
 	}
 
-	// Select generator based on protocol
-	var gen barrage.FlowGenerator
-	if cfg.Protocol == "ipfix" {
-		gen = barrage.IPFIX()
-	} else {
-		nfProfile := resolveProfile(*c.profile)
-		gen = barrage.NetFlow(nfProfile)
+	// Every target writes to the one -output sink
+	out, closeOutput, err := openOutput(*c.output, *c.outputOnly)
+	if err != nil {
+		return err
 	}
+	defer func() {
+		if err := closeOutput(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("close output: %w", err))
+		}
+	}()
 
 	// Setup lifecycle and signal handling
 	mgr := lifecycle.New()
 	defer mgr.Cancel()
 	_ = mgr.SetupSignalHandler()
 
-	// Start barrage workers
-	opts := barrage.StartCtx(mgr.Context(), cfg, gen)
+	// Start each target's workers and stats collector
+	runs := make([]*barrage.RunOpts, len(targets))
+	group := &stats.Group{}
+	for i, cfg := range targets {
+		runs[i] = barrage.StartCtx(mgr.Context(), cfg, gens[i], transport.Network{Network: cfg.Transport, TLS: tlsConfigs[i], Output: out})
+		group.Targets = append(group.Targets, runs[i].Stats)
+	}
 
-	// Start web server if needed
-	if cfg.Web {
-		opts.Wg.Add(1)
-		effectiveIP := effectiveWebIP(cfg.WebIP)
-		go web.RunWebServer(effectiveIP, cfg.WebPort, opts.Wg, mgr.Context(), opts.Stats, webUsername, webHashedPassword, *c.tlsCert, *c.tlsKey)
+	// Once every target has reached its run-length limit, shut everything down
+	go func() {
+		for _, opts := range runs {
+			<-opts.Ctx.Done()
+		}
+		mgr.Cancel()
+	}()
+
+	// Start web server if needed; several targets share one dashboard
+	if webCfg != nil {
+		var source web.StatsSource = runs[0].Stats
+		if len(runs) > 1 {
+			source = group
+		}
+		mgr.WaitGroup().Add(1)
+		effectiveIP := effectiveWebIP(webCfg.WebIP)
+		go web.RunWebServer(effectiveIP, webCfg.WebPort, mgr.WaitGroup(), mgr.Context(), source, webUsername, webHashedPassword, *c.tlsCert, *c.tlsKey)
 	}
 
-	opts.Wg.Wait()
-	opts.StopFn()
+	for i, opts := range runs {
+		opts.Wg.Wait()
+		if cause := context.Cause(opts.Ctx); cause != nil && cause != context.Canceled {
+			log.Printf("%sBarrage stopped: %v\n", targetPrefix(targets[i]), cause)
+		}
+		opts.StopFn()
+	}
+	mgr.Cancel()
 	mgr.Wait()
+	for i, opts := range runs {
+		log.Printf("%sBarrage summary: %s\n", targetPrefix(targets[i]), opts.Stats.Summary())
+	}
 	return nil
 }
 
@@ -4,9 +4,17 @@
 package cmd
 
 import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/dmabry/flowgre/models"
+	"github.com/dmabry/flowgre/pcap"
 	"github.com/dmabry/flowgre/web"
 )
 
@@ -83,6 +91,12 @@ func TestSingleCommandDefaults(t *testing.T) {
 	if *c.dstRange != "10.0.0.0/8" {
 		t.Errorf("expected dstRange '10.0.0.0/8', got %q", *c.dstRange)
 	}
+	if *c.protocol != "netflow" {
+		t.Errorf("expected protocol 'netflow', got %q", *c.protocol)
+	}
+	if *c.output != "" || *c.outputOnly {
+		t.Errorf("expected no output, got %q only %v", *c.output, *c.outputOnly)
+	}
 }
 
 func TestSingleCommandOverrides(t *testing.T) {
@@ -95,6 +109,8 @@ func TestSingleCommandOverrides(t *testing.T) {
 		"-hexdump",
 		"-src-range", "172.16.0.0/12",
 		"-dst-range", "192.168.0.0/16",
+		"-output", "golden.pcap",
+		"-output-only",
 	}
 	if err := c.ParseFlags(args); err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -103,6 +119,9 @@ func TestSingleCommandOverrides(t *testing.T) {
 	if *c.server != "192.168.1.1" {
 		t.Errorf("expected '192.168.1.1', got %q", *c.server)
 	}
+	if *c.output != "golden.pcap" || !*c.outputOnly {
+		t.Errorf("expected output 'golden.pcap' only, got %q only %v", *c.output, *c.outputOnly)
+	}
 	if *c.port != 12345 {
 		t.Errorf("expected 12345, got %d", *c.port)
 	}
@@ -185,6 +204,15 @@ func TestBarrageCommandDefaults(t *testing.T) {
 	if *c.protocol != "netflow" {
 		t.Errorf("expected protocol 'netflow', got %q", *c.protocol)
 	}
+	if *c.transport != "udp" {
+		t.Errorf("expected transport 'udp', got %q", *c.transport)
+	}
+	if *c.transportCert != "" || *c.transportKey != "" || *c.transportCA != "" || *c.serverName != "" {
+		t.Errorf("expected no transport TLS options, got %q %q %q %q", *c.transportCert, *c.transportKey, *c.transportCA, *c.serverName)
+	}
+	if *c.output != "" || *c.outputOnly {
+		t.Errorf("expected no output, got %q only %v", *c.output, *c.outputOnly)
+	}
 }
 
 func TestBarrageCommandOverrides(t *testing.T) {
@@ -199,6 +227,7 @@ func TestBarrageCommandOverrides(t *testing.T) {
 		"-web-ip", "::",
 		"-web",
 		"-protocol", "ipfix",
+		"-transport", "tcp",
 	}
 	if err := c.ParseFlags(args); err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -231,6 +260,9 @@ func TestBarrageCommandOverrides(t *testing.T) {
 	if *c.protocol != "ipfix" {
 		t.Errorf("expected 'ipfix', got %q", *c.protocol)
 	}
+	if *c.transport != "tcp" {
+		t.Errorf("expected 'tcp', got %q", *c.transport)
+	}
 }
 
 func TestBarrageCommandConfigFile(t *testing.T) {
@@ -270,6 +302,12 @@ func TestRecordCommandDefaults(t *testing.T) {
 	if *c.dbDir != "recorded_flows" {
 		t.Errorf("expected dbDir 'recorded_flows', got %q", *c.dbDir)
 	}
+	if *c.pcap != "" {
+		t.Errorf("expected no pcap file, got %q", *c.pcap)
+	}
+	if *c.tlsCert != "" || *c.tlsKey != "" || *c.clientCA != "" {
+		t.Errorf("expected no TLS files, got %q %q %q", *c.tlsCert, *c.tlsKey, *c.clientCA)
+	}
 	if *c.verbose != false {
 		t.Errorf("expected verbose false, got %v", *c.verbose)
 	}
@@ -281,12 +319,20 @@ func TestRecordCommandOverrides(t *testing.T) {
 		"-ip", "0.0.0.0",
 		"-port", "20000",
 		"-db", "/tmp/flows",
+		"-pcap", "/tmp/flows.pcap",
+		"-tls-cert", "cert.pem",
+		"-tls-key", "key.pem",
+		"-tls-client-ca", "ca.pem",
 		"-verbose",
 	}
 	if err := c.ParseFlags(args); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
+	if *c.tlsCert != "cert.pem" || *c.tlsKey != "key.pem" || *c.clientCA != "ca.pem" {
+		t.Errorf("expected TLS files cert.pem key.pem ca.pem, got %q %q %q", *c.tlsCert, *c.tlsKey, *c.clientCA)
+	}
+
 	if *c.ip != "0.0.0.0" {
 		t.Errorf("expected '0.0.0.0', got %q", *c.ip)
 	}
@@ -296,11 +342,24 @@ func TestRecordCommandOverrides(t *testing.T) {
 	if *c.dbDir != "/tmp/flows" {
 		t.Errorf("expected '/tmp/flows', got %q", *c.dbDir)
 	}
+	if *c.pcap != "/tmp/flows.pcap" {
+		t.Errorf("expected '/tmp/flows.pcap', got %q", *c.pcap)
+	}
 	if !*c.verbose {
 		t.Error("expected verbose true")
 	}
 }
 
+func TestRecordCommandExecuteTLSInvalid(t *testing.T) {
+	c := &RecordCommand{}
+	if err := c.ParseFlags([]string{"-tls-client-ca", "ca.pem"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Execute(); err == nil {
+		t.Error("expected error for -tls-client-ca without -tls-cert, got nil")
+	}
+}
+
 func TestRecordCommandIPv6(t *testing.T) {
 	c := &RecordCommand{}
 	args := []string{"-ip", "::"}
@@ -313,6 +372,127 @@ func TestRecordCommandIPv6(t *testing.T) {
 	}
 }
 
+// =============================================================================
+// CollectCommand
+// =============================================================================
+
+func TestCollectCommandDefaults(t *testing.T) {
+	c := &CollectCommand{}
+	if err := c.ParseFlags([]string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if *c.ip != "127.0.0.1" {
+		t.Errorf("expected ip '127.0.0.1', got %q", *c.ip)
+	}
+	if *c.port != 9995 {
+		t.Errorf("expected port 9995, got %d", *c.port)
+	}
+	if *c.interval != 10 {
+		t.Errorf("expected interval 10, got %d", *c.interval)
+	}
+	if *c.verbose != false {
+		t.Errorf("expected verbose false, got %v", *c.verbose)
+	}
+}
+
+func TestCollectCommandExecuteInvalid(t *testing.T) {
+	c := &CollectCommand{}
+	if err := c.ParseFlags([]string{"-interval", "0"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Execute(); err == nil {
+		t.Error("expected error for zero report interval")
+	}
+}
+
+// =============================================================================
+// InspectCommand
+// =============================================================================
+
+func TestInspectCommandDefaults(t *testing.T) {
+	c := &InspectCommand{}
+	if err := c.ParseFlags([]string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if *c.dbDir != "recorded_flows" {
+		t.Errorf("expected dbDir 'recorded_flows', got %q", *c.dbDir)
+	}
+	if *c.from != 0 || *c.to != 0 {
+		t.Errorf("expected key range 0-0, got %d-%d", *c.from, *c.to)
+	}
+	if *c.versions != "" {
+		t.Errorf("expected no version filter, got %q", *c.versions)
+	}
+	if *c.format != "text" {
+		t.Errorf("expected format 'text', got %q", *c.format)
+	}
+}
+
+func TestInspectCommandExecuteInvalid(t *testing.T) {
+	c := &InspectCommand{}
+	if err := c.ParseFlags([]string{"-format", "xml"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Execute(); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+// =============================================================================
+// ExportPCAPCommand
+// =============================================================================
+
+func TestExportPCAPCommandDefaults(t *testing.T) {
+	c := &ExportPCAPCommand{}
+	if err := c.ParseFlags([]string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if *c.dbDir != "recorded_flows" {
+		t.Errorf("expected dbDir 'recorded_flows', got %q", *c.dbDir)
+	}
+	if *c.out != "" {
+		t.Errorf("expected no output file, got %q", *c.out)
+	}
+	if *c.format != "" {
+		t.Errorf("expected no format, got %q", *c.format)
+	}
+}
+
+func TestExportPCAPCommandFormat(t *testing.T) {
+	tests := []struct {
+		out    string
+		format string
+		want   string
+	}{
+		{"flows.pcap", "", "pcap"},
+		{"flows.PCAPNG", "", "pcapng"},
+		{"-", "", "pcap"},
+		{"flows.pcap", "pcapng", "pcapng"},
+	}
+	for _, tt := range tests {
+		c := &ExportPCAPCommand{}
+		if err := c.ParseFlags([]string{"-out", tt.out, "-format", tt.format}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := c.captureFormat(); got != tt.want {
+			t.Errorf("expected format %q for %q/%q, got %q", tt.want, tt.out, tt.format, got)
+		}
+	}
+}
+
+func TestExportPCAPCommandExecuteInvalid(t *testing.T) {
+	c := &ExportPCAPCommand{}
+	if err := c.ParseFlags([]string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Execute(); err == nil {
+		t.Error("expected error for missing output file")
+	}
+}
+
 // =============================================================================
 // ReplayCommand
 // =============================================================================
@@ -347,6 +527,36 @@ func TestReplayCommandDefaults(t *testing.T) {
 	if *c.verbose != false {
 		t.Errorf("expected verbose false, got %v", *c.verbose)
 	}
+	if *c.timing != "fixed" {
+		t.Errorf("expected timing 'fixed', got %q", *c.timing)
+	}
+	if *c.speed != "1x" {
+		t.Errorf("expected speed '1x', got %q", *c.speed)
+	}
+	if *c.fast != false {
+		t.Errorf("expected as-fast-as-possible false, got %v", *c.fast)
+	}
+	if *c.renumber != false {
+		t.Errorf("expected renumber false, got %v", *c.renumber)
+	}
+	if *c.offset != 0 {
+		t.Errorf("expected domain-offset 0, got %d", *c.offset)
+	}
+	if *c.mapFile != "" {
+		t.Errorf("expected no domain-map, got %q", *c.mapFile)
+	}
+	if *c.rules != "" {
+		t.Errorf("expected no anonymize rules, got %q", *c.rules)
+	}
+	if *c.pcap != "" {
+		t.Errorf("expected no pcap file, got %q", *c.pcap)
+	}
+	if *c.filterPort != 0 {
+		t.Errorf("expected filter-port 0, got %d", *c.filterPort)
+	}
+	if *c.filterSource != "" {
+		t.Errorf("expected no filter-source, got %q", *c.filterSource)
+	}
 }
 
 func TestReplayCommandOverrides(t *testing.T) {
@@ -360,6 +570,15 @@ func TestReplayCommandOverrides(t *testing.T) {
 		"-workers", "4",
 		"-updatets",
 		"-verbose",
+		"-timing", "original",
+		"-speed", "2x",
+		"-renumber",
+		"-domain-offset", "100",
+		"-domain-map", "/tmp/domains.txt",
+		"-anonymize", "/tmp/anonymize.yaml",
+		"-pcap", "/tmp/flows.pcap",
+		"-filter-port", "2055",
+		"-filter-source", "192.0.2.0/24",
 	}
 	if err := c.ParseFlags(args); err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -389,6 +608,82 @@ func TestReplayCommandOverrides(t *testing.T) {
 	if !*c.verbose {
 		t.Error("expected verbose true")
 	}
+	if *c.timing != "original" {
+		t.Errorf("expected 'original', got %q", *c.timing)
+	}
+	if *c.speed != "2x" {
+		t.Errorf("expected '2x', got %q", *c.speed)
+	}
+	if !*c.renumber {
+		t.Error("expected renumber true")
+	}
+	if *c.offset != 100 {
+		t.Errorf("expected 100, got %d", *c.offset)
+	}
+	if *c.mapFile != "/tmp/domains.txt" {
+		t.Errorf("expected '/tmp/domains.txt', got %q", *c.mapFile)
+	}
+	if *c.rules != "/tmp/anonymize.yaml" {
+		t.Errorf("expected '/tmp/anonymize.yaml', got %q", *c.rules)
+	}
+	if *c.pcap != "/tmp/flows.pcap" {
+		t.Errorf("expected '/tmp/flows.pcap', got %q", *c.pcap)
+	}
+	if *c.filterPort != 2055 {
+		t.Errorf("expected 2055, got %d", *c.filterPort)
+	}
+	if *c.filterSource != "192.0.2.0/24" {
+		t.Errorf("expected '192.0.2.0/24', got %q", *c.filterSource)
+	}
+}
+
+func TestReplayCommandTiming(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{}, "fixed"},
+		{[]string{"-pcap", "flows.pcap"}, "original"},
+		{[]string{"-pcap", "flows.pcap", "-timing", "fixed"}, "fixed"},
+		{[]string{"-pcap", "flows.pcap", "-as-fast-as-possible"}, "fixed"},
+		{[]string{"-timing", "original"}, "original"},
+	}
+	for _, tt := range tests {
+		c := &ReplayCommand{}
+		if err := c.ParseFlags(tt.args); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := c.replayTiming(); got != tt.want {
+			t.Errorf("expected timing %q for %v, got %q", tt.want, tt.args, got)
+		}
+	}
+}
+
+func TestReplayCommandExecuteInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown timing", []string{"-timing", "realtime"}},
+		{"bad speed", []string{"-timing", "original", "-speed", "fast"}},
+		{"speed without original timing", []string{"-speed", "2x"}},
+		{"negative domain offset", []string{"-domain-offset", "-1"}},
+		{"missing domain map", []string{"-domain-map", "/nonexistent/domains.txt"}},
+		{"missing anonymize rules", []string{"-anonymize", "/nonexistent/anonymize.yaml"}},
+		{"negative filter port", []string{"-filter-port", "-1"}},
+		{"bad filter source", []string{"-filter-source", "exporter1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ReplayCommand{}
+			if err := c.ParseFlags(tt.args); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := c.Execute(); err == nil {
+				t.Errorf("expected error for %v", tt.args)
+			}
+		})
+	}
 }
 
 func TestReplayCommandIPv6(t *testing.T) {
@@ -434,6 +729,15 @@ func TestIPFIXCommandDefaults(t *testing.T) {
 	if *c.dstRange != "10.0.0.0/8" {
 		t.Errorf("expected dstRange '10.0.0.0/8', got %q", *c.dstRange)
 	}
+	if *c.transport != "udp" {
+		t.Errorf("expected transport 'udp', got %q", *c.transport)
+	}
+	if *c.tlsCert != "" || *c.tlsKey != "" || *c.tlsCA != "" || *c.serverName != "" {
+		t.Errorf("expected no transport TLS options, got %q %q %q %q", *c.tlsCert, *c.tlsKey, *c.tlsCA, *c.serverName)
+	}
+	if *c.output != "" || *c.outputOnly {
+		t.Errorf("expected no output, got %q only %v", *c.output, *c.outputOnly)
+	}
 }
 
 func TestIPFIXCommandOverrides(t *testing.T) {
@@ -446,11 +750,28 @@ func TestIPFIXCommandOverrides(t *testing.T) {
 		"-hexdump",
 		"-src-range", "172.16.0.0/12",
 		"-dst-range", "192.168.0.0/16",
+		"-output", "golden_flows",
+		"-transport", "tls",
+		"-transport-cert", "cert.pem",
+		"-transport-key", "key.pem",
+		"-transport-ca", "ca.pem",
+		"-transport-server-name", "collector.example",
 	}
 	if err := c.ParseFlags(args); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
+	if *c.transport != "tls" {
+		t.Errorf("expected transport 'tls', got %q", *c.transport)
+	}
+	if *c.tlsCert != "cert.pem" || *c.tlsKey != "key.pem" || *c.tlsCA != "ca.pem" || *c.serverName != "collector.example" {
+		t.Errorf("expected transport TLS options, got %q %q %q %q", *c.tlsCert, *c.tlsKey, *c.tlsCA, *c.serverName)
+	}
+
+	if *c.output != "golden_flows" || *c.outputOnly {
+		t.Errorf("expected output 'golden_flows', got %q only %v", *c.output, *c.outputOnly)
+	}
+
 	if *c.server != "192.168.1.1" {
 		t.Errorf("expected '192.168.1.1', got %q", *c.server)
 	}
@@ -474,6 +795,119 @@ func TestIPFIXCommandOverrides(t *testing.T) {
 	}
 }
 
+func TestIPFIXCommandExecuteOutputOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.pcapng")
+	c := &IPFIXCommand{}
+	if err := c.ParseFlags([]string{"-count", "3", "-output", path, "-output-only"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcap.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The template and three data packets
+	packets := 0
+	for ; ; packets++ {
+		if _, err := r.Next(); err != nil {
+			break
+		}
+	}
+	if packets != 4 {
+		t.Errorf("expected 4 packets, got %d", packets)
+	}
+}
+
+func TestIPFIXCommandExecuteTCP(t *testing.T) {
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	c := &IPFIXCommand{}
+	port := fmt.Sprint(ln.Addr().(*net.TCPAddr).Port)
+	if err := c.ParseFlags([]string{"-count", "3", "-port", port, "-transport", "tcp"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := <-received
+	// The template and three data messages, each framed by its header length
+	messages := 0
+	for len(data) >= 4 {
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if binary.BigEndian.Uint16(data[0:2]) != 10 || length < 16 || length > len(data) {
+			t.Fatalf("bad IPFIX message header %x", data[:4])
+		}
+		data = data[length:]
+		messages++
+	}
+	if messages != 4 || len(data) != 0 {
+		t.Errorf("expected 4 messages, got %d and %d trailing bytes", messages, len(data))
+	}
+}
+
+func TestIPFIXCommandExecuteTransportInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"dtls", []string{"-transport", "dtls"}},
+		{"tls options without tls", []string{"-transport", "tcp", "-transport-ca", "ca.pem"}},
+		{"missing CA file", []string{"-transport", "tls", "-transport-ca", filepath.Join(t.TempDir(), "missing.pem")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &IPFIXCommand{}
+			if err := c.ParseFlags(tt.args); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := c.Execute(); err == nil {
+				t.Errorf("expected error for %v, got nil", tt.args)
+			}
+		})
+	}
+}
+
+func TestBarrageCommandTCPRequiresIPFIX(t *testing.T) {
+	c := &BarrageCommand{}
+	if err := c.ParseFlags([]string{"-transport", "tcp"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Execute(); err == nil {
+		t.Error("expected error for -transport tcp with netflow, got nil")
+	}
+}
+
+func TestSingleCommandExecuteInvalid(t *testing.T) {
+	c := &SingleCommand{}
+	if err := c.ParseFlags([]string{"-output-only"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Execute(); err == nil {
+		t.Error("expected error for -output-only without -output, got nil")
+	}
+}
+
 func TestIPFIXCommandIPv6(t *testing.T) {
 	c := &IPFIXCommand{}
 	args := []string{
@@ -518,6 +952,9 @@ func TestProxyCommandDefaults(t *testing.T) {
 	if *c.verbose != false {
 		t.Errorf("expected verbose false, got %v", *c.verbose)
 	}
+	if *c.rules != "" {
+		t.Errorf("expected no anonymize rules, got %q", *c.rules)
+	}
 }
 
 func TestProxyCommandOverrides(t *testing.T) {
@@ -529,6 +966,7 @@ func TestProxyCommandOverrides(t *testing.T) {
 		"-target", "10.0.0.2:9996",
 		"-target", "10.0.0.3:9997",
 		"-verbose",
+		"-anonymize", "/tmp/anonymize.yaml",
 	}
 	if err := c.ParseFlags(args); err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -555,6 +993,20 @@ func TestProxyCommandOverrides(t *testing.T) {
 	if !*c.verbose {
 		t.Error("expected verbose true")
 	}
+	if *c.rules != "/tmp/anonymize.yaml" {
+		t.Errorf("expected '/tmp/anonymize.yaml', got %q", *c.rules)
+	}
+}
+
+func TestProxyCommandExecuteInvalid(t *testing.T) {
+	c := &ProxyCommand{}
+	args := []string{"-target", "127.0.0.1:9995", "-anonymize", "/nonexistent/anonymize.yaml"}
+	if err := c.ParseFlags(args); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Execute(); err == nil {
+		t.Errorf("expected error for %v", args)
+	}
 }
 
 func TestProxyCommandIPv6(t *testing.T) {
@@ -763,7 +1215,9 @@ func TestValidateProtocol(t *testing.T) {
 	}{
 		{"netflow", "netflow", false},
 		{"ipfix", "ipfix", false},
-		{"invalid", "sflow", true},
+		{"netflow5", "netflow5", false},
+		{"sflow", "sflow", false},
+		{"invalid", "netflow7", true},
 		{"empty", "", true},
 	}
 
@@ -780,6 +1234,55 @@ func TestValidateProtocol(t *testing.T) {
 	}
 }
 
+func TestValidateSingleProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		proto   string
+		wantErr bool
+	}{
+		{"netflow", "netflow", false},
+		{"netflow5", "netflow5", false},
+		{"ipfix", "ipfix", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSingleProtocol(tt.proto)
+			if tt.wantErr && err == nil {
+				t.Error("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateIPv4Ranges(t *testing.T) {
+	tests := []struct {
+		name    string
+		ranges  []string
+		wantErr bool
+	}{
+		{"ipv4", []string{"10.0.0.0/8", "192.168.0.0/16"}, false},
+		{"ipv6 src", []string{"2001:db8::/32", "10.0.0.0/8"}, true},
+		{"invalid", []string{"bogus"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateIPv4Ranges(tt.ranges...)
+			if tt.wantErr && err == nil {
+				t.Error("expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
 func TestValidateWebBinding(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -888,6 +1391,29 @@ func TestResolveProfile(t *testing.T) {
 	}
 }
 
+func TestResolveIPFIXProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  string
+		expected string
+	}{
+		{"generic", "generic", "generic"},
+		{"minimal", "minimal", "minimal"},
+		{"extended", "extended", "extended"},
+		{"biflow", "biflow", "biflow"},
+		{"unknown", "unknown", "generic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := resolveIPFIXProfile(tt.profile)
+			if name := profile.Name(); name != tt.expected {
+				t.Errorf("expected name %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
 func TestGenerateRandomPassword(t *testing.T) {
 	password, err := web.GenerateRandomPassword(16)
 	if err != nil {
@@ -977,3 +1503,101 @@ func TestBarrageCommandNegativeTemplateInterval(t *testing.T) {
 		t.Error("expected error for negative template-interval")
 	}
 }
+
+func TestNewGenerator(t *testing.T) {
+	custom := map[string]models.ProfileConfig{
+		"vendor": {Name: "vendor", TemplateID: 300, Fields: []models.ProfileField{
+			{Type: "IPV4_SRC_ADDR", Length: 4},
+			{Type: "IN_BYTES", Length: 4, Value: "random", Min: 1, Max: 100},
+		}},
+		"broken": {Name: "broken", Fields: []models.ProfileField{
+			{Type: "IPV4_SRC_ADDR", Length: 16},
+		}},
+	}
+	tests := []struct {
+		name     string
+		protocol string
+		profile  string
+		label    string
+		wantErr  bool
+	}{
+		{"netflow builtin", "netflow", "minimal", "Worker", false},
+		{"ipfix builtin", "ipfix", "extended", "IPFIX Worker", false},
+		{"ipfix biflow", "ipfix", "biflow", "IPFIX Worker", false},
+		{"netflow biflow", "netflow", "biflow", "", true},
+		{"netflow custom", "netflow", "vendor", "Worker", false},
+		{"ipfix custom case-insensitive", "ipfix", "Vendor", "IPFIX Worker", false},
+		{"custom invalid lengths", "netflow", "broken", "", true},
+		{"unknown profile", "netflow", "missing", "", true},
+		{"sflow ignores profile", "sflow", "missing", "sFlow Worker", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := newGenerator(tt.protocol, tt.profile, custom)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newGenerator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && gen.Label() != tt.label {
+				t.Errorf("expected label %q, got %q", tt.label, gen.Label())
+			}
+		})
+	}
+}
+
+func TestBarrageCommandExecuteTargets(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"two targets stop at their limits", fmt.Sprintf(`
+targets:
+  primary:
+    port: %[1]d
+    workers: 2
+    packets-per-second: 1000
+    max-packets: 20
+  standby:
+    port: %[1]d
+    workers: 1
+    protocol: ipfix
+    profile: minimal
+    max-flows: 100
+    delay: 1
+`, port), ""},
+		{"invalid target is named", fmt.Sprintf(`
+targets:
+  primary:
+    port: %d
+  standby:
+    protocol: netflow5
+    src-range: 2001:db8::/32
+`, port), "target standby"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c := &BarrageCommand{}
+			if err := c.ParseFlags([]string{"-config", path}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err := c.Execute()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
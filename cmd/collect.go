@@ -0,0 +1,60 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dmabry/flowgre/collect"
+	"github.com/dmabry/flowgre/config"
+	"github.com/dmabry/flowgre/lifecycle"
+)
+
+// CollectCommand holds flags and state for the collect subcommand.
+type CollectCommand struct {
+	ip       *string
+	port     *int
+	interval *int
+	verbose  *bool
+}
+
+// ParseFlags parses command-line flags for the collect mode.
+func (c *CollectCommand) ParseFlags(args []string) error {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	c.ip = fs.String("ip", "127.0.0.1", "IP address to listen on (IPv4 or IPv6)")
+	c.port = fs.Int("port", 9995, "listen udp port")
+	c.interval = fs.Int("interval", 10, "Seconds between per-exporter reports")
+	c.verbose = fs.Bool("verbose", false, "Whether to log every packet decoded. Warning can be a lot")
+	return fs.Parse(args)
+}
+
+// Execute runs the collect mode with parsed flags.
+func (c *CollectCommand) Execute() error {
+	if err := config.ValidateCollect(*c.ip, *c.port, *c.interval); err != nil {
+		return fmt.Errorf("validate collect config: %w", err)
+	}
+	mgr := lifecycle.New()
+	_ = mgr.SetupSignalHandler()
+	defer mgr.Cancel()
+	interval := time.Duration(*c.interval) * time.Second
+	if _, err := collect.RunCtx(mgr.Context(), *c.ip, *c.port, interval, *c.verbose); err != nil {
+		return fmt.Errorf("collect: %w", err)
+	}
+	return nil
+}
+
+// RunCollect is the entry point for the collect subcommand.
+func RunCollect(args []string) {
+	c := &CollectCommand{}
+	if err := c.ParseFlags(args); err != nil {
+		os.Exit(1)
+	}
+	if err := c.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "collect: %v\n", err)
+		os.Exit(1)
+	}
+}
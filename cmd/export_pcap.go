@@ -0,0 +1,93 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dmabry/flowgre/config"
+	"github.com/dmabry/flowgre/lifecycle"
+	"github.com/dmabry/flowgre/pcap"
+	"github.com/dmabry/flowgre/record"
+)
+
+// ExportPCAPCommand holds flags and state for the export-pcap subcommand.
+type ExportPCAPCommand struct {
+	dbDir  *string
+	out    *string
+	format *string
+}
+
+// ParseFlags parses command-line flags for the export-pcap mode.
+func (c *ExportPCAPCommand) ParseFlags(args []string) error {
+	fs := flag.NewFlagSet("export-pcap", flag.ExitOnError)
+	c.dbDir = fs.String("db", "recorded_flows", "Directory to read recorded flows from")
+	c.out = fs.String("out", "", "Capture file to write, or - for stdout (required)")
+	c.format = fs.String("format", "", "Capture format: pcap or pcapng (default from the -out extension, pcap otherwise)")
+	return fs.Parse(args)
+}
+
+// captureFormat returns the format to write: the one given, or pcapng for
+// a .pcapng output file and pcap otherwise.
+func (c *ExportPCAPCommand) captureFormat() string {
+	if *c.format != "" {
+		return *c.format
+	}
+	if strings.EqualFold(filepath.Ext(*c.out), ".pcapng") {
+		return pcap.FormatPCAPNG
+	}
+	return pcap.FormatPCAP
+}
+
+// Execute runs the export-pcap mode with parsed flags.
+func (c *ExportPCAPCommand) Execute() (retErr error) {
+	if err := config.ValidateExportPCAP(*c.dbDir, *c.out, *c.format); err != nil {
+		return fmt.Errorf("validate export-pcap config: %w", err)
+	}
+	var w io.Writer = os.Stdout
+	if *c.out != "-" {
+		f, err := os.Create(*c.out)
+		if err != nil {
+			return fmt.Errorf("create capture: %w", err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil && retErr == nil {
+				retErr = fmt.Errorf("close capture: %w", err)
+			}
+		}()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	mgr := lifecycle.New()
+	_ = mgr.SetupSignalHandler()
+	defer mgr.Cancel()
+	count, err := record.ExportPCAP(mgr.Context(), *c.dbDir, bw, c.captureFormat())
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("write capture: %w", err)
+	}
+	log.Printf("Exported %d packets from %s to %s", count, *c.dbDir, *c.out)
+	return nil
+}
+
+// RunExportPCAP is the entry point for the export-pcap subcommand.
+func RunExportPCAP(args []string) {
+	c := &ExportPCAPCommand{}
+	if err := c.ParseFlags(args); err != nil {
+		os.Exit(1)
+	}
+	if err := c.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "export-pcap: %v\n", err)
+		os.Exit(1)
+	}
+}
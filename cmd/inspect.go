@@ -0,0 +1,68 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dmabry/flowgre/config"
+	"github.com/dmabry/flowgre/inspect"
+	"github.com/dmabry/flowgre/lifecycle"
+)
+
+// InspectCommand holds flags and state for the inspect subcommand.
+type InspectCommand struct {
+	dbDir    *string
+	from     *int
+	to       *int
+	versions *string
+	format   *string
+}
+
+// ParseFlags parses command-line flags for the inspect mode.
+func (c *InspectCommand) ParseFlags(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	c.dbDir = fs.String("db", "recorded_flows", "Directory to read recorded flows from")
+	c.from = fs.Int("from", 0, "First record key to inspect (0 for the first record)")
+	c.to = fs.Int("to", 0, "Last record key to inspect, inclusive (0 for the last record)")
+	c.versions = fs.String("version", "", "Comma-separated flow versions to inspect: 5, 9, 10 or sflow (default all)")
+	c.format = fs.String("format", inspect.FormatText, "Output format: text, ndjson or csv")
+	return fs.Parse(args)
+}
+
+// Execute runs the inspect mode with parsed flags.
+func (c *InspectCommand) Execute() error {
+	if err := config.ValidateInspect(*c.dbDir, *c.from, *c.to, *c.versions, *c.format); err != nil {
+		return fmt.Errorf("validate inspect config: %w", err)
+	}
+	protocols, err := inspect.ParseVersions(*c.versions)
+	if err != nil {
+		return fmt.Errorf("parse versions: %w", err)
+	}
+	opts := inspect.Options{
+		DBDir:     *c.dbDir,
+		From:      uint32(*c.from),
+		To:        uint32(*c.to),
+		Protocols: protocols,
+		Format:    *c.format,
+	}
+	mgr := lifecycle.New()
+	_ = mgr.SetupSignalHandler()
+	defer mgr.Cancel()
+	return inspect.RunCtx(mgr.Context(), opts, os.Stdout)
+}
+
+// RunInspect is the entry point for the inspect subcommand.
+func RunInspect(args []string) {
+	c := &InspectCommand{}
+	if err := c.ParseFlags(args); err != nil {
+		os.Exit(1)
+	}
+	if err := c.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "inspect: %v\n", err)
+		os.Exit(1)
+	}
+}
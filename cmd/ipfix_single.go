@@ -5,12 +5,14 @@
 package cmd
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"net"
 	"os"
 
+	"github.com/dmabry/flowgre/config"
 	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/transport"
 	"github.com/dmabry/flowgre/utils"
 )
 
@@ -23,13 +25,20 @@ const (
 
 // IPFIXCommand holds flags and state for the ipfix subcommand.
 type IPFIXCommand struct {
-	server   *string
-	port     *int
-	srcPort  *int
-	count    *int
-	hexDump  *bool
-	srcRange *string
-	dstRange *string
+	server     *string
+	port       *int
+	srcPort    *int
+	count      *int
+	hexDump    *bool
+	transport  *string
+	tlsCert    *string
+	tlsKey     *string
+	tlsCA      *string
+	serverName *string
+	srcRange   *string
+	dstRange   *string
+	output     *string
+	outputOnly *bool
 }
 
 // ParseFlags parses command-line flags for the ipfix mode.
@@ -40,15 +49,33 @@ func (c *IPFIXCommand) ParseFlags(args []string) error {
 	c.srcPort = fs.Int("src-port", 0, "source port used by the client. If 0 a Random port between 10000-15000")
 	c.count = fs.Int("count", 1, "count of flows to send in sequence.")
 	c.hexDump = fs.Bool("hexdump", false, "If true, do a hexdump of the packet")
+	c.transport = fs.String("transport", "udp", "transport to send over: udp, tcp or tls")
+	c.tlsCert = fs.String("transport-cert", "", "client certificate file for -transport tls")
+	c.tlsKey = fs.String("transport-key", "", "client key file for -transport tls")
+	c.tlsCA = fs.String("transport-ca", "", "CA file the collector certificate must chain to for -transport tls (default: system roots)")
+	c.serverName = fs.String("transport-server-name", "", "server name to send as SNI and verify for -transport tls (default: -server)")
 	c.srcRange = fs.String("src-range", "10.0.0.0/8", "CIDR range for source IPs (IPv4 or IPv6)")
 	c.dstRange = fs.String("dst-range", "10.0.0.0/8", "CIDR range for destination IPs (IPv4 or IPv6)")
+	c.output = fs.String("output", "", "Also write packets to a .pcap or .pcapng capture file, or a record database directory")
+	c.outputOnly = fs.Bool("output-only", false, "Only write packets to -output, without sending them")
 	return fs.Parse(args)
 }
 
 // Execute runs the ipfix mode with parsed flags.
-func (c *IPFIXCommand) Execute() error {
+func (c *IPFIXCommand) Execute() (retErr error) {
+	if err := config.ValidateTransport(*c.transport, "ipfix"); err != nil {
+		return err
+	}
+	tlsConfig, err := transportTLS(*c.transport, transport.TLSOptions{
+		CertFile:   *c.tlsCert,
+		KeyFile:    *c.tlsKey,
+		CAFile:     *c.tlsCA,
+		ServerName: *c.serverName,
+	})
+	if err != nil {
+		return err
+	}
 	if *c.srcPort == 0 {
-		var err error
 		*c.srcPort, err = utils.RandomNum(ipfixSourcePortMin, ipfixSourcePortMax)
 		if err != nil {
 			return fmt.Errorf("generate source port: %w", err)
@@ -59,16 +86,20 @@ func (c *IPFIXCommand) Execute() error {
 		return fmt.Errorf("generate source ID: %w", err)
 	}
 
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: *c.srcPort})
+	out, closeOutput, err := openOutput(*c.output, *c.outputOnly)
 	if err != nil {
-		return fmt.Errorf("listen: %w", err)
+		return err
 	}
-	defer conn.Close()
-
-	destIP := net.ParseIP(*c.server)
-	if destIP == nil {
-		return fmt.Errorf("failed to parse destination IP %s", *c.server)
+	defer func() {
+		if err := closeOutput(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("close output: %w", err))
+		}
+	}()
+	t, err := transport.Network{Network: *c.transport, TLS: tlsConfig, Output: out, Verbose: *c.hexDump}.Dial(*c.server, *c.port, *c.srcPort)
+	if err != nil {
+		return err
 	}
+	defer t.Close()
 
 	seq := ipfix.NewIPFIXSequence()
 
@@ -78,7 +109,7 @@ func (c *IPFIXCommand) Execute() error {
 	if err != nil {
 		return fmt.Errorf("IPFIX template ToBytes: %w", err)
 	}
-	_, err = utils.SendPacket(conn, &net.UDPAddr{IP: destIP, Port: *c.port}, tBuf.Bytes(), *c.hexDump)
+	_, err = t.Send(tBuf.Bytes())
 	if err != nil {
 		return fmt.Errorf("issue sending IPFIX template: %w", err)
 	}
@@ -93,7 +124,7 @@ func (c *IPFIXCommand) Execute() error {
 		if err != nil {
 			return fmt.Errorf("IPFIX data ToBytes: %w", err)
 		}
-		_, err = utils.SendPacket(conn, &net.UDPAddr{IP: destIP, Port: *c.port}, buf.Bytes(), *c.hexDump)
+		_, err = t.Send(buf.Bytes())
 		if err != nil {
 			return fmt.Errorf("issue sending IPFIX data: %w", err)
 		}
@@ -0,0 +1,50 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+
+	"github.com/dmabry/flowgre/config"
+	"github.com/dmabry/flowgre/transport"
+)
+
+// openOutput opens the sink named by -output, if any, and returns where the
+// sending modes put their packets along with a func closing the sink.
+func openOutput(path string, only bool) (transport.Output, func() error, error) {
+	if err := config.ValidateOutput(path, only); err != nil {
+		return transport.Output{}, nil, err
+	}
+	if path == "" {
+		return transport.Output{}, func() error { return nil }, nil
+	}
+	sink, err := transport.OpenSink(path)
+	if err != nil {
+		return transport.Output{}, nil, fmt.Errorf("open output: %w", err)
+	}
+	if only {
+		log.Printf("Writing packets to %s instead of sending them", path)
+	} else {
+		log.Printf("Writing packets to %s as they are sent", path)
+	}
+	return transport.Output{Sink: sink, SinkOnly: only}, sink.Close, nil
+}
+
+// transportTLS validates the -transport-* TLS options and returns the config
+// the tls transport dials with, or nil for the other transports.
+func transportTLS(network string, opts transport.TLSOptions) (*tls.Config, error) {
+	if err := config.ValidateTransportTLS(network, opts); err != nil {
+		return nil, err
+	}
+	if network != transport.NetworkTLS {
+		return nil, nil
+	}
+	cfg, err := opts.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("transport TLS: %w", err)
+	}
+	return cfg, nil
+}
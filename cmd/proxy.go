@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/dmabry/flowgre/anonymize"
 	"github.com/dmabry/flowgre/config"
 	"github.com/dmabry/flowgre/lifecycle"
 	"github.com/dmabry/flowgre/proxy"
@@ -32,6 +33,7 @@ type ProxyCommand struct {
 	port    *int
 	targets targetFlags
 	verbose *bool
+	rules   *string
 }
 
 // ParseFlags parses command-line flags for the proxy mode.
@@ -41,6 +43,7 @@ func (c *ProxyCommand) ParseFlags(args []string) error {
 	c.port = fs.Int("port", 9995, "proxy listen udp port")
 	fs.Var(&c.targets, "target", "Can be passed multiple times in IP:PORT format")
 	c.verbose = fs.Bool("verbose", false, "Whether to log every flow received. Warning can be a lot")
+	c.rules = fs.String("anonymize", "", "YAML file of address anonymization, remapping and port/AS scrubbing rules")
 	return fs.Parse(args)
 }
 
@@ -50,10 +53,17 @@ func (c *ProxyCommand) Execute() error {
 	if err := config.ValidateProxy(*c.ip, *c.port, targets); err != nil {
 		return fmt.Errorf("validate proxy config: %w", err)
 	}
+	var anon *anonymize.Anonymizer
+	if *c.rules != "" {
+		var err error
+		if anon, err = config.LoadAnonymizeRules(*c.rules); err != nil {
+			return fmt.Errorf("validate proxy config: %w", err)
+		}
+	}
 	mgr := lifecycle.New()
 	defer mgr.Cancel()
 	_ = mgr.SetupSignalHandler()
-	if err := proxy.RunCtx(mgr.Context(), *c.ip, *c.port, *c.verbose, targets); err != nil {
+	if err := proxy.RunCtx(mgr.Context(), *c.ip, *c.port, *c.verbose, targets, anon, nil); err != nil {
 		return fmt.Errorf("proxy: %w", err)
 	}
 	return nil
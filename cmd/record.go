@@ -5,6 +5,7 @@
 package cmd
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"os"
@@ -12,22 +13,31 @@ import (
 	"github.com/dmabry/flowgre/config"
 	"github.com/dmabry/flowgre/lifecycle"
 	"github.com/dmabry/flowgre/record"
+	"github.com/dmabry/flowgre/transport"
 )
 
 // RecordCommand holds flags and state for the record subcommand.
 type RecordCommand struct {
-	ip      *string
-	port    *int
-	dbDir   *string
-	verbose *bool
+	ip       *string
+	port     *int
+	dbDir    *string
+	pcap     *string
+	tlsCert  *string
+	tlsKey   *string
+	clientCA *string
+	verbose  *bool
 }
 
 // ParseFlags parses command-line flags for the record mode.
 func (c *RecordCommand) ParseFlags(args []string) error {
 	fs := flag.NewFlagSet("record", flag.ExitOnError)
 	c.ip = fs.String("ip", "127.0.0.1", "IP address to listen on (IPv4 or IPv6)")
-	c.port = fs.Int("port", 9995, "listen udp port")
+	c.port = fs.Int("port", 9995, "listen port, UDP for every protocol and TCP for IPFIX")
 	c.dbDir = fs.String("db", "recorded_flows", "Directory to place recorded flows for later replay")
+	c.pcap = fs.String("pcap", "", "Record the flows in a pcap or pcapng capture file instead of listening")
+	c.tlsCert = fs.String("tls-cert", "", "Certificate file to accept IPFIX over TLS instead of TCP on the listen port")
+	c.tlsKey = fs.String("tls-key", "", "Key file for -tls-cert")
+	c.clientCA = fs.String("tls-client-ca", "", "Require IPFIX over TLS clients to present a certificate issued by a CA in this file")
 	c.verbose = fs.Bool("verbose", false, "Whether to log every packet received. Warning can be a lot")
 	return fs.Parse(args)
 }
@@ -37,10 +47,27 @@ func (c *RecordCommand) Execute() error {
 	if err := config.ValidateRecord(*c.ip, *c.port, *c.dbDir); err != nil {
 		return fmt.Errorf("validate record config: %w", err)
 	}
+	tlsOpts := transport.TLSOptions{CertFile: *c.tlsCert, KeyFile: *c.tlsKey, CAFile: *c.clientCA}
+	if err := config.ValidateRecordTLS(tlsOpts); err != nil {
+		return fmt.Errorf("validate record config: %w", err)
+	}
+	var tlsConfig *tls.Config
+	if tlsOpts.CertFile != "" {
+		var err error
+		if tlsConfig, err = tlsOpts.ServerConfig(); err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+	}
 	mgr := lifecycle.New()
 	_ = mgr.SetupSignalHandler()
 	defer mgr.Cancel()
-	if err := record.RunCtx(mgr.Context(), *c.ip, *c.port, *c.dbDir, *c.verbose); err != nil {
+	if *c.pcap != "" {
+		if err := record.RunPCAPCtx(mgr.Context(), *c.pcap, *c.dbDir, *c.verbose); err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+		return nil
+	}
+	if err := record.RunTLSCtx(mgr.Context(), *c.ip, *c.port, *c.dbDir, tlsConfig, *c.verbose); err != nil {
 		return fmt.Errorf("record: %w", err)
 	}
 	return nil
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/dmabry/flowgre/anonymize"
 	"github.com/dmabry/flowgre/config"
 	"github.com/dmabry/flowgre/lifecycle"
 	"github.com/dmabry/flowgre/replay"
@@ -16,14 +17,28 @@ import (
 
 // ReplayCommand holds flags and state for the replay subcommand.
 type ReplayCommand struct {
-	server   *string
-	port     *int
-	delay    *int
-	dbDir    *string
-	loop     *bool
-	workers  *int
-	updateTS *bool
-	verbose  *bool
+	server       *string
+	port         *int
+	delay        *int
+	dbDir        *string
+	loop         *bool
+	workers      *int
+	updateTS     *bool
+	verbose      *bool
+	timing       *string
+	speed        *string
+	fast         *bool
+	renumber     *bool
+	offset       *int
+	mapFile      *string
+	rules        *string
+	pcap         *string
+	filterPort   *int
+	filterSource *string
+
+	// timingSet records whether -timing was given, as -pcap defaults to
+	// original timing
+	timingSet bool
 }
 
 // ParseFlags parses command-line flags for the replay mode.
@@ -37,7 +52,34 @@ func (c *ReplayCommand) ParseFlags(args []string) error {
 	c.workers = fs.Int("workers", 1, "Number of workers to spawn for replay")
 	c.updateTS = fs.Bool("updatets", false, "Whether to update to the current timestamp on replayed flows")
 	c.verbose = fs.Bool("verbose", false, "Whether to log every packet received. Warning can be a lot")
-	return fs.Parse(args)
+	c.timing = fs.String("timing", replay.TimingFixed, "Packet timing: fixed (use -delay) or original (reproduce recorded inter-arrival gaps); -pcap defaults to original")
+	c.speed = fs.String("speed", "1x", "Speed multiplier for -timing original, e.g. 0.5x, 2x or 10x")
+	c.fast = fs.Bool("as-fast-as-possible", false, "Send packets as fast as possible, ignoring -delay and -timing")
+	c.renumber = fs.Bool("renumber", false, "Renumber sequence numbers continuously per exporter, across -loop passes")
+	c.offset = fs.Int("domain-offset", 0, "Number added to every source ID (NetFlow v9) and observation domain ID (IPFIX)")
+	c.mapFile = fs.String("domain-map", "", "File of \"<from> <to>\" source ID/observation domain ID mappings; unlisted IDs get -domain-offset")
+	c.rules = fs.String("anonymize", "", "YAML file of address anonymization, remapping and port/AS scrubbing rules")
+	c.pcap = fs.String("pcap", "", "Replay the flows in a pcap or pcapng capture file instead of -db")
+	c.filterPort = fs.Int("filter-port", 0, "Only replay packets sent to this UDP port (0 for all)")
+	c.filterSource = fs.String("filter-source", "", "Only replay packets from this exporter IP address or CIDR prefix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "timing" {
+			c.timingSet = true
+		}
+	})
+	return nil
+}
+
+// replayTiming returns the -timing given, or when it wasn't, original timing
+// for a capture file replayed without -as-fast-as-possible.
+func (c *ReplayCommand) replayTiming() string {
+	if *c.pcap != "" && !c.timingSet && !*c.fast {
+		return replay.TimingOriginal
+	}
+	return *c.timing
 }
 
 // Execute runs the replay mode with parsed flags.
@@ -45,10 +87,61 @@ func (c *ReplayCommand) Execute() error {
 	if err := config.ValidateReplay(*c.server, *c.port, *c.delay, *c.dbDir, *c.workers); err != nil {
 		return fmt.Errorf("validate replay config: %w", err)
 	}
+	speed, err := replay.ParseSpeed(*c.speed)
+	if err != nil {
+		return fmt.Errorf("validate replay config: %w", err)
+	}
+	timing := c.replayTiming()
+	if err := config.ValidateReplayTiming(timing, speed, *c.fast); err != nil {
+		return fmt.Errorf("validate replay config: %w", err)
+	}
+	if err := config.ValidateReplayFilter(*c.filterPort, *c.filterSource); err != nil {
+		return fmt.Errorf("validate replay config: %w", err)
+	}
+	source, err := replay.ParseSourceFilter(*c.filterSource)
+	if err != nil {
+		return fmt.Errorf("validate replay config: %w", err)
+	}
+	if err := config.ValidateReplayDomainOffset(*c.offset); err != nil {
+		return fmt.Errorf("validate replay config: %w", err)
+	}
+	domains := replay.DomainMap{Offset: uint32(*c.offset)}
+	if *c.mapFile != "" {
+		if domains.IDs, err = replay.LoadDomainMap(*c.mapFile); err != nil {
+			return fmt.Errorf("validate replay config: %w", err)
+		}
+	}
+	var anon *anonymize.Anonymizer
+	if *c.rules != "" {
+		if anon, err = config.LoadAnonymizeRules(*c.rules); err != nil {
+			return fmt.Errorf("validate replay config: %w", err)
+		}
+	}
+	if *c.fast {
+		timing = replay.TimingFast
+	}
+	opts := replay.Options{
+		Server:       *c.server,
+		Port:         *c.port,
+		Delay:        *c.delay,
+		DBDir:        *c.dbDir,
+		Loop:         *c.loop,
+		Workers:      *c.workers,
+		UpdateTS:     *c.updateTS,
+		Verbose:      *c.verbose,
+		Timing:       timing,
+		Speed:        speed,
+		Renumber:     *c.renumber,
+		Domains:      domains,
+		Anonymizer:   anon,
+		PCAP:         *c.pcap,
+		FilterPort:   *c.filterPort,
+		FilterSource: source,
+	}
 	mgr := lifecycle.New()
 	defer mgr.Cancel()
 	_ = mgr.SetupSignalHandler()
-	if err := replay.RunCtx(mgr.Context(), *c.server, *c.port, *c.delay, *c.dbDir, *c.loop, *c.workers, *c.updateTS, *c.verbose); err != nil {
+	if err := replay.RunCtx(mgr.Context(), opts); err != nil {
 		return fmt.Errorf("replay: %w", err)
 	}
 	return nil
@@ -5,21 +5,28 @@
 package cmd
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 
+	"github.com/dmabry/flowgre/lifecycle"
 	"github.com/dmabry/flowgre/single"
+	"github.com/dmabry/flowgre/transport"
 )
 
 // SingleCommand holds flags and state for the single subcommand.
 type SingleCommand struct {
-	server   *string
-	port     *int
-	srcPort  *int
-	count    *int
-	hexDump  *bool
-	srcRange *string
-	dstRange *string
+	server     *string
+	port       *int
+	srcPort    *int
+	count      *int
+	hexDump    *bool
+	srcRange   *string
+	dstRange   *string
+	protocol   *string
+	output     *string
+	outputOnly *bool
 }
 
 // ParseFlags parses command-line flags for the single mode.
@@ -32,12 +39,40 @@ func (c *SingleCommand) ParseFlags(args []string) error {
 	c.hexDump = fs.Bool("hexdump", false, "If true, do a hexdump of the packet")
 	c.srcRange = fs.String("src-range", "10.0.0.0/8", "CIDR range for source IPs (IPv4 or IPv6)")
 	c.dstRange = fs.String("dst-range", "10.0.0.0/8", "CIDR range for destination IPs (IPv4 or IPv6)")
+	c.protocol = fs.String("protocol", "netflow", "protocol to use: netflow (v9) or netflow5")
+	c.output = fs.String("output", "", "Also write packets to a .pcap or .pcapng capture file, or a record database directory")
+	c.outputOnly = fs.Bool("output-only", false, "Only write packets to -output, without sending them")
 	return fs.Parse(args)
 }
 
 // Execute runs the single mode with parsed flags.
-func (c *SingleCommand) Execute() {
-	single.Run(*c.server, *c.port, *c.srcPort, *c.count, *c.srcRange, *c.dstRange, *c.hexDump)
+func (c *SingleCommand) Execute() (retErr error) {
+	out, closeOutput, err := openOutput(*c.output, *c.outputOnly)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := closeOutput(); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("close output: %w", err))
+		}
+	}()
+	mgr := lifecycle.New()
+	_ = mgr.SetupSignalHandler()
+	defer mgr.Cancel()
+	if *c.protocol == "netflow5" {
+		return single.RunV5Ctx(mgr.Context(), *c.server, *c.port, *c.srcPort, *c.count, *c.srcRange, *c.dstRange, *c.hexDump, transport.Network{Output: out, Verbose: true})
+	}
+	return single.RunCtx(mgr.Context(), *c.server, *c.port, *c.srcPort, *c.count, *c.srcRange, *c.dstRange, *c.hexDump, transport.Network{Output: out, Verbose: true})
+}
+
+// validateSingleProtocol returns an error if the protocol is not supported by single.
+func validateSingleProtocol(protocol string) error {
+	switch protocol {
+	case "netflow", "netflow5":
+		return nil
+	default:
+		return fmt.Errorf("unsupported protocol %q: must be netflow or netflow5", protocol)
+	}
 }
 
 // RunSingle is the entry point for the single subcommand.
@@ -46,5 +81,12 @@ func RunSingle(args []string) {
 	if err := c.ParseFlags(args); err != nil {
 		os.Exit(1)
 	}
-	c.Execute()
+	if err := validateSingleProtocol(*c.protocol); err != nil {
+		fmt.Fprintf(os.Stderr, "single error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := c.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "single error: %v\n", err)
+		os.Exit(1)
+	}
 }
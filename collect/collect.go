@@ -0,0 +1,111 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package collect is a test collector. It decodes NetFlow v9 and IPFIX off
+// the wire and reports what each exporter sent: flow counts, sequence gaps,
+// duplicate and out-of-order packets, and data sets sent before their template.
+package collect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/lifecycle"
+)
+
+const udpMaxBufferSize = 65507
+
+// versionName returns the protocol name for a decoded message version.
+func versionName(version uint16) string {
+	if version == decode.VersionNetFlow {
+		return "NetFlow v9"
+	}
+	return "IPFIX"
+}
+
+// runCollect listens for packets and feeds them to t, logging a report every interval.
+func runCollect(ctx context.Context, t *Tracker, ip string, port int, interval time.Duration, verbose bool) error {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(ip), Port: port})
+	if err != nil {
+		return fmt.Errorf("listen on %s:%d: %w", ip, port, err)
+	}
+	log.Printf("Collecting on %s", conn.LocalAddr())
+	defer conn.Close()
+	stopCancelWakeup := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stopCancelWakeup()
+
+	payload := make([]byte, udpMaxBufferSize)
+	nextReport := time.Now().Add(interval)
+	for {
+		if ctx.Err() != nil {
+			log.Println("Collector exiting due to signal")
+			return nil
+		}
+		if now := time.Now(); !now.Before(nextReport) {
+			t.logReport()
+			nextReport = now.Add(interval)
+		}
+		if err := conn.SetReadDeadline(nextReport); err != nil {
+			return fmt.Errorf("set read deadline: %w", err)
+		}
+		length, from, err := conn.ReadFromUDP(payload)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("read UDP packet: %w", err)
+		}
+		msg, err := t.Observe(from.String(), payload[:length], time.Now())
+		if err != nil {
+			if verbose {
+				log.Printf("Skipping packet from %s: %v", from, err)
+			}
+			continue
+		}
+		if verbose {
+			log.Printf("%s packet from %s domain %d sequence %d: %d templates, %d flows, %d missing templates",
+				versionName(msg.Version), from, msg.DomainID, msg.Sequence,
+				len(msg.Templates), msg.DataRecords(true), msg.MissingTemplates())
+		}
+	}
+}
+
+// RunCtx collects on ip:port until ctx is cancelled, logging a report every
+// interval and once more on exit. The returned Tracker holds the final stats.
+// Use Run() for CLI usage where OS signal handling is desired.
+func RunCtx(ctx context.Context, ip string, port int, interval time.Duration, verbose bool) (*Tracker, error) {
+	t := NewTracker()
+	if err := runCollect(ctx, t, ip, port, interval, verbose); err != nil {
+		return t, fmt.Errorf("collect: %w", err)
+	}
+	t.logReport()
+	return t, nil
+}
+
+// Run Collect. Kicks off the collector.
+// It sets up OS signal handling (SIGINT/SIGTERM) for clean shutdown.
+// Use RunCtx() when you need to control the lifecycle via context.
+func Run(ip string, port int, interval time.Duration, verbose bool) {
+	mgr := lifecycle.New()
+	defer mgr.Cancel()
+
+	// Setup signal handling BEFORE starting the collector to avoid race
+	_ = mgr.SetupSignalHandler()
+
+	if _, err := RunCtx(mgr.Context(), ip, port, interval, verbose); err != nil {
+		log.Printf("Collect error: %v", err)
+	}
+
+	mgr.Wait()
+}
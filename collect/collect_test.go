@@ -0,0 +1,246 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package collect
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmabry/flowgre/decode/decodetest"
+	"github.com/dmabry/flowgre/ipfix"
+)
+
+const exporterAddr = "192.0.2.1:2055"
+
+// withSequence returns a copy of payload with its header sequence number set to seq.
+func withSequence(payload []byte, seq uint32) []byte {
+	p := append([]byte(nil), payload...)
+	offset := 12 // NetFlow v9
+	if binary.BigEndian.Uint16(p[0:2]) == ipfix.Version {
+		offset = 8
+	}
+	binary.BigEndian.PutUint32(p[offset:offset+4], seq)
+	return p
+}
+
+func TestTrackerNetFlowSequence(t *testing.T) {
+	t.Parallel()
+	packets := decodetest.NetFlow(t, 1, "10.0.0.0/8", 5)
+	template, data := packets[0], packets[1]
+
+	tests := []struct {
+		name      string
+		template  uint32   // template packet sequence
+		sequences []uint32 // data packet sequences after the template
+		want      ExporterStats
+	}{
+		{
+			name:      "in order",
+			template:  1,
+			sequences: []uint32{2, 3, 4},
+			want:      ExporterStats{Packets: 4, Flows: 15},
+		},
+		{
+			name:      "gap",
+			template:  1,
+			sequences: []uint32{2, 5, 6},
+			want:      ExporterStats{Packets: 4, Flows: 15, Gaps: 1, Lost: 2},
+		},
+		{
+			name:      "duplicate",
+			template:  1,
+			sequences: []uint32{2, 3, 3, 4},
+			want:      ExporterStats{Packets: 5, Flows: 20, Duplicates: 1},
+		},
+		{
+			name:      "out of order",
+			template:  1,
+			sequences: []uint32{2, 4, 3, 5},
+			want:      ExporterStats{Packets: 5, Flows: 20, Gaps: 1, OutOfOrder: 1},
+		},
+		{
+			name:      "wraparound",
+			template:  ^uint32(0) - 1,
+			sequences: []uint32{^uint32(0), 0, 1},
+			want:      ExporterStats{Packets: 4, Flows: 15},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tr := NewTracker()
+			if _, err := tr.Observe(exporterAddr, withSequence(template, tt.template), time.Now()); err != nil {
+				t.Fatalf("Observe template: %v", err)
+			}
+			for _, seq := range tt.sequences {
+				if _, err := tr.Observe(exporterAddr, withSequence(data, seq), time.Now()); err != nil {
+					t.Fatalf("Observe sequence %d: %v", seq, err)
+				}
+			}
+			got := tr.Exporters()[0].ExporterStats
+			tt.want.Version, tt.want.Templates = 9, 1
+			got.FirstSeen, got.LastSeen = time.Time{}, time.Time{}
+			if got != tt.want {
+				t.Errorf("Got: %+v Want: %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackerIPFIXSequence(t *testing.T) {
+	t.Parallel()
+	seq := ipfix.NewIPFIXSequence()
+	template := func() []byte {
+		tmpl := ipfix.GenerateTemplateIPFIX(1, seq)
+		buf, err := tmpl.ToBytes()
+		if err != nil {
+			t.Fatalf("template ToBytes: %v", err)
+		}
+		return buf.Bytes()
+	}
+	data := func() []byte {
+		flow, err := ipfix.GenerateDataIPFIX(10, 1, "10.0.0.0/8", "172.16.0.0/12", 443, seq)
+		if err != nil {
+			t.Fatalf("GenerateDataIPFIX: %v", err)
+		}
+		buf, err := flow.ToBytes()
+		if err != nil {
+			t.Fatalf("data ToBytes: %v", err)
+		}
+		return buf.Bytes()
+	}
+	options := func() []byte {
+		opts := ipfix.GenerateOptionsDataIPFIX(1, seq)
+		buf, err := opts.ToBytes()
+		if err != nil {
+			t.Fatalf("options ToBytes: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	// The first data message arrives before any template, the third data
+	// message is lost and the options data message follows a template refresh.
+	early := data()
+	payloads := [][]byte{early, template(), data()}
+	data()
+	payloads = append(payloads, data(), template(), options())
+
+	tr := NewTracker()
+	for _, payload := range payloads {
+		if _, err := tr.Observe(exporterAddr, payload, time.Now()); err != nil {
+			t.Fatalf("Observe: %v", err)
+		}
+	}
+	got := tr.Exporters()[0].ExporterStats
+	got.FirstSeen, got.LastSeen = time.Time{}, time.Time{}
+	want := ExporterStats{
+		Version:         10,
+		Packets:         6,
+		Flows:           20,
+		OptionsRecords:  1,
+		Templates:       4,
+		Lost:            10,
+		Gaps:            1,
+		MissingTemplate: 1,
+	}
+	if got != want {
+		t.Errorf("Got: %+v Want: %+v", got, want)
+	}
+}
+
+func TestTrackerExportersAndErrors(t *testing.T) {
+	t.Parallel()
+	packets := decodetest.NetFlow(t, 1, "10.0.0.0/8", 2)
+	template, data := packets[0], packets[1]
+	tr := NewTracker()
+
+	// Each exporter has its own template cache and sequence
+	for _, addr := range []string{"192.0.2.2:2055", "192.0.2.1:2055"} {
+		if _, err := tr.Observe(addr, template, time.Now()); err != nil {
+			t.Fatalf("Observe: %v", err)
+		}
+	}
+	if _, err := tr.Observe("192.0.2.3:2055", data, time.Now()); err != nil {
+		t.Fatalf("Observe: %v", err)
+	}
+	v5 := make([]byte, 24)
+	binary.BigEndian.PutUint16(v5[0:2], 5)
+	if _, err := tr.Observe("192.0.2.1:2055", v5, time.Now()); err == nil {
+		t.Error("Got: nil error for NetFlow v5 Want: error")
+	}
+	if _, err := tr.Observe("192.0.2.1:2055", data[:10], time.Now()); err == nil {
+		t.Error("Got: nil error for truncated packet Want: error")
+	}
+
+	exporters := tr.Exporters()
+	var addrs []string
+	for _, e := range exporters {
+		addrs = append(addrs, e.Address)
+	}
+	if got, want := strings.Join(addrs, ","), "192.0.2.1:2055,192.0.2.2:2055,192.0.2.3:2055"; got != want {
+		t.Errorf("Got: %s Want: %s", got, want)
+	}
+	if got := exporters[2].MissingTemplate; got != 1 {
+		t.Errorf("Got: %d missing templates Want: 1", got)
+	}
+	if tr.Ignored() != 1 || tr.Invalid() != 1 {
+		t.Errorf("Got: %d ignored %d invalid Want: 1 ignored 1 invalid", tr.Ignored(), tr.Invalid())
+	}
+	report := tr.Report()
+	if len(report) != 4 || !strings.Contains(report[0], "Exporter 192.0.2.1:2055 domain 1 (NetFlow v9)") {
+		t.Errorf("Got: %q Want: 3 exporter lines and a totals line", report)
+	}
+}
+
+func TestRunCollect(t *testing.T) {
+	t.Parallel()
+	probe, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+	port := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tr := NewTracker()
+	done := make(chan error, 1)
+	go func() { done <- runCollect(ctx, tr, "127.0.0.1", port, time.Second, false) }()
+
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: port})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	packets := decodetest.NetFlow(t, 1, "10.0.0.0/8", 3)
+	template, data := packets[0], packets[1]
+
+	// Resend until the collector is listening and has decoded a data packet
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if exporters := tr.Exporters(); len(exporters) == 1 && exporters[0].Flows > 0 {
+			break
+		}
+		_, _ = conn.Write(template)
+		_, _ = conn.Write(data)
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runCollect: %v", err)
+	}
+
+	exporters := tr.Exporters()
+	if len(exporters) != 1 || exporters[0].Flows == 0 {
+		t.Fatalf("Got: %+v Want: 1 exporter with flows", exporters)
+	}
+	if got, want := exporters[0].Address, conn.LocalAddr().String(); got != want {
+		t.Errorf("Got: exporter %s Want: %s", got, want)
+	}
+}
@@ -0,0 +1,215 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package collect
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dmabry/flowgre/decode"
+)
+
+// recentWindow is how many recent sequence numbers each exporter remembers to
+// tell duplicate packets apart from late ones.
+const recentWindow = 256
+
+// ExporterKey identifies an exporter by address and source ID (NetFlow v9) or
+// observation domain ID (IPFIX).
+type ExporterKey struct {
+	Address  string
+	DomainID uint32
+}
+
+// ExporterStats is what has been received from an exporter. NetFlow v9
+// sequence numbers count export packets, so Lost counts packets; IPFIX
+// sequence numbers count data records, so Lost counts records.
+type ExporterStats struct {
+	Version         uint16
+	Packets         uint64
+	Flows           uint64 // decoded flow data records
+	OptionsRecords  uint64 // decoded options data records
+	Templates       uint64 // template and options template records received
+	Lost            uint64 // packets (v9) or records (IPFIX) missing from sequence gaps
+	Gaps            uint64 // sequence jumps forward
+	Duplicates      uint64 // packets repeating a recently seen sequence number
+	OutOfOrder      uint64 // packets arriving after a later sequence number
+	MissingTemplate uint64 // data sets received before their template
+	FirstSeen       time.Time
+	LastSeen        time.Time
+}
+
+// Exporter is a snapshot of one exporter's stats.
+type Exporter struct {
+	ExporterKey
+	ExporterStats
+}
+
+// exporter tracks one exporter's stats and sequence state.
+type exporter struct {
+	stats  ExporterStats
+	synced bool   // next is known
+	next   uint32 // expected sequence number of the next message
+	recent [recentWindow]uint32
+	seen   int // sequence numbers written to recent
+}
+
+// Tracker decodes received messages and tracks per-exporter stats. It is safe
+// for concurrent use.
+type Tracker struct {
+	decoder *decode.Decoder
+
+	mu        sync.Mutex
+	exporters map[ExporterKey]*exporter
+	invalid   uint64
+	ignored   uint64
+}
+
+// NewTracker returns an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{
+		decoder:   decode.NewDecoder(),
+		exporters: make(map[ExporterKey]*exporter),
+	}
+}
+
+// Observe decodes payload received from addr and updates the exporter's stats.
+// It returns the decoded message, or an error if payload is not a valid
+// NetFlow v9 or IPFIX message. Other flow versions are counted as ignored.
+func (t *Tracker) Observe(addr string, payload []byte, now time.Time) (*decode.Message, error) {
+	msg, err := t.decoder.Decode(addr, payload)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		if errors.Is(err, decode.ErrUnsupportedVersion) {
+			t.ignored++
+		} else {
+			t.invalid++
+		}
+		return nil, err
+	}
+
+	key := ExporterKey{Address: addr, DomainID: msg.DomainID}
+	e, ok := t.exporters[key]
+	if !ok {
+		e = &exporter{stats: ExporterStats{Version: msg.Version, FirstSeen: now}}
+		t.exporters[key] = e
+	}
+	e.stats.Packets++
+	e.stats.LastSeen = now
+	e.stats.Templates += uint64(len(msg.Templates))
+	e.stats.Flows += uint64(msg.DataRecords(true))
+	e.stats.OptionsRecords += uint64(msg.DataRecords(false))
+	e.stats.MissingTemplate += uint64(msg.MissingTemplates())
+
+	if msg.Version == decode.VersionNetFlow {
+		e.sequence(msg.Sequence, 1, true)
+	} else {
+		// Records of undecodable data sets can't be counted, so the next
+		// sequence number is unknown until the following message.
+		records := msg.DataRecords(true) + msg.DataRecords(false)
+		e.sequence(msg.Sequence, uint32(records), msg.MissingTemplates() == 0)
+	}
+	return msg, nil
+}
+
+// sequence checks seq against the expected sequence number. count is how far
+// the message advances the sequence: 1 per NetFlow v9 packet, or the number of
+// data records in an IPFIX message. known is false when count is uncertain.
+func (e *exporter) sequence(seq, count uint32, known bool) {
+	if e.synced {
+		diff := int32(seq - e.next)
+		switch {
+		case diff > 0:
+			e.stats.Gaps++
+			e.stats.Lost += uint64(diff)
+		case diff < 0:
+			if count == 0 {
+				// IPFIX template-only messages don't advance the sequence,
+				// so a late one is harmless
+				return
+			}
+			if e.recentlySeen(seq) {
+				e.stats.Duplicates++
+			} else {
+				e.stats.OutOfOrder++
+				e.stats.Lost -= min(e.stats.Lost, uint64(count))
+			}
+			return
+		}
+	}
+	if count > 0 {
+		e.remember(seq)
+	}
+	e.next = seq + count
+	e.synced = known
+}
+
+// recentlySeen reports whether seq is among the last recentWindow sequence numbers remembered.
+func (e *exporter) recentlySeen(seq uint32) bool {
+	return slices.Contains(e.recent[:min(e.seen, recentWindow)], seq)
+}
+
+// remember records seq as seen.
+func (e *exporter) remember(seq uint32) {
+	e.recent[e.seen%recentWindow] = seq
+	e.seen++
+}
+
+// Exporters returns a snapshot of every exporter's stats, sorted by address and domain.
+func (t *Tracker) Exporters() []Exporter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	exporters := make([]Exporter, 0, len(t.exporters))
+	for key, e := range t.exporters {
+		exporters = append(exporters, Exporter{ExporterKey: key, ExporterStats: e.stats})
+	}
+	slices.SortFunc(exporters, func(a, b Exporter) int {
+		return cmp.Or(cmp.Compare(a.Address, b.Address), cmp.Compare(a.DomainID, b.DomainID))
+	})
+	return exporters
+}
+
+// Invalid returns the number of packets that failed to decode.
+func (t *Tracker) Invalid() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.invalid
+}
+
+// Ignored returns the number of packets of other flow versions, such as NetFlow v5 or sFlow.
+func (t *Tracker) Ignored() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ignored
+}
+
+// Report returns one line per exporter describing what has been received,
+// followed by a line of packets that could not be decoded.
+func (t *Tracker) Report() []string {
+	var lines []string
+	for _, e := range t.Exporters() {
+		lost := "packets"
+		if e.Version == decode.VersionIPFIX {
+			lost = "records"
+		}
+		lines = append(lines, fmt.Sprintf(
+			"Exporter %s domain %d (%s): Packets: %d Flows: %d Options Records: %d Templates: %d "+
+				"Gaps: %d (%d %s lost) Duplicates: %d Out of Order: %d Missing Template: %d",
+			e.Address, e.DomainID, versionName(e.Version), e.Packets, e.Flows, e.OptionsRecords, e.Templates,
+			e.Gaps, e.Lost, lost, e.Duplicates, e.OutOfOrder, e.MissingTemplate))
+	}
+	return append(lines, fmt.Sprintf("Invalid Packets: %d Ignored Packets: %d", t.Invalid(), t.Ignored()))
+}
+
+// logReport logs the tracker's report.
+func (t *Tracker) logReport() {
+	for _, line := range t.Report() {
+		log.Println(line)
+	}
+}
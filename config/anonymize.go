@@ -0,0 +1,67 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/dmabry/flowgre/anonymize"
+	"github.com/spf13/viper"
+)
+
+// LoadAnonymizeRules reads the address rewrite rules used by replay and proxy
+// from a YAML file of their own, so they don't mix with a barrage config. The
+// expected format is:
+//
+//	key: 0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0
+//	remap:
+//	  - from: 192.168.0.0/16
+//	    to: 10.20.0.0/16
+//	  - from: 2001:db8:1::/48
+//	    to: 2001:db8:2::/48
+//	scrub:
+//	  - ports
+//	  - as
+//
+// Every section is optional. The rules are checked by building an Anonymizer.
+func LoadAnonymizeRules(path string) (*anonymize.Anonymizer, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read anonymize rules: %w", err)
+	}
+	for _, key := range v.AllKeys() {
+		switch key {
+		case "key", "remap", "scrub":
+		default:
+			return nil, fmt.Errorf("anonymize rules: unknown setting %q", key)
+		}
+	}
+
+	rules := anonymize.Rules{Key: v.GetString("key")}
+	if v.IsSet("remap") {
+		entries, ok := v.Get("remap").([]any)
+		if !ok {
+			return nil, fmt.Errorf("anonymize rules: remap must be a list of from/to pairs")
+		}
+		for i, entry := range entries {
+			pair, ok := entry.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("anonymize rules: unexpected type for remap %d: %T", i, entry)
+			}
+			from, to := getString(pair, "from", ""), getString(pair, "to", "")
+			if from == "" || to == "" {
+				return nil, fmt.Errorf("anonymize rules: remap %d needs both from and to", i)
+			}
+			rules.Remap = append(rules.Remap, anonymize.Remap{From: from, To: to})
+		}
+	}
+	rules.Scrub = v.GetStringSlice("scrub")
+
+	a, err := anonymize.New(rules)
+	if err != nil {
+		return nil, fmt.Errorf("anonymize rules: %w", err)
+	}
+	return a, nil
+}
@@ -7,14 +7,31 @@ package config
 import (
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/dmabry/flowgre/models"
 	"github.com/spf13/viper"
 )
 
-// LoadBarrageConfig reads a Viper-loaded YAML config and returns a models.Config.
-// The expected format is:
+// LoadBarrageConfig reads a Viper-loaded YAML config with a single target and
+// returns its models.Config. Use LoadBarrageTargets for configs with several.
+func LoadBarrageConfig() (*models.Config, error) {
+	targets, err := LoadBarrageTargets()
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) > 1 {
+		return nil, fmt.Errorf("found %d targets in config file, only 1 is allowed", len(targets))
+	}
+	return targets[0], nil
+}
+
+// LoadBarrageTargets reads every target of a Viper-loaded YAML config, sorted
+// by name. Each target gets its own workers and stats. At most one target may
+// enable the web dashboard, which then reports on all of them. The expected
+// format is:
 //
 //	targets:
 //	  server1:
@@ -25,12 +42,22 @@ import (
 //	    template-interval: 30
 //	    src-range: 10.0.0.0/8
 //	    dst-range: 10.0.0.0/8
-//
-// \t    web: false
-// \t    web-ip: 0.0.0.0
-// \t    web-port: 8080
-// \t    protocol: netflow
-func LoadBarrageConfig() (*models.Config, error) {
+//	    web: false
+//	    web-ip: 0.0.0.0
+//	    web-port: 8080
+//	    protocol: netflow
+//	    profile: generic
+//	    flows-per-second: 0
+//	    packets-per-second: 0
+//	    bits-per-second: 0
+//	    load-shape: ramp:10:100:5m
+//	    duration: 10m
+//	    max-packets: 0
+//	    max-flows: 0
+//	  server2:
+//	    ip: 127.0.0.2
+//	    protocol: ipfix
+func LoadBarrageTargets() ([]*models.Config, error) {
 	if !viper.IsSet("targets") {
 		return nil, fmt.Errorf("couldn't find targets section in config file")
 	}
@@ -41,22 +68,36 @@ func LoadBarrageConfig() (*models.Config, error) {
 		return nil, fmt.Errorf("no targets found in config")
 	}
 
-	if len(targetMap) > 1 {
-		return nil, fmt.Errorf("found more than 1 target in config file, only 1 is allowed")
+	names := make([]string, 0, len(targetMap))
+	for name := range targetMap {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	// Get the single target
-	var targetName string
-	var targetValues map[string]any
-	for name, vals := range targetMap {
-		targetName = name
-		tv, ok := vals.(map[string]any)
+	configs := make([]*models.Config, 0, len(names))
+	webTarget := ""
+	for _, name := range names {
+		tv, ok := targetMap[name].(map[string]any)
 		if !ok {
-			return nil, fmt.Errorf("unexpected type for target %s: %T", name, vals)
+			return nil, fmt.Errorf("unexpected type for target %s: %T", name, targetMap[name])
+		}
+		cfg, err := loadTarget(name, tv)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", name, err)
 		}
-		targetValues = tv
+		if cfg.Web {
+			if webTarget != "" {
+				return nil, fmt.Errorf("targets %s and %s both enable web, only 1 dashboard is allowed", webTarget, name)
+			}
+			webTarget = name
+		}
+		configs = append(configs, cfg)
 	}
+	return configs, nil
+}
 
+// loadTarget converts the values of one named target, applying defaults.
+func loadTarget(targetName string, targetValues map[string]any) (*models.Config, error) {
 	// Extract values with defaults
 	ip := getString(targetValues, "ip", "127.0.0.1")
 	port, err := getInt(targetValues, "port", 9995)
@@ -84,13 +125,45 @@ func LoadBarrageConfig() (*models.Config, error) {
 	}
 	web := getBool(targetValues, "web", false)
 	protocol := getString(targetValues, "protocol", "netflow")
+	network := getString(targetValues, "transport", "udp")
+	transportCert := getString(targetValues, "transport-cert", "")
+	transportKey := getString(targetValues, "transport-key", "")
+	transportCA := getString(targetValues, "transport-ca", "")
+	transportServerName := getString(targetValues, "transport-server-name", "")
+	profile := getString(targetValues, "profile", "")
 	webUsername := getString(targetValues, "web-username", "")
 	webPassword := getString(targetValues, "web-password", "")
+	flowsPerSecond, err := getInt(targetValues, "flows-per-second", 0)
+	if err != nil {
+		return nil, err
+	}
+	packetsPerSecond, err := getInt(targetValues, "packets-per-second", 0)
+	if err != nil {
+		return nil, err
+	}
+	bitsPerSecond, err := getInt(targetValues, "bits-per-second", 0)
+	if err != nil {
+		return nil, err
+	}
+	loadShape := getString(targetValues, "load-shape", "")
+	duration, err := getDuration(targetValues, "duration")
+	if err != nil {
+		return nil, err
+	}
+	maxPackets, err := getInt(targetValues, "max-packets", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxFlows, err := getInt(targetValues, "max-flows", 0)
+	if err != nil {
+		return nil, err
+	}
 
 	log.Printf("target: %s ip: %s port: %d workers: %d delay: %d template-interval: %d src-range: %s dst-range: %s web: %v web-ip: %s web-port: %d protocol: %s\n",
 		targetName, ip, port, workers, delay, templateInterval, srcRange, dstRange, web, webIP, webPort, protocol)
 
 	return &models.Config{
+		Name:             targetName,
 		Server:           ip,
 		DstPort:          port,
 		Workers:          workers,
@@ -102,8 +175,22 @@ func LoadBarrageConfig() (*models.Config, error) {
 		WebPort:          webPort,
 		Web:              web,
 		Protocol:         protocol,
+		Transport:        network,
+		Profile:          profile,
 		WebUsername:      webUsername,
 		WebPassword:      webPassword,
+		FlowsPerSecond:   flowsPerSecond,
+		PacketsPerSecond: packetsPerSecond,
+		BitsPerSecond:    bitsPerSecond,
+		LoadShape:        loadShape,
+		Duration:         duration,
+		MaxPackets:       maxPackets,
+		MaxFlows:         maxFlows,
+
+		TransportCert:       transportCert,
+		TransportKey:        transportKey,
+		TransportCA:         transportCA,
+		TransportServerName: transportServerName,
 	}, nil
 }
 
@@ -146,6 +233,19 @@ func getInt(m map[string]any, key string, def int) (int, error) {
 	return def, nil
 }
 
+// getDuration gets a duration such as "90s" or "10m" from a map, defaulting to 0.
+func getDuration(m map[string]any, key string) (time.Duration, error) {
+	v, ok := m[key]
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(fmt.Sprint(v))
+	if err != nil {
+		return 0, fmt.Errorf("config value %q is not a valid duration: %q", key, fmt.Sprint(v))
+	}
+	return d, nil
+}
+
 // getBool safely gets a bool value from a map with a default.
 func getBool(m map[string]any, key string, def bool) bool {
 	if v, ok := m[key]; ok {
@@ -4,8 +4,12 @@
 package config
 
 import (
+	"net/netip"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -72,6 +76,9 @@ targets:
     web: true
     web-ip: 127.0.0.1
     web-port: 3000
+    load-shape: sine:10:100:24h
+    duration: 90s
+    max-flows: 100000
 `
 	if _, err := tmpFile.WriteString(configContent); err != nil {
 		t.Fatalf("Failed to write config: %v", err)
@@ -116,6 +123,12 @@ targets:
 	if cfg.WebPort != 3000 {
 		t.Errorf("Expected WebPort 3000, got %d", cfg.WebPort)
 	}
+	if cfg.LoadShape != "sine:10:100:24h" {
+		t.Errorf("Expected LoadShape 'sine:10:100:24h', got '%s'", cfg.LoadShape)
+	}
+	if cfg.Duration != 90*time.Second || cfg.MaxFlows != 100000 || cfg.MaxPackets != 0 {
+		t.Errorf("Expected 90s duration and 100000 max flows, got %s, %d packets, %d flows", cfg.Duration, cfg.MaxPackets, cfg.MaxFlows)
+	}
 }
 
 // TestLoadBarrageConfigMissingTargets tests that missing targets section returns error.
@@ -183,6 +196,103 @@ targets:
 	}
 }
 
+// TestLoadBarrageTargets tests loading several targets, each with its own settings.
+func TestLoadBarrageTargets(t *testing.T) {
+	viper.Reset()
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	configContent := `
+targets:
+  standby:
+    ip: 192.0.2.2
+    port: 4739
+    protocol: ipfix
+    profile: minimal
+    packets-per-second: 500
+  primary:
+    ip: 192.0.2.1
+    workers: 8
+    flows-per-second: 10000
+    web: true
+`
+	if _, err := tmpFile.WriteString(configContent); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	tmpFile.Close()
+
+	if err := InitViper(tmpFile.Name()); err != nil {
+		t.Fatalf("InitViper failed: %v", err)
+	}
+
+	targets, err := LoadBarrageTargets()
+	if err != nil {
+		t.Fatalf("LoadBarrageTargets failed: %v", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("Expected 2 targets, got %d", len(targets))
+	}
+	// Targets are sorted by name
+	primary, standby := targets[0], targets[1]
+	if primary.Name != "primary" || primary.Server != "192.0.2.1" || primary.Workers != 8 ||
+		primary.FlowsPerSecond != 10000 || !primary.Web || primary.Protocol != "netflow" {
+		t.Errorf("Unexpected primary target: %+v", primary)
+	}
+	if standby.Name != "standby" || standby.DstPort != 4739 || standby.Protocol != "ipfix" ||
+		standby.Profile != "minimal" || standby.PacketsPerSecond != 500 || standby.Web {
+		t.Errorf("Unexpected standby target: %+v", standby)
+	}
+}
+
+// TestLoadBarrageTargetsErrors tests that invalid targets are reported by name.
+func TestLoadBarrageTargetsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"two dashboards", `
+targets:
+  a:
+    web: true
+  b:
+    web: true
+`, "both enable web"},
+		{"bad value", `
+targets:
+  a:
+    port: 9995
+  b:
+    workers: many
+`, "target b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			tmpFile, err := os.CreateTemp("", "config-*.yaml")
+			if err != nil {
+				t.Fatalf("Failed to create temp file: %v", err)
+			}
+			defer os.Remove(tmpFile.Name())
+			if _, err := tmpFile.WriteString(tt.content); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			tmpFile.Close()
+
+			if err := InitViper(tmpFile.Name()); err != nil {
+				t.Fatalf("InitViper failed: %v", err)
+			}
+			_, err = LoadBarrageTargets()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 // TestLoadBarrageConfigDefaults tests that missing fields get defaults.
 func TestLoadBarrageConfigDefaults(t *testing.T) {
 	viper.Reset()
@@ -232,6 +342,92 @@ targets:
 	}
 }
 
+// TestLoadBarrageConfigProtocol tests that the protocol key is read from the target.
+func TestLoadBarrageConfigProtocol(t *testing.T) {
+	viper.Reset()
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	configContent := `
+targets:
+  switch1:
+    ip: 10.0.0.1
+    port: 6343
+    protocol: sflow
+`
+	if _, err := tmpFile.WriteString(configContent); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	tmpFile.Close()
+
+	if err := InitViper(tmpFile.Name()); err != nil {
+		t.Fatalf("InitViper failed: %v", err)
+	}
+
+	cfg, err := LoadBarrageConfig()
+	if err != nil {
+		t.Fatalf("LoadBarrageConfig failed: %v", err)
+	}
+	if cfg.Protocol != "sflow" {
+		t.Errorf("Expected Protocol 'sflow', got '%s'", cfg.Protocol)
+	}
+}
+
+// TestLoadBarrageConfigTransport tests that the transport keys are read from
+// the target and the transport defaults to udp.
+func TestLoadBarrageConfigTransport(t *testing.T) {
+	viper.Reset()
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	configContent := `
+targets:
+  collector1:
+    protocol: ipfix
+    transport: tls
+    transport-cert: exporter.pem
+    transport-key: exporter-key.pem
+    transport-ca: ca.pem
+    transport-server-name: collector.example
+  collector2:
+    protocol: ipfix
+`
+	if _, err := tmpFile.WriteString(configContent); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	tmpFile.Close()
+
+	if err := InitViper(tmpFile.Name()); err != nil {
+		t.Fatalf("InitViper failed: %v", err)
+	}
+
+	targets, err := LoadBarrageTargets()
+	if err != nil {
+		t.Fatalf("LoadBarrageTargets failed: %v", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("Expected 2 targets, got %d", len(targets))
+	}
+	if targets[0].Transport != "tls" {
+		t.Errorf("Expected Transport 'tls', got '%s'", targets[0].Transport)
+	}
+	if targets[0].TransportCert != "exporter.pem" || targets[0].TransportKey != "exporter-key.pem" {
+		t.Errorf("Expected transport cert and key, got '%s' '%s'", targets[0].TransportCert, targets[0].TransportKey)
+	}
+	if targets[0].TransportCA != "ca.pem" || targets[0].TransportServerName != "collector.example" {
+		t.Errorf("Expected transport CA and server name, got '%s' '%s'", targets[0].TransportCA, targets[0].TransportServerName)
+	}
+	if targets[1].Transport != "udp" {
+		t.Errorf("Expected Transport 'udp' (default), got '%s'", targets[1].Transport)
+	}
+}
+
 // TestLoadBarrageConfigValidation tests config validation with various inputs.
 func TestLoadBarrageConfigValidation(t *testing.T) {
 	viper.Reset()
@@ -286,3 +482,178 @@ targets: {}
 		})
 	}
 }
+
+// TestLoadProfiles tests loading user-defined profiles from the profiles section.
+func TestLoadProfiles(t *testing.T) {
+	viper.Reset()
+	tmpFile, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	configContent := `
+targets:
+  server1:
+    ip: 127.0.0.1
+profiles:
+  Vendor-A:
+    template-id: 300
+    fields:
+      - type: octetDeltaCount
+        length: 8
+        value: random
+        min: 64
+        max: 1500
+      - type: 7
+        length: 2
+        value: constant
+        constant: 443
+      - type: sourceIPv4Address
+        length: 4
+        value: cidr
+        cidr: 192.0.2.0/24
+      - type: IN_PKTS
+        length: 4
+      - type: 1
+        length: 4
+        enterprise: 29305
+      - type: applicationName
+        length: variable
+        value: choice
+        choices: [dns, https]
+      - type: subTemplateList
+        length: variable
+        list:
+          semantic: all-of
+          template-id: 400
+          fields:
+            - type: sourceIPv4Address
+              length: 4
+`
+	if _, err := tmpFile.WriteString(configContent); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	tmpFile.Close()
+
+	if err := InitViper(tmpFile.Name()); err != nil {
+		t.Fatalf("InitViper failed: %v", err)
+	}
+
+	profiles, err := LoadProfiles()
+	if err != nil {
+		t.Fatalf("LoadProfiles failed: %v", err)
+	}
+	p, ok := profiles["vendor-a"]
+	if !ok {
+		t.Fatalf("Expected profile 'vendor-a', got %v", profiles)
+	}
+	if p.TemplateID != 300 || len(p.Fields) != 7 {
+		t.Fatalf("Expected template-id 300 with 7 fields, got %d with %d", p.TemplateID, len(p.Fields))
+	}
+	if f := p.Fields[0]; f.Type != "octetDeltaCount" || f.Length != 8 || f.Value != "random" || f.Min != 64 || f.Max != 1500 {
+		t.Errorf("Field 0 wrong: %+v", f)
+	}
+	if f := p.Fields[1]; f.Type != "7" || f.Constant != "443" {
+		t.Errorf("Field 1 wrong: %+v", f)
+	}
+	if f := p.Fields[2]; f.CIDR != "192.0.2.0/24" {
+		t.Errorf("Field 2 wrong: %+v", f)
+	}
+	if f := p.Fields[3]; f.Value != "" || f.Step != 1 {
+		t.Errorf("Field 3 should use defaults: %+v", f)
+	}
+	if f := p.Fields[4]; f.Type != "1" || f.Enterprise != 29305 {
+		t.Errorf("Field 4 wrong: %+v", f)
+	}
+	if f := p.Fields[5]; f.Length != 65535 || f.Value != "choice" || len(f.Choices) != 2 || f.Choices[1] != "https" {
+		t.Errorf("Field 5 wrong: %+v", f)
+	}
+	if l := p.Fields[6].List; l == nil || l.Semantic != "all-of" || l.TemplateID != 400 || l.Count != 1 || len(l.Fields) != 1 || l.Fields[0].Length != 4 {
+		t.Errorf("Field 6 list wrong: %+v", l)
+	}
+}
+
+// TestLoadProfilesErrors tests that malformed profiles are rejected.
+func TestLoadProfilesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"reserved name", "profiles:\n  minimal:\n    fields:\n      - type: 1\n        length: 4\n"},
+		{"no fields", "profiles:\n  empty:\n    template-id: 300\n"},
+		{"missing type", "profiles:\n  p:\n    fields:\n      - length: 4\n"},
+		{"fractional length", "profiles:\n  p:\n    fields:\n      - type: 1\n        length: 4.5\n"},
+		{"unknown length", "profiles:\n  p:\n    fields:\n      - type: 1\n        length: long\n"},
+		{"choices not a list", "profiles:\n  p:\n    fields:\n      - type: 96\n        length: variable\n        choices: dns\n"},
+		{"list without fields", "profiles:\n  p:\n    fields:\n      - type: 291\n        length: variable\n        list:\n          count: 2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			viper.SetConfigType("yaml")
+			if err := viper.ReadConfig(strings.NewReader(tt.content)); err != nil {
+				t.Fatalf("ReadConfig failed: %v", err)
+			}
+			if _, err := LoadProfiles(); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+// TestLoadAnonymizeRules tests that a rules file builds an Anonymizer applying
+// its remaps.
+func TestLoadAnonymizeRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anonymize.yaml")
+	content := `
+key: "0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0"
+remap:
+  - from: 192.168.0.0/16
+    to: 10.20.0.0/16
+scrub:
+  - ports
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write rules: %v", err)
+	}
+	a, err := LoadAnonymizeRules(path)
+	if err != nil {
+		t.Fatalf("LoadAnonymizeRules failed: %v", err)
+	}
+	if got := a.Addr(netip.MustParseAddr("192.168.1.2")); got.String() != "10.20.1.2" {
+		t.Errorf("Expected 10.20.1.2, got %s", got)
+	}
+	if got := a.Addr(netip.MustParseAddr("198.51.100.1")); got.String() == "198.51.100.1" {
+		t.Error("Expected address outside the remaps to be anonymized")
+	}
+
+	if _, err := LoadAnonymizeRules(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected error for missing file, got nil")
+	}
+}
+
+// TestLoadAnonymizeRulesErrors tests that malformed rules are rejected.
+func TestLoadAnonymizeRulesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unknown setting", "keys: abc\n"},
+		{"remap not a list", "remap: 10.0.0.0/8\n"},
+		{"remap missing to", "remap:\n  - from: 10.0.0.0/8\n"},
+		{"short key", "key: abcd\n"},
+		{"unknown scrub", "scrub:\n  - macs\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "anonymize.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("Failed to write rules: %v", err)
+			}
+			if _, err := LoadAnonymizeRules(path); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dmabry/flowgre/models"
+	"github.com/spf13/viper"
+)
+
+// builtinProfiles are the profile names that cannot be redefined in the config file.
+var builtinProfiles = map[string]bool{"generic": true, "minimal": true, "extended": true, "biflow": true}
+
+// LoadProfiles reads the optional profiles section of a Viper-loaded YAML config.
+// Profile names are case-insensitive. The expected format is:
+//
+//	profiles:
+//	  vendor-a:
+//	    template-id: 300
+//	    fields:
+//	      - type: octetDeltaCount
+//	        length: 8
+//	        value: random
+//	        min: 64
+//	        max: 1500000
+//	      - type: sourceIPv4Address
+//	        length: 4
+//	        value: cidr
+//	        cidr: 192.0.2.0/24
+//	      - type: 7
+//	        length: 2
+//	        value: constant
+//	        constant: 443
+//	      - type: IN_PKTS
+//	        length: 4
+//	        value: sequence
+//	        start: 1
+//	        step: 1
+//
+// A field without a value uses the default generator for its type.
+func LoadProfiles() (map[string]models.ProfileConfig, error) {
+	if !viper.IsSet("profiles") {
+		return nil, nil
+	}
+	profileMap, ok := viper.Get("profiles").(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("profiles section must be a map of profile names")
+	}
+
+	profiles := make(map[string]models.ProfileConfig, len(profileMap))
+	for name, vals := range profileMap {
+		if builtinProfiles[name] {
+			return nil, fmt.Errorf("profile name %q is reserved for a built-in profile", name)
+		}
+		pv, ok := vals.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type for profile %s: %T", name, vals)
+		}
+		templateID, err := getInt(pv, "template-id", 0)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		rawFields, ok := pv["fields"].([]any)
+		if !ok || len(rawFields) == 0 {
+			return nil, fmt.Errorf("profile %s has no fields", name)
+		}
+		fields := make([]models.ProfileField, len(rawFields))
+		for i, raw := range rawFields {
+			fields[i], err = loadProfileField(raw)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s field %d: %w", name, i, err)
+			}
+		}
+		profiles[name] = models.ProfileConfig{
+			Name:       name,
+			TemplateID: templateID,
+			Fields:     fields,
+		}
+	}
+	return profiles, nil
+}
+
+// loadProfileField converts one entry of a profile's fields list.
+func loadProfileField(raw any) (models.ProfileField, error) {
+	fv, ok := raw.(map[string]any)
+	if !ok {
+		return models.ProfileField{}, fmt.Errorf("unexpected type %T", raw)
+	}
+	fieldType, ok := fv["type"]
+	if !ok {
+		return models.ProfileField{}, fmt.Errorf("type is required")
+	}
+	field := models.ProfileField{
+		Type:  fmt.Sprint(fieldType),
+		Value: getString(fv, "value", ""),
+		CIDR:  getString(fv, "cidr", ""),
+	}
+	if c, ok := fv["constant"]; ok {
+		field.Constant = fmt.Sprint(c)
+	}
+	var err error
+	if l, ok := fv["length"].(string); ok && strings.EqualFold(l, "variable") {
+		field.Length = 65535 // the IPFIX variable-length marker
+	} else if field.Length, err = getInt(fv, "length", 0); err != nil {
+		return models.ProfileField{}, err
+	}
+	if field.Min, err = getInt(fv, "min", 0); err != nil {
+		return models.ProfileField{}, err
+	}
+	if field.Max, err = getInt(fv, "max", 0); err != nil {
+		return models.ProfileField{}, err
+	}
+	if field.Start, err = getInt(fv, "start", 0); err != nil {
+		return models.ProfileField{}, err
+	}
+	if field.Step, err = getInt(fv, "step", 1); err != nil {
+		return models.ProfileField{}, err
+	}
+	if field.Enterprise, err = getInt(fv, "enterprise", 0); err != nil {
+		return models.ProfileField{}, err
+	}
+	if raw, ok := fv["choices"]; ok {
+		choices, ok := raw.([]any)
+		if !ok {
+			return models.ProfileField{}, fmt.Errorf("choices must be a list")
+		}
+		for _, c := range choices {
+			field.Choices = append(field.Choices, fmt.Sprint(c))
+		}
+	}
+	if raw, ok := fv["list"]; ok {
+		if field.List, err = loadProfileList(raw); err != nil {
+			return models.ProfileField{}, fmt.Errorf("list: %w", err)
+		}
+	}
+	return field, nil
+}
+
+// loadProfileList converts the list of a basicList or subTemplateList field.
+func loadProfileList(raw any) (*models.ProfileList, error) {
+	lv, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T", raw)
+	}
+	list := &models.ProfileList{Semantic: getString(lv, "semantic", "")}
+	var err error
+	if list.Count, err = getInt(lv, "count", 1); err != nil {
+		return nil, err
+	}
+	if list.TemplateID, err = getInt(lv, "template-id", 0); err != nil {
+		return nil, err
+	}
+	rawFields, ok := lv["fields"].([]any)
+	if !ok || len(rawFields) == 0 {
+		return nil, fmt.Errorf("fields are required")
+	}
+	list.Fields = make([]models.ProfileField, len(rawFields))
+	for i, rf := range rawFields {
+		if list.Fields[i], err = loadProfileField(rf); err != nil {
+			return nil, fmt.Errorf("field %d: %w", i, err)
+		}
+	}
+	return list, nil
+}
@@ -7,8 +7,16 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"net"
 	"strconv"
+	"time"
+
+	"github.com/dmabry/flowgre/inspect"
+	"github.com/dmabry/flowgre/loadshape"
+	"github.com/dmabry/flowgre/pcap"
+	"github.com/dmabry/flowgre/replay"
+	"github.com/dmabry/flowgre/transport"
 )
 
 // ValidateRecord validates record command configuration.
@@ -25,6 +33,110 @@ func ValidateRecord(ip string, port int, dbdir string) error {
 	return nil
 }
 
+// ValidateCollect validates collect command configuration.
+func ValidateCollect(ip string, port int, interval int) error {
+	if err := validateListenerIP(ip); err != nil {
+		return fmt.Errorf("collect listener IP: %w", err)
+	}
+	if err := validatePort(port, false); err != nil {
+		return fmt.Errorf("collect listener port: %w", err)
+	}
+	if interval < 1 {
+		return fmt.Errorf("collect report interval must be at least 1 second, got %d", interval)
+	}
+	return nil
+}
+
+// ValidateInspect validates inspect command configuration.
+func ValidateInspect(dbdir string, from, to int, versions, format string) error {
+	if dbdir == "" {
+		return fmt.Errorf("inspect database directory is required")
+	}
+	if from < 0 || from > math.MaxUint32 || to < 0 || to > math.MaxUint32 {
+		return fmt.Errorf("inspect record keys must be between 0 and %d, got %d-%d", uint32(math.MaxUint32), from, to)
+	}
+	if to != 0 && to < from {
+		return fmt.Errorf("inspect record key range %d-%d ends before it starts", from, to)
+	}
+	if _, err := inspect.ParseVersions(versions); err != nil {
+		return fmt.Errorf("inspect versions: %w", err)
+	}
+	switch format {
+	case inspect.FormatText, inspect.FormatNDJSON, inspect.FormatCSV:
+	default:
+		return fmt.Errorf("inspect format must be %s, %s or %s, got %q", inspect.FormatText, inspect.FormatNDJSON, inspect.FormatCSV, format)
+	}
+	return nil
+}
+
+// ValidateExportPCAP validates export-pcap command configuration. An empty
+// format is chosen from the output file extension.
+func ValidateExportPCAP(dbdir, out, format string) error {
+	if dbdir == "" {
+		return fmt.Errorf("export-pcap database directory is required")
+	}
+	if out == "" {
+		return fmt.Errorf("export-pcap output file is required")
+	}
+	switch format {
+	case "", pcap.FormatPCAP, pcap.FormatPCAPNG:
+	default:
+		return fmt.Errorf("export-pcap format must be %s or %s, got %q", pcap.FormatPCAP, pcap.FormatPCAPNG, format)
+	}
+	return nil
+}
+
+// ValidateOutput validates the -output sink of a sending mode. Sending only
+// to the sink requires one.
+func ValidateOutput(output string, outputOnly bool) error {
+	if outputOnly && output == "" {
+		return fmt.Errorf("output-only requires an output sink")
+	}
+	return nil
+}
+
+// ValidateTransport validates the -transport of a sending mode. TCP and TLS
+// carry IPFIX only, as the other protocols define no stream framing.
+func ValidateTransport(network, protocol string) error {
+	switch network {
+	case "", transport.NetworkUDP:
+		return nil
+	case transport.NetworkTCP, transport.NetworkTLS:
+		if protocol != "ipfix" {
+			return fmt.Errorf("transport %s is only supported for ipfix, got protocol %q", network, protocol)
+		}
+		return nil
+	case transport.NetworkDTLS:
+		return transport.ErrDTLSUnsupported
+	default:
+		return fmt.Errorf("transport must be %s, %s or %s, got %q", transport.NetworkUDP, transport.NetworkTCP, transport.NetworkTLS, network)
+	}
+}
+
+// ValidateTransportTLS validates the TLS options of a sending mode. They
+// only apply to the tls transport, and a client certificate needs its key.
+func ValidateTransportTLS(network string, opts transport.TLSOptions) error {
+	if network != transport.NetworkTLS && opts != (transport.TLSOptions{}) {
+		return fmt.Errorf("transport TLS options require transport %s, got %q", transport.NetworkTLS, network)
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return fmt.Errorf("transport TLS certificate and key must be provided together")
+	}
+	return nil
+}
+
+// ValidateRecordTLS validates the TLS options of the record listener. The
+// certificate and key go together, and verifying clients needs both.
+func ValidateRecordTLS(opts transport.TLSOptions) error {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return fmt.Errorf("record TLS certificate and key must be provided together")
+	}
+	if opts.CAFile != "" && opts.CertFile == "" {
+		return fmt.Errorf("record TLS client CA requires a certificate and key")
+	}
+	return nil
+}
+
 // ValidateReplay validates replay command configuration.
 func ValidateReplay(server string, port int, delay int, dbdir string, workers int) error {
 	if err := validateDestIP(server); err != nil {
@@ -45,6 +157,48 @@ func ValidateReplay(server string, port int, delay int, dbdir string, workers in
 	return nil
 }
 
+// ValidateReplayTiming validates the replay timing flags. A speed other than
+// 1 only applies to original timing, and as-fast-as-possible replaces timing
+// altogether, so both are rejected where they would be ignored.
+func ValidateReplayTiming(timing string, speed float64, fast bool) error {
+	switch timing {
+	case replay.TimingFixed, replay.TimingOriginal:
+	default:
+		return fmt.Errorf("replay timing must be %s or %s, got %q", replay.TimingFixed, replay.TimingOriginal, timing)
+	}
+	if speed <= 0 {
+		return fmt.Errorf("replay speed must be positive, got %g", speed)
+	}
+	if speed != 1 && (timing != replay.TimingOriginal || fast) {
+		return fmt.Errorf("replay speed %gx requires -timing %s", speed, replay.TimingOriginal)
+	}
+	if fast && timing != replay.TimingFixed {
+		return fmt.Errorf("replay -as-fast-as-possible cannot be combined with -timing %s", timing)
+	}
+	return nil
+}
+
+// ValidateReplayFilter validates the UDP destination port and exporter
+// address or prefix replayed packets are filtered by; 0 and "" match all.
+func ValidateReplayFilter(port int, source string) error {
+	if err := validatePort(port, true); err != nil {
+		return fmt.Errorf("replay filter port: %w", err)
+	}
+	if _, err := replay.ParseSourceFilter(source); err != nil {
+		return fmt.Errorf("replay filter source: %w", err)
+	}
+	return nil
+}
+
+// ValidateReplayDomainOffset validates the offset replay adds to source IDs
+// and observation domain IDs, which are 32-bit.
+func ValidateReplayDomainOffset(offset int) error {
+	if offset < 0 || offset > math.MaxUint32 {
+		return fmt.Errorf("replay domain offset must be between 0 and %d, got %d", uint32(math.MaxUint32), offset)
+	}
+	return nil
+}
+
 // ValidateBarrage validates barrage command configuration.
 func ValidateBarrage(server string, port int, srcRange, dstRange string, workers, delay, templateInterval int) error {
 	if err := validateDestIP(server); err != nil {
@@ -71,6 +225,55 @@ func ValidateBarrage(server string, port int, srcRange, dstRange string, workers
 	return nil
 }
 
+// ValidateRates validates the barrage send rate targets. Each must be zero
+// (unset) or positive, and at most one may be set.
+func ValidateRates(flowsPerSecond, packetsPerSecond, bitsPerSecond int) error {
+	set := 0
+	for name, rate := range map[string]int{
+		"flows-per-second":   flowsPerSecond,
+		"packets-per-second": packetsPerSecond,
+		"bits-per-second":    bitsPerSecond,
+	} {
+		if rate < 0 {
+			return fmt.Errorf("barrage %s must be 0 (disabled) or positive, got %d", name, rate)
+		}
+		if rate > 0 {
+			set++
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("only one of flows-per-second, packets-per-second and bits-per-second may be set")
+	}
+	return nil
+}
+
+// ValidateLoadShape validates a barrage load shape. An empty shape is valid and
+// keeps the send rate constant.
+func ValidateLoadShape(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	if _, err := loadshape.Parse(spec); err != nil {
+		return fmt.Errorf("barrage load-shape: %w", err)
+	}
+	return nil
+}
+
+// ValidateLimits validates the barrage run-length limits. Each must be zero
+// (no limit) or positive.
+func ValidateLimits(duration time.Duration, maxPackets, maxFlows int) error {
+	if duration < 0 {
+		return fmt.Errorf("barrage duration must be 0 (no limit) or positive, got %s", duration)
+	}
+	if maxPackets < 0 {
+		return fmt.Errorf("barrage max-packets must be 0 (no limit) or positive, got %d", maxPackets)
+	}
+	if maxFlows < 0 {
+		return fmt.Errorf("barrage max-flows must be 0 (no limit) or positive, got %d", maxFlows)
+	}
+	return nil
+}
+
 // ValidateProxy validates proxy command configuration.
 func ValidateProxy(ip string, port int, targets []string) error {
 	if err := validateListenerIP(ip); err != nil {
@@ -3,7 +3,12 @@
 
 package config
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/dmabry/flowgre/transport"
+)
 
 func TestValidateRecord(t *testing.T) {
 	tests := []struct {
@@ -30,6 +35,176 @@ func TestValidateRecord(t *testing.T) {
 	}
 }
 
+func TestValidateCollect(t *testing.T) {
+	tests := []struct {
+		name     string
+		ip       string
+		port     int
+		interval int
+		wantErr  bool
+	}{
+		{"valid", "127.0.0.1", 9995, 10, false},
+		{"valid IPv6", "::1", 9995, 1, false},
+		{"invalid IP", "localhos", 9995, 10, true},
+		{"port zero", "127.0.0.1", 0, 10, true},
+		{"interval zero", "127.0.0.1", 9995, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCollect(tt.ip, tt.port, tt.interval)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCollect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateInspect(t *testing.T) {
+	tests := []struct {
+		name     string
+		dbdir    string
+		from     int
+		to       int
+		versions string
+		format   string
+		wantErr  bool
+	}{
+		{"valid", "/tmp/db", 0, 0, "", "text", false},
+		{"valid range and versions", "/tmp/db", 10, 20, "9,10,sflow", "csv", false},
+		{"valid open-ended range", "/tmp/db", 10, 0, "5", "ndjson", false},
+		{"empty dbdir", "", 0, 0, "", "text", true},
+		{"negative from", "/tmp/db", -1, 0, "", "text", true},
+		{"to before from", "/tmp/db", 20, 10, "", "text", true},
+		{"unknown version", "/tmp/db", 0, 0, "7", "text", true},
+		{"unknown format", "/tmp/db", 0, 0, "", "xml", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInspect(tt.dbdir, tt.from, tt.to, tt.versions, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateInspect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateExportPCAP(t *testing.T) {
+	tests := []struct {
+		name    string
+		dbdir   string
+		out     string
+		format  string
+		wantErr bool
+	}{
+		{"valid", "/tmp/db", "flows.pcap", "", false},
+		{"valid pcapng", "/tmp/db", "-", "pcapng", false},
+		{"empty dbdir", "", "flows.pcap", "", true},
+		{"empty output", "/tmp/db", "", "pcap", true},
+		{"unknown format", "/tmp/db", "flows.erf", "erf", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateExportPCAP(tt.dbdir, tt.out, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateExportPCAP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		outputOnly bool
+		wantErr    bool
+	}{
+		{"no output", "", false, false},
+		{"capture", "flows.pcap", false, false},
+		{"database only", "golden_flows", true, false},
+		{"only without output", "", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOutput(tt.output, tt.outputOnly)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  string
+		protocol string
+		wantErr  bool
+	}{
+		{"default", "", "netflow", false},
+		{"udp", "udp", "sflow", false},
+		{"tcp ipfix", "tcp", "ipfix", false},
+		{"tcp netflow", "tcp", "netflow", true},
+		{"tls ipfix", "tls", "ipfix", false},
+		{"tls sflow", "tls", "sflow", true},
+		{"dtls", "dtls", "ipfix", true},
+		{"unknown", "sctp", "ipfix", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTransport(tt.network, tt.protocol)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTransport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTransportTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		opts    transport.TLSOptions
+		wantErr bool
+	}{
+		{"udp without options", "udp", transport.TLSOptions{}, false},
+		{"tls without options", "tls", transport.TLSOptions{}, false},
+		{"tls client cert", "tls", transport.TLSOptions{CertFile: "c.pem", KeyFile: "k.pem", CAFile: "ca.pem", ServerName: "collector"}, false},
+		{"tls cert without key", "tls", transport.TLSOptions{CertFile: "c.pem"}, true},
+		{"tcp with options", "tcp", transport.TLSOptions{CAFile: "ca.pem"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTransportTLS(tt.network, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTransportTLS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRecordTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    transport.TLSOptions
+		wantErr bool
+	}{
+		{"plain", transport.TLSOptions{}, false},
+		{"server cert", transport.TLSOptions{CertFile: "c.pem", KeyFile: "k.pem"}, false},
+		{"client CA", transport.TLSOptions{CertFile: "c.pem", KeyFile: "k.pem", CAFile: "ca.pem"}, false},
+		{"key without cert", transport.TLSOptions{KeyFile: "k.pem"}, true},
+		{"client CA without cert", transport.TLSOptions{CAFile: "ca.pem"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRecordTLS(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRecordTLS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateReplay(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -60,6 +235,82 @@ func TestValidateReplay(t *testing.T) {
 	}
 }
 
+func TestValidateReplayTiming(t *testing.T) {
+	tests := []struct {
+		name    string
+		timing  string
+		speed   float64
+		fast    bool
+		wantErr bool
+	}{
+		{"fixed", "fixed", 1, false, false},
+		{"original", "original", 1, false, false},
+		{"original half speed", "original", 0.5, false, false},
+		{"original 10x", "original", 10, false, false},
+		{"as fast as possible", "fixed", 1, true, false},
+		{"unknown timing", "realtime", 1, false, true},
+		{"empty timing", "", 1, false, true},
+		{"speed zero", "original", 0, false, true},
+		{"speed with fixed timing", "fixed", 2, false, true},
+		{"speed with as fast as possible", "original", 2, true, true},
+		{"original with as fast as possible", "original", 1, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateReplayTiming(tt.timing, tt.speed, tt.fast)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateReplayTiming() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReplayDomainOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		offset  int
+		wantErr bool
+	}{
+		{"zero", 0, false},
+		{"offset", 1000, false},
+		{"max", 4294967295, false},
+		{"negative", -1, true},
+		{"too large", 4294967296, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateReplayDomainOffset(tt.offset)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateReplayDomainOffset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReplayFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		port    int
+		source  string
+		wantErr bool
+	}{
+		{"no filter", 0, "", false},
+		{"port and address", 2055, "192.0.2.1", false},
+		{"prefix", 0, "2001:db8::/32", false},
+		{"negative port", -1, "", true},
+		{"port too large", 65536, "", true},
+		{"bad source", 0, "exporter1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateReplayFilter(tt.port, tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateReplayFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateBarrage(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -93,6 +344,78 @@ func TestValidateBarrage(t *testing.T) {
 	}
 }
 
+func TestValidateRates(t *testing.T) {
+	tests := []struct {
+		name    string
+		flows   int
+		packets int
+		bits    int
+		wantErr bool
+	}{
+		{"none", 0, 0, 0, false},
+		{"flows", 10000, 0, 0, false},
+		{"packets", 0, 500, 0, false},
+		{"bits", 0, 0, 100_000_000, false},
+		{"negative", -1, 0, 0, true},
+		{"two set", 10000, 500, 0, true},
+		{"all set", 1, 1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRates(tt.flows, tt.packets, tt.bits)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLoadShape(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{"none", "", false},
+		{"ramp", "ramp:10:100:5m", false},
+		{"steps", "steps:25,50,100:1m", false},
+		{"unknown", "square:10:100:1m", true},
+		{"bad duration", "ramp:10:100:soon", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLoadShape(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateLoadShape() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		duration   time.Duration
+		maxPackets int
+		maxFlows   int
+		wantErr    bool
+	}{
+		{"none", 0, 0, 0, false},
+		{"all set", time.Minute, 1000, 50000, false},
+		{"negative duration", -time.Second, 0, 0, true},
+		{"negative packets", 0, -1, 0, true},
+		{"negative flows", 0, 0, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLimits(tt.duration, tt.maxPackets, tt.maxFlows)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateProxy(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,202 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package decode fully decodes NetFlow v9 and IPFIX messages. Templates are
+// cached per exporter address, source ID or observation domain and template ID,
+// so data sets can be decoded in later messages from the same exporter.
+package decode
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dmabry/flowgre/ipfix"
+)
+
+// Protocol versions handled by the decoder.
+const (
+	VersionNetFlow = 9
+	VersionIPFIX   = 10
+)
+
+// ErrUnsupportedVersion is returned for messages that are not NetFlow v9 or IPFIX.
+var ErrUnsupportedVersion = errors.New("unsupported flow version")
+
+// VariableLength is the IPFIX field length marking a variable-length field (RFC 7011 §7).
+const VariableLength = 0xFFFF
+
+// Field is a template field specifier.
+type Field struct {
+	Type             uint16
+	Length           uint16 // VariableLength for IPFIX variable-length fields
+	EnterpriseNumber uint32 // IPFIX only; 0 for IANA elements
+}
+
+// Template is a decoded template or options template.
+type Template struct {
+	ID              uint16
+	Options         bool
+	ScopeFieldCount int // leading scope fields of an options template
+	Fields          []Field
+}
+
+// minRecordLength returns the smallest encoding of a record. With variable set,
+// as in IPFIX, variable-length fields take at least their 1-byte length prefix.
+func (t Template) minRecordLength(variable bool) int {
+	n := 0
+	for _, f := range t.Fields {
+		if variable && f.Length == VariableLength {
+			n++
+		} else {
+			n += int(f.Length)
+		}
+	}
+	return n
+}
+
+// Value is one decoded field of a data record.
+type Value struct {
+	Field Field
+	Data  []byte // slice of the decoded payload, so writes to it modify the payload
+}
+
+// Uint returns the value as a big-endian unsigned integer. Values longer than
+// 8 bytes return only their trailing 8 bytes.
+func (v Value) Uint() uint64 {
+	var n uint64
+	for _, b := range v.Data {
+		n = n<<8 | uint64(b)
+	}
+	return n
+}
+
+// Record is a decoded data record, one value per template field.
+type Record []Value
+
+// DataSet is a data FlowSet (NetFlow v9) or Data Set (IPFIX).
+type DataSet struct {
+	TemplateID uint16
+	// Template is nil when no template has been received for TemplateID yet,
+	// in which case Records is empty.
+	Template *Template
+	Records  []Record
+}
+
+// Message is a decoded NetFlow v9 or IPFIX message.
+type Message struct {
+	Version    uint16
+	Exporter   string
+	DomainID   uint32 // source ID (NetFlow v9) or observation domain ID (IPFIX)
+	Sequence   uint32
+	ExportTime time.Time
+	SysUptime  uint32 // NetFlow v9 only, in milliseconds
+	Count      uint16 // NetFlow v9 only: records in the packet
+	Templates  []Template
+	Withdrawn  []uint16 // IPFIX template IDs withdrawn by this message
+	DataSets   []DataSet
+}
+
+// DataRecords returns the number of decoded data records. When flow is true
+// only records of flow templates are counted, otherwise only options records.
+func (m *Message) DataRecords(flow bool) int {
+	n := 0
+	for _, ds := range m.DataSets {
+		if ds.Template != nil && ds.Template.Options != flow {
+			n += len(ds.Records)
+		}
+	}
+	return n
+}
+
+// MissingTemplates returns the number of data sets that could not be decoded
+// because their template had not been received yet.
+func (m *Message) MissingTemplates() int {
+	n := 0
+	for _, ds := range m.DataSets {
+		if ds.Template == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// templateKey identifies a template within an exporter's observation domain.
+type templateKey struct {
+	exporter   string
+	domainID   uint32
+	version    uint16
+	templateID uint16
+}
+
+// Decoder decodes messages and caches the templates they carry. It is safe
+// for concurrent use.
+type Decoder struct {
+	mu        sync.Mutex
+	templates map[templateKey]Template
+}
+
+// NewDecoder returns a Decoder with an empty template cache.
+func NewDecoder() *Decoder {
+	return &Decoder{templates: make(map[templateKey]Template)}
+}
+
+// Decode decodes a NetFlow v9 or IPFIX message received from exporter, which
+// is usually the sender's address. Templates in the message are cached before
+// its data sets are decoded.
+func (d *Decoder) Decode(exporter string, payload []byte) (*Message, error) {
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("payload too short for flow header: %d bytes", len(payload))
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch version := binary.BigEndian.Uint16(payload[0:2]); version {
+	case VersionNetFlow:
+		return d.decodeNetFlow(exporter, payload)
+	case VersionIPFIX:
+		return d.decodeIPFIX(exporter, payload)
+	default:
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, version)
+	}
+}
+
+// Templates returns the number of cached templates.
+func (d *Decoder) Templates() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.templates)
+}
+
+// decodeRecords decodes the records of a data set body using t. Trailing bytes
+// too short for another record are padding. Only IPFIX sets variable, since
+// NetFlow v9 (RFC 3954) has no variable-length encoding and a field of length
+// VariableLength is simply that long.
+func decodeRecords(t Template, body []byte, variable bool) ([]Record, error) {
+	var records []Record
+	minLen := t.minRecordLength(variable)
+	if minLen == 0 {
+		return nil, fmt.Errorf("template %d has zero-length records", t.ID)
+	}
+	for len(body) >= minLen {
+		record := make(Record, len(t.Fields))
+		for i, f := range t.Fields {
+			length := int(f.Length)
+			if variable && f.Length == VariableLength {
+				n, prefix, err := ipfix.ReadVariableLength(body)
+				if err != nil {
+					return nil, fmt.Errorf("template %d field %d: %w", t.ID, i, err)
+				}
+				length, body = n, body[prefix:]
+			}
+			if len(body) < length {
+				return nil, fmt.Errorf("template %d field %d: record truncated", t.ID, i)
+			}
+			record[i] = Value{Field: f, Data: body[:length:length]}
+			body = body[length:]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,355 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/dmabry/flowgre/decode/decodetest"
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflow"
+)
+
+func TestDecodeRoundTrip(t *testing.T) {
+	t.Parallel()
+	nf := decodetest.NetFlow(t, 42, "10.0.0.0/8", 10)
+	nfTemplate, nfData := nf[0], nf[1]
+	ix := decodetest.IPFIX(t, 42, "10.0.0.0/8", 10)
+	ipfixTemplate, ipfixData := ix[0], ix[1]
+
+	tests := []struct {
+		name          string
+		template      []byte
+		data          []byte
+		version       uint16
+		wantTemplates int
+	}{
+		{name: "netflow v9", template: nfTemplate, data: nfData, version: VersionNetFlow, wantTemplates: 1},
+		{name: "ipfix", template: ipfixTemplate, data: ipfixData, version: VersionIPFIX, wantTemplates: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := NewDecoder()
+
+			msg, err := d.Decode("192.0.2.1:2055", tt.template)
+			if err != nil {
+				t.Fatalf("Decode template: %v", err)
+			}
+			if msg.Version != tt.version || msg.DomainID != 42 {
+				t.Errorf("Got: version %d domain %d Want: version %d domain 42", msg.Version, msg.DomainID, tt.version)
+			}
+			if len(msg.Templates) != tt.wantTemplates {
+				t.Fatalf("Got: %d templates Want: %d", len(msg.Templates), tt.wantTemplates)
+			}
+
+			msg, err = d.Decode("192.0.2.1:2055", tt.data)
+			if err != nil {
+				t.Fatalf("Decode data: %v", err)
+			}
+			if got := msg.DataRecords(true); got != 10 {
+				t.Errorf("Got: %d flow records Want: 10", got)
+			}
+			if got := msg.MissingTemplates(); got != 0 {
+				t.Errorf("Got: %d missing templates Want: 0", got)
+			}
+			ds := msg.DataSets[0]
+			for i, record := range ds.Records {
+				if len(record) != len(ds.Template.Fields) {
+					t.Fatalf("record %d: Got: %d values Want: %d", i, len(record), len(ds.Template.Fields))
+				}
+				for j, v := range record {
+					if len(v.Data) != int(v.Field.Length) {
+						t.Errorf("record %d value %d: Got: %d bytes Want: %d", i, j, len(v.Data), v.Field.Length)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeMissingTemplate(t *testing.T) {
+	t.Parallel()
+	nf := decodetest.NetFlow(t, 1, "10.0.0.0/8", 5)
+	nfTemplate, nfData := nf[0], nf[1]
+	d := NewDecoder()
+
+	msg, err := d.Decode("192.0.2.1:2055", nfData)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := msg.MissingTemplates(); got != 1 {
+		t.Errorf("Got: %d missing templates Want: 1", got)
+	}
+	if got := msg.DataRecords(true); got != 0 {
+		t.Errorf("Got: %d flow records Want: 0", got)
+	}
+
+	// Templates are scoped to the exporter that sent them
+	if _, err := d.Decode("192.0.2.2:2055", nfTemplate); err != nil {
+		t.Fatalf("Decode template: %v", err)
+	}
+	msg, err = d.Decode("192.0.2.1:2055", nfData)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := msg.MissingTemplates(); got != 1 {
+		t.Errorf("Got: %d missing templates for another exporter's template Want: 1", got)
+	}
+}
+
+func TestDecodeIPFIXOptions(t *testing.T) {
+	t.Parallel()
+	seq := ipfix.NewIPFIXSequence()
+	tmpl := ipfix.GenerateTemplateIPFIX(7, seq)
+	tmplBuf, err := tmpl.ToBytes()
+	if err != nil {
+		t.Fatalf("template ToBytes: %v", err)
+	}
+	opts := ipfix.GenerateOptionsDataIPFIX(7, seq)
+	optsBuf, err := opts.ToBytes()
+	if err != nil {
+		t.Fatalf("options ToBytes: %v", err)
+	}
+
+	d := NewDecoder()
+	msg, err := d.Decode("192.0.2.1:4739", tmplBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode template: %v", err)
+	}
+	var options *Template
+	for i := range msg.Templates {
+		if msg.Templates[i].Options {
+			options = &msg.Templates[i]
+		}
+	}
+	if options == nil || options.ID != ipfix.OptionsTemplateID || options.ScopeFieldCount == 0 {
+		t.Fatalf("Got: options template %+v Want: ID %d with scope fields", options, ipfix.OptionsTemplateID)
+	}
+
+	msg, err = d.Decode("192.0.2.1:4739", optsBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode options data: %v", err)
+	}
+	if got := msg.DataRecords(false); got != 1 {
+		t.Errorf("Got: %d options records Want: 1", got)
+	}
+	if got := msg.DataRecords(true); got != 0 {
+		t.Errorf("Got: %d flow records Want: 0", got)
+	}
+}
+
+func TestDecodeNetFlowOptions(t *testing.T) {
+	t.Parallel()
+	opts := netflow.GenerateOptionsNetflow(7, netflow.NewSession())
+	buf := opts.ToBytes()
+
+	msg, err := NewDecoder().Decode("192.0.2.1:2055", buf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(msg.Templates) != 2 || !msg.Templates[0].Options || msg.Templates[1].ScopeFieldCount != 1 {
+		t.Fatalf("Got: templates %+v Want: two options templates with one scope field", msg.Templates)
+	}
+	if got := msg.DataRecords(false); got != 64 {
+		t.Errorf("Got: %d options records Want: 64", got)
+	}
+	if got := msg.DataRecords(true); got != 0 {
+		t.Errorf("Got: %d flow records Want: 0", got)
+	}
+}
+
+func TestDecodeIPFIXEnterpriseAndVariableLength(t *testing.T) {
+	t.Parallel()
+	// Template 300: enterprise field 1 (PEN 29305, 4 bytes) and a variable-length
+	// interfaceName (82) field.
+	template := []byte{
+		0x00, 0x0a, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, // header
+		0x00, 0x02, 0x00, 0x14, // template set, length 20
+		0x01, 0x2c, 0x00, 0x02, // template 300, 2 fields
+		0x80, 0x01, 0x00, 0x04, 0x00, 0x00, 0x72, 0x79, // enterprise field
+		0x00, 0x52, 0xff, 0xff, // variable-length field
+	}
+	binary.BigEndian.PutUint16(template[2:4], uint16(len(template)))
+
+	data := []byte{
+		0x00, 0x0a, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, // header
+		0x01, 0x2c, 0x00, 0x13, // data set 300, length 19
+		0xde, 0xad, 0xbe, 0xef, 0x03, 'e', 't', 'h', // record 1
+		0x00, 0x00, 0x00, 0x01, 0xff, 0x00, 0x00, // record 2, 3-byte length of 0
+	}
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)))
+
+	d := NewDecoder()
+	msg, err := d.Decode("exporter", template)
+	if err != nil {
+		t.Fatalf("Decode template: %v", err)
+	}
+	f := msg.Templates[0].Fields[0]
+	if f.Type != 1 || f.EnterpriseNumber != 29305 {
+		t.Errorf("Got: type %d enterprise %d Want: type 1 enterprise 29305", f.Type, f.EnterpriseNumber)
+	}
+
+	msg, err = d.Decode("exporter", data)
+	if err != nil {
+		t.Fatalf("Decode data: %v", err)
+	}
+	records := msg.DataSets[0].Records
+	if len(records) != 2 {
+		t.Fatalf("Got: %d records Want: 2", len(records))
+	}
+	if got := records[0][0].Uint(); got != 0xdeadbeef {
+		t.Errorf("Got: %#x Want: 0xdeadbeef", got)
+	}
+	if got := string(records[0][1].Data); got != "eth" {
+		t.Errorf("Got: %q Want: %q", got, "eth")
+	}
+	if got := len(records[1][1].Data); got != 0 {
+		t.Errorf("Got: %d bytes Want: 0", got)
+	}
+}
+
+func TestDecodeRecordsVariableLength(t *testing.T) {
+	t.Parallel()
+	tmpl := Template{ID: 256, Fields: []Field{{Type: 82, Length: VariableLength}}}
+	body := []byte{0x03, 'e', 't', 'h'}
+
+	// IPFIX reads a length prefix
+	records, err := decodeRecords(tmpl, body, true)
+	if err != nil || len(records) != 1 || string(records[0][0].Data) != "eth" {
+		t.Errorf("Got: %v, %v Want: one record holding %q", records, err, "eth")
+	}
+	// NetFlow v9 has no variable-length encoding: the field is 65535 bytes
+	// long and the short body is padding
+	records, err = decodeRecords(tmpl, body, false)
+	if err != nil || len(records) != 0 {
+		t.Errorf("Got: %v, %v Want: no records", records, err)
+	}
+}
+
+func TestDecodeIPFIXWithdrawal(t *testing.T) {
+	t.Parallel()
+	packets := decodetest.IPFIX(t, 1, "10.0.0.0/8", 3)
+	template, data := packets[0], packets[1]
+	withdrawal := []byte{
+		0x00, 0x0a, 0x00, 0x18, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, // header
+		0x00, 0x02, 0x00, 0x08, 0x01, 0x00, 0x00, 0x00, // withdraw template 256
+	}
+
+	d := NewDecoder()
+	for _, payload := range [][]byte{template, withdrawal} {
+		if _, err := d.Decode("exporter", payload); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+	}
+	msg, err := d.Decode("exporter", data)
+	if err != nil {
+		t.Fatalf("Decode data: %v", err)
+	}
+	if got := msg.MissingTemplates(); got != 1 {
+		t.Errorf("Got: %d missing templates after withdrawal Want: 1", got)
+	}
+}
+
+func TestDecodeIPFIXWithdrawAll(t *testing.T) {
+	t.Parallel()
+	seq := ipfix.NewIPFIXSequence()
+	tmpl := ipfix.GenerateTemplateIPFIX(1, seq)
+	tmplBuf, err := tmpl.ToBytes()
+	if err != nil {
+		t.Fatalf("template ToBytes: %v", err)
+	}
+	opts := ipfix.GenerateOptionsDataIPFIX(1, seq)
+	optsBuf, err := opts.ToBytes()
+	if err != nil {
+		t.Fatalf("options ToBytes: %v", err)
+	}
+	data := decodetest.IPFIX(t, 1, "10.0.0.0/8", 3)[1]
+	withdrawAll := []byte{
+		0x00, 0x0a, 0x00, 0x1c, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, // header
+		0x00, 0x02, 0x00, 0x0c, 0x00, 0x02, 0x00, 0x00, // withdraw all templates
+		0x00, 0x00, 0x00, 0x00, // padding
+	}
+
+	d := NewDecoder()
+	if _, err := d.Decode("exporter", tmplBuf.Bytes()); err != nil {
+		t.Fatalf("Decode template: %v", err)
+	}
+	msg, err := d.Decode("exporter", withdrawAll)
+	if err != nil {
+		t.Fatalf("Decode withdrawal: %v", err)
+	}
+	if len(msg.Withdrawn) != 1 || msg.Withdrawn[0] != ipfix.DefaultTemplateID {
+		t.Errorf("Got: withdrawn %v Want: [%d]", msg.Withdrawn, ipfix.DefaultTemplateID)
+	}
+	msg, err = d.Decode("exporter", data)
+	if err != nil {
+		t.Fatalf("Decode data: %v", err)
+	}
+	if got := msg.MissingTemplates(); got != 1 {
+		t.Errorf("Got: %d missing templates after withdrawal Want: 1", got)
+	}
+	// Options templates are withdrawn by their own set ID only
+	msg, err = d.Decode("exporter", optsBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode options data: %v", err)
+	}
+	if got := msg.DataRecords(false); got != 1 {
+		t.Errorf("Got: %d options records Want: 1", got)
+	}
+}
+
+func TestDecodeIPFIXTemplatePadding(t *testing.T) {
+	t.Parallel()
+	padded := []byte{
+		0x00, 0x0a, 0x00, 0x20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, // header
+		0x00, 0x02, 0x00, 0x10, // template set
+		0x01, 0x2c, 0x00, 0x01, 0x00, 0x08, 0x00, 0x04, // template 300: sourceIPv4Address
+		0x00, 0x00, 0x00, 0x00, // padding
+	}
+
+	msg, err := NewDecoder().Decode("exporter", padded)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(msg.Templates) != 1 || msg.Templates[0].ID != 300 {
+		t.Errorf("Got: templates %+v Want: template 300", msg.Templates)
+	}
+	if len(msg.Withdrawn) != 0 {
+		t.Errorf("Got: withdrawn %v Want: none", msg.Withdrawn)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	t.Parallel()
+	nfData := decodetest.NetFlow(t, 1, "10.0.0.0/8", 2)[1]
+	v5 := make([]byte, 24)
+	binary.BigEndian.PutUint16(v5[0:2], 5)
+
+	tests := []struct {
+		name        string
+		payload     []byte
+		unsupported bool
+	}{
+		{name: "empty", payload: nil},
+		{name: "netflow v5", payload: v5, unsupported: true},
+		{name: "truncated netflow v9", payload: nfData[:len(nfData)-3]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := NewDecoder().Decode("exporter", tt.payload)
+			if err == nil {
+				t.Fatal("Got: nil error Want: error")
+			}
+			if got := errors.Is(err, ErrUnsupportedVersion); got != tt.unsupported {
+				t.Errorf("Got: unsupported %v Want: %v (%v)", got, tt.unsupported, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package decodetest builds NetFlow v9 and IPFIX packets for tests of the
+// packages that decode them.
+package decodetest
+
+import (
+	"testing"
+
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflow"
+)
+
+// NetFlow returns a NetFlow v9 template packet from sourceID followed by a
+// data packet of each of flowCounts flows, between addresses in cidr.
+func NetFlow(t testing.TB, sourceID int, cidr string, flowCounts ...int) [][]byte {
+	t.Helper()
+	session := netflow.NewSession()
+	tmpl := netflow.GenerateTemplateNetflow(sourceID, session)
+	buf := tmpl.ToBytes()
+	packets := [][]byte{buf.Bytes()}
+	for _, flows := range flowCounts {
+		data, err := netflow.GenerateDataNetflow(flows, sourceID, cidr, cidr, 443, session)
+		if err != nil {
+			t.Fatalf("GenerateDataNetflow: %v", err)
+		}
+		buf := data.ToBytes()
+		packets = append(packets, buf.Bytes())
+	}
+	return packets
+}
+
+// IPFIX returns an IPFIX template message for domainID followed by a data
+// message of each of flowCounts records, between addresses in cidr.
+func IPFIX(t testing.TB, domainID int, cidr string, flowCounts ...int) [][]byte {
+	t.Helper()
+	seq := ipfix.NewIPFIXSequence()
+	tmpl := ipfix.GenerateTemplateIPFIX(domainID, seq)
+	buf, err := tmpl.ToBytes()
+	if err != nil {
+		t.Fatalf("template ToBytes: %v", err)
+	}
+	packets := [][]byte{buf.Bytes()}
+	for _, flows := range flowCounts {
+		data, err := ipfix.GenerateDataIPFIX(flows, domainID, cidr, cidr, 443, seq)
+		if err != nil {
+			t.Fatalf("GenerateDataIPFIX: %v", err)
+		}
+		buf, err := data.ToBytes()
+		if err != nil {
+			t.Fatalf("data ToBytes: %v", err)
+		}
+		packets = append(packets, buf.Bytes())
+	}
+	return packets
+}
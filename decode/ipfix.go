@@ -0,0 +1,120 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dmabry/flowgre/ipfix"
+)
+
+// enterpriseBit marks an IPFIX field specifier followed by an enterprise number.
+const enterpriseBit = 0x8000
+
+// decodeIPFIX decodes an IPFIX message. Must be called with d.mu held.
+func (d *Decoder) decodeIPFIX(exporter string, payload []byte) (*Message, error) {
+	if _, err := ipfix.IsValidIPFIX(payload); err != nil {
+		return nil, err
+	}
+	msg := &Message{
+		Version:    VersionIPFIX,
+		Exporter:   exporter,
+		ExportTime: time.Unix(int64(binary.BigEndian.Uint32(payload[4:8])), 0),
+		Sequence:   binary.BigEndian.Uint32(payload[8:12]),
+		DomainID:   binary.BigEndian.Uint32(payload[12:16]),
+	}
+
+	for offset := ipfix.HeaderSize; offset+4 <= len(payload); {
+		setID := binary.BigEndian.Uint16(payload[offset : offset+2])
+		setLength := int(binary.BigEndian.Uint16(payload[offset+2 : offset+4]))
+		body := payload[offset+4 : offset+setLength]
+		offset += setLength
+
+		switch setID {
+		case ipfix.SetIDTemplate, ipfix.SetIDOptionsTemplate:
+			if err := d.ipfixTemplates(msg, setID, body); err != nil {
+				return nil, err
+			}
+		default:
+			ds, err := d.dataSet(msg, setID, body)
+			if err != nil {
+				return nil, err
+			}
+			msg.DataSets = append(msg.DataSets, ds)
+		}
+	}
+	return msg, nil
+}
+
+// ipfixTemplates parses the records of a Template or Options Template Set,
+// caching new templates and dropping withdrawn ones. Must be called with d.mu held.
+func (d *Decoder) ipfixTemplates(msg *Message, setID uint16, body []byte) error {
+	options := setID == ipfix.SetIDOptionsTemplate
+	for len(body) >= 4 {
+		t := Template{ID: binary.BigEndian.Uint16(body[0:2]), Options: options}
+		fieldCount := int(binary.BigEndian.Uint16(body[2:4]))
+		if t.ID == setID && fieldCount == 0 {
+			// All templates withdrawal (RFC 7011 §8.1)
+			d.withdrawAll(msg, options)
+			body = body[4:]
+			continue
+		}
+		if t.ID < 256 {
+			break // padding
+		}
+		body = body[4:]
+		if fieldCount == 0 {
+			// Template withdrawal (RFC 7011 §8.1)
+			delete(d.templates, templateKey{msg.Exporter, msg.DomainID, msg.Version, t.ID})
+			msg.Withdrawn = append(msg.Withdrawn, t.ID)
+			continue
+		}
+		if options {
+			if len(body) < 2 {
+				return fmt.Errorf("options template %d: missing scope field count", t.ID)
+			}
+			t.ScopeFieldCount = int(binary.BigEndian.Uint16(body[0:2]))
+			body = body[2:]
+		}
+		t.Fields = make([]Field, fieldCount)
+		for i := range t.Fields {
+			if len(body) < 4 {
+				return fmt.Errorf("template %d: field specifier %d truncated", t.ID, i)
+			}
+			f := Field{
+				Type:   binary.BigEndian.Uint16(body[0:2]),
+				Length: binary.BigEndian.Uint16(body[2:4]),
+			}
+			body = body[4:]
+			if f.Type&enterpriseBit != 0 {
+				if len(body) < 4 {
+					return fmt.Errorf("template %d: enterprise number of field %d truncated", t.ID, i)
+				}
+				f.Type &^= enterpriseBit
+				f.EnterpriseNumber = binary.BigEndian.Uint32(body[0:4])
+				body = body[4:]
+			}
+			t.Fields[i] = f
+		}
+		d.addTemplates(msg, []Template{t})
+	}
+	return nil
+}
+
+// withdrawAll drops every cached template, or every options template, of the
+// message's observation domain. Must be called with d.mu held.
+func (d *Decoder) withdrawAll(msg *Message, options bool) {
+	var withdrawn []uint16
+	for k, t := range d.templates {
+		if k.exporter == msg.Exporter && k.domainID == msg.DomainID && k.version == msg.Version && t.Options == options {
+			delete(d.templates, k)
+			withdrawn = append(withdrawn, k.templateID)
+		}
+	}
+	slices.Sort(withdrawn)
+	msg.Withdrawn = append(msg.Withdrawn, withdrawn...)
+}
@@ -0,0 +1,145 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/dmabry/flowgre/netflow"
+)
+
+// NetFlow v9 FlowSet IDs (RFC 3954 §5.2).
+const (
+	netflowTemplateSetID = 0
+	netflowOptionsSetID  = 1
+)
+
+// netflowHeaderLength is the size of the NetFlow v9 packet header.
+const netflowHeaderLength = 20
+
+// decodeNetFlow decodes a NetFlow v9 export packet. Must be called with d.mu held.
+func (d *Decoder) decodeNetFlow(exporter string, payload []byte) (*Message, error) {
+	if _, err := netflow.IsValidNetFlow(payload, VersionNetFlow); err != nil {
+		return nil, err
+	}
+	msg := &Message{
+		Version:    VersionNetFlow,
+		Exporter:   exporter,
+		Count:      binary.BigEndian.Uint16(payload[2:4]),
+		SysUptime:  binary.BigEndian.Uint32(payload[4:8]),
+		ExportTime: time.Unix(int64(binary.BigEndian.Uint32(payload[8:12])), 0),
+		Sequence:   binary.BigEndian.Uint32(payload[12:16]),
+		DomainID:   binary.BigEndian.Uint32(payload[16:20]),
+	}
+
+	for offset := netflowHeaderLength; offset+4 <= len(payload); {
+		setID := binary.BigEndian.Uint16(payload[offset : offset+2])
+		setLength := int(binary.BigEndian.Uint16(payload[offset+2 : offset+4]))
+		body := payload[offset+4 : offset+setLength]
+		offset += setLength
+
+		switch setID {
+		case netflowTemplateSetID:
+			templates, err := netflowTemplates(body)
+			if err != nil {
+				return nil, err
+			}
+			d.addTemplates(msg, templates)
+		case netflowOptionsSetID:
+			templates, err := netflowOptionsTemplates(body)
+			if err != nil {
+				return nil, err
+			}
+			d.addTemplates(msg, templates)
+		default:
+			ds, err := d.dataSet(msg, setID, body)
+			if err != nil {
+				return nil, err
+			}
+			msg.DataSets = append(msg.DataSets, ds)
+		}
+	}
+	return msg, nil
+}
+
+// netflowTemplates parses the records of a Template FlowSet. A record with a
+// template ID below 256 can only be padding and ends the FlowSet.
+func netflowTemplates(body []byte) ([]Template, error) {
+	var templates []Template
+	for len(body) >= 4 {
+		t := Template{ID: binary.BigEndian.Uint16(body[0:2])}
+		if t.ID < 256 {
+			break
+		}
+		fieldCount := int(binary.BigEndian.Uint16(body[2:4]))
+		body = body[4:]
+		if len(body) < fieldCount*4 {
+			return nil, fmt.Errorf("template %d: %d fields exceed the FlowSet", t.ID, fieldCount)
+		}
+		t.Fields, body = netflowFields(body, fieldCount)
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// netflowOptionsTemplates parses the records of an Options Template FlowSet,
+// whose scope and option lengths are given in bytes.
+func netflowOptionsTemplates(body []byte) ([]Template, error) {
+	var templates []Template
+	for len(body) >= 6 {
+		t := Template{ID: binary.BigEndian.Uint16(body[0:2]), Options: true}
+		if t.ID < 256 {
+			break
+		}
+		scopeLength := int(binary.BigEndian.Uint16(body[2:4]))
+		optionLength := int(binary.BigEndian.Uint16(body[4:6]))
+		body = body[6:]
+		if scopeLength%4 != 0 || optionLength%4 != 0 || len(body) < scopeLength+optionLength {
+			return nil, fmt.Errorf("options template %d: invalid scope length %d or option length %d", t.ID, scopeLength, optionLength)
+		}
+		t.ScopeFieldCount = scopeLength / 4
+		t.Fields, body = netflowFields(body, (scopeLength+optionLength)/4)
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// netflowFields parses count type/length field specifiers from the start of body.
+func netflowFields(body []byte, count int) ([]Field, []byte) {
+	fields := make([]Field, count)
+	for i := range fields {
+		fields[i] = Field{
+			Type:   binary.BigEndian.Uint16(body[0:2]),
+			Length: binary.BigEndian.Uint16(body[2:4]),
+		}
+		body = body[4:]
+	}
+	return fields, body
+}
+
+// addTemplates caches templates and records them on msg. Must be called with d.mu held.
+func (d *Decoder) addTemplates(msg *Message, templates []Template) {
+	for _, t := range templates {
+		d.templates[templateKey{msg.Exporter, msg.DomainID, msg.Version, t.ID}] = t
+		msg.Templates = append(msg.Templates, t)
+	}
+}
+
+// dataSet decodes a data set with the cached template for setID. Must be called with d.mu held.
+func (d *Decoder) dataSet(msg *Message, setID uint16, body []byte) (DataSet, error) {
+	ds := DataSet{TemplateID: setID}
+	t, ok := d.templates[templateKey{msg.Exporter, msg.DomainID, msg.Version, setID}]
+	if !ok {
+		return ds, nil
+	}
+	records, err := decodeRecords(t, body, msg.Version == VersionIPFIX)
+	if err != nil {
+		return ds, err
+	}
+	ds.Template = &t
+	ds.Records = records
+	return ds, nil
+}
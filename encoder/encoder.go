@@ -0,0 +1,183 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package encoder turns a template (an ordered list of fields) plus one value
+// source per field into a wire-format flow record. It is protocol neutral:
+// NetFlow v9 and IPFIX profiles describe their records as data and use the
+// encoder instead of hand-written structs whose layout must mirror the template.
+package encoder
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/dmabry/flowgre/utils"
+)
+
+// VariableLength is the length of an IPFIX variable-length field (RFC 7011
+// Section 7). Its value is encoded with a length prefix in each record.
+const VariableLength = 0xFFFF
+
+// Field describes a single template field: its element ID and encoded length in bytes.
+type Field struct {
+	Type   uint16
+	Length uint16
+}
+
+// Flow is the per-record context that value sources draw from. It carries the
+// addressing picked for the record so address, port and protocol fields stay
+// consistent with each other.
+type Flow struct {
+	SrcIP    net.IP
+	DstIP    net.IP
+	SrcPort  uint16
+	DstPort  uint16
+	Protocol uint8
+	// Now is the wall-clock time the record is generated at.
+	Now time.Time
+	// Uptime is the exporter uptime in milliseconds at Now.
+	Uptime uint32
+	// Index is the position of the record within its data set.
+	Index int
+	// Packets and Octets are the forward traffic counters of the record, kept
+	// by PacketCount and OctetCount for sources of later fields that derive
+	// from them, such as RFC 5103 reverse counters.
+	Packets uint64
+	Octets  uint64
+}
+
+// ValueSource produces the value of one field. Value must fill all of dst,
+// whose length equals the field's Length.
+type ValueSource interface {
+	Value(field Field, flow *Flow, dst []byte) error
+}
+
+// ValueFunc adapts an ordinary function to the ValueSource interface.
+type ValueFunc func(field Field, flow *Flow, dst []byte) error
+
+// Value calls fn(field, flow, dst).
+func (fn ValueFunc) Value(field Field, flow *Flow, dst []byte) error {
+	return fn(field, flow, dst)
+}
+
+// VariableSource is implemented by value sources that can fill a
+// variable-length field, choosing the length of the value themselves.
+type VariableSource interface {
+	VariableValue(field Field, flow *Flow) ([]byte, error)
+}
+
+// VariableFunc adapts a function returning a value of any length to the
+// ValueSource and VariableSource interfaces. In a fixed-length field the value
+// must be exactly the field's length.
+type VariableFunc func(field Field, flow *Flow) ([]byte, error)
+
+// VariableValue calls fn(field, flow).
+func (fn VariableFunc) VariableValue(field Field, flow *Flow) ([]byte, error) {
+	return fn(field, flow)
+}
+
+// Value calls fn(field, flow) and copies the result into dst.
+func (fn VariableFunc) Value(field Field, flow *Flow, dst []byte) error {
+	b, err := fn(field, flow)
+	if err != nil {
+		return err
+	}
+	if len(b) != len(dst) {
+		return fmt.Errorf("value is %d bytes, field length is %d", len(b), len(dst))
+	}
+	copy(dst, b)
+	return nil
+}
+
+// RecordSize returns the encoded size of a record for the given template
+// fields. Variable-length fields count as their shortest encoding, an empty
+// value behind a 1-byte length.
+func RecordSize(fields []Field) int {
+	size := 0
+	for _, f := range fields {
+		if f.Length == VariableLength {
+			size++
+			continue
+		}
+		size += int(f.Length)
+	}
+	return size
+}
+
+// Encode builds one record by asking sources[i] for the value of fields[i],
+// in template order. Every field must have a source, and variable-length
+// fields a VariableSource.
+func Encode(fields []Field, sources []ValueSource, flow *Flow) ([]byte, error) {
+	if len(sources) != len(fields) {
+		return nil, fmt.Errorf("template has %d fields but %d value sources", len(fields), len(sources))
+	}
+	record := make([]byte, 0, RecordSize(fields))
+	for i, f := range fields {
+		if sources[i] == nil {
+			return nil, fmt.Errorf("field %d (type %d) has no value source", i, f.Type)
+		}
+		var err error
+		if f.Length == VariableLength {
+			record, err = appendVariableField(record, f, sources[i], flow)
+		} else {
+			offset := len(record)
+			record = append(record, make([]byte, f.Length)...)
+			err = sources[i].Value(f, flow, record[offset:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %d (type %d): %w", i, f.Type, err)
+		}
+	}
+	return record, nil
+}
+
+// appendVariableField appends the value source gives for the variable-length
+// field f to record.
+func appendVariableField(record []byte, f Field, source ValueSource, flow *Flow) ([]byte, error) {
+	vs, ok := source.(VariableSource)
+	if !ok {
+		return nil, fmt.Errorf("value source cannot fill a variable-length field")
+	}
+	value, err := vs.VariableValue(f, flow)
+	if err != nil {
+		return nil, err
+	}
+	return AppendVariable(record, value)
+}
+
+// AppendVariable appends value to dst in the variable-length encoding of RFC
+// 7011 Section 7: a 1-byte length below 255, else 255 and a 2-byte length.
+func AppendVariable(dst []byte, value []byte) ([]byte, error) {
+	switch {
+	case len(value) < 255:
+		dst = append(dst, byte(len(value)))
+	case len(value) < VariableLength:
+		dst = append(dst, 255, byte(len(value)>>8), byte(len(value)))
+	default:
+		return nil, fmt.Errorf("variable-length value of %d bytes exceeds %d", len(value), VariableLength-1)
+	}
+	return append(dst, value...), nil
+}
+
+// NewFlow builds the record context for a flow from srcIP to dstIP on the given
+// well-known port. The source port is random and the destination port and
+// protocol come from utils.ResolvePortProtocol. startTime is the exporter start
+// in nanoseconds since epoch and is used to derive Uptime.
+func NewFlow(srcIP net.IP, dstIP net.IP, flowPort int, startTime int64) (*Flow, error) {
+	srcPort, err := utils.GenerateRand16(10000)
+	if err != nil {
+		return nil, fmt.Errorf("generate source port: %w", err)
+	}
+	dstPort, protocol := utils.ResolvePortProtocol(flowPort)
+	now := time.Now()
+	return &Flow{
+		SrcIP:    srcIP,
+		DstIP:    dstIP,
+		SrcPort:  srcPort,
+		DstPort:  dstPort,
+		Protocol: protocol,
+		Now:      now,
+		Uptime:   uint32((now.UnixNano()-startTime)/int64(time.Millisecond)) + 1000,
+	}, nil
+}
@@ -0,0 +1,254 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dmabry/flowgre/utils"
+)
+
+func testFlow(src, dst string) *Flow {
+	return &Flow{
+		SrcIP:    net.ParseIP(src),
+		DstIP:    net.ParseIP(dst),
+		SrcPort:  12345,
+		DstPort:  443,
+		Protocol: utils.TCPProto,
+		Now:      time.UnixMilli(1_700_000_000_000),
+		Uptime:   5000,
+	}
+}
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	fields := []Field{
+		{Type: 1, Length: 4},
+		{Type: 8, Length: 4},
+		{Type: 27, Length: 16},
+		{Type: 7, Length: 2},
+		{Type: 11, Length: 2},
+		{Type: 4, Length: 1},
+		{Type: 22, Length: 4},
+		{Type: 152, Length: 8},
+		{Type: 999, Length: 3},
+	}
+	sources := []ValueSource{
+		Uint(0x01020304),
+		SrcAddr(),
+		SrcAddr(),
+		SrcPort(),
+		DstPort(),
+		Protocol(),
+		Uptime(-100),
+		UnixMillis(-10),
+		Zero(),
+	}
+	record, err := Encode(fields, sources, testFlow("10.1.2.3", "10.4.5.6"))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if len(record) != RecordSize(fields) || RecordSize(fields) != 44 {
+		t.Fatalf("record size wrong! Got: %d Want: 44", len(record))
+	}
+	want := []byte{1, 2, 3, 4, 10, 1, 2, 3}
+	if !bytes.Equal(record[0:8], want) {
+		t.Errorf("leading bytes wrong! Got: %v Want: %v", record[0:8], want)
+	}
+	if !bytes.Equal(record[8:24], make([]byte, 16)) {
+		t.Errorf("IPv6 field should be zero for an IPv4 flow, got %v", record[8:24])
+	}
+	if got := binary.BigEndian.Uint16(record[24:26]); got != 12345 {
+		t.Errorf("src port wrong! Got: %d", got)
+	}
+	if got := binary.BigEndian.Uint16(record[26:28]); got != 443 {
+		t.Errorf("dst port wrong! Got: %d", got)
+	}
+	if record[28] != utils.TCPProto {
+		t.Errorf("protocol wrong! Got: %d", record[28])
+	}
+	if got := binary.BigEndian.Uint32(record[29:33]); got != 4900 {
+		t.Errorf("uptime wrong! Got: %d Want: 4900", got)
+	}
+	if got := binary.BigEndian.Uint64(record[33:41]); got != 1_700_000_000_000-10 {
+		t.Errorf("unix millis wrong! Got: %d", got)
+	}
+}
+
+func TestEncodeIPv6Addresses(t *testing.T) {
+	t.Parallel()
+	fields := []Field{{Type: 8, Length: 4}, {Type: 27, Length: 16}, {Type: 29, Length: 1}}
+	sources := []ValueSource{DstAddr(), DstAddr(), IPv6PrefixLength(64)}
+	record, err := Encode(fields, sources, testFlow("2001:db8::1", "2001:db8::2"))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !bytes.Equal(record[0:4], make([]byte, 4)) {
+		t.Errorf("IPv4 field should be zero for an IPv6 flow, got %v", record[0:4])
+	}
+	if !net.IP(record[4:20]).Equal(net.ParseIP("2001:db8::2")) {
+		t.Errorf("IPv6 address wrong! Got: %v", net.IP(record[4:20]))
+	}
+	if record[20] != 64 {
+		t.Errorf("prefix length wrong! Got: %d", record[20])
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	t.Parallel()
+	fields := []Field{{Type: 1, Length: 4}, {Type: 2, Length: 2}}
+	flow := testFlow("10.0.0.1", "10.0.0.2")
+	if _, err := Encode(fields, []ValueSource{Zero()}, flow); err == nil {
+		t.Error("expected error for missing value source")
+	}
+	if _, err := Encode(fields, []ValueSource{Zero(), nil}, flow); err == nil {
+		t.Error("expected error for nil value source")
+	}
+	if _, err := Encode(fields, []ValueSource{Zero(), Bytes([]byte{1, 2, 3})}, flow); err == nil {
+		t.Error("expected error for constant of wrong length")
+	}
+	errBoom := errors.New("boom")
+	failing := ValueFunc(func(Field, *Flow, []byte) error { return errBoom })
+	if _, err := Encode(fields, []ValueSource{Zero(), failing}, flow); !errors.Is(err, errBoom) {
+		t.Errorf("expected wrapped source error, got %v", err)
+	}
+}
+
+func TestEncodeVariableLength(t *testing.T) {
+	t.Parallel()
+	long := bytes.Repeat([]byte{'x'}, 300)
+	fields := []Field{{Type: 82, Length: VariableLength}, {Type: 7, Length: 2}, {Type: 96, Length: VariableLength}}
+	sources := []ValueSource{Bytes([]byte("eth0")), SrcPort(), Bytes(long)}
+	record, err := Encode(fields, sources, testFlow("10.0.0.1", "10.0.0.2"))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	want := append([]byte{4, 'e', 't', 'h', '0', 0x30, 0x39, 255, 0x01, 0x2c}, long...)
+	if !bytes.Equal(record, want) {
+		t.Errorf("Got: %x Want: %x", record, want)
+	}
+	if got := RecordSize(fields); got != 4 {
+		t.Errorf("Got: minimum record size %d Want: 4", got)
+	}
+
+	if _, err := Encode(fields[:1], []ValueSource{Zero()}, testFlow("10.0.0.1", "10.0.0.2")); err == nil {
+		t.Error("expected error for a fixed-length source in a variable-length field")
+	}
+	if _, err := AppendVariable(nil, make([]byte, VariableLength)); err == nil {
+		t.Error("expected error for a value too long to encode")
+	}
+}
+
+func TestChoice(t *testing.T) {
+	t.Parallel()
+	values := [][]byte{[]byte("dns"), []byte("https")}
+	seen := map[string]bool{}
+	for range 100 {
+		v, err := Choice(values).(VariableSource).VariableValue(Field{Length: VariableLength}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[string(v)] = true
+	}
+	if len(seen) != 2 || !seen["dns"] || !seen["https"] {
+		t.Errorf("Got: %v Want: both values", seen)
+	}
+}
+
+func TestUintTruncatesAndPads(t *testing.T) {
+	t.Parallel()
+	dst := make([]byte, 2)
+	if err := Uint(0x123456).Value(Field{Length: 2}, nil, dst); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst, []byte{0x34, 0x56}) {
+		t.Errorf("truncation wrong! Got: %v", dst)
+	}
+	dst = make([]byte, 10)
+	if err := Uint(0x0102).Value(Field{Length: 10}, nil, dst); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst, []byte{0, 0, 0, 0, 0, 0, 0, 0, 1, 2}) {
+		t.Errorf("padding wrong! Got: %v", dst)
+	}
+}
+
+func TestSequenceAndRandom(t *testing.T) {
+	t.Parallel()
+	seq := Sequence(100, 5)
+	dst := make([]byte, 4)
+	for i := range 3 {
+		if err := seq.Value(Field{Length: 4}, nil, dst); err != nil {
+			t.Fatal(err)
+		}
+		if got := binary.BigEndian.Uint32(dst); got != uint32(100+5*i) {
+			t.Errorf("sequence value %d wrong! Got: %d Want: %d", i, got, 100+5*i)
+		}
+	}
+	for range 50 {
+		if err := Random(10, 20).Value(Field{Length: 4}, nil, dst); err != nil {
+			t.Fatal(err)
+		}
+		if got := binary.BigEndian.Uint32(dst); got < 10 || got >= 20 {
+			t.Fatalf("random value %d outside [10, 20)", got)
+		}
+	}
+}
+
+func TestPacketAndOctetCount(t *testing.T) {
+	t.Parallel()
+	fields := []Field{{Type: 2, Length: 4}, {Type: 1, Length: 8}}
+	sources := []ValueSource{PacketCount(1, 65), OctetCount(64, 512)}
+	for range 50 {
+		flow := testFlow("10.0.0.1", "10.0.0.2")
+		record, err := Encode(fields, sources, flow)
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		packets := uint64(binary.BigEndian.Uint32(record[0:4]))
+		octets := binary.BigEndian.Uint64(record[4:12])
+		if packets != flow.Packets || octets != flow.Octets {
+			t.Fatalf("Got: %d packets %d octets Want: kept %d/%d", packets, octets, flow.Packets, flow.Octets)
+		}
+		if packets < 1 || packets >= 65 || octets < 64*packets || octets >= 512*packets {
+			t.Fatalf("Got: %d octets in %d packets Want: 64-511 bytes per packet", octets, packets)
+		}
+	}
+}
+
+func TestNewFlow(t *testing.T) {
+	t.Parallel()
+	start := time.Now().Add(-2 * time.Second).UnixNano()
+	flow, err := NewFlow(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), utils.DNSPort, start)
+	if err != nil {
+		t.Fatalf("NewFlow failed: %v", err)
+	}
+	if flow.DstPort != utils.DNSPort || flow.Protocol != utils.UDPProto {
+		t.Errorf("port/protocol wrong! Got: %d/%d", flow.DstPort, flow.Protocol)
+	}
+	if flow.Uptime < 3000 {
+		t.Errorf("uptime should include 2s of session time plus 1000ms offset, got %d", flow.Uptime)
+	}
+}
+
+func TestCIDR(t *testing.T) {
+	t.Parallel()
+	dst := make([]byte, 4)
+	for range 20 {
+		if err := CIDR("192.0.2.0/24").Value(Field{Length: 4}, nil, dst); err != nil {
+			t.Fatal(err)
+		}
+		if dst[0] != 192 || dst[1] != 0 || dst[2] != 2 {
+			t.Fatalf("address %v outside 192.0.2.0/24", dst)
+		}
+	}
+	if err := CIDR("2001:db8::/64").Value(Field{Length: 4}, nil, dst); err == nil {
+		t.Error("expected error for IPv6 range in a 4-byte field")
+	}
+}
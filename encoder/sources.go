@@ -0,0 +1,244 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package encoder
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/dmabry/flowgre/utils"
+)
+
+// putUint writes v big-endian into dst, right-aligned. Fields shorter than
+// 8 bytes keep the low-order bytes; longer fields are zero-padded on the left.
+func putUint(dst []byte, v uint64) {
+	for i := len(dst) - 1; i >= 0; i-- {
+		dst[i] = byte(v)
+		v >>= 8
+	}
+}
+
+// Zero fills the field with zero bytes.
+func Zero() ValueSource {
+	return ValueFunc(func(_ Field, _ *Flow, dst []byte) error {
+		clear(dst)
+		return nil
+	})
+}
+
+// Uint writes the constant v as an unsigned integer of the field's length.
+func Uint(v uint64) ValueSource {
+	return ValueFunc(func(_ Field, _ *Flow, dst []byte) error {
+		putUint(dst, v)
+		return nil
+	})
+}
+
+// Bytes writes b verbatim. A fixed-length field must be len(b) bytes long; a
+// variable-length field takes b as its value.
+func Bytes(b []byte) ValueSource {
+	return VariableFunc(func(_ Field, _ *Flow) ([]byte, error) {
+		return b, nil
+	})
+}
+
+// Choice writes one of values, picked at random for each record. A
+// fixed-length field must be as long as the value picked.
+func Choice(values [][]byte) ValueSource {
+	return VariableFunc(func(_ Field, _ *Flow) ([]byte, error) {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("no values to choose from")
+		}
+		n, err := utils.RandomNum(0, len(values))
+		if err != nil {
+			return nil, fmt.Errorf("choose value: %w", err)
+		}
+		return values[n], nil
+	})
+}
+
+// Random writes a random unsigned integer in [lo, hi).
+func Random(lo, hi int) ValueSource {
+	return ValueFunc(func(_ Field, _ *Flow, dst []byte) error {
+		n, err := utils.RandomNum(lo, hi)
+		if err != nil {
+			return fmt.Errorf("generate random value: %w", err)
+		}
+		putUint(dst, uint64(n))
+		return nil
+	})
+}
+
+// PacketCount writes a random packet count in [lo, hi) and keeps it in flow.Packets.
+func PacketCount(lo, hi int) ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		n, err := utils.RandomNum(lo, hi)
+		if err != nil {
+			return fmt.Errorf("generate packet count: %w", err)
+		}
+		flow.Packets = uint64(n)
+		putUint(dst, flow.Packets)
+		return nil
+	})
+}
+
+// OctetCount writes the size of flow.Packets packets of a random size in
+// [lo, hi) bytes and keeps it in flow.Octets. The packet count must come
+// before it in the template.
+func OctetCount(lo, hi int) ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		n, err := utils.RandomNum(lo, hi)
+		if err != nil {
+			return fmt.Errorf("generate packet size: %w", err)
+		}
+		flow.Octets = flow.Packets * uint64(n)
+		putUint(dst, flow.Octets)
+		return nil
+	})
+}
+
+// RandomBytes fills the field with random bytes, e.g. for MAC addresses.
+func RandomBytes() ValueSource {
+	return ValueFunc(func(_ Field, _ *Flow, dst []byte) error {
+		for i := range dst {
+			n, err := utils.RandomNum(0, 256)
+			if err != nil {
+				return fmt.Errorf("generate random byte: %w", err)
+			}
+			dst[i] = byte(n)
+		}
+		return nil
+	})
+}
+
+// Sequence writes start, start+step, start+2*step, ... on successive records.
+// The counter is shared by every record encoded with the returned source.
+func Sequence(start, step uint64) ValueSource {
+	var counter atomic.Uint64
+	return ValueFunc(func(_ Field, _ *Flow, dst []byte) error {
+		n := counter.Add(1) - 1
+		putUint(dst, start+n*step)
+		return nil
+	})
+}
+
+// SrcAddr writes the flow source address. 4-byte fields take an IPv4 address
+// and 16-byte fields an IPv6 address; a field of the other family is zeroed,
+// so templates can carry both IPv4 and IPv6 address fields.
+func SrcAddr() ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		putAddr(dst, flow.SrcIP)
+		return nil
+	})
+}
+
+// DstAddr writes the flow destination address. See SrcAddr.
+func DstAddr() ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		putAddr(dst, flow.DstIP)
+		return nil
+	})
+}
+
+// putAddr writes ip into dst when the lengths match its family, else zeroes dst.
+func putAddr(dst []byte, ip []byte) {
+	clear(dst)
+	v4 := len(ip) == 4 || (len(ip) == 16 && isV4Mapped(ip))
+	switch {
+	case len(dst) == 4 && v4:
+		copy(dst, ip[len(ip)-4:])
+	case len(dst) == 16 && !v4 && len(ip) == 16:
+		copy(dst, ip)
+	}
+}
+
+// isV4Mapped reports whether a 16-byte address is an IPv4-mapped IPv6 address.
+func isV4Mapped(ip []byte) bool {
+	for _, b := range ip[:10] {
+		if b != 0 {
+			return false
+		}
+	}
+	return ip[10] == 0xff && ip[11] == 0xff
+}
+
+// CIDR writes a random address from cidr. The field length must match the
+// address family: 4 bytes for an IPv4 range, 16 bytes for an IPv6 range.
+func CIDR(cidr string) ValueSource {
+	return ValueFunc(func(_ Field, _ *Flow, dst []byte) error {
+		ip, err := utils.RandomIPCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("pick address from %s: %w", cidr, err)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+		if len(ip) != len(dst) {
+			return fmt.Errorf("address from %s is %d bytes, field length is %d", cidr, len(ip), len(dst))
+		}
+		copy(dst, ip)
+		return nil
+	})
+}
+
+// IPv6PrefixLength writes prefix for IPv6 flows and zero for IPv4 flows.
+func IPv6PrefixLength(prefix uint8) ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		if flow.SrcIP.To4() != nil {
+			clear(dst)
+			return nil
+		}
+		putUint(dst, uint64(prefix))
+		return nil
+	})
+}
+
+// SrcPort writes the flow source port.
+func SrcPort() ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		putUint(dst, uint64(flow.SrcPort))
+		return nil
+	})
+}
+
+// DstPort writes the flow destination port.
+func DstPort() ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		putUint(dst, uint64(flow.DstPort))
+		return nil
+	})
+}
+
+// Protocol writes the flow IP protocol number.
+func Protocol() ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		putUint(dst, uint64(flow.Protocol))
+		return nil
+	})
+}
+
+// Uptime writes the exporter uptime in milliseconds shifted by offsetMillis,
+// e.g. Uptime(-100) for a flow that started 100ms ago.
+func Uptime(offsetMillis int64) ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		putUint(dst, uint64(int64(flow.Uptime)+offsetMillis))
+		return nil
+	})
+}
+
+// UnixMillis writes the wall-clock time in epoch milliseconds shifted by offsetMillis.
+func UnixMillis(offsetMillis int64) ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		putUint(dst, uint64(flow.Now.UnixMilli()+offsetMillis))
+		return nil
+	})
+}
+
+// UnixSeconds writes the wall-clock time in epoch seconds shifted by offsetSeconds.
+func UnixSeconds(offsetSeconds int64) ValueSource {
+	return ValueFunc(func(_ Field, flow *Flow, dst []byte) error {
+		putUint(dst, uint64(flow.Now.Unix()+offsetSeconds))
+		return nil
+	})
+}
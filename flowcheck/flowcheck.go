@@ -0,0 +1,66 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package flowcheck identifies and validates NetFlow v5, NetFlow v9, IPFIX and
+// sFlow payloads by their version field. It has no storage or network
+// dependencies, so record, proxy and the tools reading recordings share it.
+package flowcheck
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/sflow"
+)
+
+// Protocol names returned by DetectProtocol.
+const (
+	ProtocolNetFlowV5 = "netflow5"
+	ProtocolNetFlowV9 = "netflow9"
+	ProtocolIPFIX     = "ipfix"
+	ProtocolSFlow     = "sflow"
+)
+
+// DetectProtocol returns the protocol of a flow payload based on its version
+// field, or "" if it is not a supported version. sFlow carries a 32-bit
+// version, so it is checked before the 16-bit NetFlow/IPFIX version.
+func DetectProtocol(payload []byte) string {
+	if sflow.HasSFlowHeader(payload) {
+		return ProtocolSFlow
+	}
+	if len(payload) < 2 {
+		return ""
+	}
+	switch binary.BigEndian.Uint16(payload[0:2]) {
+	case netflowv5.Version:
+		return ProtocolNetFlowV5
+	case 9:
+		return ProtocolNetFlowV9
+	case ipfix.Version:
+		return ProtocolIPFIX
+	default:
+		return ""
+	}
+}
+
+// IsValidFlow validates the payload with the validator matching its version field.
+func IsValidFlow(payload []byte) (bool, error) {
+	if len(payload) < 2 {
+		return false, fmt.Errorf("payload too short for flow header: %d bytes", len(payload))
+	}
+	switch DetectProtocol(payload) {
+	case ProtocolSFlow:
+		return sflow.IsValidSFlow(payload)
+	case ProtocolNetFlowV5:
+		return netflowv5.IsValidNetFlowV5(payload)
+	case ProtocolNetFlowV9:
+		return netflow.IsValidNetFlow(payload, 9)
+	case ProtocolIPFIX:
+		return ipfix.IsValidIPFIX(payload)
+	default:
+		return false, fmt.Errorf("unsupported flow version %d", binary.BigEndian.Uint16(payload[0:2]))
+	}
+}
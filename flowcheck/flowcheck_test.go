@@ -0,0 +1,67 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package flowcheck
+
+import (
+	"testing"
+
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/sflow"
+)
+
+// TestIsValidFlow verifies version dispatch for NetFlow v5, v9, IPFIX and sFlow.
+func TestIsValidFlow(t *testing.T) {
+	t.Parallel()
+
+	v5, err := netflowv5.GenerateNetflowV5(3, 100, "10.0.0.0/8", "10.0.0.0/8", 0, netflow.NewSession(), netflowv5.NewSequence())
+	if err != nil {
+		t.Fatalf("GenerateNetflowV5 failed: %v", err)
+	}
+	v5Buf, err := v5.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	v9 := netflow.GenerateTemplateNetflow(100, netflow.NewSession())
+	v9Buf := v9.ToBytes()
+	v10Flow := ipfix.GenerateTemplateIPFIX(100, ipfix.NewIPFIXSequence())
+	v10, err := v10Flow.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+
+	sf, err := sflow.GenerateDatagram(3, 100, "10.0.0.0/8", "10.0.0.0/8", 0, netflow.NewSession(), sflow.NewAgent())
+	if err != nil {
+		t.Fatalf("GenerateDatagram failed: %v", err)
+	}
+	sfBuf, err := sf.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{"netflow v5", v5Buf.Bytes(), true},
+		{"sflow v5", sfBuf.Bytes(), true},
+		{"sflow v5 truncated", sfBuf.Bytes()[:sfBuf.Len()-4], false},
+		{"netflow v5 truncated", v5Buf.Bytes()[:v5Buf.Len()-1], false},
+		{"netflow v9", v9Buf.Bytes(), true},
+		{"ipfix", v10.Bytes(), true},
+		{"unknown version", []byte{0, 7, 0, 0}, false},
+		{"too short", []byte{0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := IsValidFlow(tt.payload)
+			if got != tt.want {
+				t.Errorf("IsValidFlow() = %v, want %v (err: %v)", got, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package inspect decodes the packets in a database written by record and
+// prints them as text, NDJSON or CSV.
+package inspect
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v3"
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/flowcheck"
+	"github.com/dmabry/flowgre/record"
+)
+
+// Output formats.
+const (
+	FormatText   = "text"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// Options selects which recorded packets to inspect and how to print them.
+type Options struct {
+	DBDir     string
+	From      uint32   // first record key; 0 starts at the first record
+	To        uint32   // last record key, inclusive; 0 runs to the last record
+	Protocols []string // protocols to include; empty includes all
+	Format    string   // FormatText, FormatNDJSON or FormatCSV
+}
+
+// ParseVersions parses a comma-separated list of flow versions into protocol
+// names. 5, 9 and 10 select NetFlow v5, NetFlow v9 and IPFIX; "sflow" selects
+// sFlow v5. An empty spec selects every protocol.
+func ParseVersions(spec string) ([]string, error) {
+	var protocols []string
+	for _, v := range strings.Split(spec, ",") {
+		var protocol string
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "":
+			continue
+		case "5":
+			protocol = ProtocolNetFlowV5
+		case "9":
+			protocol = ProtocolNetFlowV9
+		case "10", "ipfix":
+			protocol = ProtocolIPFIX
+		case "sflow":
+			protocol = ProtocolSFlow
+		default:
+			return nil, fmt.Errorf("unknown flow version %q: expected 5, 9, 10 or sflow", v)
+		}
+		if !slices.Contains(protocols, protocol) {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols, nil
+}
+
+// walk decodes every recorded packet selected by opts in key order and calls
+// fn for each. Templates are cached across the whole capture, so packets
+// before opts.From are decoded too, but not passed to fn.
+func walk(ctx context.Context, opts Options, fn func(Packet) error) (retErr error) {
+	options := badger.DefaultOptions(opts.DBDir)
+	options.Logger = nil
+	db, err := badger.Open(options)
+	if err != nil {
+		return fmt.Errorf("open DB %s: %w", opts.DBDir, err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil && retErr == nil {
+			retErr = fmt.Errorf("close DB: %w", err)
+		}
+	}()
+
+	d := decode.NewDecoder()
+	return db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item := it.Item()
+			if len(item.Key()) != 4 {
+				continue
+			}
+			key := binary.BigEndian.Uint32(item.Key())
+			if opts.To != 0 && key > opts.To {
+				return nil
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return fmt.Errorf("read record %d: %w", key, err)
+			}
+			entry, err := record.UnmarshalEntry(value)
+			if err != nil {
+				return fmt.Errorf("decode record %d: %w", key, err)
+			}
+			protocol := flowcheck.DetectProtocol(entry.Payload)
+			if key < opts.From {
+				// Only template-bearing protocols need decoding ahead of the range
+				if protocol == ProtocolNetFlowV9 || protocol == ProtocolIPFIX {
+					_, _ = d.Decode(entry.Source, entry.Payload)
+				}
+				continue
+			}
+			if len(opts.Protocols) > 0 && !slices.Contains(opts.Protocols, protocol) {
+				// Still learn templates from filtered-out packets
+				if protocol == ProtocolNetFlowV9 || protocol == ProtocolIPFIX {
+					_, _ = d.Decode(entry.Source, entry.Payload)
+				}
+				continue
+			}
+			if err := fn(decodePacket(d, key, entry)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunCtx prints the recorded packets selected by opts to w.
+func RunCtx(ctx context.Context, opts Options, w io.Writer) error {
+	var err error
+	switch opts.Format {
+	case FormatText, "":
+		err = writeText(ctx, opts, w)
+	case FormatNDJSON:
+		err = writeNDJSON(ctx, opts, w)
+	case FormatCSV:
+		err = writeCSV(ctx, opts, w)
+	default:
+		err = fmt.Errorf("unknown format %q", opts.Format)
+	}
+	if err != nil {
+		return fmt.Errorf("inspect: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/decode/decodetest"
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/record"
+	"github.com/dmabry/flowgre/sflow"
+)
+
+// captureSource is the exporter the IPFIX packets in writeCapture arrived from.
+const captureSource = "192.0.2.1:4739"
+
+// writeCapture records one packet of each protocol, keyed from 1 like record does:
+// 1 NetFlow v9 template, 2 NetFlow v9 data (3 flows), 3 IPFIX template,
+// 4 IPFIX data (2 flows), 5 NetFlow v5 (4 flows), 6 sFlow, 7 garbage.
+// The IPFIX packets carry arrival metadata; the rest are stored bare, as
+// databases written before the metadata envelope are.
+func writeCapture(t *testing.T) string {
+	t.Helper()
+	session := netflow.NewSession()
+	v5, err := netflowv5.GenerateNetflowV5(4, 1, "10.0.0.0/8", "10.0.0.0/8", 443, session, netflowv5.NewSequence())
+	if err != nil {
+		t.Fatalf("GenerateNetflowV5: %v", err)
+	}
+	datagram, err := sflow.GenerateDatagram(2, 1, "10.0.0.0/8", "10.0.0.0/8", 443, session, sflow.NewAgent())
+	if err != nil {
+		t.Fatalf("GenerateDatagram: %v", err)
+	}
+
+	payloads := decodetest.NetFlow(t, 7, "10.0.0.0/8", 3)
+	payloads = append(payloads, decodetest.IPFIX(t, 8, "2001:db8::/64", 2)...)
+	for _, gen := range []func() (bytes.Buffer, error){v5.ToBytes, datagram.ToBytes} {
+		buf, err := gen()
+		if err != nil {
+			t.Fatalf("ToBytes: %v", err)
+		}
+		payloads = append(payloads, buf.Bytes())
+	}
+	payloads = append(payloads, []byte{0x00, 0x07, 0x00, 0x00})
+
+	dir := t.TempDir()
+	options := badger.DefaultOptions(dir)
+	options.Logger = nil
+	db, err := badger.Open(options)
+	if err != nil {
+		t.Fatalf("open DB: %v", err)
+	}
+	defer db.Close()
+	err = db.Update(func(txn *badger.Txn) error {
+		for i, payload := range payloads {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(i+1))
+			value := payload
+			if i == 2 || i == 3 {
+				entry := record.Entry{Received: time.Unix(1700000000, 0), Source: captureSource, Payload: payload}
+				var err error
+				if value, err = entry.MarshalBinary(); err != nil {
+					return err
+				}
+			}
+			if err := txn.Set(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("write DB: %v", err)
+	}
+	return dir
+}
+
+func TestRunCtxText(t *testing.T) {
+	t.Parallel()
+	dir := writeCapture(t)
+	var out bytes.Buffer
+	if err := RunCtx(context.Background(), Options{DBDir: dir, Format: FormatText}, &out); err != nil {
+		t.Fatalf("RunCtx: %v", err)
+	}
+	text := out.String()
+	for _, want := range []string{
+		"#1 netflow9",
+		"template 256: IN_BYTES(4)",
+		"data set 256: 3 records",
+		"IPV4_SRC_ADDR=10.",
+		"#3 ipfix",
+		"from 192.0.2.1:4739 at 2023-11-14T22:13:20Z",
+		"options template 257:",
+		"sourceIPv6Address=2001:db8::",
+		"#5 netflow5",
+		"  4 records",
+		"#6 sflow",
+		"samples=3",
+		"#7  4 bytes error: unsupported flow version 7",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Got: output without %q Want: it present\n%s", want, text)
+		}
+	}
+}
+
+func TestDecodePacketShortPayload(t *testing.T) {
+	t.Parallel()
+	for _, payload := range [][]byte{nil, {0x00}} {
+		p := decodePacket(decode.NewDecoder(), 1, record.Entry{Payload: payload})
+		if p.Err == nil || !strings.Contains(p.Err.Error(), "payload too short") {
+			t.Errorf("Got: %v Want: payload too short error for %d bytes", p.Err, len(payload))
+		}
+	}
+}
+
+func TestRunCtxNDJSON(t *testing.T) {
+	t.Parallel()
+	dir := writeCapture(t)
+
+	tests := []struct {
+		name     string
+		opts     Options
+		wantKeys []uint32
+	}{
+		{name: "all", opts: Options{}, wantKeys: []uint32{2, 2, 2, 4, 4, 5, 5, 5, 5}},
+		{name: "key range", opts: Options{From: 3, To: 4}, wantKeys: []uint32{4, 4}},
+		{name: "version", opts: Options{Protocols: []string{ProtocolIPFIX}}, wantKeys: []uint32{4, 4}},
+		// The NetFlow v9 template at key 1 is outside the range but still decodes key 2
+		{name: "template before range", opts: Options{From: 2, To: 2}, wantKeys: []uint32{2, 2, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			opts := tt.opts
+			opts.DBDir, opts.Format = dir, FormatNDJSON
+			var out bytes.Buffer
+			if err := RunCtx(context.Background(), opts, &out); err != nil {
+				t.Fatalf("RunCtx: %v", err)
+			}
+			var keys []uint32
+			scanner := bufio.NewScanner(&out)
+			for scanner.Scan() {
+				var row struct {
+					Key      uint32         `json:"key"`
+					Protocol string         `json:"protocol"`
+					Source   string         `json:"source"`
+					Fields   map[string]any `json:"fields"`
+				}
+				if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+					t.Fatalf("Unmarshal %s: %v", scanner.Text(), err)
+				}
+				if len(row.Fields) == 0 {
+					t.Errorf("Got: row without fields Want: fields (%s)", scanner.Text())
+				}
+				if wantSource := row.Protocol == ProtocolIPFIX; (row.Source == captureSource) != wantSource {
+					t.Errorf("Got: source %q for %s Want: source only on IPFIX rows", row.Source, row.Protocol)
+				}
+				keys = append(keys, row.Key)
+			}
+			if !slices.Equal(keys, tt.wantKeys) {
+				t.Errorf("Got: %v Want: %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestRunCtxCSV(t *testing.T) {
+	t.Parallel()
+	dir := writeCapture(t)
+	var out bytes.Buffer
+	opts := Options{DBDir: dir, Format: FormatCSV, Protocols: []string{ProtocolNetFlowV9, ProtocolIPFIX}}
+	if err := RunCtx(context.Background(), opts, &out); err != nil {
+		t.Fatalf("RunCtx: %v", err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(rows) != 6 {
+		t.Fatalf("Got: %d rows Want: header and 5 records", len(rows))
+	}
+	header := rows[0]
+	if !slices.Equal(header[:len(csvColumns)], csvColumns) {
+		t.Errorf("Got: %v Want: %v first", header, csvColumns)
+	}
+	v4 := slices.Index(header, "IPV4_SRC_ADDR")
+	v6 := slices.Index(header, "sourceIPv6Address")
+	if v4 < 0 || v6 < 0 {
+		t.Fatalf("Got: header %v Want: IPV4_SRC_ADDR and sourceIPv6Address columns", header)
+	}
+	// NetFlow v9 rows leave IPFIX columns empty and vice versa
+	if rows[1][v4] == "" || rows[1][v6] != "" {
+		t.Errorf("Got: %q, %q Want: NetFlow v9 address only", rows[1][v4], rows[1][v6])
+	}
+	if rows[5][v4] != "" || !strings.HasPrefix(rows[5][v6], "2001:db8::") {
+		t.Errorf("Got: %q, %q Want: IPFIX address only", rows[5][v4], rows[5][v6])
+	}
+	// Only the IPFIX packets were recorded with arrival metadata
+	source := slices.Index(header, "source")
+	if rows[1][source] != "" || rows[5][source] != captureSource {
+		t.Errorf("Got: sources %q, %q Want: \"\", %q", rows[1][source], rows[5][source], captureSource)
+	}
+}
+
+func TestParseVersions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "9", want: []string{ProtocolNetFlowV9}},
+		{spec: "5, 10,sflow,10", want: []string{ProtocolNetFlowV5, ProtocolIPFIX, ProtocolSFlow}},
+		{spec: "ipfix", want: []string{ProtocolIPFIX}},
+		{spec: "7", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseVersions(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Got: error %v Want: error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Got: %v Want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldNameReverse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		field decode.Field
+		want  string
+	}{
+		{decode.Field{Type: ipfix.OctetDeltaCount, EnterpriseNumber: ipfix.ReverseEnterpriseNumber}, "reverseOctetDeltaCount"},
+		{decode.Field{Type: 4000, EnterpriseNumber: ipfix.ReverseEnterpriseNumber}, "enterprise29305_4000"},
+		{decode.Field{Type: ipfix.OctetDeltaCount, EnterpriseNumber: 9}, "enterprise9_1"},
+	}
+	for _, tt := range tests {
+		if got := fieldName(decode.VersionIPFIX, tt.field); got != tt.want {
+			t.Errorf("Got: %q Want: %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package inspect
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatText formats a value for text and CSV output.
+func formatText(v any) string {
+	switch v := v.(type) {
+	case []byte:
+		return fmt.Sprintf("%x", v)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// String formats fields as space-separated name=value pairs.
+func (f Fields) String() string {
+	parts := make([]string, len(f))
+	for i, field := range f {
+		parts[i] = field.Name + "=" + formatText(field.Value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// writeText prints each packet with its header, templates and data records.
+func writeText(ctx context.Context, opts Options, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	err := walk(ctx, opts, func(p Packet) error {
+		fmt.Fprintf(bw, "#%d %s %d bytes", p.Key, p.Protocol, p.Length)
+		if p.Source != "" {
+			fmt.Fprintf(bw, " from %s at %s", p.Source, p.Received.UTC().Format(time.RFC3339Nano))
+		}
+		if p.Err != nil {
+			fmt.Fprintf(bw, " error: %v\n", p.Err)
+			return nil
+		}
+		fmt.Fprintf(bw, " %s\n", p.Header)
+		for _, t := range p.Templates {
+			kind := "template"
+			if t.Options {
+				kind = "options template"
+			}
+			names := make([]string, len(t.Fields))
+			for i, f := range t.Fields {
+				names[i] = fmt.Sprintf("%s(%d)", fieldName(versionOf(p.Protocol), f), f.Length)
+			}
+			fmt.Fprintf(bw, "  %s %d: %s\n", kind, t.ID, strings.Join(names, " "))
+		}
+		for _, ds := range p.DataSets {
+			if ds.Missing {
+				fmt.Fprintf(bw, "  data set %d: template not seen yet\n", ds.TemplateID)
+				continue
+			}
+			if p.Protocol == ProtocolNetFlowV5 {
+				fmt.Fprintf(bw, "  %d records\n", len(ds.Records))
+			} else {
+				fmt.Fprintf(bw, "  data set %d: %d records\n", ds.TemplateID, len(ds.Records))
+			}
+			for i, record := range ds.Records {
+				fmt.Fprintf(bw, "    [%d] %s\n", i, record)
+			}
+		}
+		return nil
+	})
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// versionOf returns the NetFlow/IPFIX version of a protocol name.
+func versionOf(protocol string) uint16 {
+	if protocol == ProtocolIPFIX {
+		return 10
+	}
+	return 9
+}
+
+// recordRow is one exported data record.
+type recordRow struct {
+	Key        uint32 `json:"key"`
+	Protocol   string `json:"protocol"`
+	Received   string `json:"received,omitempty"` // RFC 3339 arrival time
+	Source     string `json:"source,omitempty"`
+	DomainID   uint32 `json:"domain_id"`
+	Sequence   uint32 `json:"sequence"`
+	TemplateID uint16 `json:"template_id"`
+	Options    bool   `json:"options"`
+	Fields     Fields `json:"fields"`
+}
+
+// eachRecord calls fn for every decoded data record. Packets without data
+// records, and packets that failed to decode, produce no rows.
+func eachRecord(ctx context.Context, opts Options, fn func(recordRow) error) error {
+	return walk(ctx, opts, func(p Packet) error {
+		for _, ds := range p.DataSets {
+			for _, record := range ds.Records {
+				row := recordRow{
+					Key:        p.Key,
+					Protocol:   p.Protocol,
+					Source:     p.Source,
+					DomainID:   p.DomainID,
+					Sequence:   p.Sequence,
+					TemplateID: ds.TemplateID,
+					Options:    ds.Options,
+					Fields:     record,
+				}
+				if !p.Received.IsZero() {
+					row.Received = p.Received.UTC().Format(time.RFC3339Nano)
+				}
+				if err := fn(row); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// writeNDJSON prints one JSON object per data record.
+func writeNDJSON(ctx context.Context, opts Options, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := eachRecord(ctx, opts, func(row recordRow) error {
+		return enc.Encode(row)
+	})
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// csvColumns are the columns every CSV row starts with.
+var csvColumns = []string{"key", "protocol", "received", "source", "domain_id", "sequence", "template_id", "options"}
+
+// writeCSV prints one row per data record. Records of different templates
+// carry different fields, so a first pass collects every field name for the
+// header and a second pass writes the rows, leaving absent fields empty.
+func writeCSV(ctx context.Context, opts Options, w io.Writer) error {
+	index := make(map[string]int)
+	var names []string
+	err := eachRecord(ctx, opts, func(row recordRow) error {
+		for _, f := range row.Fields {
+			if _, ok := index[f.Name]; !ok {
+				index[f.Name] = len(names)
+				names = append(names, f.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append(append([]string(nil), csvColumns...), names...)); err != nil {
+		return err
+	}
+	err = eachRecord(ctx, opts, func(row recordRow) error {
+		values := make([]string, len(csvColumns)+len(names))
+		values[0] = strconv.FormatUint(uint64(row.Key), 10)
+		values[1] = row.Protocol
+		values[2] = row.Received
+		values[3] = row.Source
+		values[4] = strconv.FormatUint(uint64(row.DomainID), 10)
+		values[5] = strconv.FormatUint(uint64(row.Sequence), 10)
+		values[6] = strconv.FormatUint(uint64(row.TemplateID), 10)
+		values[7] = strconv.FormatBool(row.Options)
+		for _, f := range row.Fields {
+			values[len(csvColumns)+index[f.Name]] = formatText(f.Value)
+		}
+		return cw.Write(values)
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	return err
+}
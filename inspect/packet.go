@@ -0,0 +1,326 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/flowcheck"
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/record"
+	"github.com/dmabry/flowgre/sflow"
+)
+
+// Protocol names used for filtering and output.
+const (
+	ProtocolNetFlowV5 = record.ProtocolNetFlowV5
+	ProtocolNetFlowV9 = record.ProtocolNetFlowV9
+	ProtocolIPFIX     = record.ProtocolIPFIX
+	ProtocolSFlow     = record.ProtocolSFlow
+)
+
+// Field is a named value. Values are uint64, string, or []byte for opaque data.
+type Field struct {
+	Name  string
+	Value any
+}
+
+// Fields is an ordered list of named values. It marshals to a JSON object
+// that keeps the field order.
+type Fields []Field
+
+// MarshalJSON implements json.Marshaler.
+func (f Fields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range f {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(field.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(jsonValue(field.Value))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonValue returns v as it should be marshaled: opaque bytes as hex rather
+// than encoding/json's base64.
+func jsonValue(v any) any {
+	if b, ok := v.([]byte); ok {
+		return fmt.Sprintf("%x", b)
+	}
+	return v
+}
+
+// DataSet is a decoded data set. Missing is true when its template was not
+// found earlier in the capture, in which case Records is empty.
+type DataSet struct {
+	TemplateID uint16
+	Options    bool
+	Missing    bool
+	Records    []Fields
+}
+
+// Packet is a decoded recorded packet.
+type Packet struct {
+	Key       uint32
+	Protocol  string
+	Length    int
+	Received  time.Time // zero for packets recorded without metadata
+	Source    string    // exporter IP:port; empty for packets recorded without metadata
+	Header    Fields
+	DomainID  uint32 // source ID (NetFlow v9) or observation domain ID (IPFIX)
+	Sequence  uint32
+	Templates []decode.Template
+	DataSets  []DataSet
+	Err       error // set when the packet could not be decoded
+}
+
+// decodePacket decodes the entry stored under key. NetFlow v9 and IPFIX
+// templates are cached in d, so data sets decode once their template has been
+// seen earlier in the capture.
+func decodePacket(d *decode.Decoder, key uint32, entry record.Entry) Packet {
+	payload := entry.Payload
+	p := Packet{
+		Key:      key,
+		Protocol: flowcheck.DetectProtocol(payload),
+		Length:   len(payload),
+		Received: entry.Received,
+		Source:   entry.Source,
+	}
+	switch p.Protocol {
+	case ProtocolNetFlowV9, ProtocolIPFIX:
+		// Templates are scoped by exporter, which is empty for packets
+		// recorded without metadata
+		msg, err := d.Decode(entry.Source, payload)
+		if err != nil {
+			p.Err = err
+			return p
+		}
+		p.fromMessage(msg)
+	case ProtocolNetFlowV5:
+		p.Err = p.decodeNetFlowV5(payload)
+	case ProtocolSFlow:
+		p.Err = p.decodeSFlow(payload)
+	default:
+		if len(payload) < 2 {
+			p.Err = fmt.Errorf("payload too short for flow header: %d bytes", len(payload))
+			return p
+		}
+		p.Err = fmt.Errorf("unsupported flow version %d", binary.BigEndian.Uint16(payload[0:2]))
+	}
+	return p
+}
+
+// fromMessage fills p from a decoded NetFlow v9 or IPFIX message.
+func (p *Packet) fromMessage(msg *decode.Message) {
+	p.DomainID = msg.DomainID
+	p.Sequence = msg.Sequence
+	p.Templates = msg.Templates
+	if msg.Version == decode.VersionNetFlow {
+		p.Header = Fields{
+			{"version", uint64(msg.Version)},
+			{"count", uint64(msg.Count)},
+			{"sys_uptime", uint64(msg.SysUptime)},
+			{"export_time", msg.ExportTime.UTC().Format(time.RFC3339)},
+			{"sequence", uint64(msg.Sequence)},
+			{"source_id", uint64(msg.DomainID)},
+		}
+	} else {
+		p.Header = Fields{
+			{"version", uint64(msg.Version)},
+			{"export_time", msg.ExportTime.UTC().Format(time.RFC3339)},
+			{"sequence", uint64(msg.Sequence)},
+			{"observation_domain_id", uint64(msg.DomainID)},
+		}
+	}
+	for _, ds := range msg.DataSets {
+		set := DataSet{TemplateID: ds.TemplateID, Missing: ds.Template == nil}
+		if ds.Template != nil {
+			set.Options = ds.Template.Options
+		}
+		for _, rec := range ds.Records {
+			fields := make(Fields, len(rec))
+			for i, v := range rec {
+				fields[i] = Field{fieldName(msg.Version, v.Field), formatValue(msg.Version, v)}
+			}
+			set.Records = append(set.Records, fields)
+		}
+		p.DataSets = append(p.DataSets, set)
+	}
+}
+
+// decodeNetFlowV5 fills p from a NetFlow v5 packet. Its fixed records are
+// named after the equivalent NetFlow v9 field types.
+func (p *Packet) decodeNetFlowV5(payload []byte) error {
+	if _, err := netflowv5.IsValidNetFlowV5(payload); err != nil {
+		return err
+	}
+	var header netflowv5.Header
+	if err := binary.Read(bytes.NewReader(payload), binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("read NetFlow v5 header: %w", err)
+	}
+	p.Sequence = header.FlowSequence
+	p.Header = Fields{
+		{"version", uint64(header.Version)},
+		{"count", uint64(header.Count)},
+		{"sys_uptime", uint64(header.SysUptime)},
+		{"export_time", time.Unix(int64(header.UnixSecs), int64(header.UnixNsecs)).UTC().Format(time.RFC3339Nano)},
+		{"flow_sequence", uint64(header.FlowSequence)},
+		{"engine_type", uint64(header.EngineType)},
+		{"engine_id", uint64(header.EngineID)},
+		{"sampling_interval", uint64(header.SamplingInterval)},
+	}
+	records := make([]netflowv5.Record, header.Count)
+	if err := binary.Read(bytes.NewReader(payload[netflowv5.HeaderSize:]), binary.BigEndian, records); err != nil {
+		return fmt.Errorf("read NetFlow v5 records: %w", err)
+	}
+	set := DataSet{}
+	for _, r := range records {
+		set.Records = append(set.Records, Fields{
+			{netflow.FieldName(netflow.IPV4_SRC_ADDR), ipv4(r.SrcAddr)},
+			{netflow.FieldName(netflow.IPV4_DST_ADDR), ipv4(r.DstAddr)},
+			{netflow.FieldName(netflow.IPV4_NEXT_HOP), ipv4(r.NextHop)},
+			{netflow.FieldName(netflow.INPUT_SNMP), uint64(r.Input)},
+			{netflow.FieldName(netflow.OUTPUT_SNMP), uint64(r.Output)},
+			{netflow.FieldName(netflow.IN_PKTS), uint64(r.DPkts)},
+			{netflow.FieldName(netflow.IN_BYTES), uint64(r.DOctets)},
+			{netflow.FieldName(netflow.FIRST_SWITCHED), uint64(r.First)},
+			{netflow.FieldName(netflow.LAST_SWITCHED), uint64(r.Last)},
+			{netflow.FieldName(netflow.L4_SRC_PORT), uint64(r.SrcPort)},
+			{netflow.FieldName(netflow.L4_DST_PORT), uint64(r.DstPort)},
+			{netflow.FieldName(netflow.TCP_FLAGS), uint64(r.TCPFlags)},
+			{netflow.FieldName(netflow.PROTOCOL), uint64(r.Protocol)},
+			{netflow.FieldName(netflow.SRC_TOS), uint64(r.Tos)},
+			{netflow.FieldName(netflow.SRC_AS), uint64(r.SrcAS)},
+			{netflow.FieldName(netflow.DST_AS), uint64(r.DstAS)},
+			{netflow.FieldName(netflow.SRC_MASK), uint64(r.SrcMask)},
+			{netflow.FieldName(netflow.DST_MASK), uint64(r.DstMask)},
+		})
+	}
+	p.DataSets = []DataSet{set}
+	return nil
+}
+
+// decodeSFlow fills p with the header of an sFlow v5 datagram. Samples are
+// counted but not decoded.
+func (p *Packet) decodeSFlow(payload []byte) error {
+	if _, err := sflow.IsValidSFlow(payload); err != nil {
+		return err
+	}
+	offset := 8
+	var agent net.IP
+	if binary.BigEndian.Uint32(payload[4:8]) == sflow.AddressIPv4 {
+		agent = net.IP(payload[offset : offset+4])
+		offset += 4
+	} else {
+		agent = net.IP(payload[offset : offset+16])
+		offset += 16
+	}
+	p.Sequence = binary.BigEndian.Uint32(payload[offset+4 : offset+8])
+	p.Header = Fields{
+		{"version", uint64(sflow.Version)},
+		{"agent_address", agent.String()},
+		{"sub_agent_id", uint64(binary.BigEndian.Uint32(payload[offset : offset+4]))},
+		{"sequence", uint64(p.Sequence)},
+		{"sys_uptime", uint64(binary.BigEndian.Uint32(payload[offset+8 : offset+12]))},
+		{"samples", uint64(binary.BigEndian.Uint32(payload[offset+12 : offset+16]))},
+	}
+	return nil
+}
+
+// ipv4 formats a NetFlow v5 address.
+func ipv4(addr uint32) string {
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr)).String()
+}
+
+// fieldName returns the NetFlow v9 or IANA IPFIX name of a template field.
+// Fields missing from flowgre's tables are named by number.
+func fieldName(version uint16, f decode.Field) string {
+	if f.EnterpriseNumber == ipfix.ReverseEnterpriseNumber {
+		if name := ipfix.ReverseElementName(f.Type); name != "" {
+			return name
+		}
+	}
+	if f.EnterpriseNumber != 0 {
+		return fmt.Sprintf("enterprise%d_%d", f.EnterpriseNumber, f.Type)
+	}
+	if version == decode.VersionNetFlow {
+		if name := netflow.FieldName(f.Type); name != "" {
+			return name
+		}
+		return fmt.Sprintf("FIELD_%d", f.Type)
+	}
+	if name := ipfix.ElementName(f.Type); name != "" {
+		return name
+	}
+	return fmt.Sprintf("ie%d", f.Type)
+}
+
+// formatValue converts a decoded value for output: addresses as text, strings
+// as text, integers of up to 8 bytes as numbers and anything else as raw bytes.
+func formatValue(version uint16, v decode.Value) any {
+	if v.Field.EnterpriseNumber != 0 {
+		return opaque(v.Data)
+	}
+	kind := valueKind(version, v.Field.Type)
+	switch {
+	case kind == "ipv4Address" && len(v.Data) == net.IPv4len,
+		kind == "ipv6Address" && len(v.Data) == net.IPv6len:
+		return net.IP(v.Data).String()
+	case kind == "macAddress" && len(v.Data) == 6:
+		return net.HardwareAddr(v.Data).String()
+	case kind == "string" && utf8.Valid(v.Data):
+		return strings.TrimRight(string(v.Data), "\x00")
+	}
+	return opaque(v.Data)
+}
+
+// opaque returns data up to 8 bytes long as an integer, otherwise as bytes.
+func opaque(data []byte) any {
+	if len(data) > 0 && len(data) <= 8 {
+		return decode.Value{Data: data}.Uint()
+	}
+	return data
+}
+
+// valueKind returns the IPFIX abstract data type of a field, inferring it from
+// the field name for NetFlow v9.
+func valueKind(version uint16, fieldType uint16) string {
+	if version != decode.VersionNetFlow {
+		return ipfix.ElementDataType(fieldType)
+	}
+	switch fieldType {
+	case netflow.IPV4_SRC_ADDR, netflow.IPV4_DST_ADDR, netflow.IPV4_NEXT_HOP, netflow.BGP_IPV4_NEXT_HOP,
+		netflow.IPV4_SRC_PREFIX, netflow.IPV4_DST_PREFIX, netflow.MPLS_TOP_LABEL_IP_ADDR:
+		return "ipv4Address"
+	case netflow.IPV6_SRC_ADDR, netflow.IPV6_DST_ADDR, netflow.IPV6_NEXT_HOP, netflow.BGP_IPV6_NEXT_HOP:
+		return "ipv6Address"
+	case netflow.IN_SRC_MAC, netflow.OUT_DST_MAC, netflow.IN_DST_MAC, netflow.OUT_SRC_MAC:
+		return "macAddress"
+	case netflow.IF_NAME, netflow.IF_DESC, netflow.SAMPLER_NAME, netflow.APPLICATION_NAME, netflow.APPLICATION_DESCRIPTION:
+		return "string"
+	}
+	return ""
+}
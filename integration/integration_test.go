@@ -181,7 +181,7 @@ func TestRoundTrip_NetFlow(t *testing.T) {
 	sCtx, sCancel := context.WithCancel(context.Background())
 	sDone := make(chan struct{})
 	go func() {
-		single.RunCtx(sCtx, "127.0.0.1", recPort, 0, 10, "10.0.0.0/8", "172.16.0.0/12", false)
+		single.RunCtx(sCtx, "127.0.0.1", recPort, 0, 10, "10.0.0.0/8", "172.16.0.0/12", false, nil)
 		close(sDone)
 	}()
 	// Wait for sender to finish (it sends 10 flows then exits)
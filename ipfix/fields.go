@@ -0,0 +1,237 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package ipfix
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dataType is an RFC 7012 abstract data type, reduced to the encoded lengths
+// it allows and whether it may use variable-length encoding.
+type dataType struct {
+	name     string
+	min, max uint16
+	variable bool
+}
+
+// RFC 7011 Section 6.2 allows unsigned and signed integers to use reduced-size
+// encoding, so they accept any length up to their full width.
+var (
+	unsigned8            = dataType{"unsigned8", 1, 1, false}
+	unsigned16           = dataType{"unsigned16", 1, 2, false}
+	unsigned32           = dataType{"unsigned32", 1, 4, false}
+	unsigned64           = dataType{"unsigned64", 1, 8, false}
+	ipv4Address          = dataType{"ipv4Address", 4, 4, false}
+	ipv6Address          = dataType{"ipv6Address", 16, 16, false}
+	macAddress           = dataType{"macAddress", 6, 6, false}
+	dateTimeSeconds      = dataType{"dateTimeSeconds", 4, 4, false}
+	dateTimeMilliseconds = dataType{"dateTimeMilliseconds", 8, 8, false}
+	dateTimeMicroseconds = dataType{"dateTimeMicroseconds", 8, 8, false}
+	dateTimeNanoseconds  = dataType{"dateTimeNanoseconds", 8, 8, false}
+	str                  = dataType{"string", 1, 0xFFFE, true}
+	octetArray           = dataType{"octetArray", 1, 0xFFFE, true}
+)
+
+// RFC 6313 structured data types. A fixed-length list holds at least its
+// header: the semantic and element field specifier of a basicList, the
+// semantic and template ID of a subTemplateList.
+var (
+	basicList            = dataType{"basicList", 5, 0xFFFE, true}
+	subTemplateList      = dataType{"subTemplateList", 3, 0xFFFE, true}
+	subTemplateMultiList = dataType{"subTemplateMultiList", 1, 0xFFFE, true}
+)
+
+// element names an IANA Information Element and its data type.
+type element struct {
+	name string
+	typ  dataType
+}
+
+// elements lists commonly exported IANA Information Elements.
+var elements = map[uint16]element{
+	OctetDeltaCount:             {"octetDeltaCount", unsigned64},
+	PacketDeltaCount:            {"packetDeltaCount", unsigned64},
+	3:                           {"deltaFlowCount", unsigned64},
+	ProtocolIdentifier:          {"protocolIdentifier", unsigned8},
+	IPClassOfService:            {"ipClassOfService", unsigned8},
+	TCPFlags:                    {"tcpControlBits", unsigned16},
+	SourceTransportPort:         {"sourceTransportPort", unsigned16},
+	SourceIPv4Address:           {"sourceIPv4Address", ipv4Address},
+	9:                           {"sourceIPv4PrefixLength", unsigned8},
+	10:                          {"ingressInterface", unsigned32},
+	DestinationTransportPort:    {"destinationTransportPort", unsigned16},
+	DestinationIPv4Address:      {"destinationIPv4Address", ipv4Address},
+	13:                          {"destinationIPv4PrefixLength", unsigned8},
+	14:                          {"egressInterface", unsigned32},
+	15:                          {"ipNextHopIPv4Address", ipv4Address},
+	16:                          {"bgpSourceAsNumber", unsigned32},
+	17:                          {"bgpDestinationAsNumber", unsigned32},
+	18:                          {"bgpNextHopIPv4Address", ipv4Address},
+	19:                          {"postMCastPacketDeltaCount", unsigned64},
+	20:                          {"postMCastOctetDeltaCount", unsigned64},
+	21:                          {"flowEndSysUpTime", unsigned32},
+	22:                          {"flowStartSysUpTime", unsigned32},
+	PostOctetDeltaCount:         {"postOctetDeltaCount", unsigned64},
+	PostPacketDeltaCount:        {"postPacketDeltaCount", unsigned64},
+	25:                          {"minimumIpTotalLength", unsigned64},
+	26:                          {"maximumIpTotalLength", unsigned64},
+	SourceIPv6Address:           {"sourceIPv6Address", ipv6Address},
+	DestinationIPv6Address:      {"destinationIPv6Address", ipv6Address},
+	SourceIPv6PrefixLength:      {"sourceIPv6PrefixLength", unsigned8},
+	DestinationIPv6PrefixLength: {"destinationIPv6PrefixLength", unsigned8},
+	31:                          {"flowLabelIPv6", unsigned32},
+	32:                          {"icmpTypeCodeIPv4", unsigned16},
+	44:                          {"sourceIPv4Prefix", ipv4Address},
+	45:                          {"destinationIPv4Prefix", ipv4Address},
+	47:                          {"mplsTopLabelIPv4Address", ipv4Address},
+	52:                          {"minimumTTL", unsigned8},
+	53:                          {"maximumTTL", unsigned8},
+	54:                          {"fragmentIdentification", unsigned32},
+	55:                          {"postIpClassOfService", unsigned8},
+	56:                          {"sourceMacAddress", macAddress},
+	57:                          {"postDestinationMacAddress", macAddress},
+	58:                          {"vlanId", unsigned16},
+	59:                          {"postVlanId", unsigned16},
+	60:                          {"ipVersion", unsigned8},
+	FlowDirection:               {"flowDirection", unsigned8},
+	62:                          {"ipNextHopIPv6Address", ipv6Address},
+	63:                          {"bgpNextHopIPv6Address", ipv6Address},
+	80:                          {"destinationMacAddress", macAddress},
+	81:                          {"postSourceMacAddress", macAddress},
+	82:                          {"interfaceName", str},
+	83:                          {"interfaceDescription", str},
+	94:                          {"applicationDescription", str},
+	95:                          {"applicationId", octetArray},
+	96:                          {"applicationName", str},
+	128:                         {"bgpNextAdjacentAsNumber", unsigned32},
+	129:                         {"bgpPrevAdjacentAsNumber", unsigned32},
+	130:                         {"exporterIPv4Address", ipv4Address},
+	131:                         {"exporterIPv6Address", ipv6Address},
+	FlowEndReason:               {"flowEndReason", unsigned8},
+	148:                         {"flowId", unsigned64},
+	ObservationDomainId:         {"observationDomainId", unsigned32},
+	150:                         {"flowStartSeconds", dateTimeSeconds},
+	151:                         {"flowEndSeconds", dateTimeSeconds},
+	FlowStartMilliseconds:       {"flowStartMilliseconds", dateTimeMilliseconds},
+	FlowEndMilliseconds:         {"flowEndMilliseconds", dateTimeMilliseconds},
+	154:                         {"flowStartMicroseconds", dateTimeMicroseconds},
+	155:                         {"flowEndMicroseconds", dateTimeMicroseconds},
+	156:                         {"flowStartNanoseconds", dateTimeNanoseconds},
+	157:                         {"flowEndNanoseconds", dateTimeNanoseconds},
+	160:                         {"systemInitTimeMilliseconds", dateTimeMilliseconds},
+	169:                         {"destinationIPv6Prefix", ipv6Address},
+	170:                         {"sourceIPv6Prefix", ipv6Address},
+	176:                         {"icmpTypeIPv4", unsigned8},
+	177:                         {"icmpCodeIPv4", unsigned8},
+	180:                         {"udpSourcePort", unsigned16},
+	181:                         {"udpDestinationPort", unsigned16},
+	182:                         {"tcpSourcePort", unsigned16},
+	183:                         {"tcpDestinationPort", unsigned16},
+	225:                         {"postNATSourceIPv4Address", ipv4Address},
+	226:                         {"postNATDestinationIPv4Address", ipv4Address},
+	227:                         {"postNAPTSourceTransportPort", unsigned16},
+	228:                         {"postNAPTDestinationTransportPort", unsigned16},
+	234:                         {"ingressVRFID", unsigned32},
+	235:                         {"egressVRFID", unsigned32},
+	BiflowDirection:             {"biflowDirection", unsigned8},
+	258:                         {"collectionTimeMilliseconds", dateTimeMilliseconds},
+	281:                         {"postNATSourceIPv6Address", ipv6Address},
+	282:                         {"postNATDestinationIPv6Address", ipv6Address},
+	BasicList:                   {"basicList", basicList},
+	SubTemplateList:             {"subTemplateList", subTemplateList},
+	SubTemplateMultiList:        {"subTemplateMultiList", subTemplateMultiList},
+	322:                         {"observationTimeSeconds", dateTimeSeconds},
+	323:                         {"observationTimeMilliseconds", dateTimeMilliseconds},
+	324:                         {"observationTimeMicroseconds", dateTimeMicroseconds},
+	325:                         {"observationTimeNanoseconds", dateTimeNanoseconds},
+}
+
+// elementsByName maps lower-cased Information Element names to their ID.
+var elementsByName = func() map[string]uint16 {
+	m := make(map[string]uint16, len(elements))
+	for id, e := range elements {
+		m[strings.ToLower(e.name)] = id
+	}
+	return m
+}()
+
+// ElementByName returns the ID of an IANA Information Element name such as
+// "octetDeltaCount". The lookup is case-insensitive.
+func ElementByName(name string) (uint16, bool) {
+	id, ok := elementsByName[strings.ToLower(name)]
+	return id, ok
+}
+
+// ElementName returns the IANA name of an Information Element, or "" if it is unknown.
+func ElementName(id uint16) string {
+	return elements[id].name
+}
+
+// ReverseElementName returns the RFC 5103 name of the reverse of IANA element
+// id, such as "reverseOctetDeltaCount", or "" if id is unknown.
+func ReverseElementName(id uint16) string {
+	name := elements[id].name
+	if name == "" {
+		return ""
+	}
+	return "reverse" + strings.ToUpper(name[:1]) + name[1:]
+}
+
+// ElementDataType returns the RFC 7012 abstract data type of an Information
+// Element, such as "ipv4Address", or "" if it is unknown.
+func ElementDataType(id uint16) string {
+	return elements[id].typ.name
+}
+
+// ValidateField returns an error if f is not a valid template field. IANA
+// elements are checked with ValidateFieldLength. Enterprise-specific elements
+// need an ID that leaves the enterprise bit clear and accept any length, except
+// RFC 5103 reverse elements, which take the lengths of their forward element.
+func ValidateField(f Field) error {
+	if f.EnterpriseNumber == 0 {
+		if f.Type&enterpriseBit != 0 {
+			return fmt.Errorf("information element %d has the enterprise bit set but no enterprise number", f.Type)
+		}
+		return ValidateFieldLength(f.Type, f.Length)
+	}
+	if f.Type == 0 || f.Type&enterpriseBit != 0 {
+		return fmt.Errorf("enterprise %d information element ID must be between 1 and 32767, got %d", f.EnterpriseNumber, f.Type)
+	}
+	if f.Length == 0 {
+		return fmt.Errorf("enterprise %d information element %d has zero length", f.EnterpriseNumber, f.Type)
+	}
+	if f.EnterpriseNumber == ReverseEnterpriseNumber {
+		if err := ValidateFieldLength(f.Type, f.Length); err != nil {
+			return fmt.Errorf("reverse element: %w", err)
+		}
+	}
+	return nil
+}
+
+// ValidateFieldLength returns an error if length is not a valid encoding of
+// the Information Element id. VariableLength is accepted for strings, octet
+// arrays and RFC 6313 lists. Unknown elements accept any length.
+func ValidateFieldLength(id, length uint16) error {
+	if length == 0 {
+		return fmt.Errorf("information element %d has zero length", id)
+	}
+	e, ok := elements[id]
+	if !ok {
+		return nil
+	}
+	if length == VariableLength {
+		if !e.typ.variable {
+			return fmt.Errorf("%s (%s) cannot use variable-length encoding", e.name, e.typ.name)
+		}
+		return nil
+	}
+	if length < e.typ.min || length > e.typ.max {
+		if e.typ.min == e.typ.max {
+			return fmt.Errorf("%s (%s) must be %d bytes, got %d", e.name, e.typ.name, e.typ.min, length)
+		}
+		return fmt.Errorf("%s (%s) must be %d-%d bytes, got %d", e.name, e.typ.name, e.typ.min, e.typ.max, length)
+	}
+	return nil
+}
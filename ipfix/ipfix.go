@@ -22,12 +22,23 @@ import (
 // IPFIX version number per RFC 7011.
 const Version = 10
 
+// HeaderSize is the size of the IPFIX Message Header (RFC 7011 Section 3.1).
+const HeaderSize = 16
+
 // RFC 7011 Section 3.3.2: Set ID constants.
 const (
 	SetIDTemplate        = 2
 	SetIDOptionsTemplate = 3
 )
 
+// Template IDs used for generated data and options data sets.
+const (
+	// DefaultTemplateID is the template ID used by profiles that do not choose their own.
+	DefaultTemplateID = 256
+	// OptionsTemplateID is the ID of the observation domain options template.
+	OptionsTemplateID = 257
+)
+
 // IANA IPFIX Information Element identifiers (RFC 7011 / IANA registry).
 const (
 	OctetDeltaCount             = 1
@@ -50,8 +61,16 @@ const (
 	FlowEndMilliseconds         = 153
 	FlowEndReason               = 136
 	ObservationDomainId         = 149
+	BiflowDirection             = 239
+	BasicList                   = 291
+	SubTemplateList             = 292
+	SubTemplateMultiList        = 293
 )
 
+// VariableLength is the field length of a variable-length Information Element
+// (RFC 7011 Section 7).
+const VariableLength = 0xFFFF
+
 // Header is the RFC 7011 Section 3.1 IPFIX Message Header (16 bytes).
 type Header struct {
 	Version             uint16 // 10 for IPFIX
@@ -71,10 +90,51 @@ func (h *Header) Generate(sourceID int, sequenceNum uint32) Header {
 	}
 }
 
+// ReverseEnterpriseNumber is the Private Enterprise Number of RFC 5103 reverse
+// Information Elements. A reverse element has the ID and data type of its
+// forward IANA counterpart, e.g. reverseOctetDeltaCount is 29305/1.
+const ReverseEnterpriseNumber = 29305
+
+// enterpriseBit is the high bit of an Information Element ID, set in a field
+// specifier followed by a Private Enterprise Number (RFC 7011 Section 3.2).
+const enterpriseBit = 0x8000
+
 // Field describes a single field in an IPFIX template.
 type Field struct {
-	Type   uint16
-	Length uint16
+	Type             uint16
+	Length           uint16
+	EnterpriseNumber uint32 // Private Enterprise Number; 0 for IANA elements
+}
+
+// specifierSize returns the size of f's field specifier: 4 bytes, or 8 for an
+// enterprise-specific element.
+func (f Field) specifierSize() int {
+	if f.EnterpriseNumber != 0 {
+		return 8
+	}
+	return 4
+}
+
+// fieldsSize returns the size of the field specifiers of fields.
+func fieldsSize(fields []Field) int {
+	size := 0
+	for _, f := range fields {
+		size += f.specifierSize()
+	}
+	return size
+}
+
+// writeFieldSpecifier writes f's field specifier, setting the enterprise bit
+// and appending the enterprise number for an enterprise-specific element.
+func writeFieldSpecifier(buf *bytes.Buffer, f Field) {
+	if f.EnterpriseNumber == 0 {
+		mustWriteBinary(buf, f.Type)
+		mustWriteBinary(buf, f.Length)
+		return
+	}
+	mustWriteBinary(buf, f.Type|enterpriseBit)
+	mustWriteBinary(buf, f.Length)
+	mustWriteBinary(buf, f.EnterpriseNumber)
 }
 
 // Template describes an IPFIX template record.
@@ -103,14 +163,18 @@ func (t *TemplateFlowSet) Generate(_ *netflow.Session, profile ...IPFIXFlowProfi
 
 	fields := p.TemplateFields()
 
-	template := Template{
-		TemplateID: 256,
+	// Sub-templates of the profile's lists go ahead of the template using them
+	templates := append(profileSubTemplates(p), Template{
+		TemplateID: profileTemplateID(p),
 		FieldCount: uint16(len(fields)),
 		Fields:     fields,
-	}
+	})
 
-	// FlowSetID(2) + Length(2) + TemplateID(2) + FieldCount(2) + fields*N*4
-	rawSize := 4 + 4 + len(fields)*4
+	// FlowSetID(2) + Length(2) + per template: TemplateID(2) + FieldCount(2) + field specifiers
+	rawSize := 4
+	for _, t := range templates {
+		rawSize += 4 + fieldsSize(t.Fields)
+	}
 	padding := 0
 	remainder := rawSize % 4
 	if remainder > 0 {
@@ -121,7 +185,7 @@ func (t *TemplateFlowSet) Generate(_ *netflow.Session, profile ...IPFIXFlowProfi
 	return TemplateFlowSet{
 		FlowSetID: SetIDTemplate,
 		Length:    uint16(rawSize),
-		Templates: []Template{template},
+		Templates: templates,
 		Padding:   padding,
 	}
 }
@@ -154,8 +218,8 @@ func (o *OptionsTemplateFlowSet) Generate(_ *netflow.Session) OptionsTemplateFlo
 
 	// Calculate raw size:
 	// FlowSetID(2) + Length(2) + TemplateID(2) + FieldCount(2) + ScopeFieldCount(2)
-	// + allFields*N*4
-	rawSize := 4 + 6 + len(allFields)*4
+	// + field specifiers
+	rawSize := 4 + 6 + fieldsSize(allFields)
 	padding := 0
 	remainder := rawSize % 4
 	if remainder > 0 {
@@ -167,7 +231,7 @@ func (o *OptionsTemplateFlowSet) Generate(_ *netflow.Session) OptionsTemplateFlo
 		FlowSetID: SetIDOptionsTemplate,
 		Length:    uint16(rawSize),
 		Template: OptionsTemplate{
-			TemplateID:      257,
+			TemplateID:      OptionsTemplateID,
 			FieldCount:      uint16(len(allFields)),
 			ScopeFieldCount: uint16(len(scopeFields)),
 			Fields:          allFields,
@@ -207,15 +271,18 @@ func (o *OptionsDataFlowSet) Generate(sourceID int) OptionsDataFlowSet {
 	}
 
 	return OptionsDataFlowSet{
-		FlowSetID: 257,
+		FlowSetID: OptionsTemplateID,
 		Length:    uint16(length),
 		Records:   records,
 		Padding:   padding,
 	}
 }
 
-// GenericFlow represents an IPFIX flow record with IANA field types.
-// Field order must match GetTemplateFields() exactly.
+// GenericFlow represents an IPFIX flow record with one field per
+// GenericIPFIXProfile template field.
+//
+// Deprecated: data flow sets encode GenericIPFIXProfile records from
+// DefaultValueSource and no longer use GenericFlow.
 type GenericFlow struct {
 	OctetDeltaCount      uint32
 	PostOctetDeltaCount  uint32
@@ -238,32 +305,16 @@ type GenericFlow struct {
 	FlowEndReason        uint8
 }
 
-// GetTemplateFields returns the IPFIX field definitions for the template.
+// GetTemplateFields returns the GenericIPFIXProfile template fields.
+//
+// Deprecated: use GenericIPFIXProfile.TemplateFields.
 func (gf *GenericFlow) GetTemplateFields() []Field {
-	return []Field{
-		{Type: OctetDeltaCount, Length: 4},
-		{Type: PostOctetDeltaCount, Length: 4},
-		{Type: PacketDeltaCount, Length: 4},
-		{Type: PostPacketDeltaCount, Length: 4},
-		{Type: SourceIPv4Address, Length: 4},
-		{Type: DestinationIPv4Address, Length: 4},
-		{Type: SourceIPv6Address, Length: 16},
-		{Type: DestinationIPv6Address, Length: 16},
-		{Type: SourceIPv6PrefixLength, Length: 1},
-		{Type: DestinationIPv6PrefixLength, Length: 1},
-		{Type: SourceTransportPort, Length: 2},
-		{Type: DestinationTransportPort, Length: 2},
-		{Type: ProtocolIdentifier, Length: 1},
-		{Type: TCPFlags, Length: 1},
-		{Type: FlowStartMilliseconds, Length: 8},
-		{Type: FlowEndMilliseconds, Length: 8},
-		{Type: FlowDirection, Length: 1},
-		{Type: IPClassOfService, Length: 1},
-		{Type: FlowEndReason, Length: 1},
-	}
+	return new(GenericIPFIXProfile).TemplateFields()
 }
 
 // Generate creates a GenericFlow with randomly generated data.
+//
+// Deprecated: data flow sets generate records from DefaultValueSource.
 func (gf *GenericFlow) Generate(srcIP net.IP, dstIP net.IP, flowSrcPort int, session *netflow.Session) (GenericFlow, error) {
 	now := time.Now()
 	epochMillis := uint64(now.UnixMilli())
@@ -338,8 +389,12 @@ type DataFlowSet struct {
 }
 
 // Generate creates a DataFlowSet with random flow data.
+// If profile is nil, defaults to GenericIPFIXProfile for backward compatibility.
 func (d *DataFlowSet) Generate(flowCount int, srcRange string, dstRange string, flowSrcPort int, session *netflow.Session, profile ...IPFIXFlowProfile) (DataFlowSet, error) {
-	_ = profile
+	p := IPFIXFlowProfile(&GenericIPFIXProfile{})
+	if len(profile) > 0 && profile[0] != nil {
+		p = profile[0]
+	}
 
 	protoPorts := utils.ProtoPorts
 
@@ -361,19 +416,23 @@ func (d *DataFlowSet) Generate(flowCount int, srcRange string, dstRange string,
 			}
 			port = protoPorts[idx]
 		}
-		flow, err := new(GenericFlow).Generate(srcIP, dstIP, port, session)
+		flow, err := generateFlow(p, srcIP, dstIP, port, session)
 		if err != nil {
 			return DataFlowSet{}, fmt.Errorf("generate flow %d: %w", i, err)
 		}
 		items[i] = flow
 	}
 
-	// Calculate length: FlowSetID(2) + Length(2) + records + padding
-	recordSize := binary.Size(GenericFlow{})
-	length := 4 + flowCount*recordSize
+	// Calculate length: FlowSetID(2) + Length(2) + records + padding.
+	// RFC 7011 Section 3.3.1: padding must be shorter than any record, which
+	// records of empty variable-length fields may not be, so it is left out then.
+	length := 4
+	for _, item := range items {
+		length += binary.Size(item)
+	}
 	padding := 0
 	remainder := length % 4
-	if remainder > 0 {
+	if remainder > 0 && 4-remainder < minRecordLength(p.TemplateFields()) {
 		padding = 4 - remainder
 		length += padding
 	}
@@ -386,7 +445,7 @@ func (d *DataFlowSet) Generate(flowCount int, srcRange string, dstRange string,
 	}
 
 	return DataFlowSet{
-		FlowSetID: 256,
+		FlowSetID: profileTemplateID(p),
 		Length:    uint16(length),
 		Items:     items,
 		Padding:   padding,
@@ -456,8 +515,7 @@ func (f *IPFIX) ToBytes() (bytes.Buffer, error) {
 			mustWriteBinary(&setsBuf, template.TemplateID)
 			mustWriteBinary(&setsBuf, template.FieldCount)
 			for _, field := range template.Fields {
-				mustWriteBinary(&setsBuf, field.Type)
-				mustWriteBinary(&setsBuf, field.Length)
+				writeFieldSpecifier(&setsBuf, field)
 			}
 		}
 		if tFlow.Padding > 0 {
@@ -473,8 +531,7 @@ func (f *IPFIX) ToBytes() (bytes.Buffer, error) {
 		mustWriteBinary(&setsBuf, t.FieldCount)
 		mustWriteBinary(&setsBuf, t.ScopeFieldCount)
 		for _, field := range t.Fields {
-			mustWriteBinary(&setsBuf, field.Type)
-			mustWriteBinary(&setsBuf, field.Length)
+			writeFieldSpecifier(&setsBuf, field)
 		}
 		if oFlow.Padding > 0 {
 			setsBuf.Write(bytes.Repeat([]byte{0}, oFlow.Padding))
@@ -530,29 +587,60 @@ func (f *IPFIX) ToBytes() (bytes.Buffer, error) {
 	return result, nil
 }
 
+// parseFieldSpecifier returns the field described by the specifier at offset,
+// whose size fieldSpecifierSize has checked.
+func parseFieldSpecifier(payload []byte, offset int) Field {
+	f := Field{
+		Type:   binary.BigEndian.Uint16(payload[offset : offset+2]),
+		Length: binary.BigEndian.Uint16(payload[offset+2 : offset+4]),
+	}
+	if f.Type&enterpriseBit != 0 {
+		f.Type &^= enterpriseBit
+		f.EnterpriseNumber = binary.BigEndian.Uint32(payload[offset+4 : offset+8])
+	}
+	return f
+}
+
 // fieldSpecifierSize returns the size of a field specifier at the given offset.
 // Standard specifiers are 4 bytes; enterprise specifiers are 8 bytes.
-// RFC 7011 §3.2: The Enterprise bit is the high bit of Element Length.
+// RFC 7011 §3.2: The Enterprise bit is the high bit of the Information Element ID.
 func fieldSpecifierSize(payload []byte, offset int) int {
 	if offset+4 > len(payload) {
 		return 4 // assume standard if we can't read
 	}
-	elementLength := binary.BigEndian.Uint16(payload[offset : offset+2])
-	if elementLength&0x8000 != 0 {
+	elementID := binary.BigEndian.Uint16(payload[offset : offset+2])
+	if elementID&enterpriseBit != 0 {
 		return 8 // enterprise specifier has 4-byte PEN
 	}
 	return 4
 }
 
-// validateTemplateRecord validates a Template record starting at setOffset.
+// isPadding reports whether the rest of a set is zero padding (RFC 7011 §3.3.1).
+func isPadding(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// validateTemplateRecord validates a Template record starting at setOffset
+// and records its fields in templates.
 // Returns the number of bytes consumed (excluding padding).
-func validateTemplateRecord(payload []byte, setOffset, remaining int) (int, error) {
+func validateTemplateRecord(payload []byte, setOffset, remaining int, templates map[uint16][]Field) (int, error) {
 	if remaining < 4 {
 		return 0, fmt.Errorf("insufficient data for Template record header")
 	}
 	templateID := binary.BigEndian.Uint16(payload[setOffset : setOffset+2])
 	fieldCount := binary.BigEndian.Uint16(payload[setOffset+2 : setOffset+4])
 
+	// RFC 7011 §8.1: a withdrawal with the Set ID as its Template ID
+	// withdraws all Templates of the Observation Domain.
+	if templateID == SetIDTemplate && fieldCount == 0 {
+		clear(templates)
+		return 4, nil
+	}
 	if templateID < 256 {
 		return 0, fmt.Errorf("Template ID %d is below 256", templateID)
 	}
@@ -560,10 +648,12 @@ func validateTemplateRecord(payload []byte, setOffset, remaining int) (int, erro
 	// RFC 7011 §8.1: A Template Record with Field Count of 0 is a
 	// Template Withdrawal. It contains only the Template ID and Field Count.
 	if fieldCount == 0 {
+		delete(templates, templateID)
 		return 4, nil
 	}
 
 	consumed := 4
+	fields := make([]Field, 0, fieldCount)
 	for i := uint16(0); i < fieldCount; i++ {
 		if consumed+4 > remaining {
 			return 0, fmt.Errorf("insufficient data for field specifier %d", i)
@@ -572,20 +662,30 @@ func validateTemplateRecord(payload []byte, setOffset, remaining int) (int, erro
 		if consumed+specSize > remaining {
 			return 0, fmt.Errorf("enterprise field specifier %d exceeds remaining bytes", i)
 		}
+		fields = append(fields, parseFieldSpecifier(payload, setOffset+consumed))
 		consumed += specSize
 	}
+	templates[templateID] = fields
 	return consumed, nil
 }
 
-// validateOptionsTemplateRecord validates an Options Template record.
+// validateOptionsTemplateRecord validates an Options Template record and
+// records its fields in templates.
 // Returns the number of bytes consumed (excluding padding).
-func validateOptionsTemplateRecord(payload []byte, setOffset, remaining int) (int, error) {
+func validateOptionsTemplateRecord(payload []byte, setOffset, remaining int, templates map[uint16][]Field) (int, error) {
 	if remaining < 4 {
 		return 0, fmt.Errorf("insufficient data for Options Template record header")
 	}
 	templateID := binary.BigEndian.Uint16(payload[setOffset : setOffset+2])
 	fieldCount := binary.BigEndian.Uint16(payload[setOffset+2 : setOffset+4])
 
+	// RFC 7011 §8.1: withdraws all Options Templates of the Observation
+	// Domain. templates doesn't tell them apart from Templates, so it drops
+	// both and later Data Sets of either go unchecked.
+	if templateID == SetIDOptionsTemplate && fieldCount == 0 {
+		clear(templates)
+		return 4, nil
+	}
 	if templateID < 256 {
 		return 0, fmt.Errorf("Options Template ID %d is below 256", templateID)
 	}
@@ -593,6 +693,7 @@ func validateOptionsTemplateRecord(payload []byte, setOffset, remaining int) (in
 	// RFC 7011 §8.1: Options Template Withdrawal is a 4-byte record with
 	// Template ID and Field Count of zero (no Scope Field Count field).
 	if fieldCount == 0 {
+		delete(templates, templateID)
 		return 4, nil
 	}
 
@@ -611,6 +712,7 @@ func validateOptionsTemplateRecord(payload []byte, setOffset, remaining int) (in
 	}
 
 	consumed := 6
+	fields := make([]Field, 0, fieldCount)
 	for i := uint16(0); i < fieldCount; i++ {
 		if consumed+4 > remaining {
 			return 0, fmt.Errorf("insufficient data for field specifier %d", i)
@@ -619,12 +721,16 @@ func validateOptionsTemplateRecord(payload []byte, setOffset, remaining int) (in
 		if consumed+specSize > remaining {
 			return 0, fmt.Errorf("enterprise field specifier %d exceeds remaining bytes", i)
 		}
+		fields = append(fields, parseFieldSpecifier(payload, setOffset+consumed))
 		consumed += specSize
 	}
+	templates[templateID] = fields
 	return consumed, nil
 }
 
-// IsValidIPFIX validates the given payload against RFC 7011.
+// IsValidIPFIX validates the given payload against RFC 7011. Data Sets whose
+// template is defined earlier in the same message are walked record by record,
+// checking variable-length fields and RFC 6313 lists fit their records.
 func IsValidIPFIX(payload []byte) (bool, error) {
 	if len(payload) < 16 {
 		return false, fmt.Errorf("payload too short for IPFIX header: %d bytes", len(payload))
@@ -646,6 +752,7 @@ func IsValidIPFIX(payload []byte) (bool, error) {
 	offset := 16
 	limit := int(messageLength)
 	setCount := 0
+	templates := make(map[uint16][]Field)
 
 	for offset < limit {
 		if offset+4 > limit {
@@ -681,7 +788,10 @@ func IsValidIPFIX(payload []byte) (bool, error) {
 			// Template Set: one or more Template records
 			recordsParsed := 0
 			for remaining >= 4 {
-				consumed, err := validateTemplateRecord(payload, setOffset, remaining)
+				if recordsParsed > 0 && isPadding(payload[setOffset:setOffset+remaining]) {
+					break
+				}
+				consumed, err := validateTemplateRecord(payload, setOffset, remaining, templates)
 				if err != nil {
 					return false, fmt.Errorf("Template Set at offset %d: %w", offset, err)
 				}
@@ -697,7 +807,10 @@ func IsValidIPFIX(payload []byte) (bool, error) {
 			// Minimum is 4 bytes (withdrawal: TemplateID + FieldCount).
 			recordsParsed := 0
 			for remaining >= 4 {
-				consumed, err := validateOptionsTemplateRecord(payload, setOffset, remaining)
+				if recordsParsed > 0 && isPadding(payload[setOffset:setOffset+remaining]) {
+					break
+				}
+				consumed, err := validateOptionsTemplateRecord(payload, setOffset, remaining, templates)
 				if err != nil {
 					return false, fmt.Errorf("Options Template Set at offset %d: %w", offset, err)
 				}
@@ -709,7 +822,13 @@ func IsValidIPFIX(payload []byte) (bool, error) {
 				return false, fmt.Errorf("Options Template Set at offset %d contains no records", offset)
 			}
 		default:
-			// Data Set (ID >= 256): records are opaque, just check length
+			// Data Set (ID >= 256): records can only be checked against a
+			// template from this message
+			if fields, ok := templates[setID]; ok {
+				if err := validateDataRecords(payload[setOffset:setEnd], fields, templates); err != nil {
+					return false, fmt.Errorf("Data Set %d at offset %d: %w", setID, offset, err)
+				}
+			}
 		}
 
 		setCount++
@@ -761,8 +880,9 @@ func (s *IPFIXSequence) Current() uint32 {
 
 // GenerateTemplateIPFIX creates an IPFIX packet containing template and options template FlowSets.
 // The sequence number reflects the current count of Data Records sent.
-func GenerateTemplateIPFIX(sourceID int, seq *IPFIXSequence) IPFIX {
-	templateFlow := new(TemplateFlowSet).Generate(nil)
+// If profile is nil, defaults to GenericIPFIXProfile.
+func GenerateTemplateIPFIX(sourceID int, seq *IPFIXSequence, profile ...IPFIXFlowProfile) IPFIX {
+	templateFlow := new(TemplateFlowSet).Generate(nil, profile...)
 	optionsTemplate := new(OptionsTemplateFlowSet).Generate(nil)
 
 	// Template messages carry the current Data Record count, don't advance it
@@ -791,9 +911,10 @@ func GenerateOptionsDataIPFIX(sourceID int, seq *IPFIXSequence) IPFIX {
 }
 
 // GenerateDataIPFIX creates an IPFIX packet containing only data FlowSets.
-func GenerateDataIPFIX(flowCount int, sourceID int, srcRange string, dstRange string, flowSrcPort int, seq *IPFIXSequence) (IPFIX, error) {
+// If profile is nil, defaults to GenericIPFIXProfile.
+func GenerateDataIPFIX(flowCount int, sourceID int, srcRange string, dstRange string, flowSrcPort int, seq *IPFIXSequence, profile ...IPFIXFlowProfile) (IPFIX, error) {
 	session := netflow.NewSession()
-	dataFlow, err := new(DataFlowSet).Generate(flowCount, srcRange, dstRange, flowSrcPort, session)
+	dataFlow, err := new(DataFlowSet).Generate(flowCount, srcRange, dstRange, flowSrcPort, session, profile...)
 	if err != nil {
 		return IPFIX{}, fmt.Errorf("generate data flow set: %w", err)
 	}
@@ -854,10 +975,7 @@ func (t *TemplateFlowSet) size() int {
 	for _, i := range t.Templates {
 		size += binary.Size(i.TemplateID)
 		size += binary.Size(i.FieldCount)
-		for _, f := range i.Fields {
-			size += binary.Size(f.Type)
-			size += binary.Size(f.Length)
-		}
+		size += fieldsSize(i.Fields)
 	}
 	size += t.Padding
 	return size
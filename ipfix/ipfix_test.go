@@ -15,6 +15,23 @@ import (
 	"github.com/google/go-cmp/cmp"
 )
 
+// readRecord decodes an encoded record item into T, the struct with its wire layout.
+func readRecord[T any](t *testing.T, item any) T {
+	t.Helper()
+	var record T
+	b, ok := item.([]byte)
+	if !ok {
+		t.Fatalf("Got: item of type %T Want: []byte", item)
+	}
+	if len(b) != binary.Size(record) {
+		t.Fatalf("Got: record of %d bytes Want: %d", len(b), binary.Size(record))
+	}
+	if err := binary.Read(bytes.NewReader(b), binary.BigEndian, &record); err != nil {
+		t.Fatalf("read %T: %v", record, err)
+	}
+	return record
+}
+
 func TestHeader_Generate(t *testing.T) {
 	t.Parallel()
 	sourceID := 618
@@ -208,9 +225,11 @@ func TestToBytes_RoundTrip(t *testing.T) {
 			remaining -= 2
 			fields := make([]Field, fieldCount)
 			for i := range fieldCount {
-				if err := binary.Read(treader, binary.BigEndian, &fields[i]); err != nil {
+				var spec [2]uint16
+				if err := binary.Read(treader, binary.BigEndian, &spec); err != nil {
 					break
 				}
+				fields[i] = Field{Type: spec[0], Length: spec[1]}
 				remaining -= 4
 			}
 			tparsed.OptionsTemplateFlowSets = append(tparsed.OptionsTemplateFlowSets, OptionsTemplateFlowSet{
@@ -236,9 +255,11 @@ func TestToBytes_RoundTrip(t *testing.T) {
 			remaining -= 2
 			fields := make([]Field, fieldCount)
 			for i := range fieldCount {
-				if err := binary.Read(treader, binary.BigEndian, &fields[i]); err != nil {
+				var spec [2]uint16
+				if err := binary.Read(treader, binary.BigEndian, &spec); err != nil {
 					break
 				}
+				fields[i] = Field{Type: spec[0], Length: spec[1]}
 				remaining -= 4
 			}
 			tFlowSet := TemplateFlowSet{
@@ -321,6 +342,10 @@ func TestToBytes_RoundTrip(t *testing.T) {
 
 	dparsed.DataFlowSets = append(dparsed.DataFlowSets, *dFlowSet)
 
+	// Generated records are encoded bytes; compare them as GenericFlow
+	for i, item := range dFlow.DataFlowSets[0].Items {
+		dFlow.DataFlowSets[0].Items[i] = readRecord[GenericFlow](t, item)
+	}
 	if !cmp.Equal(dFlow, dparsed) {
 		t.Log("Generated IPFIX Data Flow and Parsed are different!")
 		// Header.Length is set during ToBytes, so set it before comparing
@@ -615,10 +640,7 @@ func TestGenerateDataIPFIX_IPv6(t *testing.T) {
 		}
 
 		for i, item := range dFlow.Items {
-			gf, ok := item.(GenericFlow)
-			if !ok {
-				t.Fatalf("Item %d is not a GenericFlow", i)
-			}
+			gf := readRecord[GenericFlow](t, item)
 			if gf.SourceIPv6Addr == [16]byte{} {
 				t.Errorf("Item %d: expected non-zero IPv6 src", i)
 			}
@@ -907,6 +929,42 @@ func TestGolden_OptionsTemplateWithdrawal(t *testing.T) {
 	}
 }
 
+func TestGolden_WithdrawAllTemplates(t *testing.T) {
+	t.Parallel()
+	// RFC 7011 §8.1: a withdrawal whose Template ID is the Set ID withdraws
+	// all (Options) Templates. Trailing zero bytes are set padding.
+	for _, setID := range []uint16{SetIDTemplate, SetIDOptionsTemplate} {
+		payload := make([]byte, 28)
+		binary.BigEndian.PutUint16(payload[0:2], 10)      // Version
+		binary.BigEndian.PutUint16(payload[2:4], 28)      // Length
+		binary.BigEndian.PutUint32(payload[4:8], 1000)    // ExportTime
+		binary.BigEndian.PutUint32(payload[12:16], 42)    // ObservationDomainId
+		binary.BigEndian.PutUint16(payload[16:18], setID) // FlowSetID
+		binary.BigEndian.PutUint16(payload[18:20], 12)    // Set Length
+		binary.BigEndian.PutUint16(payload[20:22], setID) // TemplateID (all)
+		// FieldCount 0 and 4 bytes of padding
+
+		if ok, err := IsValidIPFIX(payload); !ok {
+			t.Errorf("set %d: IsValidIPFIX should accept withdraw-all: %v", setID, err)
+		}
+	}
+}
+
+func TestGolden_RejectPaddingOnlyTemplateSet(t *testing.T) {
+	t.Parallel()
+	payload := make([]byte, 24)
+	binary.BigEndian.PutUint16(payload[0:2], 10)   // Version
+	binary.BigEndian.PutUint16(payload[2:4], 24)   // Length
+	binary.BigEndian.PutUint32(payload[4:8], 1000) // ExportTime
+	binary.BigEndian.PutUint16(payload[16:18], 2)  // FlowSetID
+	binary.BigEndian.PutUint16(payload[18:20], 8)  // Set Length
+	// Template ID 0 is not padding without a record before it
+
+	if ok, _ := IsValidIPFIX(payload); ok {
+		t.Error("IsValidIPFIX should reject a Template Set without records")
+	}
+}
+
 func TestGolden_RejectOptionsTemplateZeroScopeFields(t *testing.T) {
 	t.Parallel()
 	// RFC 7011 §3.4.2.2: Normal Options Templates must have at least one
@@ -975,6 +1033,83 @@ func TestGolden_TemplateSetByteLayout(t *testing.T) {
 	}
 }
 
+func TestGolden_EnterpriseFieldSpecifier(t *testing.T) {
+	t.Parallel()
+	// An enterprise field specifier sets the high bit of the element ID and is
+	// followed by the 4-byte PEN (RFC 7011 Section 3.2).
+	fields := []Field{
+		{Type: OctetDeltaCount, Length: 4},
+		{Type: 1, Length: 2, EnterpriseNumber: 29305},
+	}
+	p := NewCustomProfile("enterprise", 300, fields, nil)
+	msg := GenerateTemplateIPFIX(42, NewIPFIXSequence(), p)
+	buf, err := msg.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes error: %v", err)
+	}
+	want := []byte{
+		0x00, 0x02, 0x00, 0x14, // Template Set, length 20
+		0x01, 0x2c, 0x00, 0x02, // template 300, 2 fields
+		0x00, 0x01, 0x00, 0x04, // octetDeltaCount, length 4
+		0x80, 0x01, 0x00, 0x02, 0x00, 0x00, 0x72, 0x79, // enterprise element 1, length 2, PEN 29305
+	}
+	if got := buf.Bytes()[16 : 16+len(want)]; !bytes.Equal(got, want) {
+		t.Errorf("Got: %x Want: %x", got, want)
+	}
+	if got := int(msg.TemplateFlowSets[0].Length); got != len(want) {
+		t.Errorf("Got: set length %d Want: %d", got, len(want))
+	}
+	if ok, err := IsValidIPFIX(buf.Bytes()); !ok {
+		t.Errorf("IsValidIPFIX should accept the template: %v", err)
+	}
+
+	data, err := GenerateDataIPFIX(2, 42, "10.0.0.0/8", "10.0.0.0/8", 0, NewIPFIXSequence(), p)
+	if err != nil {
+		t.Fatalf("GenerateDataIPFIX error: %v", err)
+	}
+	dBuf, err := data.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes error: %v", err)
+	}
+	// Two 6-byte records and 4 bytes of set header, padded to 16
+	if got := dBuf.Len(); got != 16+16 {
+		t.Errorf("Got: data message %d bytes Want: %d", got, 32)
+	}
+}
+
+func TestValidateField(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		field   Field
+		wantErr bool
+	}{
+		{"iana", Field{Type: SourceIPv4Address, Length: 4}, false},
+		{"iana wrong length", Field{Type: SourceIPv4Address, Length: 2}, true},
+		{"enterprise bit without pen", Field{Type: 0x8001, Length: 4}, true},
+		{"enterprise any length", Field{Type: SourceIPv4Address, Length: 2, EnterpriseNumber: 9}, false},
+		{"enterprise id with enterprise bit", Field{Type: 0x8001, Length: 4, EnterpriseNumber: 9}, true},
+		{"enterprise id zero", Field{Type: 0, Length: 4, EnterpriseNumber: 9}, true},
+		{"enterprise zero length", Field{Type: 1, Length: 0, EnterpriseNumber: 9}, true},
+		{"variable-length string", Field{Type: 82, Length: VariableLength}, false},
+		{"variable-length list", Field{Type: BasicList, Length: VariableLength}, false},
+		{"variable-length address", Field{Type: SourceIPv4Address, Length: VariableLength}, true},
+		{"variable-length unknown", Field{Type: 4000, Length: VariableLength}, false},
+		{"enterprise variable-length", Field{Type: 1, Length: VariableLength, EnterpriseNumber: 9}, false},
+		{"reverse element", Field{Type: OctetDeltaCount, Length: 4, EnterpriseNumber: ReverseEnterpriseNumber}, false},
+		{"reverse element wrong length", Field{Type: SourceIPv4Address, Length: 2, EnterpriseNumber: ReverseEnterpriseNumber}, true},
+		{"reverse unknown element", Field{Type: 4000, Length: 3, EnterpriseNumber: ReverseEnterpriseNumber}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := ValidateField(tt.field); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateField() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestGolden_DataSetByteLayout(t *testing.T) {
 	t.Parallel()
 	// Verify exact byte layout of a Data Set with one record.
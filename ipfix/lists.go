@@ -0,0 +1,256 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/dmabry/flowgre/encoder"
+)
+
+// RFC 6313 Section 4.4 list semantics, the first byte of every list.
+const (
+	SemanticNoneOf       = 0x00
+	SemanticExactlyOneOf = 0x01
+	SemanticOneOrMoreOf  = 0x02
+	SemanticAllOf        = 0x03
+	SemanticOrdered      = 0x04
+	SemanticUndefined    = 0xFF
+)
+
+// BasicListSource returns a value source for a basicList (RFC 6313 Section
+// 4.5.1) of count elements of element, each produced by source. A nil source
+// uses the element's default value source.
+func BasicListSource(semantic uint8, element Field, count int, source encoder.ValueSource) encoder.ValueSource {
+	if source == nil {
+		source = defaultFieldSource(element)
+	}
+	fields := EncoderFields([]Field{element})
+	sources := []encoder.ValueSource{source}
+	return encoder.VariableFunc(func(_ encoder.Field, flow *encoder.Flow) ([]byte, error) {
+		var buf bytes.Buffer
+		buf.WriteByte(semantic)
+		writeFieldSpecifier(&buf, element)
+		for i := range count {
+			value, err := encoder.Encode(fields, sources, flow)
+			if err != nil {
+				return nil, fmt.Errorf("basicList element %d: %w", i, err)
+			}
+			buf.Write(value)
+		}
+		return buf.Bytes(), nil
+	})
+}
+
+// subTemplateValues is the value source returned by SubTemplateListSource.
+type subTemplateValues struct {
+	semantic uint8
+	template Template
+	count    int
+	sources  []encoder.ValueSource
+}
+
+// SubTemplateListSource returns a value source for a subTemplateList (RFC 6313
+// Section 4.5.2) of count records of template, with one value source per
+// template field; nil sources use the field's default. The source is a
+// SubTemplateProvider, so profiles using it export template along with their
+// own.
+func SubTemplateListSource(semantic uint8, template Template, count int, sources []encoder.ValueSource) encoder.ValueSource {
+	resolved := make([]encoder.ValueSource, len(template.Fields))
+	for i, f := range template.Fields {
+		if i < len(sources) && sources[i] != nil {
+			resolved[i] = sources[i]
+		} else {
+			resolved[i] = defaultFieldSource(f)
+		}
+	}
+	template.FieldCount = uint16(len(template.Fields))
+	return &subTemplateValues{semantic: semantic, template: template, count: count, sources: resolved}
+}
+
+// VariableValue encodes the list.
+func (l *subTemplateValues) VariableValue(_ encoder.Field, flow *encoder.Flow) ([]byte, error) {
+	value := []byte{l.semantic, byte(l.template.TemplateID >> 8), byte(l.template.TemplateID)}
+	fields := EncoderFields(l.template.Fields)
+	for i := range l.count {
+		record, err := encoder.Encode(fields, l.sources, flow)
+		if err != nil {
+			return nil, fmt.Errorf("subTemplateList record %d: %w", i, err)
+		}
+		value = append(value, record...)
+	}
+	return value, nil
+}
+
+// Value encodes the list into a fixed-length field, which must fit it exactly.
+func (l *subTemplateValues) Value(f encoder.Field, flow *encoder.Flow, dst []byte) error {
+	return encoder.VariableFunc(l.VariableValue).Value(f, flow, dst)
+}
+
+// SubTemplates returns the list's template, preceded by the templates of any
+// lists nested in its records.
+func (l *subTemplateValues) SubTemplates() []Template {
+	return append(subTemplates(l.sources), l.template)
+}
+
+// subTemplates collects the templates of the SubTemplateProvider sources.
+func subTemplates(sources []encoder.ValueSource) []Template {
+	var templates []Template
+	for _, s := range sources {
+		if sp, ok := s.(SubTemplateProvider); ok {
+			templates = append(templates, sp.SubTemplates()...)
+		}
+	}
+	return templates
+}
+
+// ReadVariableLength reads the RFC 7011 Section 7 length prefix at the start of
+// b, returning the value length and the prefix size.
+func ReadVariableLength(b []byte) (int, int, error) {
+	if len(b) < 1 {
+		return 0, 0, fmt.Errorf("missing variable length")
+	}
+	if b[0] < 255 {
+		return int(b[0]), 1, nil
+	}
+	if len(b) < 3 {
+		return 0, 0, fmt.Errorf("missing extended variable length")
+	}
+	return int(binary.BigEndian.Uint16(b[1:3])), 3, nil
+}
+
+// minRecordLength returns the shortest encoding of a record of fields:
+// variable-length fields take at least their 1-byte length.
+func minRecordLength(fields []Field) int {
+	size := 0
+	for _, f := range fields {
+		if f.Length == VariableLength {
+			size++
+		} else {
+			size += int(f.Length)
+		}
+	}
+	return size
+}
+
+// validateDataRecords walks the records of a Data Set body encoded with
+// fields. Trailing bytes too short for a record are padding.
+func validateDataRecords(body []byte, fields []Field, templates map[uint16][]Field) error {
+	minLength := minRecordLength(fields)
+	if minLength == 0 {
+		return nil
+	}
+	for i := 0; len(body) >= minLength; i++ {
+		n, err := validateRecord(body, fields, templates)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+		body = body[n:]
+	}
+	return nil
+}
+
+// validateRecords walks records of fields that must fill b exactly, as in the
+// contents of a list.
+func validateRecords(b []byte, fields []Field, templates map[uint16][]Field) error {
+	if minRecordLength(fields) == 0 {
+		return nil
+	}
+	for i := 0; len(b) > 0; i++ {
+		n, err := validateRecord(b, fields, templates)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// validateRecord checks the record of fields at the start of b, including
+// the contents of any lists, and returns its length.
+func validateRecord(b []byte, fields []Field, templates map[uint16][]Field) (int, error) {
+	offset := 0
+	for i, f := range fields {
+		length := int(f.Length)
+		if f.Length == VariableLength {
+			n, prefix, err := ReadVariableLength(b[offset:])
+			if err != nil {
+				return 0, fmt.Errorf("field %d: %w", i, err)
+			}
+			offset += prefix
+			length = n
+		}
+		if offset+length > len(b) {
+			return 0, fmt.Errorf("field %d: %d bytes exceed the record", i, length)
+		}
+		if f.EnterpriseNumber == 0 {
+			if err := validateList(f.Type, b[offset:offset+length], templates); err != nil {
+				return 0, fmt.Errorf("field %d: %w", i, err)
+			}
+		}
+		offset += length
+	}
+	return offset, nil
+}
+
+// validateList checks value if id is an RFC 6313 list element. Records of
+// templates not in templates can't be checked and are skipped.
+func validateList(id uint16, value []byte, templates map[uint16][]Field) error {
+	switch id {
+	case BasicList:
+		if len(value) < 5 {
+			return fmt.Errorf("basicList of %d bytes is shorter than its header", len(value))
+		}
+		specSize := fieldSpecifierSize(value, 1)
+		if len(value) < 1+specSize {
+			return fmt.Errorf("basicList enterprise field specifier truncated")
+		}
+		element := parseFieldSpecifier(value, 1)
+		if element.Length == 0 {
+			return fmt.Errorf("basicList element %d has zero length", element.Type)
+		}
+		if err := validateRecords(value[1+specSize:], []Field{element}, templates); err != nil {
+			return fmt.Errorf("basicList: %w", err)
+		}
+	case SubTemplateList:
+		if len(value) < 3 {
+			return fmt.Errorf("subTemplateList of %d bytes is shorter than its header", len(value))
+		}
+		templateID := binary.BigEndian.Uint16(value[1:3])
+		if templateID < 256 {
+			return fmt.Errorf("subTemplateList template ID %d is below 256", templateID)
+		}
+		if fields, ok := templates[templateID]; ok {
+			if err := validateRecords(value[3:], fields, templates); err != nil {
+				return fmt.Errorf("subTemplateList template %d: %w", templateID, err)
+			}
+		}
+	case SubTemplateMultiList:
+		if len(value) < 1 {
+			return fmt.Errorf("subTemplateMultiList has no semantic")
+		}
+		for b := value[1:]; len(b) > 0; {
+			if len(b) < 4 {
+				return fmt.Errorf("subTemplateMultiList entry header truncated")
+			}
+			templateID := binary.BigEndian.Uint16(b[0:2])
+			length := int(binary.BigEndian.Uint16(b[2:4]))
+			if templateID < 256 {
+				return fmt.Errorf("subTemplateMultiList template ID %d is below 256", templateID)
+			}
+			if length < 4 || length > len(b) {
+				return fmt.Errorf("subTemplateMultiList entry length %d for %d bytes", length, len(b))
+			}
+			if fields, ok := templates[templateID]; ok {
+				if err := validateRecords(b[4:length], fields, templates); err != nil {
+					return fmt.Errorf("subTemplateMultiList template %d: %w", templateID, err)
+				}
+			}
+			b = b[length:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dmabry/flowgre/encoder"
+)
+
+// listProfile returns a profile with a variable-length string, a basicList and
+// a subTemplateList using template 400, with constant values throughout.
+func listProfile() *CustomProfile {
+	sub := Template{TemplateID: 400, Fields: []Field{
+		{Type: SourceIPv4Address, Length: 4},
+		{Type: 96, Length: VariableLength}, // applicationName
+	}}
+	fields := []Field{
+		{Type: 82, Length: VariableLength}, // interfaceName
+		{Type: BasicList, Length: VariableLength},
+		{Type: SubTemplateList, Length: VariableLength},
+	}
+	sources := []encoder.ValueSource{
+		encoder.Bytes([]byte("eth0")),
+		BasicListSource(SemanticAllOf, Field{Type: 10, Length: 4}, 2, encoder.Uint(7)),
+		SubTemplateListSource(SemanticExactlyOneOf, sub, 2, []encoder.ValueSource{
+			encoder.Bytes([]byte{192, 0, 2, 1}),
+			encoder.Bytes([]byte("dns")),
+		}),
+	}
+	return NewCustomProfile("lists", 300, fields, sources)
+}
+
+// oneMessage joins the sets of messages into one IPFIX message.
+func oneMessage(t *testing.T, messages ...IPFIX) []byte {
+	t.Helper()
+	var msg []byte
+	for _, m := range messages {
+		buf, err := m.ToBytes()
+		if err != nil {
+			t.Fatalf("ToBytes error: %v", err)
+		}
+		if msg == nil {
+			msg = append(msg, buf.Bytes()...)
+			continue
+		}
+		msg = append(msg, buf.Bytes()[16:]...)
+	}
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(msg)))
+	return msg
+}
+
+func TestGolden_VariableLengthAndLists(t *testing.T) {
+	t.Parallel()
+	p := listProfile()
+	seq := NewIPFIXSequence()
+	tmpl := GenerateTemplateIPFIX(42, seq, p)
+	templates := tmpl.TemplateFlowSets[0].Templates
+	if len(templates) != 2 || templates[0].TemplateID != 400 || templates[1].TemplateID != 300 {
+		t.Fatalf("Got: %+v Want: sub-template 400 ahead of template 300", templates)
+	}
+	data, err := GenerateDataIPFIX(2, 42, "10.0.0.0/8", "10.0.0.0/8", 0, seq, p)
+	if err != nil {
+		t.Fatalf("GenerateDataIPFIX error: %v", err)
+	}
+
+	want := []byte{
+		0x04, 'e', 't', 'h', '0', // interfaceName
+		0x0d, 0x03, 0x00, 0x0a, 0x00, 0x04, 0, 0, 0, 7, 0, 0, 0, 7, // basicList, allOf two ingressInterface
+		0x13, 0x01, 0x01, 0x90, // subTemplateList, exactlyOneOf template 400
+		192, 0, 2, 1, 0x03, 'd', 'n', 's',
+		192, 0, 2, 1, 0x03, 'd', 'n', 's',
+	}
+	for i, item := range data.DataFlowSets[0].Items {
+		if got := item.([]byte); !bytes.Equal(got, want) {
+			t.Errorf("record %d: Got: %x Want: %x", i, got, want)
+		}
+	}
+
+	msg := oneMessage(t, tmpl, data)
+	if ok, err := IsValidIPFIX(msg); !ok {
+		t.Errorf("IsValidIPFIX should accept the lists: %v", err)
+	}
+}
+
+func TestIsValidIPFIX_RejectMalformedVariableLength(t *testing.T) {
+	t.Parallel()
+	p := listProfile()
+	tmpl := GenerateTemplateIPFIX(42, NewIPFIXSequence(), p)
+	data, err := GenerateDataIPFIX(1, 42, "10.0.0.0/8", "10.0.0.0/8", 0, NewIPFIXSequence(), p)
+	if err != nil {
+		t.Fatalf("GenerateDataIPFIX error: %v", err)
+	}
+	valid := oneMessage(t, tmpl, data)
+	// The 39-byte data record is last, ahead of the set padding
+	padding := data.DataFlowSets[0].Padding
+	record := len(valid) - padding - 39
+
+	tests := []struct {
+		name   string
+		offset int
+		value  byte
+	}{
+		{"string overruns record", record, 0x40},
+		{"basicList overruns record", record + 5, 0x30},
+		{"basicList element cut short", record + 5, 0x0c},
+		{"basicList header too short", record + 5, 0x02},
+		{"subTemplateList record cut short", record + 19, 0x12},
+		{"subTemplateList template ID below 256", record + 21, 0x00},
+		{"subTemplateList nested string overruns", record + 27, 0x09},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			payload := bytes.Clone(valid)
+			payload[tt.offset] = tt.value
+			if ok, err := IsValidIPFIX(payload); ok || err == nil {
+				t.Errorf("IsValidIPFIX should reject the record, got ok %v err %v", ok, err)
+			}
+		})
+	}
+
+	// Without the template the data set can't be checked
+	buf, err := data.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataOnly := buf.Bytes()
+	dataOnly[len(dataOnly)-padding-39] = 0x40
+	if ok, err := IsValidIPFIX(dataOnly); !ok {
+		t.Errorf("IsValidIPFIX should accept a data set without its template: %v", err)
+	}
+}
+
+func TestIsValidIPFIX_SubTemplateMultiList(t *testing.T) {
+	t.Parallel()
+	// Template 300 is one subTemplateMultiList; template 400 one 2-byte field.
+	tmplSet := []byte{
+		0x00, 0x02, 0x00, 0x14, // Template Set, length 20
+		0x01, 0x90, 0x00, 0x01, 0x00, 0x07, 0x00, 0x02, // template 400: sourceTransportPort
+		0x01, 0x2c, 0x00, 0x01, 0x01, 0x25, 0xff, 0xff, // template 300: subTemplateMultiList
+	}
+	list := []byte{
+		0x09, SemanticAllOf, // length, semantic
+		0x01, 0x90, 0x00, 0x08, 0x00, 0x35, 0x01, 0xbb, // template 400, two records
+	}
+	build := func(list []byte) []byte {
+		msg := make([]byte, 16)
+		binary.BigEndian.PutUint16(msg[0:2], Version)
+		msg = append(msg, tmplSet...)
+		msg = append(msg, 0x01, 0x2c, 0x00, byte(4+len(list)))
+		msg = append(msg, list...)
+		binary.BigEndian.PutUint16(msg[2:4], uint16(len(msg)))
+		return msg
+	}
+	if ok, err := IsValidIPFIX(build(list)); !ok {
+		t.Errorf("IsValidIPFIX should accept the list: %v", err)
+	}
+	bad := bytes.Clone(list[:9])
+	bad[0], bad[5] = 0x08, 0x07 // a record and a half of template 400
+	if ok, _ := IsValidIPFIX(build(bad)); ok {
+		t.Error("IsValidIPFIX should reject a partial record")
+	}
+	bad = bytes.Clone(list)
+	bad[5] = 0x10 // entry longer than the list
+	if ok, _ := IsValidIPFIX(build(bad)); ok {
+		t.Error("IsValidIPFIX should reject an entry overrunning the list")
+	}
+}
+
+func TestDataSetPaddingShorterThanRecords(t *testing.T) {
+	t.Parallel()
+	// Records of one empty variable-length field are a single byte, so no
+	// padding can be told apart from them.
+	p := NewCustomProfile("short", 300, []Field{{Type: 82, Length: VariableLength}}, nil)
+	data, err := GenerateDataIPFIX(3, 42, "10.0.0.0/8", "10.0.0.0/8", 0, NewIPFIXSequence(), p)
+	if err != nil {
+		t.Fatalf("GenerateDataIPFIX error: %v", err)
+	}
+	if got := data.DataFlowSets[0].Padding; got != 0 {
+		t.Errorf("Got: padding %d Want: 0", got)
+	}
+	if got := data.DataFlowSets[0].Length; got != 4+3 {
+		t.Errorf("Got: set length %d Want: 7", got)
+	}
+}
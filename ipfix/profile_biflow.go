@@ -0,0 +1,146 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package ipfix
+
+import (
+	"fmt"
+
+	"github.com/dmabry/flowgre/encoder"
+	"github.com/dmabry/flowgre/utils"
+)
+
+// RFC 5103 Section 6.3 biflowDirection values.
+const (
+	BiflowArbitrary        = 0x00
+	BiflowInitiator        = 0x01
+	BiflowReverseInitiator = 0x02
+	BiflowPerimeter        = 0x03
+)
+
+// TCP control bits set on generated biflows.
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// BiflowIPFIXProfile generates RFC 5103 bidirectional flows: each record is a
+// request from the source to the destination together with its response.
+type BiflowIPFIXProfile struct{}
+
+// Name returns the profile name.
+func (p *BiflowIPFIXProfile) Name() string { return "biflow" }
+
+// TemplateFields returns the biflow template. Reverse counters and TCP flags
+// are RFC 5103 reverse elements under ReverseEnterpriseNumber.
+func (p *BiflowIPFIXProfile) TemplateFields() []Field {
+	return []Field{
+		{Type: SourceIPv4Address, Length: 4},
+		{Type: DestinationIPv4Address, Length: 4},
+		{Type: SourceIPv6Address, Length: 16},
+		{Type: DestinationIPv6Address, Length: 16},
+		{Type: SourceTransportPort, Length: 2},
+		{Type: DestinationTransportPort, Length: 2},
+		{Type: ProtocolIdentifier, Length: 1},
+		{Type: FlowStartMilliseconds, Length: 8},
+		{Type: FlowEndMilliseconds, Length: 8},
+		{Type: PacketDeltaCount, Length: 4},
+		{Type: OctetDeltaCount, Length: 4},
+		{Type: TCPFlags, Length: 1},
+		{Type: OctetDeltaCount, Length: 4, EnterpriseNumber: ReverseEnterpriseNumber},
+		{Type: PacketDeltaCount, Length: 4, EnterpriseNumber: ReverseEnterpriseNumber},
+		{Type: TCPFlags, Length: 1, EnterpriseNumber: ReverseEnterpriseNumber},
+		{Type: BiflowDirection, Length: 1},
+		{Type: FlowEndReason, Length: 1},
+	}
+}
+
+// ValueSources returns the sources of a random request and its response. The
+// source initiates the conversation from an ephemeral port. The response
+// carries one to sixteen times the request bytes, in packets of at most 1500
+// bytes and no fewer than half as many packets as the request, as for ACKs.
+func (p *BiflowIPFIXProfile) ValueSources() []encoder.ValueSource {
+	return []encoder.ValueSource{
+		encoder.SrcAddr(),
+		encoder.DstAddr(),
+		encoder.SrcAddr(),
+		encoder.DstAddr(),
+		encoder.Random(49152, 65536),
+		encoder.DstPort(),
+		encoder.Protocol(),
+		biflowStart(),
+		encoder.UnixMillis(-10),
+		encoder.PacketCount(1, 65),
+		encoder.OctetCount(64, 512),
+		derived(biflowTCPFlags),
+		derived(reverseOctets),
+		derived(reversePackets),
+		derived(biflowTCPFlags),
+		encoder.Uint(BiflowInitiator),
+		derived(biflowEndReason),
+	}
+}
+
+// derived writes the value fn derives from the record's flow.
+func derived(fn func(flow *encoder.Flow) uint64) encoder.ValueSource {
+	return encoder.ValueFunc(func(f encoder.Field, flow *encoder.Flow, dst []byte) error {
+		return encoder.Uint(fn(flow)).Value(f, flow, dst)
+	})
+}
+
+// biflowStart writes a flow start 10ms to 5s before the flow end.
+func biflowStart() encoder.ValueSource {
+	return encoder.ValueFunc(func(f encoder.Field, flow *encoder.Flow, dst []byte) error {
+		duration, err := utils.RandomNum(10, 5000)
+		if err != nil {
+			return fmt.Errorf("generate flow duration: %w", err)
+		}
+		return encoder.UnixMillis(int64(-10-duration)).Value(f, flow, dst)
+	})
+}
+
+// responseFactor returns how many times the request bytes the response
+// carries, 1 to 16. It's derived from the random request bytes so both reverse
+// counters agree on it.
+func responseFactor(flow *encoder.Flow) uint64 {
+	return 1 + flow.Octets%16
+}
+
+// reverseOctets returns the response bytes.
+func reverseOctets(flow *encoder.Flow) uint64 {
+	return flow.Octets * responseFactor(flow)
+}
+
+// reversePackets returns the response packets.
+func reversePackets(flow *encoder.Flow) uint64 {
+	return max((reverseOctets(flow)+1499)/1500, flow.Packets/2, 1)
+}
+
+// biflowClosed reports whether the conversation was closed with FIN both ways,
+// as about half of TCP conversations are, picked by the request packet count.
+func biflowClosed(flow *encoder.Flow) bool {
+	return flow.Protocol == utils.TCPProto && flow.Packets%2 == 0
+}
+
+// biflowTCPFlags returns the TCP flags of either direction: the initiator's
+// SYN is answered by a SYN-ACK, and a closed conversation carries FIN both ways.
+func biflowTCPFlags(flow *encoder.Flow) uint64 {
+	if flow.Protocol != utils.TCPProto {
+		return 0
+	}
+	if biflowClosed(flow) {
+		return tcpSYN | tcpACK | tcpPSH | tcpFIN
+	}
+	return tcpSYN | tcpACK | tcpPSH
+}
+
+// biflowEndReason returns end of flow detected for closed conversations, and
+// idle timeout for the rest.
+func biflowEndReason(flow *encoder.Flow) uint64 {
+	if biflowClosed(flow) {
+		return 3
+	}
+	return 1
+}
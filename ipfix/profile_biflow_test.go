@@ -0,0 +1,113 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dmabry/flowgre/utils"
+)
+
+// biflowRecord is the wire layout of a BiflowIPFIXProfile record.
+type biflowRecord struct {
+	SourceIPv4Addr          uint32
+	DestIPv4Addr            uint32
+	SourceIPv6Addr          [16]byte
+	DestIPv6Addr            [16]byte
+	SourcePort              uint16
+	DestPort                uint16
+	ProtocolIdentifier      uint8
+	FlowStartMillis         uint64
+	FlowEndMillis           uint64
+	PacketDeltaCount        uint32
+	OctetDeltaCount         uint32
+	TCPFlags                uint8
+	ReverseOctetDeltaCount  uint32
+	ReversePacketDeltaCount uint32
+	ReverseTCPFlags         uint8
+	BiflowDirection         uint8
+	FlowEndReason           uint8
+}
+
+func TestBiflowIPFIXProfile_Template(t *testing.T) {
+	t.Parallel()
+	p := &BiflowIPFIXProfile{}
+	fields := p.TemplateFields()
+	for i, f := range fields {
+		if err := ValidateField(f); err != nil {
+			t.Errorf("field %d: %v", i, err)
+		}
+	}
+	if got, want := binary.Size(biflowRecord{}), minRecordLength(fields); got != want {
+		t.Errorf("Got: record size %d Want: template size %d", got, want)
+	}
+	reverse := 0
+	for _, f := range fields {
+		if f.EnterpriseNumber == ReverseEnterpriseNumber {
+			reverse++
+		}
+	}
+	if reverse != 3 {
+		t.Errorf("Got: %d reverse elements Want: 3", reverse)
+	}
+}
+
+func TestBiflowIPFIXFlow_Correlated(t *testing.T) {
+	t.Parallel()
+	seq := NewIPFIXSequence()
+	p := &BiflowIPFIXProfile{}
+	tmpl := GenerateTemplateIPFIX(42, seq, p)
+	for _, port := range []int{utils.HTTPSPort, utils.DNSPort} {
+		data, err := GenerateDataIPFIX(20, 42, "10.0.0.0/8", "192.168.0.0/16", port, seq, p)
+		if err != nil {
+			t.Fatalf("GenerateDataIPFIX error: %v", err)
+		}
+		if ok, err := IsValidIPFIX(oneMessage(t, tmpl, data)); !ok {
+			t.Errorf("IsValidIPFIX should accept the biflows: %v", err)
+		}
+		for i, item := range data.DataFlowSets[0].Items {
+			var f biflowRecord
+			if err := binary.Read(bytes.NewReader(item.([]byte)), binary.BigEndian, &f); err != nil {
+				t.Fatalf("record %d: %v", i, err)
+			}
+			if f.DestPort != uint16(port) || f.SourcePort < 49152 {
+				t.Errorf("record %d: Got: ports %d -> %d Want: ephemeral -> %d", i, f.SourcePort, f.DestPort, port)
+			}
+			if f.ReverseOctetDeltaCount < f.OctetDeltaCount || f.ReverseOctetDeltaCount > 16*f.OctetDeltaCount {
+				t.Errorf("record %d: Got: reverse bytes %d Want: 1-16x forward %d", i, f.ReverseOctetDeltaCount, f.OctetDeltaCount)
+			}
+			if f.ReversePacketDeltaCount == 0 || f.ReverseOctetDeltaCount > 1500*f.ReversePacketDeltaCount {
+				t.Errorf("record %d: Got: %d reverse bytes in %d packets Want: at most 1500 per packet", i, f.ReverseOctetDeltaCount, f.ReversePacketDeltaCount)
+			}
+			if f.ReversePacketDeltaCount < f.PacketDeltaCount/2 {
+				t.Errorf("record %d: Got: %d reverse packets Want: at least half of %d", i, f.ReversePacketDeltaCount, f.PacketDeltaCount)
+			}
+			if f.FlowStartMillis >= f.FlowEndMillis {
+				t.Errorf("record %d: Got: start %d end %d Want: start before end", i, f.FlowStartMillis, f.FlowEndMillis)
+			}
+			if f.BiflowDirection != BiflowInitiator {
+				t.Errorf("record %d: Got: biflowDirection %d Want: %d", i, f.BiflowDirection, BiflowInitiator)
+			}
+			wantFlags := f.ProtocolIdentifier == utils.TCPProto
+			if (f.TCPFlags&tcpSYN != 0) != wantFlags || f.TCPFlags != f.ReverseTCPFlags {
+				t.Errorf("record %d: Got: flags %#x reverse %#x for protocol %d", i, f.TCPFlags, f.ReverseTCPFlags, f.ProtocolIdentifier)
+			}
+			if closed := f.TCPFlags&tcpFIN != 0; closed != (f.FlowEndReason == 3) {
+				t.Errorf("record %d: Got: flags %#x end reason %d Want: end of flow only after FIN", i, f.TCPFlags, f.FlowEndReason)
+			}
+		}
+	}
+}
+
+func TestReverseElementName(t *testing.T) {
+	t.Parallel()
+	if got := ReverseElementName(OctetDeltaCount); got != "reverseOctetDeltaCount" {
+		t.Errorf("Got: %q Want: reverseOctetDeltaCount", got)
+	}
+	if got := ReverseElementName(4000); got != "" {
+		t.Errorf("Got: %q Want: empty for an unknown element", got)
+	}
+}
@@ -0,0 +1,75 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package ipfix
+
+import "github.com/dmabry/flowgre/encoder"
+
+// TemplateIDProvider is implemented by profiles that use a template ID other
+// than DefaultTemplateID. The ID must be 256 or greater and must not be
+// OptionsTemplateID.
+type TemplateIDProvider interface {
+	TemplateID() uint16
+}
+
+// SubTemplateProvider is implemented by profiles and value sources whose
+// records carry subTemplateLists. The templates are exported in the Template
+// Set ahead of the profile's own template.
+type SubTemplateProvider interface {
+	SubTemplates() []Template
+}
+
+// profileSubTemplates returns the sub-templates of p.
+func profileSubTemplates(p IPFIXFlowProfile) []Template {
+	if sp, ok := p.(SubTemplateProvider); ok {
+		return sp.SubTemplates()
+	}
+	return nil
+}
+
+// profileTemplateID returns the template ID for p.
+func profileTemplateID(p IPFIXFlowProfile) uint16 {
+	if tp, ok := p.(TemplateIDProvider); ok {
+		return tp.TemplateID()
+	}
+	return DefaultTemplateID
+}
+
+// CustomProfile is an IPFIXFlowProfile described entirely by data, such as a
+// profile declared in the config file. Records are built by the encoder.
+type CustomProfile struct {
+	name       string
+	templateID uint16
+	fields     []Field
+	sources    []encoder.ValueSource
+}
+
+// NewCustomProfile returns a profile with the given template ID, fields and one
+// value source per field. A nil source uses DefaultValueSource for its field,
+// or zeros for an enterprise-specific field.
+func NewCustomProfile(name string, templateID uint16, fields []Field, sources []encoder.ValueSource) *CustomProfile {
+	resolved := make([]encoder.ValueSource, len(fields))
+	for i, f := range fields {
+		if i < len(sources) && sources[i] != nil {
+			resolved[i] = sources[i]
+		} else {
+			resolved[i] = defaultFieldSource(f)
+		}
+	}
+	return &CustomProfile{name: name, templateID: templateID, fields: fields, sources: resolved}
+}
+
+// Name returns the profile name.
+func (p *CustomProfile) Name() string { return p.name }
+
+// TemplateFields returns the profile's template fields.
+func (p *CustomProfile) TemplateFields() []Field { return p.fields }
+
+// TemplateID returns the profile's template ID.
+func (p *CustomProfile) TemplateID() uint16 { return p.templateID }
+
+// ValueSources returns one value source per template field.
+func (p *CustomProfile) ValueSources() []encoder.ValueSource { return p.sources }
+
+// SubTemplates returns the templates of the profile's subTemplateList fields.
+func (p *CustomProfile) SubTemplates() []Template { return subTemplates(p.sources) }
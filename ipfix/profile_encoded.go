@@ -0,0 +1,112 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package ipfix
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/dmabry/flowgre/encoder"
+	"github.com/dmabry/flowgre/netflow"
+)
+
+// ValueSourcer is implemented by profiles that supply their own value source for
+// each template field. ValueSources must return one source per TemplateFields entry.
+// Profiles that do not implement it get DefaultValueSource for every field.
+// ValueSources is called for every record, so stateful sources such as
+// encoder.Sequence must be created once and returned on each call.
+type ValueSourcer interface {
+	ValueSources() []encoder.ValueSource
+}
+
+// DefaultValueSource returns the value source used for an IANA Information
+// Element when a profile does not provide its own. The built-in generic,
+// minimal and extended profiles are encoded entirely from these. Unknown
+// elements are zero-filled.
+func DefaultValueSource(elementID uint16) encoder.ValueSource {
+	switch elementID {
+	case OctetDeltaCount, PostOctetDeltaCount, PacketDeltaCount, PostPacketDeltaCount:
+		return encoder.Random(0, 10000)
+	case SourceIPv4Address, SourceIPv6Address:
+		return encoder.SrcAddr()
+	case DestinationIPv4Address, DestinationIPv6Address:
+		return encoder.DstAddr()
+	case SourceIPv6PrefixLength, DestinationIPv6PrefixLength:
+		return encoder.IPv6PrefixLength(64)
+	case SourceTransportPort:
+		return encoder.SrcPort()
+	case DestinationTransportPort:
+		return encoder.DstPort()
+	case ProtocolIdentifier:
+		return encoder.Protocol()
+	case TCPFlags:
+		return encoder.Random(0, 32)
+	case FlowStartMilliseconds:
+		return encoder.UnixMillis(-100)
+	case FlowEndMilliseconds:
+		return encoder.UnixMillis(-10)
+	case FlowEndReason:
+		return encoder.Random(0, 4)
+	default:
+		return encoder.Zero()
+	}
+}
+
+// defaultFieldSource returns the default value source for f. Enterprise-specific
+// elements share ID numbers with unrelated IANA elements, so they are
+// zero-filled; variable-length fields are empty.
+func defaultFieldSource(f Field) encoder.ValueSource {
+	if f.Length == VariableLength {
+		return encoder.Bytes(nil)
+	}
+	if f.EnterpriseNumber != 0 {
+		return encoder.Zero()
+	}
+	return DefaultValueSource(f.Type)
+}
+
+// EncoderFields converts IPFIX template fields to encoder fields.
+func EncoderFields(fields []Field) []encoder.Field {
+	out := make([]encoder.Field, len(fields))
+	for i, f := range fields {
+		out[i] = encoder.Field{Type: f.Type, Length: f.Length}
+	}
+	return out
+}
+
+// profileValueSources returns the value sources for p's template fields.
+func profileValueSources(p IPFIXFlowProfile, fields []Field) ([]encoder.ValueSource, error) {
+	if vs, ok := p.(ValueSourcer); ok {
+		sources := vs.ValueSources()
+		if len(sources) != len(fields) {
+			return nil, fmt.Errorf("profile %s has %d fields but %d value sources", p.Name(), len(fields), len(sources))
+		}
+		return sources, nil
+	}
+	sources := make([]encoder.ValueSource, len(fields))
+	for i, f := range fields {
+		sources[i] = defaultFieldSource(f)
+	}
+	return sources, nil
+}
+
+// generateFlow encodes a flow record for p from its template fields and value sources.
+func generateFlow(p IPFIXFlowProfile, srcIP, dstIP net.IP, flowPort int, session *netflow.Session) (DataAny, error) {
+	fields := p.TemplateFields()
+	sources, err := profileValueSources(p, fields)
+	if err != nil {
+		return nil, err
+	}
+	// IPFIX timestamps are absolute, so a session is optional here
+	startTime := time.Now().UnixNano()
+	if session != nil {
+		startTime = session.StartTime()
+	}
+	flow, err := encoder.NewFlow(srcIP, dstIP, flowPort, startTime)
+	if err != nil {
+		return nil, err
+	}
+	return encoder.Encode(EncoderFields(fields), sources, flow)
+}
@@ -0,0 +1,76 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package ipfix
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/dmabry/flowgre/utils"
+)
+
+func TestGenerateDataIPFIX_ExtendedProfile(t *testing.T) {
+	t.Parallel()
+
+	profile := &ExtendedIPFIXProfile{}
+	seq := NewIPFIXSequence()
+	flow, err := GenerateDataIPFIX(4, 1, "10.0.0.0/8", "10.0.0.0/8", utils.SSHPort, seq, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordSize := 0
+	for _, f := range profile.TemplateFields() {
+		recordSize += int(f.Length)
+	}
+	for i, item := range flow.DataFlowSets[0].Items {
+		record, ok := item.([]byte)
+		if !ok {
+			t.Fatalf("item[%d]: expected []byte, got %T", i, item)
+		}
+		if len(record) != recordSize {
+			t.Fatalf("item[%d]: record size %d, want %d", i, len(record), recordSize)
+		}
+		// destinationTransportPort follows 24 bytes of counters and IPv4 addresses plus the source port
+		if got := binary.BigEndian.Uint16(record[26:28]); got != utils.SSHPort {
+			t.Errorf("item[%d]: dst port %d, want %d", i, got, utils.SSHPort)
+		}
+		start := binary.BigEndian.Uint64(record[30:38])
+		end := binary.BigEndian.Uint64(record[38:46])
+		if start == 0 || end-start != 90 {
+			t.Errorf("item[%d]: flow start/end %d/%d", i, start, end)
+		}
+	}
+
+	buf, err := flow.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := IsValidIPFIX(buf.Bytes()); !ok {
+		t.Errorf("data packet invalid: %v", err)
+	}
+	if want := 16 + 4 + 4*recordSize; buf.Len() != want {
+		t.Errorf("packet length %d, want %d", buf.Len(), want)
+	}
+}
+
+func TestGenerateDataIPFIX_MinimalProfile(t *testing.T) {
+	t.Parallel()
+
+	flow, err := GenerateDataIPFIX(3, 1, "10.0.0.0/8", "10.0.0.0/8", 0, NewIPFIXSequence(), &MinimalIPFIXProfile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range flow.DataFlowSets[0].Items {
+		readRecord[MinimalIPFIXFlow](t, item)
+	}
+	// 3 records of 21 bytes + 4 byte header = 67, padded to 68
+	if dfs := flow.DataFlowSets[0]; dfs.Length != 68 || dfs.Padding != 1 {
+		t.Errorf("length/padding wrong! Got: %d/%d Want: 68/1", dfs.Length, dfs.Padding)
+	}
+
+	tmpl := GenerateTemplateIPFIX(1, NewIPFIXSequence(), &MinimalIPFIXProfile{})
+	if got := tmpl.TemplateFlowSets[0].Templates[0].FieldCount; got != 7 {
+		t.Errorf("template field count %d, want 7", got)
+	}
+}
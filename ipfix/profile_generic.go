@@ -28,7 +28,7 @@ func (p *GenericIPFIXProfile) Name() string {
 	return "generic"
 }
 
-// TemplateFields returns the 19-field IPFIX template that matches GenericFlow struct layout.
+// TemplateFields returns the 19-field generic IPFIX template.
 func (p *GenericIPFIXProfile) TemplateFields() []Field {
 	return []Field{
 		{Type: OctetDeltaCount, Length: 4},
@@ -72,7 +72,11 @@ func (p *MinimalIPFIXProfile) TemplateFields() []Field {
 	}
 }
 
-// MinimalIPFIXFlow is a minimal IPFIX flow record with 7 essential fields.
+// MinimalIPFIXFlow is a minimal IPFIX flow record with one field per
+// MinimalIPFIXProfile template field.
+//
+// Deprecated: data flow sets encode MinimalIPFIXProfile records from
+// DefaultValueSource and no longer use MinimalIPFIXFlow.
 type MinimalIPFIXFlow struct {
 	OctetDeltaCount    uint32
 	PacketDeltaCount   uint32
@@ -84,6 +88,8 @@ type MinimalIPFIXFlow struct {
 }
 
 // Generate creates a MinimalIPFIXFlow with randomly generated data.
+//
+// Deprecated: data flow sets generate records from DefaultValueSource.
 func (mf *MinimalIPFIXFlow) Generate(srcIP net.IP, dstIP net.IP, flowSrcPort int, session *netflow.Session) (MinimalIPFIXFlow, error) {
 	var err error
 	mf.OctetDeltaCount, err = utils.GenerateRand32(10000)
@@ -0,0 +1,206 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package loadshape describes how a barrage send rate changes over time.
+// A Shape returns the share of the configured rate, in percent, to send at a
+// given time since the barrage started.
+package loadshape
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Shape scales a send rate over time.
+type Shape interface {
+	// Percent returns the share of the configured rate to send after elapsed, in percent.
+	Percent(elapsed time.Duration) float64
+	// String returns the shape in the form accepted by Parse.
+	String() string
+}
+
+// Ramp changes linearly from From to To percent over Over, then holds To.
+type Ramp struct {
+	From, To float64
+	Over     time.Duration
+}
+
+// Percent implements Shape.
+func (r Ramp) Percent(elapsed time.Duration) float64 {
+	if elapsed >= r.Over {
+		return r.To
+	}
+	return r.From + (r.To-r.From)*float64(elapsed)/float64(r.Over)
+}
+
+// String implements Shape.
+func (r Ramp) String() string {
+	return fmt.Sprintf("ramp:%g:%g:%s", r.From, r.To, r.Over)
+}
+
+// Steps holds each level for Every, in order, then holds the last level.
+type Steps struct {
+	Levels []float64
+	Every  time.Duration
+}
+
+// Percent implements Shape.
+func (s Steps) Percent(elapsed time.Duration) float64 {
+	i := int(elapsed / s.Every)
+	if i >= len(s.Levels) {
+		i = len(s.Levels) - 1
+	}
+	return s.Levels[i]
+}
+
+// String implements Shape.
+func (s Steps) String() string {
+	levels := make([]string, len(s.Levels))
+	for i, l := range s.Levels {
+		levels[i] = strconv.FormatFloat(l, 'g', -1, 64)
+	}
+	return fmt.Sprintf("steps:%s:%s", strings.Join(levels, ","), s.Every)
+}
+
+// Burst sends Peak percent for Length at the start of every Period and Base otherwise.
+type Burst struct {
+	Base, Peak     float64
+	Period, Length time.Duration
+}
+
+// Percent implements Shape.
+func (b Burst) Percent(elapsed time.Duration) float64 {
+	if elapsed%b.Period < b.Length {
+		return b.Peak
+	}
+	return b.Base
+}
+
+// String implements Shape.
+func (b Burst) String() string {
+	return fmt.Sprintf("burst:%g:%g:%s:%s", b.Base, b.Peak, b.Period, b.Length)
+}
+
+// Sine swings between Min and Max percent once per Period, starting at Min.
+// A 24h period gives a diurnal traffic pattern.
+type Sine struct {
+	Min, Max float64
+	Period   time.Duration
+}
+
+// Percent implements Shape.
+func (s Sine) Percent(elapsed time.Duration) float64 {
+	phase := 2 * math.Pi * float64(elapsed%s.Period) / float64(s.Period)
+	return s.Min + (s.Max-s.Min)*(1-math.Cos(phase))/2
+}
+
+// String implements Shape.
+func (s Sine) String() string {
+	return fmt.Sprintf("sine:%g:%g:%s", s.Min, s.Max, s.Period)
+}
+
+// Parse parses a load shape. Levels are percentages of the configured rate and
+// must be positive; durations use time.ParseDuration syntax:
+//
+//	ramp:FROM:TO:OVER            e.g. ramp:10:100:5m
+//	steps:L1,L2,...:EVERY        e.g. steps:25,50,75,100:1m
+//	burst:BASE:PEAK:PERIOD:LEN   e.g. burst:20:100:1m:5s
+//	sine:MIN:MAX:PERIOD          e.g. sine:10:100:24h
+func Parse(spec string) (Shape, error) {
+	kind, args, _ := strings.Cut(spec, ":")
+	parts := strings.Split(args, ":")
+	switch kind {
+	case "ramp":
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("ramp load shape must be ramp:FROM:TO:OVER, got %q", spec)
+		}
+		levels, err := parseLevels(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+		over, err := parseDuration(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		return Ramp{From: levels[0], To: levels[1], Over: over}, nil
+	case "steps":
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("steps load shape must be steps:L1,L2,...:EVERY, got %q", spec)
+		}
+		levels, err := parseLevels(strings.Split(parts[0], ",")...)
+		if err != nil {
+			return nil, err
+		}
+		every, err := parseDuration(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		return Steps{Levels: levels, Every: every}, nil
+	case "burst":
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("burst load shape must be burst:BASE:PEAK:PERIOD:LENGTH, got %q", spec)
+		}
+		levels, err := parseLevels(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+		period, err := parseDuration(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		length, err := parseDuration(parts[3])
+		if err != nil {
+			return nil, err
+		}
+		if length >= period {
+			return nil, fmt.Errorf("burst length %s must be shorter than its period %s", length, period)
+		}
+		return Burst{Base: levels[0], Peak: levels[1], Period: period, Length: length}, nil
+	case "sine":
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("sine load shape must be sine:MIN:MAX:PERIOD, got %q", spec)
+		}
+		levels, err := parseLevels(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+		period, err := parseDuration(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		return Sine{Min: levels[0], Max: levels[1], Period: period}, nil
+	default:
+		return nil, fmt.Errorf("unknown load shape %q: must be ramp, steps, burst or sine", kind)
+	}
+}
+
+// parseLevels parses percentages, which must be positive.
+func parseLevels(values ...string) ([]float64, error) {
+	levels := make([]float64, len(values))
+	for i, v := range values {
+		level, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid load level %q: %w", v, err)
+		}
+		if level <= 0 || math.IsInf(level, 0) || math.IsNaN(level) {
+			return nil, fmt.Errorf("load level must be a positive percentage, got %q", v)
+		}
+		levels[i] = level
+	}
+	return levels, nil
+}
+
+// parseDuration parses a duration, which must be positive.
+func parseDuration(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid load shape duration %q: %w", v, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("load shape duration must be positive, got %q", v)
+	}
+	return d, nil
+}
@@ -0,0 +1,107 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package loadshape
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		spec    string
+		want    Shape
+		wantErr bool
+	}{
+		{"ramp:10:100:5m", Ramp{From: 10, To: 100, Over: 5 * time.Minute}, false},
+		{"ramp:100:0.5:30s", Ramp{From: 100, To: 0.5, Over: 30 * time.Second}, false},
+		{"burst:20:100:1m:5s", Burst{Base: 20, Peak: 100, Period: time.Minute, Length: 5 * time.Second}, false},
+		{"sine:10:100:24h", Sine{Min: 10, Max: 100, Period: 24 * time.Hour}, false},
+		{"ramp:10:100", nil, true},
+		{"ramp:0:100:5m", nil, true},
+		{"ramp:-10:100:5m", nil, true},
+		{"ramp:ten:100:5m", nil, true},
+		{"ramp:10:100:0s", nil, true},
+		{"steps::1m", nil, true},
+		{"steps:25,50:1m:2m", nil, true},
+		{"burst:20:100:1m:1m", nil, true},
+		{"sine:10:100:forever", nil, true},
+		{"square:10:100:1m", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			t.Parallel()
+			got, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse error wrong! Got: %v WantErr: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("shape wrong! Got: %#v Want: %#v", got, tt.want)
+			}
+			// String round-trips through Parse
+			again, err := Parse(got.String())
+			if err != nil || again != got {
+				t.Errorf("String round trip failed! Got: %#v (%v) Want: %#v", again, err, got)
+			}
+		})
+	}
+}
+
+func TestParseSteps(t *testing.T) {
+	t.Parallel()
+	got, err := Parse("steps:25,50,75,100:1m")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	steps, ok := got.(Steps)
+	if !ok || len(steps.Levels) != 4 || steps.Levels[3] != 100 || steps.Every != time.Minute {
+		t.Errorf("steps wrong! Got: %#v Want: 25,50,75,100 every 1m", got)
+	}
+	if s := got.String(); s != "steps:25,50,75,100:1m0s" {
+		t.Errorf("String wrong! Got: %s Want: steps:25,50,75,100:1m0s", s)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	t.Parallel()
+	ramp := Ramp{From: 10, To: 100, Over: 10 * time.Second}
+	steps := Steps{Levels: []float64{25, 50, 100}, Every: time.Minute}
+	burst := Burst{Base: 20, Peak: 100, Period: time.Minute, Length: 5 * time.Second}
+	sine := Sine{Min: 10, Max: 100, Period: 24 * time.Hour}
+	tests := []struct {
+		name    string
+		shape   Shape
+		elapsed time.Duration
+		want    float64
+	}{
+		{"ramp start", ramp, 0, 10},
+		{"ramp middle", ramp, 5 * time.Second, 55},
+		{"ramp end", ramp, 10 * time.Second, 100},
+		{"ramp holds", ramp, time.Hour, 100},
+		{"steps first", steps, 59 * time.Second, 25},
+		{"steps second", steps, time.Minute, 50},
+		{"steps holds last", steps, time.Hour, 100},
+		{"burst peak", burst, 0, 100},
+		{"burst base", burst, 5 * time.Second, 20},
+		{"burst repeats", burst, 62 * time.Second, 100},
+		{"sine start", sine, 0, 10},
+		{"sine quarter", sine, 6 * time.Hour, 55},
+		{"sine peak", sine, 12 * time.Hour, 100},
+		{"sine wraps", sine, 24 * time.Hour, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.shape.Percent(tt.elapsed); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("percent wrong! Got: %v Want: %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,7 +15,7 @@ const license = "Apache License, Version 2.0"
 func main() {
 	if len(os.Args) < 2 {
 		printGenericHelp()
-		fmt.Println("expected 'single', 'barrage', 'ipfix', 'record', 'replay', 'proxy' or 'version' subcommands")
+		fmt.Println("expected 'single', 'barrage', 'ipfix', 'record', 'replay', 'proxy', 'collect', 'inspect', 'export-pcap' or 'version' subcommands")
 		os.Exit(1)
 	}
 
@@ -34,6 +34,12 @@ func main() {
 		cmd.RunReplay(os.Args[2:])
 	case "proxy":
 		cmd.RunProxy(os.Args[2:])
+	case "collect":
+		cmd.RunCollect(os.Args[2:])
+	case "inspect":
+		cmd.RunInspect(os.Args[2:])
+	case "export-pcap":
+		cmd.RunExportPCAP(os.Args[2:])
 	case "version":
 		fmt.Printf("Version: %s\n", version)
 		fmt.Printf("License: %s\n", license)
@@ -41,7 +47,7 @@ func main() {
 		printGenericHelp()
 	default:
 		printGenericHelp()
-		fmt.Println("expected 'single', 'barrage', 'ipfix', 'record', 'replay', 'proxy' or 'version' subcommands")
+		fmt.Println("expected 'single', 'barrage', 'ipfix', 'record', 'replay', 'proxy', 'collect', 'inspect', 'export-pcap' or 'version' subcommands")
 		os.Exit(2)
 	}
 }
@@ -55,7 +61,7 @@ func printHelpHeader() {
                       |___/          
 `)
 	fmt.Println("Slinging packets since 2022!")
-	fmt.Println("Used for NetFlow v9 and IPFIX (RFC 7011) Collector Stress testing and other fun activities.")
+	fmt.Println("Used for NetFlow v5/v9, IPFIX (RFC 7011) and sFlow v5 Collector Stress testing and other fun activities.")
 }
 
 func printGenericHelp() {
@@ -64,10 +70,13 @@ func printGenericHelp() {
 	fmt.Println()
 	fmt.Println("to print more details pass '-help' after the subcommand")
 	fmt.Println()
-	fmt.Println("Single  - Send a given number of flows in sequence to a collector for testing.")
-	fmt.Println("Barrage - Send a continuous barrage of flows to a collector for testing.")
-	fmt.Println("IPFIX   - Send IPFIX (RFC 7011) flows to a collector for testing.")
-	fmt.Println("Record  - Record flows to a file for later replay testing.")
-	fmt.Println("Replay  - Send recorded flows to a target server.")
-	fmt.Println("Proxy   - Accept flows and relay them to multiple targets.")
+	fmt.Println("Single      - Send a given number of flows in sequence to a collector for testing.")
+	fmt.Println("Barrage     - Send a continuous barrage of flows to a collector for testing.")
+	fmt.Println("IPFIX       - Send IPFIX (RFC 7011) flows to a collector for testing.")
+	fmt.Println("Record      - Record flows, live or from a capture file, for later replay testing.")
+	fmt.Println("Replay      - Send recorded flows to a target server.")
+	fmt.Println("Proxy       - Accept flows and relay them to multiple targets.")
+	fmt.Println("Collect     - Decode flows and report per-exporter counts, sequence gaps and template errors.")
+	fmt.Println("Inspect     - Decode recorded flows and print them as text, NDJSON or CSV.")
+	fmt.Println("Export-PCAP - Write recorded flows to a pcap or pcapng file for Wireshark.")
 }
@@ -8,6 +8,7 @@ package models
 import "time"
 
 type Config struct {
+	Name             string `json:"name,omitempty"` // target name from the config file
 	Server           string `json:"server,omitempty"`
 	DstPort          int    `json:"dst_port,omitempty"`
 	SrcRange         string `json:"src_range,omitempty"`
@@ -18,9 +19,60 @@ type Config struct {
 	WebIP            string `json:"web_ip,omitempty"`
 	WebPort          int    `json:"web_port,omitempty"`
 	Web              bool   `json:"web,omitempty"`
-	Protocol         string `json:"protocol,omitempty"` // "netflow" or "ipfix"
+	Protocol         string `json:"protocol,omitempty"`  // "netflow", "netflow5", "ipfix" or "sflow"
+	Transport        string `json:"transport,omitempty"` // "udp" or, for ipfix, "tcp" or "tls"; empty is udp
+	Profile          string `json:"profile,omitempty"`   // empty uses the -profile flag
 	WebUsername      string `json:"web_username,omitempty"`
 	WebPassword      string `json:"web_password,omitempty"`
+	// TLS options of the "tls" transport: client certificate and key, the CA
+	// the collector's certificate must chain to, and the SNI server name.
+	TransportCert       string `json:"transport_cert,omitempty"`
+	TransportKey        string `json:"transport_key,omitempty"`
+	TransportCA         string `json:"transport_ca,omitempty"`
+	TransportServerName string `json:"transport_server_name,omitempty"`
+	// Aggregate send rate targets, split across workers. At most one is set;
+	// when all are zero each worker sends one packet per Delay.
+	FlowsPerSecond   int `json:"flows_per_second,omitempty"`
+	PacketsPerSecond int `json:"packets_per_second,omitempty"`
+	BitsPerSecond    int `json:"bits_per_second,omitempty"`
+	// LoadShape scales the send rate over time, e.g. "ramp:10:100:5m". See package loadshape.
+	LoadShape string `json:"load_shape,omitempty"`
+	// Run-length limits; the barrage stops once any is reached. Zero means no limit.
+	Duration   time.Duration `json:"duration,omitempty"`
+	MaxPackets int           `json:"max_packets,omitempty"` // data packets across all workers
+	MaxFlows   int           `json:"max_flows,omitempty"`
+}
+
+// ProfileConfig is a user-defined flow profile declared in the config file.
+type ProfileConfig struct {
+	Name       string         `json:"name,omitempty"`
+	TemplateID int            `json:"template_id,omitempty"` // 0 uses the default of 256
+	Fields     []ProfileField `json:"fields,omitempty"`
+}
+
+// ProfileField is a single template field of a ProfileConfig and the generator for its value.
+type ProfileField struct {
+	Type     string `json:"type,omitempty"` // field name (IN_BYTES, octetDeltaCount) or numeric type
+	Length   int    `json:"length,omitempty"`
+	Value    string `json:"value,omitempty"` // "random", "constant", "sequence", "cidr" or empty for the field default
+	Min      int    `json:"min,omitempty"`
+	Max      int    `json:"max,omitempty"`
+	Constant string `json:"constant,omitempty"` // integer, 0x-prefixed hex bytes or IP address
+	Start    int    `json:"start,omitempty"`
+	Step     int    `json:"step,omitempty"`
+	CIDR     string `json:"cidr,omitempty"`
+
+	Enterprise int          `json:"enterprise,omitempty"` // IPFIX Private Enterprise Number; 0 for IANA elements
+	Choices    []string     `json:"choices,omitempty"`    // values picked at random by the "choice" generator
+	List       *ProfileList `json:"list,omitempty"`       // contents of an IPFIX basicList or subTemplateList field
+}
+
+// ProfileList describes the contents of an RFC 6313 basicList or subTemplateList field.
+type ProfileList struct {
+	Semantic   string         `json:"semantic,omitempty"`    // none-of, exactly-one-of, one-or-more-of, all-of, ordered or undefined
+	Count      int            `json:"count,omitempty"`       // elements or records in each list
+	TemplateID int            `json:"template_id,omitempty"` // subTemplateList only: ID of the sub-template
+	Fields     []ProfileField `json:"fields,omitempty"`      // the basicList element, or the sub-template's fields
 }
 
 type WorkerStat struct {
@@ -37,11 +89,19 @@ type StatTotals struct {
 	BytesSent uint64 `json:"bytes_sent,omitempty"`
 }
 
+// RateStat compares the achieved aggregate send rate with the configured target.
+type RateStat struct {
+	Unit     string  `json:"unit"`     // "flows/s", "packets/s" or "bits/s"
+	Target   float64 `json:"target"`   // 0 when workers are paced by delay
+	Achieved float64 `json:"achieved"` // measured over the last stats interval
+}
+
 // StatSnapshot is a point-in-time snapshot of stats for time-series charting.
 type StatSnapshot struct {
 	Timestamp time.Time          `json:"timestamp"`
 	Totals    StatTotals         `json:"totals"`
 	Workers   map[int]WorkerStat `json:"workers"`
+	Rate      RateStat           `json:"rate"` // target at Timestamp and latest achieved rate
 }
 
 type WorkerStats []WorkerStat
@@ -58,7 +118,20 @@ type DashboardPage struct {
 	ConfigOut   *Config            `json:"config_out"`
 	StatsMapOut map[int]WorkerStat `json:"stats_map_out"`
 	StatsTotal  StatTotals         `json:"stats_total"`
-	Protocol    string             `json:"protocol"`   // "netflow" or "ipfix"
-	StartTime   time.Time          `json:"start_time"` // when barrage started
-	Uptime      string             `json:"uptime"`     // human-readable uptime
+	Protocol    string             `json:"protocol"`          // "netflow", "netflow5", "ipfix" or "sflow"
+	StartTime   time.Time          `json:"start_time"`        // when barrage started
+	Uptime      string             `json:"uptime"`            // human-readable uptime
+	Targets     []TargetStat       `json:"targets,omitempty"` // per-target breakdown when barraging several targets
+}
+
+// TargetStat summarizes one barrage target for the dashboard.
+type TargetStat struct {
+	Name     string     `json:"name"`
+	Server   string     `json:"server"`
+	DstPort  int        `json:"dst_port"`
+	Protocol string     `json:"protocol"`
+	Profile  string     `json:"profile,omitempty"`
+	Workers  int        `json:"workers"`
+	Totals   StatTotals `json:"totals"`
+	Rate     RateStat   `json:"rate"`
 }
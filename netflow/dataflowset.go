@@ -6,7 +6,6 @@ package netflow
 import (
 	"encoding/binary"
 	"fmt"
-	"net"
 
 	"github.com/dmabry/flowgre/utils"
 )
@@ -21,7 +20,7 @@ type DataFlowSet struct {
 
 // Generate a DataFlowSet.
 // Per Netflow v9 spec, FlowSetID is *always* set to the TemplateID from a given TemplateFlowSet.
-// Hardcoded TemplateID to 256, but could be variable as long as it is greater than 255.
+// The TemplateID is DefaultTemplateID unless the profile implements TemplateIDProvider.
 // Currently hardcoded to generate random src/dst IPs from 10.0.0.0/8.
 // If profile is nil, defaults to GenericProfile for backward compatibility.
 func (d *DataFlowSet) Generate(flowCount int, srcRange string, dstRange string, flowSrcPort int, session *Session, profile ...FlowProfile) (DataFlowSet, error) {
@@ -31,7 +30,7 @@ func (d *DataFlowSet) Generate(flowCount int, srcRange string, dstRange string,
 	}
 
 	dataFlowSet := new(DataFlowSet)
-	dataFlowSet.FlowSetID = 256
+	dataFlowSet.FlowSetID = profileTemplateID(p)
 	protoPorts := utils.ProtoPorts
 	items := make([]any, flowCount)
 	for i := range flowCount {
@@ -53,7 +52,7 @@ func (d *DataFlowSet) Generate(flowCount int, srcRange string, dstRange string,
 		} else {
 			flowPort = flowSrcPort
 		}
-		flow, err := generateFlow(p, srcIP, dstIP, flowPort, session)
+		flow, err := encodeFlow(p, srcIP, dstIP, flowPort, session)
 		if err != nil {
 			return DataFlowSet{}, fmt.Errorf("generate flow %d: %w", i, err)
 		}
@@ -68,20 +67,6 @@ func (d *DataFlowSet) Generate(flowCount int, srcRange string, dstRange string,
 	return *dataFlowSet, nil
 }
 
-// generateFlow creates a flow record appropriate for the given profile.
-func generateFlow(p FlowProfile, srcIP, dstIP net.IP, flowPort int, session *Session) (any, error) {
-	switch prof := p.(type) {
-	case *MinimalProfile:
-		_ = prof
-		return new(MinimalFlow).Generate(srcIP, dstIP, flowPort, session)
-	case *ExtendedProfile:
-		_ = prof
-		return new(ExtendedFlow).Generate(srcIP, dstIP, flowPort, session)
-	default:
-		return new(GenericFlow).Generate(srcIP, dstIP, flowPort, session)
-	}
-}
-
 // Get the size of the DataFlowSet in bytes
 func (d *DataFlowSet) size() int {
 	padding := 0
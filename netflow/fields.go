@@ -0,0 +1,154 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package netflow
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fieldSpec names a NetFlow v9 field type and the encoded lengths it accepts.
+type fieldSpec struct {
+	name     string
+	min, max uint16
+}
+
+// fieldSpecs lists the field types from RFC 3954 / Cisco's NetFlow v9 field
+// type definitions. Counters may be sent in fewer bytes than their default
+// length, so they accept 1-8 bytes; addresses, ports and timestamps are fixed.
+var fieldSpecs = map[uint16]fieldSpec{
+	IN_BYTES:                     {"IN_BYTES", 1, 8},
+	IN_PKTS:                      {"IN_PKTS", 1, 8},
+	FLOWS:                        {"FLOWS", 1, 8},
+	PROTOCOL:                     {"PROTOCOL", 1, 1},
+	SRC_TOS:                      {"SRC_TOS", 1, 1},
+	TCP_FLAGS:                    {"TCP_FLAGS", 1, 2},
+	L4_SRC_PORT:                  {"L4_SRC_PORT", 2, 2},
+	IPV4_SRC_ADDR:                {"IPV4_SRC_ADDR", 4, 4},
+	SRC_MASK:                     {"SRC_MASK", 1, 1},
+	INPUT_SNMP:                   {"INPUT_SNMP", 1, 4},
+	L4_DST_PORT:                  {"L4_DST_PORT", 2, 2},
+	IPV4_DST_ADDR:                {"IPV4_DST_ADDR", 4, 4},
+	DST_MASK:                     {"DST_MASK", 1, 1},
+	OUTPUT_SNMP:                  {"OUTPUT_SNMP", 1, 4},
+	IPV4_NEXT_HOP:                {"IPV4_NEXT_HOP", 4, 4},
+	SRC_AS:                       {"SRC_AS", 2, 4},
+	DST_AS:                       {"DST_AS", 2, 4},
+	BGP_IPV4_NEXT_HOP:            {"BGP_IPV4_NEXT_HOP", 4, 4},
+	MUL_DST_PKTS:                 {"MUL_DST_PKTS", 1, 8},
+	MUL_DST_BYTES:                {"MUL_DST_BYTES", 1, 8},
+	LAST_SWITCHED:                {"LAST_SWITCHED", 4, 4},
+	FIRST_SWITCHED:               {"FIRST_SWITCHED", 4, 4},
+	OUT_BYTES:                    {"OUT_BYTES", 1, 8},
+	OUT_PKTS:                     {"OUT_PKTS", 1, 8},
+	MIN_PKT_LNGTH:                {"MIN_PKT_LNGTH", 2, 2},
+	MAX_PKT_LNGTH:                {"MAX_PKT_LNGTH", 2, 2},
+	IPV6_SRC_ADDR:                {"IPV6_SRC_ADDR", 16, 16},
+	IPV6_DST_ADDR:                {"IPV6_DST_ADDR", 16, 16},
+	IPV6_SRC_MASK:                {"IPV6_SRC_MASK", 1, 1},
+	IPV6_DST_MASK:                {"IPV6_DST_MASK", 1, 1},
+	IPV6_FLOW_LABEL:              {"IPV6_FLOW_LABEL", 3, 3},
+	ICMP_TYPE:                    {"ICMP_TYPE", 2, 2},
+	MUL_IGMP_TYPE:                {"MUL_IGMP_TYPE", 1, 1},
+	SAMPLING_INTERVAL:            {"SAMPLING_INTERVAL", 4, 4},
+	SAMPLING_ALGORITHM:           {"SAMPLING_ALGORITHM", 1, 1},
+	FLOW_ACTIVE_TIMEOUT:          {"FLOW_ACTIVE_TIMEOUT", 2, 2},
+	FLOW_INACTIVE_TIMEOUT:        {"FLOW_INACTIVE_TIMEOUT", 2, 2},
+	ENGINE_TYPE:                  {"ENGINE_TYPE", 1, 1},
+	ENGINE_ID:                    {"ENGINE_ID", 1, 1},
+	TOTAL_BYTES_EXP:              {"TOTAL_BYTES_EXP", 1, 8},
+	TOTAL_PKTS_EXP:               {"TOTAL_PKTS_EXP", 1, 8},
+	TOTAL_FLOWS_EXP:              {"TOTAL_FLOWS_EXP", 1, 8},
+	IPV4_SRC_PREFIX:              {"IPV4_SRC_PREFIX", 4, 4},
+	IPV4_DST_PREFIX:              {"IPV4_DST_PREFIX", 4, 4},
+	MPLS_TOP_LABEL_TYPE:          {"MPLS_TOP_LABEL_TYPE", 1, 1},
+	MPLS_TOP_LABEL_IP_ADDR:       {"MPLS_TOP_LABEL_IP_ADDR", 4, 4},
+	FLOW_SAMPLER_ID:              {"FLOW_SAMPLER_ID", 1, 4},
+	FLOW_SAMPLER_MODE:            {"FLOW_SAMPLER_MODE", 1, 1},
+	FLOW_SAMPLER_RANDOM_INTERVAL: {"FLOW_SAMPLER_RANDOM_INTERVAL", 4, 4},
+	MIN_TTL:                      {"MIN_TTL", 1, 1},
+	MAX_TTL:                      {"MAX_TTL", 1, 1},
+	IPV4_IDENT:                   {"IPV4_IDENT", 2, 2},
+	DST_TOS:                      {"DST_TOS", 1, 1},
+	IN_SRC_MAC:                   {"IN_SRC_MAC", 6, 6},
+	OUT_DST_MAC:                  {"OUT_DST_MAC", 6, 6},
+	SRC_VLAN:                     {"SRC_VLAN", 2, 2},
+	DST_VLAN:                     {"DST_VLAN", 2, 2},
+	IP_PROTOCOL_VERSION:          {"IP_PROTOCOL_VERSION", 1, 1},
+	DIRECTION:                    {"DIRECTION", 1, 1},
+	IPV6_NEXT_HOP:                {"IPV6_NEXT_HOP", 16, 16},
+	BGP_IPV6_NEXT_HOP:            {"BGP_IPV6_NEXT_HOP", 16, 16},
+	IPV6_OPTION_HEADERS:          {"IPV6_OPTION_HEADERS", 4, 4},
+	MPLS_LABEL_1:                 {"MPLS_LABEL_1", 3, 3},
+	MPLS_LABEL_2:                 {"MPLS_LABEL_2", 3, 3},
+	MPLS_LABEL_3:                 {"MPLS_LABEL_3", 3, 3},
+	MPLS_LABEL_4:                 {"MPLS_LABEL_4", 3, 3},
+	MPLS_LABEL_5:                 {"MPLS_LABEL_5", 3, 3},
+	MPLS_LABEL_6:                 {"MPLS_LABEL_6", 3, 3},
+	MPLS_LABEL_7:                 {"MPLS_LABEL_7", 3, 3},
+	MPLS_LABEL_8:                 {"MPLS_LABEL_8", 3, 3},
+	MPLS_LABEL_9:                 {"MPLS_LABEL_9", 3, 3},
+	MPLS_LABEL_10:                {"MPLS_LABEL_10", 3, 3},
+	IN_DST_MAC:                   {"IN_DST_MAC", 6, 6},
+	OUT_SRC_MAC:                  {"OUT_SRC_MAC", 6, 6},
+	IF_NAME:                      {"IF_NAME", 1, 0xFFFF},
+	IF_DESC:                      {"IF_DESC", 1, 0xFFFF},
+	SAMPLER_NAME:                 {"SAMPLER_NAME", 1, 0xFFFF},
+	IN_PERMANENT_BYTES:           {"IN_PERMANENT_BYTES", 1, 8},
+	IN_PERMANENT_PKTS:            {"IN_PERMANENT_PKTS", 1, 8},
+	FRAGMENT_OFFSET:              {"FRAGMENT_OFFSET", 2, 2},
+	FORWARDING_STATUS:            {"FORWARDING_STATUS", 1, 1},
+	MPLS_PAL_RD:                  {"MPLS_PAL_RD", 8, 8},
+	MPLS_PREFIX_LEN:              {"MPLS_PREFIX_LEN", 1, 1},
+	SRC_TRAFFIC_INDEX:            {"SRC_TRAFFIC_INDEX", 4, 4},
+	DST_TRAFFIC_INDEX:            {"DST_TRAFFIC_INDEX", 4, 4},
+	APPLICATION_DESCRIPTION:      {"APPLICATION_DESCRIPTION", 1, 0xFFFF},
+	APPLICATION_TAG:              {"APPLICATION_TAG", 1, 0xFFFF},
+	APPLICATION_NAME:             {"APPLICATION_NAME", 1, 0xFFFF},
+	POSTIP_DIFF_SERV_CODE_POINT:  {"POSTIP_DIFF_SERV_CODE_POINT", 1, 1},
+	REPLICATION_FACTOR:           {"REPLICATION_FACTOR", 4, 4},
+	LAYER2_PKT_SECTION_OFFSET:    {"LAYER2_PKT_SECTION_OFFSET", 2, 2},
+	LAYER2_PKT_SECTION_SIZE:      {"LAYER2_PKT_SECTION_SIZE", 2, 2},
+	LAYER2_PKT_SECTION_DATA:      {"LAYER2_PKT_SECTION_DATA", 1, 0xFFFF},
+}
+
+// fieldTypesByName maps lower-cased field names to their type.
+var fieldTypesByName = func() map[string]uint16 {
+	m := make(map[string]uint16, len(fieldSpecs))
+	for t, spec := range fieldSpecs {
+		m[strings.ToLower(spec.name)] = t
+	}
+	return m
+}()
+
+// FieldTypeByName returns the field type for a NetFlow v9 field name such as
+// "IN_BYTES". The lookup is case-insensitive.
+func FieldTypeByName(name string) (uint16, bool) {
+	t, ok := fieldTypesByName[strings.ToLower(name)]
+	return t, ok
+}
+
+// FieldName returns the NetFlow v9 name of a field type, or "" if it is unknown.
+func FieldName(fieldType uint16) string {
+	return fieldSpecs[fieldType].name
+}
+
+// ValidateFieldLength returns an error if length is not a valid encoding of
+// fieldType. Unknown field types accept any non-zero length.
+func ValidateFieldLength(fieldType, length uint16) error {
+	if length == 0 {
+		return fmt.Errorf("field type %d has zero length", fieldType)
+	}
+	spec, ok := fieldSpecs[fieldType]
+	if !ok {
+		return nil
+	}
+	if length < spec.min || length > spec.max {
+		if spec.min == spec.max {
+			return fmt.Errorf("field %s must be %d bytes, got %d", spec.name, spec.min, length)
+		}
+		return fmt.Errorf("field %s must be %d-%d bytes, got %d", spec.name, spec.min, spec.max, length)
+	}
+	return nil
+}
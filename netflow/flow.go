@@ -108,9 +108,11 @@ const (
 	LAYER2_PKT_SECTION_DATA      = 104
 )
 
-// GenericFlow is used to create and generate NetFlow v9 flow records.
-// Field order must match GetTemplateFields() exactly — binary.Write
-// serializes in struct field order, and the template defines the wire format.
+// GenericFlow is a NetFlow v9 flow record with one field per GenericProfile
+// template field.
+//
+// Deprecated: data flow sets encode GenericProfile records from
+// DefaultValueSource and no longer use GenericFlow.
 type GenericFlow struct {
 	InBytes       uint32
 	OutBytes      uint32
@@ -132,33 +134,17 @@ type GenericFlow struct {
 	EngineID      uint8
 }
 
-// GetTemplateFields returns the Fields for the Template to be used.
-// Field order must match GenericFlow struct field order exactly.
+// GetTemplateFields returns the GenericProfile template fields.
+//
+// Deprecated: use GenericProfile.TemplateFields.
 func (gf *GenericFlow) GetTemplateFields() []Field {
-	fields := make([]Field, 18)
-	fields[0] = Field{Type: IN_BYTES, Length: 4}
-	fields[1] = Field{Type: OUT_BYTES, Length: 4}
-	fields[2] = Field{Type: IN_PKTS, Length: 4}
-	fields[3] = Field{Type: OUT_PKTS, Length: 4}
-	fields[4] = Field{Type: IPV4_SRC_ADDR, Length: 4}
-	fields[5] = Field{Type: IPV4_DST_ADDR, Length: 4}
-	fields[6] = Field{Type: IPV6_SRC_ADDR, Length: 16}
-	fields[7] = Field{Type: IPV6_DST_ADDR, Length: 16}
-	fields[8] = Field{Type: IPV6_SRC_MASK, Length: 1}
-	fields[9] = Field{Type: IPV6_DST_MASK, Length: 1}
-	fields[10] = Field{Type: L4_SRC_PORT, Length: 2}
-	fields[11] = Field{Type: L4_DST_PORT, Length: 2}
-	fields[12] = Field{Type: PROTOCOL, Length: 1}
-	fields[13] = Field{Type: TCP_FLAGS, Length: 1}
-	fields[14] = Field{Type: FIRST_SWITCHED, Length: 4}
-	fields[15] = Field{Type: LAST_SWITCHED, Length: 4}
-	fields[16] = Field{Type: ENGINE_TYPE, Length: 1}
-	fields[17] = Field{Type: ENGINE_ID, Length: 1}
-	return fields
+	return new(GenericProfile).TemplateFields()
 }
 
 // Generate returns a NetFlow v9 Flow with randomly generated payload.
 // Populates both IPv4 and IPv6 fields based on the input IP version.
+//
+// Deprecated: data flow sets generate records from DefaultValueSource.
 func (gf *GenericFlow) Generate(srcIP net.IP, dstIP net.IP, flowSrcPort int, session *Session) (GenericFlow, error) {
 	now := time.Now().UnixNano()
 	startTime := session.StartTime()
@@ -14,6 +14,23 @@ import (
 	"github.com/dmabry/flowgre/utils"
 )
 
+// readRecord decodes an encoded record item into T, the struct with its wire layout.
+func readRecord[T any](t *testing.T, item any) T {
+	t.Helper()
+	var record T
+	b, ok := item.([]byte)
+	if !ok {
+		t.Fatalf("Got: item of type %T Want: []byte", item)
+	}
+	if len(b) != binary.Size(record) {
+		t.Fatalf("Got: record of %d bytes Want: %d", len(b), binary.Size(record))
+	}
+	if err := binary.Read(bytes.NewReader(b), binary.BigEndian, &record); err != nil {
+		t.Fatalf("read %T: %v", record, err)
+	}
+	return record
+}
+
 func TestHeader_Generate(t *testing.T) {
 	t.Parallel()
 	flowCount := 10
@@ -221,6 +238,10 @@ func TestToBytes(t *testing.T) {
 	} else {
 		t.Log("Generated Netflow Template Flow and Parsed Match!")
 	}
+	// Generated records are encoded bytes; compare them as GenericFlow
+	for i, item := range dflow.DataFlowSets[0].Items {
+		dflow.DataFlowSets[0].Items[i] = readRecord[GenericFlow](t, item)
+	}
 	if !cmp.Equal(dflow, dparsed) {
 		t.Error("Failed Generated Netflow Data Flow and Parsed is different!")
 	} else {
@@ -364,11 +385,7 @@ func TestIPv6DataNetflow(t *testing.T) {
 
 	// Verify each item has valid IPv6 addresses
 	for i, item := range dFlow.Items {
-		gf, ok := item.(GenericFlow)
-		if !ok {
-			t.Errorf("item[%d]: expected GenericFlow, got %T", i, item)
-			continue
-		}
+		gf := readRecord[GenericFlow](t, item)
 		// IPv6 addresses should not be all zeros
 		if gf.Ipv6SrcAddr == [16]byte{} {
 			t.Errorf("item[%d]: IPv6 src addr is all zeros", i)
@@ -0,0 +1,159 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package netflow
+
+import "fmt"
+
+// OptionsTemplateFlowSetID is the FlowSet ID of Options Template FlowSets (RFC 3954 Section 6.1).
+const OptionsTemplateFlowSetID = 1
+
+// RFC 3954 Section 6.1 scope field types of an options template.
+const (
+	ScopeSystem    = 1
+	ScopeInterface = 2
+	ScopeLineCard  = 3
+	ScopeCache     = 4
+	ScopeTemplate  = 5
+)
+
+// Options template IDs. Custom profiles can't use them.
+const (
+	// SystemOptionsTemplateID is the ID of the system-scoped sampler and
+	// exporter statistics options template.
+	SystemOptionsTemplateID = 257
+	// InterfaceOptionsTemplateID is the ID of the interface-scoped interface
+	// name options template.
+	InterfaceOptionsTemplateID = 258
+)
+
+// interfaceCount is the number of interfaces named in options data. Default
+// INPUT_SNMP and OUTPUT_SNMP values are drawn from the same ifIndexes.
+const interfaceCount = 63
+
+// interfaceNameLength is the length of the IF_NAME option field.
+const interfaceNameLength = 16
+
+// OptionsTemplate is an Options Template record: the scope fields describe what
+// the options apply to, the option fields what is reported about it.
+type OptionsTemplate struct {
+	TemplateID   uint16
+	ScopeFields  []Field
+	OptionFields []Field
+}
+
+// OptionsTemplateFlowSet for Netflow
+type OptionsTemplateFlowSet struct {
+	FlowSetID uint16 // always OptionsTemplateFlowSetID
+	Length    uint16
+	Templates []OptionsTemplate
+	Padding   int
+}
+
+// systemOptionsTemplate returns the system-scoped options template.
+func systemOptionsTemplate() OptionsTemplate {
+	return OptionsTemplate{
+		TemplateID:  SystemOptionsTemplateID,
+		ScopeFields: []Field{{Type: ScopeSystem, Length: 4}},
+		OptionFields: []Field{
+			{Type: SAMPLING_INTERVAL, Length: 4},
+			{Type: SAMPLING_ALGORITHM, Length: 1},
+			{Type: FLOW_SAMPLER_ID, Length: 1},
+			{Type: FLOW_SAMPLER_MODE, Length: 1},
+			{Type: FLOW_SAMPLER_RANDOM_INTERVAL, Length: 4},
+			{Type: TOTAL_PKTS_EXP, Length: 4},
+		},
+	}
+}
+
+// interfaceOptionsTemplate returns the interface-scoped options template.
+func interfaceOptionsTemplate() OptionsTemplate {
+	return OptionsTemplate{
+		TemplateID:   InterfaceOptionsTemplateID,
+		ScopeFields:  []Field{{Type: ScopeInterface, Length: 4}},
+		OptionFields: []Field{{Type: IF_NAME, Length: interfaceNameLength}},
+	}
+}
+
+// Generate an OptionsTemplateFlowSet with the system and interface options templates.
+func (o *OptionsTemplateFlowSet) Generate() OptionsTemplateFlowSet {
+	optionsFlowSet := OptionsTemplateFlowSet{
+		FlowSetID: OptionsTemplateFlowSetID,
+		Templates: []OptionsTemplate{systemOptionsTemplate(), interfaceOptionsTemplate()},
+	}
+	rawSize := optionsFlowSet.rawSize()
+	remainder := rawSize % 4
+	if remainder > 0 {
+		optionsFlowSet.Padding = 4 - remainder
+	}
+	optionsFlowSet.Length = uint16(rawSize + optionsFlowSet.Padding)
+	return optionsFlowSet
+}
+
+// rawSize returns the size of the OptionsTemplateFlowSet in bytes before padding.
+func (o *OptionsTemplateFlowSet) rawSize() int {
+	// FlowSetID(2) + Length(2), then per template
+	// TemplateID(2) + Option Scope Length(2) + Option Length(2) + field specifiers
+	size := 4
+	for _, t := range o.Templates {
+		size += 6 + 4*(len(t.ScopeFields)+len(t.OptionFields))
+	}
+	return size
+}
+
+// SystemOptionsRecord is an options data record of the system options template.
+// flowgre generates unsampled flows, so every sampling interval is 1.
+type SystemOptionsRecord struct {
+	System                    uint32
+	SamplingInterval          uint32
+	SamplingAlgorithm         uint8
+	FlowSamplerID             uint8
+	FlowSamplerMode           uint8
+	FlowSamplerRandomInterval uint32
+	TotalPacketsExported      uint32
+}
+
+// InterfaceOptionsRecord is an options data record of the interface options template.
+type InterfaceOptionsRecord struct {
+	Interface uint32
+	Name      [interfaceNameLength]byte
+}
+
+// optionsDataFlowSet returns a Data FlowSet of options records for templateID.
+func optionsDataFlowSet(templateID uint16, records []any) DataFlowSet {
+	dataFlowSet := DataFlowSet{FlowSetID: templateID, Items: records}
+	dataFlowSet.Length = uint16(dataFlowSet.size())
+	return dataFlowSet
+}
+
+// GenerateOptionsNetflow Generates a Netflow containing the options templates and
+// their options data: the sampler settings and export packet count of sourceID,
+// and the name of every interface.
+func GenerateOptionsNetflow(sourceID int, session *Session) Netflow {
+	netflow := new(Netflow)
+	optionsFlow := new(OptionsTemplateFlowSet).Generate()
+	// 2 options templates, 1 system record and a record per interface
+	header := new(Header).Generate(2+1+interfaceCount, sourceID, session)
+
+	system := optionsDataFlowSet(SystemOptionsTemplateID, []any{SystemOptionsRecord{
+		System:                    uint32(sourceID),
+		SamplingInterval:          1,
+		SamplingAlgorithm:         1, // deterministic
+		FlowSamplerID:             1,
+		FlowSamplerMode:           1, // deterministic
+		FlowSamplerRandomInterval: 1,
+		TotalPacketsExported:      header.FlowSequence,
+	}})
+	interfaces := make([]any, interfaceCount)
+	for i := range interfaces {
+		record := InterfaceOptionsRecord{Interface: uint32(i + 1)}
+		copy(record.Name[:], fmt.Sprintf("Gi0/0/%d", i+1))
+		interfaces[i] = record
+	}
+	names := optionsDataFlowSet(InterfaceOptionsTemplateID, interfaces)
+
+	netflow.Header = header
+	netflow.OptionsTemplateFlowSets = append(netflow.OptionsTemplateFlowSets, optionsFlow)
+	netflow.DataFlowSets = append(netflow.DataFlowSets, system, names)
+	return *netflow
+}
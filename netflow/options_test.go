@@ -0,0 +1,74 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package netflow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// optionsRecordSize returns the size of an options data record of t in bytes.
+func optionsRecordSize(t OptionsTemplate) int {
+	size := 0
+	for _, f := range t.ScopeFields {
+		size += int(f.Length)
+	}
+	for _, f := range t.OptionFields {
+		size += int(f.Length)
+	}
+	return size
+}
+
+func TestGenerateOptionsNetflow(t *testing.T) {
+	t.Parallel()
+	session := NewSession()
+	GenerateTemplateNetflow(42, session)
+	flow := GenerateOptionsNetflow(42, session)
+
+	if len(flow.OptionsTemplateFlowSets) != 1 || len(flow.DataFlowSets) != 2 {
+		t.Fatalf("Got: %d options template and %d data FlowSets Want: 1 and 2", len(flow.OptionsTemplateFlowSets), len(flow.DataFlowSets))
+	}
+	templates := flow.OptionsTemplateFlowSets[0].Templates
+	for i, ds := range flow.DataFlowSets {
+		if ds.FlowSetID != templates[i].TemplateID {
+			t.Errorf("Got: data FlowSet %d Want: %d", ds.FlowSetID, templates[i].TemplateID)
+		}
+		for _, item := range ds.Items {
+			if got, want := binary.Size(item), optionsRecordSize(templates[i]); got != want {
+				t.Errorf("template %d: Got: record of %d bytes Want: %d", templates[i].TemplateID, got, want)
+			}
+		}
+	}
+	system := flow.DataFlowSets[0].Items[0].(SystemOptionsRecord)
+	if system.System != 42 || system.SamplingInterval != 1 || system.TotalPacketsExported != 2 {
+		t.Errorf("Got: %+v Want: system 42, sampling interval 1 and 2 packets exported", system)
+	}
+	name := flow.DataFlowSets[1].Items[0].(InterfaceOptionsRecord)
+	if name.Interface != 1 || string(bytes.TrimRight(name.Name[:], "\x00")) != "Gi0/0/1" {
+		t.Errorf("Got: interface %d named %q Want: interface 1 named Gi0/0/1", name.Interface, name.Name)
+	}
+
+	buf := flow.ToBytes()
+	payload := buf.Bytes()
+	if ok, err := IsValidNetFlow(payload, 9); !ok {
+		t.Fatalf("IsValidNetFlow should accept the options packet: %v", err)
+	}
+	// The Options Template FlowSet follows the header
+	set := payload[20:]
+	if id := binary.BigEndian.Uint16(set[0:2]); id != OptionsTemplateFlowSetID {
+		t.Errorf("Got: FlowSet ID %d Want: %d", id, OptionsTemplateFlowSetID)
+	}
+	if length := int(binary.BigEndian.Uint16(set[2:4])); length%4 != 0 || length != int(flow.OptionsTemplateFlowSets[0].Length) {
+		t.Errorf("Got: Options Template FlowSet length %d Want: %d, a multiple of 4", length, flow.OptionsTemplateFlowSets[0].Length)
+	}
+	want := []byte{
+		0x01, 0x01, 0x00, 0x04, 0x00, 0x18, // template 257: 1 scope field, 6 option fields
+		0x00, ScopeSystem, 0x00, 0x04,
+		0x00, SAMPLING_INTERVAL, 0x00, 0x04,
+	}
+	if got := set[4 : 4+len(want)]; !bytes.Equal(got, want) {
+		t.Errorf("Got: %x Want: %x", got, want)
+	}
+}
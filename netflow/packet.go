@@ -12,9 +12,10 @@ import (
 
 // Netflow complete record
 type Netflow struct {
-	Header           Header
-	TemplateFlowSets []TemplateFlowSet
-	DataFlowSets     []DataFlowSet
+	Header                  Header
+	TemplateFlowSets        []TemplateFlowSet
+	OptionsTemplateFlowSets []OptionsTemplateFlowSet
+	DataFlowSets            []DataFlowSet
 }
 
 // ToBytes Converts Netflow struct to a bytes buffer than can be written to the wire
@@ -67,6 +68,46 @@ func (n *Netflow) ToBytes() bytes.Buffer {
 			}
 		}
 	}
+	// Write Options Template flow(s) if any exists
+	for _, oFlow := range n.OptionsTemplateFlowSets {
+		// Order FlowSetID, Length, Options Template(s)
+		err := binary.Write(&buf, binary.BigEndian, oFlow.FlowSetID)
+		if err != nil {
+			log.Println("[ERROR] Issue writing Options Template FlowSetID: ", err)
+		}
+		err = binary.Write(&buf, binary.BigEndian, oFlow.Length)
+		if err != nil {
+			log.Println("[ERROR] Issue writing Options Template Length: ", err)
+		}
+		for _, template := range oFlow.Templates {
+			// Order TemplateId, Option Scope Length, Option Length, Scope Field(s), Option Field(s)
+			err = binary.Write(&buf, binary.BigEndian, template.TemplateID)
+			if err != nil {
+				log.Println("[ERROR] Issue writing Options Template ID: ", err)
+			}
+			err = binary.Write(&buf, binary.BigEndian, uint16(4*len(template.ScopeFields)))
+			if err != nil {
+				log.Println("[ERROR] Issue writing Option Scope Length: ", err)
+			}
+			err = binary.Write(&buf, binary.BigEndian, uint16(4*len(template.OptionFields)))
+			if err != nil {
+				log.Println("[ERROR] Issue writing Option Length: ", err)
+			}
+			for _, fields := range [][]Field{template.ScopeFields, template.OptionFields} {
+				err = binary.Write(&buf, binary.BigEndian, fields)
+				if err != nil {
+					log.Println("[ERROR] Issue writing Options Template Fields: ", err)
+				}
+			}
+		}
+		// Padding to 32 bit boundary per Netflow v9 RFC
+		if oFlow.Padding > 0 {
+			err = binary.Write(&buf, binary.BigEndian, bytes.Repeat([]byte{0}, oFlow.Padding))
+			if err != nil {
+				log.Println("[ERROR] Issue writing Options Template Padding: ", err)
+			}
+		}
+	}
 	// Write Data flow(s) if any exists
 	if len(n.DataFlowSets) > 0 {
 		for _, dFlow := range n.DataFlowSets {
@@ -106,6 +147,13 @@ func GetNetFlowSizes(netFlow Netflow) string {
 		tSize += tFlow.rawSize()
 	}
 	output += fmt.Sprintf("Template Size: %d bytes\n", tSize)
+	oSize := 0
+	for _, oFlow := range netFlow.OptionsTemplateFlowSets {
+		oSize += oFlow.rawSize()
+	}
+	if oSize > 0 {
+		output += fmt.Sprintf("Options Template Size: %d bytes\n", oSize)
+	}
 	dSize := 0
 	for _, dFlow := range netFlow.DataFlowSets {
 		dSize += dFlow.size()
@@ -0,0 +1,55 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package netflow
+
+import "github.com/dmabry/flowgre/encoder"
+
+// TemplateIDProvider is implemented by profiles that use a template ID other
+// than DefaultTemplateID. The ID must be 256 or greater.
+type TemplateIDProvider interface {
+	TemplateID() uint16
+}
+
+// profileTemplateID returns the template ID for p.
+func profileTemplateID(p FlowProfile) uint16 {
+	if tp, ok := p.(TemplateIDProvider); ok {
+		return tp.TemplateID()
+	}
+	return DefaultTemplateID
+}
+
+// CustomProfile is a FlowProfile described entirely by data, such as a
+// profile declared in the config file. Records are built by the encoder.
+type CustomProfile struct {
+	name       string
+	templateID uint16
+	fields     []Field
+	sources    []encoder.ValueSource
+}
+
+// NewCustomProfile returns a profile with the given template ID, fields and one
+// value source per field. A nil source uses DefaultValueSource for its field.
+func NewCustomProfile(name string, templateID uint16, fields []Field, sources []encoder.ValueSource) *CustomProfile {
+	resolved := make([]encoder.ValueSource, len(fields))
+	for i, f := range fields {
+		if i < len(sources) && sources[i] != nil {
+			resolved[i] = sources[i]
+		} else {
+			resolved[i] = DefaultValueSource(f.Type)
+		}
+	}
+	return &CustomProfile{name: name, templateID: templateID, fields: fields, sources: resolved}
+}
+
+// Name returns the profile name.
+func (p *CustomProfile) Name() string { return p.name }
+
+// TemplateFields returns the profile's template fields.
+func (p *CustomProfile) TemplateFields() []Field { return p.fields }
+
+// TemplateID returns the profile's template ID.
+func (p *CustomProfile) TemplateID() uint16 { return p.templateID }
+
+// ValueSources returns one value source per template field.
+func (p *CustomProfile) ValueSources() []encoder.ValueSource { return p.sources }
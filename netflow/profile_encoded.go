@@ -0,0 +1,101 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package netflow
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/dmabry/flowgre/encoder"
+)
+
+// ValueSourcer is implemented by profiles that supply their own value source for
+// each template field. ValueSources must return one source per TemplateFields entry.
+// Profiles that do not implement it get DefaultValueSource for every field.
+// ValueSources is called for every record, so stateful sources such as
+// encoder.Sequence must be created once and returned on each call.
+type ValueSourcer interface {
+	ValueSources() []encoder.ValueSource
+}
+
+// DefaultValueSource returns the value source used for a NetFlow v9 field type
+// when a profile does not provide its own. The built-in profiles are encoded
+// entirely from these. Unknown field types are zero-filled.
+func DefaultValueSource(fieldType uint16) encoder.ValueSource {
+	switch fieldType {
+	case IN_BYTES, OUT_BYTES, IN_PKTS, OUT_PKTS:
+		return encoder.Random(0, 10000)
+	case IPV4_SRC_ADDR, IPV6_SRC_ADDR:
+		return encoder.SrcAddr()
+	case IPV4_DST_ADDR, IPV6_DST_ADDR:
+		return encoder.DstAddr()
+	case IPV6_SRC_MASK, IPV6_DST_MASK:
+		return encoder.IPv6PrefixLength(64)
+	case SRC_MASK, DST_MASK:
+		return encoder.Uint(8)
+	case L4_SRC_PORT:
+		return encoder.SrcPort()
+	case L4_DST_PORT:
+		return encoder.DstPort()
+	case PROTOCOL:
+		return encoder.Protocol()
+	case TCP_FLAGS:
+		return encoder.Random(0, 32)
+	case FIRST_SWITCHED:
+		return encoder.Uptime(-100)
+	case LAST_SWITCHED:
+		return encoder.Uptime(-10)
+	case INPUT_SNMP, OUTPUT_SNMP:
+		return encoder.Random(1, interfaceCount+1)
+	case SRC_AS, DST_AS:
+		return encoder.Random(1, 65535)
+	case IN_SRC_MAC, OUT_DST_MAC, IN_DST_MAC, OUT_SRC_MAC:
+		return encoder.RandomBytes()
+	case SRC_VLAN, DST_VLAN:
+		return encoder.Random(1, 4094)
+	case MIN_TTL, MAX_TTL:
+		return encoder.Random(1, 128)
+	default:
+		return encoder.Zero()
+	}
+}
+
+// EncoderFields converts NetFlow v9 template fields to encoder fields.
+func EncoderFields(fields []Field) []encoder.Field {
+	out := make([]encoder.Field, len(fields))
+	for i, f := range fields {
+		out[i] = encoder.Field{Type: f.Type, Length: f.Length}
+	}
+	return out
+}
+
+// profileValueSources returns the value sources for p's template fields.
+func profileValueSources(p FlowProfile, fields []Field) ([]encoder.ValueSource, error) {
+	if vs, ok := p.(ValueSourcer); ok {
+		sources := vs.ValueSources()
+		if len(sources) != len(fields) {
+			return nil, fmt.Errorf("profile %s has %d fields but %d value sources", p.Name(), len(fields), len(sources))
+		}
+		return sources, nil
+	}
+	sources := make([]encoder.ValueSource, len(fields))
+	for i, f := range fields {
+		sources[i] = DefaultValueSource(f.Type)
+	}
+	return sources, nil
+}
+
+// encodeFlow encodes a flow record for p from its template fields and value sources.
+func encodeFlow(p FlowProfile, srcIP, dstIP net.IP, flowPort int, session *Session) ([]byte, error) {
+	fields := p.TemplateFields()
+	sources, err := profileValueSources(p, fields)
+	if err != nil {
+		return nil, err
+	}
+	flow, err := encoder.NewFlow(srcIP, dstIP, flowPort, session.StartTime())
+	if err != nil {
+		return nil, err
+	}
+	return encoder.Encode(EncoderFields(fields), sources, flow)
+}
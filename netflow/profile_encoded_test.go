@@ -0,0 +1,130 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package netflow
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/dmabry/flowgre/encoder"
+	"github.com/dmabry/flowgre/utils"
+)
+
+// asProfile is a data-only profile with no record struct.
+type asProfile struct{}
+
+func (p *asProfile) Name() string { return "as" }
+
+func (p *asProfile) TemplateFields() []Field {
+	return []Field{
+		{Type: IPV4_SRC_ADDR, Length: 4},
+		{Type: IPV4_DST_ADDR, Length: 4},
+		{Type: SRC_AS, Length: 4},
+		{Type: DST_AS, Length: 4},
+		{Type: L4_DST_PORT, Length: 2},
+		{Type: PROTOCOL, Length: 1},
+	}
+}
+
+// sourcedProfile overrides the default value sources.
+type sourcedProfile struct {
+	asProfile
+	sources []encoder.ValueSource
+}
+
+func newSourcedProfile() *sourcedProfile {
+	return &sourcedProfile{sources: []encoder.ValueSource{
+		encoder.SrcAddr(),
+		encoder.DstAddr(),
+		encoder.Uint(64512),
+		encoder.Sequence(65000, 1),
+		encoder.DstPort(),
+		encoder.Protocol(),
+	}}
+}
+
+func (p *sourcedProfile) ValueSources() []encoder.ValueSource {
+	return p.sources
+}
+
+// shortSourcedProfile returns too few value sources.
+type shortSourcedProfile struct{ asProfile }
+
+func (p *shortSourcedProfile) ValueSources() []encoder.ValueSource {
+	return []encoder.ValueSource{encoder.Zero()}
+}
+
+func TestDataFlowSet_Generate_EncodedProfile(t *testing.T) {
+	t.Parallel()
+
+	session := NewSession()
+	profile := newSourcedProfile()
+	flow, err := GenerateDataNetflow(5, 1, "10.0.0.0/8", "10.0.0.0/8", utils.DNSPort, session, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := flow.DataFlowSets[0].Items
+	if len(items) != 5 {
+		t.Fatalf("expected 5 items, got %d", len(items))
+	}
+	for i, item := range items {
+		record, ok := item.([]byte)
+		if !ok {
+			t.Fatalf("item[%d]: expected []byte, got %T", i, item)
+		}
+		if len(record) != 19 {
+			t.Fatalf("item[%d]: expected 19-byte record, got %d", i, len(record))
+		}
+		if record[0] != 10 || record[4] != 10 {
+			t.Errorf("item[%d]: addresses not from 10.0.0.0/8: %v", i, record[0:8])
+		}
+		if got := binary.BigEndian.Uint32(record[8:12]); got != 64512 {
+			t.Errorf("item[%d]: src AS %d, want 64512", i, got)
+		}
+		if got := binary.BigEndian.Uint32(record[12:16]); got != uint32(65000+i) {
+			t.Errorf("item[%d]: dst AS %d, want %d", i, got, 65000+i)
+		}
+		if got := binary.BigEndian.Uint16(record[16:18]); got != utils.DNSPort || record[18] != utils.UDPProto {
+			t.Errorf("item[%d]: port/protocol %d/%d", i, got, record[18])
+		}
+	}
+
+	// Template and data must agree so the packet validates end to end
+	tmpl := GenerateTemplateNetflow(1, session, profile)
+	tBuf := tmpl.ToBytes()
+	dBuf := flow.ToBytes()
+	for name, pkt := range map[string][]byte{"template": tBuf.Bytes(), "data": dBuf.Bytes()} {
+		if ok, err := IsValidNetFlow(pkt, 9); !ok {
+			t.Errorf("%s packet invalid: %v", name, err)
+		}
+	}
+}
+
+func TestDataFlowSet_Generate_DefaultValueSources(t *testing.T) {
+	t.Parallel()
+
+	dfs, err := new(DataFlowSet).Generate(3, "10.0.0.0/8", "10.0.0.0/8", utils.HTTPSPort, NewSession(), &asProfile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range dfs.Items {
+		record := item.([]byte)
+		if got := binary.BigEndian.Uint16(record[16:18]); got != utils.HTTPSPort {
+			t.Errorf("item[%d]: dst port %d, want %d", i, got, utils.HTTPSPort)
+		}
+	}
+	// 3 records of 19 bytes + 4 byte header = 61, padded to 64
+	if dfs.Length != 64 || dfs.Padding != 3 {
+		t.Errorf("length/padding wrong! Got: %d/%d Want: 64/3", dfs.Length, dfs.Padding)
+	}
+}
+
+func TestDataFlowSet_Generate_ValueSourceMismatch(t *testing.T) {
+	t.Parallel()
+
+	_, err := new(DataFlowSet).Generate(1, "10.0.0.0/8", "10.0.0.0/8", 0, NewSession(), &shortSourcedProfile{})
+	if err == nil {
+		t.Error("expected error for profile with too few value sources")
+	}
+}
@@ -38,8 +38,11 @@ func (p *ExtendedProfile) TemplateFields() []Field {
 	}
 }
 
-// ExtendedFlow is an extended NetFlow v9 flow record with 15 fields.
-// Field order must match ExtendedProfile.TemplateFields() exactly.
+// ExtendedFlow is an extended NetFlow v9 flow record with one field per
+// ExtendedProfile template field.
+//
+// Deprecated: data flow sets encode ExtendedProfile records from
+// DefaultValueSource and no longer use ExtendedFlow.
 type ExtendedFlow struct {
 	InBytes       uint32
 	InPkts        uint32
@@ -59,6 +62,8 @@ type ExtendedFlow struct {
 }
 
 // Generate creates an ExtendedFlow with randomly generated data.
+//
+// Deprecated: data flow sets generate records from DefaultValueSource.
 func (ef *ExtendedFlow) Generate(srcIP net.IP, dstIP net.IP, flowSrcPort int, session *Session) (ExtendedFlow, error) {
 	now := time.Now().UnixNano()
 	startTime := session.StartTime()
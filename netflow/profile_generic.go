@@ -8,7 +8,7 @@ package netflow
 // a factory for creating corresponding data records.
 type FlowProfile interface {
 	// TemplateFields returns the field definitions for the template.
-	// Field order must match the data record struct field order exactly.
+	// Records are encoded field by field from value sources (see ValueSourcer).
 	TemplateFields() []Field
 
 	// Name returns a human-readable name for logging and CLI display.
@@ -16,7 +16,7 @@ type FlowProfile interface {
 }
 
 // GenericProfile implements FlowProfile for the default 18-field flow.
-// This profile maintains backward compatibility with existing GenericFlow records.
+// Its records keep the wire layout of the original GenericFlow records.
 type GenericProfile struct{}
 
 // Name returns the profile name.
@@ -24,8 +24,7 @@ func (p *GenericProfile) Name() string {
 	return "generic"
 }
 
-// TemplateFields returns the 18-field template that matches GenericFlow struct layout.
-// Field order must match GenericFlow struct field order exactly.
+// TemplateFields returns the 18-field generic template.
 func (p *GenericProfile) TemplateFields() []Field {
 	return []Field{
 		{Type: IN_BYTES, Length: 4},
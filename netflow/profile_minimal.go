@@ -30,8 +30,11 @@ func (p *MinimalProfile) TemplateFields() []Field {
 	}
 }
 
-// MinimalFlow is a minimal NetFlow v9 flow record with 7 essential fields.
-// Field order must match MinimalProfile.TemplateFields() exactly.
+// MinimalFlow is a minimal NetFlow v9 flow record with one field per
+// MinimalProfile template field.
+//
+// Deprecated: data flow sets encode MinimalProfile records from
+// DefaultValueSource and no longer use MinimalFlow.
 type MinimalFlow struct {
 	InBytes  uint32
 	InPkts   uint32
@@ -43,6 +46,8 @@ type MinimalFlow struct {
 }
 
 // Generate creates a MinimalFlow with randomly generated data.
+//
+// Deprecated: data flow sets generate records from DefaultValueSource.
 func (mf *MinimalFlow) Generate(srcIP net.IP, dstIP net.IP, flowSrcPort int, session *Session) (MinimalFlow, error) {
 	var err error
 	mf.InBytes, err = utils.GenerateRand32(10000)
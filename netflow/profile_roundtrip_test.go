@@ -25,11 +25,7 @@ func TestDataFlowSet_Generate_MinimalProfile(t *testing.T) {
 	}
 
 	for i, item := range dfs.Items {
-		mf, ok := item.(MinimalFlow)
-		if !ok {
-			t.Errorf("item[%d]: expected MinimalFlow, got %T", i, item)
-			continue
-		}
+		mf := readRecord[MinimalFlow](t, item)
 		if mf.SrcAddr == 0 {
 			t.Errorf("item[%d]: expected non-zero src addr", i)
 		}
@@ -53,11 +49,7 @@ func TestDataFlowSet_Generate_ExtendedProfile(t *testing.T) {
 	}
 
 	for i, item := range dfs.Items {
-		ef, ok := item.(ExtendedFlow)
-		if !ok {
-			t.Errorf("item[%d]: expected ExtendedFlow, got %T", i, item)
-			continue
-		}
+		ef := readRecord[ExtendedFlow](t, item)
 		if ef.SrcAddr == 0 {
 			t.Errorf("item[%d]: expected non-zero src addr", i)
 		}
@@ -84,11 +76,7 @@ func TestDataFlowSet_Generate_DefaultProfile(t *testing.T) {
 	}
 
 	for i, item := range dfs.Items {
-		gf, ok := item.(GenericFlow)
-		if !ok {
-			t.Errorf("item[%d]: expected GenericFlow, got %T", i, item)
-			continue
-		}
+		gf := readRecord[GenericFlow](t, item)
 		if gf.Ipv4SrcAddr == 0 {
 			t.Errorf("item[%d]: expected non-zero IPv4 src addr", i)
 		}
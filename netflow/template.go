@@ -9,6 +9,9 @@ import (
 	"time"
 )
 
+// DefaultTemplateID is the template ID used by profiles that do not choose their own.
+const DefaultTemplateID = 256
+
 // Header NetflowHeader v9
 type Header struct {
 	Version      uint16
@@ -102,7 +105,7 @@ type TemplateFlowSet struct {
 
 // Generate a TemplateFlowSet.
 // Per Netflow v9 spec, FlowSetID is *always* 0 for a TemplateFlow.
-// Hardcoded TemplateID to 256, but could be variable as long as it is greater than 255.
+// TemplateID is DefaultTemplateID unless the profile implements TemplateIDProvider.
 // If profile is nil, defaults to GenericProfile for backward compatibility.
 func (t *TemplateFlowSet) Generate(session *Session, profile ...FlowProfile) TemplateFlowSet {
 	p := FlowProfile(&GenericProfile{}) // default
@@ -116,7 +119,7 @@ func (t *TemplateFlowSet) Generate(session *Session, profile ...FlowProfile) Tem
 	// template
 	template := new(Template)
 	fields := p.TemplateFields()
-	template.TemplateID = 256
+	template.TemplateID = profileTemplateID(p)
 	template.FieldCount = uint16(len(fields))
 	// add fields to the template
 	template.Fields = fields
@@ -0,0 +1,256 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// NetFlow v5 funcs and structs used for generating fixed-format netflow packets to be put on the wire.
+// NetFlow v5 has no templates: every packet is a 24-byte header followed by up to 30 48-byte flow records.
+
+package netflowv5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/utils"
+)
+
+// NetFlow v5 version number and wire sizes.
+const (
+	Version    = 5
+	HeaderSize = 24
+	RecordSize = 48
+	// MaxRecords is the maximum number of flow records a single v5 packet can carry.
+	MaxRecords = 30
+)
+
+// Header is the fixed 24-byte NetFlow v5 header.
+type Header struct {
+	Version          uint16
+	Count            uint16
+	SysUptime        uint32
+	UnixSecs         uint32
+	UnixNsecs        uint32
+	FlowSequence     uint32 // total flows exported before this packet
+	EngineType       uint8
+	EngineID         uint8
+	SamplingInterval uint16
+}
+
+// Generate a Header for a packet carrying flowCount records. NetFlow v5 has no
+// source ID, so the sourceID is spread across the engine type and engine ID bytes.
+func (h *Header) Generate(flowCount int, sourceID int, flowSequence uint32, session *netflow.Session) Header {
+	now := time.Now().UnixNano()
+	sysUptime := uint32((now-session.StartTime())/int64(time.Millisecond)) + 1000
+
+	return Header{
+		Version:      Version,
+		Count:        uint16(flowCount),
+		SysUptime:    sysUptime,
+		UnixSecs:     uint32(now / int64(time.Second)),
+		UnixNsecs:    uint32(now % int64(time.Second)),
+		FlowSequence: flowSequence,
+		EngineType:   uint8(sourceID >> 8),
+		EngineID:     uint8(sourceID),
+	}
+}
+
+// String returns a human-readable representation of the Header.
+func (h *Header) String() string {
+	return fmt.Sprintf("Version: %d Count: %d SysUptime: %d UnixSecs: %d UnixNsecs: %d FlowSequence: %d EngineType: %d EngineID: %d SamplingInterval: %d",
+		h.Version, h.Count, h.SysUptime, h.UnixSecs, h.UnixNsecs, h.FlowSequence, h.EngineType, h.EngineID, h.SamplingInterval)
+}
+
+// Record is a fixed 48-byte NetFlow v5 flow record.
+// Field order is the wire order; binary.Write serializes in struct field order.
+type Record struct {
+	SrcAddr  uint32
+	DstAddr  uint32
+	NextHop  uint32
+	Input    uint16
+	Output   uint16
+	DPkts    uint32
+	DOctets  uint32
+	First    uint32
+	Last     uint32
+	SrcPort  uint16
+	DstPort  uint16
+	Pad1     uint8
+	TCPFlags uint8
+	Protocol uint8
+	Tos      uint8
+	SrcAS    uint16
+	DstAS    uint16
+	SrcMask  uint8
+	DstMask  uint8
+	Pad2     uint16
+}
+
+// Generate creates a Record with randomly generated data.
+// NetFlow v5 only carries IPv4 addresses, so IPv6 addresses are rejected.
+func (r *Record) Generate(srcIP net.IP, dstIP net.IP, flowSrcPort int, session *netflow.Session) (Record, error) {
+	if srcIP.To4() == nil || dstIP.To4() == nil {
+		return Record{}, fmt.Errorf("NetFlow v5 supports IPv4 only, got %s -> %s", srcIP, dstIP)
+	}
+	now := time.Now().UnixNano()
+	uptime := uint32((now-session.StartTime())/int64(time.Millisecond)) + 1000
+
+	var err error
+	r.SrcAddr = utils.IPToNum(srcIP.To4())
+	r.DstAddr = utils.IPToNum(dstIP.To4())
+	r.NextHop = 0
+	r.DPkts, err = utils.GenerateRand32(10000)
+	if err != nil {
+		return Record{}, fmt.Errorf("generate DPkts: %w", err)
+	}
+	r.DOctets, err = utils.GenerateRand32(10000)
+	if err != nil {
+		return Record{}, fmt.Errorf("generate DOctets: %w", err)
+	}
+	r.SrcPort, err = utils.GenerateRand16(10000)
+	if err != nil {
+		return Record{}, fmt.Errorf("generate SrcPort: %w", err)
+	}
+	tcpFlags, err := utils.RandomNum(0, 32)
+	if err != nil {
+		return Record{}, fmt.Errorf("generate TCPFlags: %w", err)
+	}
+	r.TCPFlags = uint8(tcpFlags)
+	r.First = uptime - 100
+	r.Last = uptime - 10
+	r.SrcMask = 8
+	r.DstMask = 8
+
+	r.DstPort, r.Protocol = utils.ResolvePortProtocol(flowSrcPort)
+
+	return *r, nil
+}
+
+// NetflowV5 is a complete NetFlow v5 packet.
+type NetflowV5 struct {
+	Header  Header
+	Records []Record
+}
+
+// ToBytes converts the NetflowV5 struct to a bytes buffer that can be written to the wire.
+func (n *NetflowV5) ToBytes() (bytes.Buffer, error) {
+	var buf bytes.Buffer
+	if len(n.Records) > MaxRecords {
+		return buf, fmt.Errorf("NetFlow v5 packet has %d records, maximum is %d", len(n.Records), MaxRecords)
+	}
+	buf.Grow(HeaderSize + len(n.Records)*RecordSize)
+	if err := binary.Write(&buf, binary.BigEndian, &n.Header); err != nil {
+		return bytes.Buffer{}, fmt.Errorf("write header: %w", err)
+	}
+	for i := range n.Records {
+		if err := binary.Write(&buf, binary.BigEndian, &n.Records[i]); err != nil {
+			return bytes.Buffer{}, fmt.Errorf("write record %d: %w", i, err)
+		}
+	}
+	return buf, nil
+}
+
+// Sequence tracks the NetFlow v5 flow sequence number, the count of flows
+// exported before the current packet.
+type Sequence struct {
+	counter atomic.Uint32
+}
+
+// NewSequence creates a new sequence tracker.
+func NewSequence() *Sequence {
+	return &Sequence{}
+}
+
+// Reserve returns the current sequence number and atomically advances
+// the counter by flowCount.
+func (s *Sequence) Reserve(flowCount int) uint32 {
+	return s.counter.Add(uint32(flowCount)) - uint32(flowCount)
+}
+
+// Current returns the current sequence number without advancing.
+func (s *Sequence) Current() uint32 {
+	return s.counter.Load()
+}
+
+// GenerateNetflowV5 generates a NetFlow v5 packet containing flowCount random flow records.
+// If flowSrcPort is 0 a random well-known port is picked for every flow.
+func GenerateNetflowV5(flowCount int, sourceID int, srcRange string, dstRange string, flowSrcPort int, session *netflow.Session, seq *Sequence) (NetflowV5, error) {
+	if flowCount < 1 || flowCount > MaxRecords {
+		return NetflowV5{}, fmt.Errorf("NetFlow v5 flow count must be between 1 and %d, got %d", MaxRecords, flowCount)
+	}
+	protoPorts := utils.ProtoPorts
+	records := make([]Record, flowCount)
+	for i := range flowCount {
+		srcIP, err := utils.RandomIPCIDR(srcRange)
+		if err != nil {
+			return NetflowV5{}, fmt.Errorf("failed to generate src IP for flow %d: %w", i, err)
+		}
+		dstIP, err := utils.RandomIPCIDR(dstRange)
+		if err != nil {
+			return NetflowV5{}, fmt.Errorf("failed to generate dst IP for flow %d: %w", i, err)
+		}
+		port := flowSrcPort
+		if port == 0 {
+			idx, err := utils.RandomNum(0, len(protoPorts))
+			if err != nil {
+				return NetflowV5{}, fmt.Errorf("select random port for flow %d: %w", i, err)
+			}
+			port = protoPorts[idx]
+		}
+		record, err := new(Record).Generate(srcIP, dstIP, port, session)
+		if err != nil {
+			return NetflowV5{}, fmt.Errorf("generate flow %d: %w", i, err)
+		}
+		records[i] = record
+	}
+	header := new(Header).Generate(flowCount, sourceID, seq.Reserve(flowCount), session)
+	return NetflowV5{Header: header, Records: records}, nil
+}
+
+// IsValidNetFlowV5 validates the given payload as a structurally correct NetFlow v5 packet.
+// The packet length must exactly match the header plus Count records.
+func IsValidNetFlowV5(payload []byte) (bool, error) {
+	if len(payload) < HeaderSize {
+		return false, fmt.Errorf("payload too short for NetFlow v5 header: %d bytes", len(payload))
+	}
+	version := binary.BigEndian.Uint16(payload[0:2])
+	if version != Version {
+		return false, fmt.Errorf("header version doesn't match: got %d, expected %d", version, Version)
+	}
+	count := int(binary.BigEndian.Uint16(payload[2:4]))
+	if count == 0 {
+		return false, fmt.Errorf("header Count is zero")
+	}
+	if count > MaxRecords {
+		return false, fmt.Errorf("header Count %d exceeds maximum %d", count, MaxRecords)
+	}
+	if want := HeaderSize + count*RecordSize; len(payload) != want {
+		return false, fmt.Errorf("payload length %d does not match %d records (want %d bytes)", len(payload), count, want)
+	}
+	return true, nil
+}
+
+// UpdateTimeStamp changes the header UnixSecs and UnixNsecs to the current time.
+func UpdateTimeStamp(payload []byte) ([]byte, error) {
+	if len(payload) < HeaderSize {
+		return nil, fmt.Errorf("payload too short for NetFlow v5 header: %d bytes", len(payload))
+	}
+	result := make([]byte, len(payload))
+	copy(result, payload)
+
+	now := time.Now().UnixNano()
+	binary.BigEndian.PutUint32(result[8:12], uint32(now/int64(time.Second)))
+	binary.BigEndian.PutUint32(result[12:16], uint32(now%int64(time.Second)))
+	return result, nil
+}
+
+// GetNetFlowV5Sizes gets the size of a given NetflowV5 and returns it as a String
+func GetNetFlowV5Sizes(nf NetflowV5) string {
+	output := fmt.Sprintf("Header Size: %d bytes\n", HeaderSize)
+	output += fmt.Sprintf("Record Size: %d bytes x %d\n", RecordSize, len(nf.Records))
+	output += fmt.Sprintf("Data Size: %d bytes\n", RecordSize*len(nf.Records))
+	return output
+}
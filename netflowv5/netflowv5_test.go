@@ -0,0 +1,167 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package netflowv5
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/utils"
+)
+
+func TestRecordSize(t *testing.T) {
+	t.Parallel()
+	if size := binary.Size(Record{}); size != RecordSize {
+		t.Errorf("Record size wrong! Got: %d Want: %d", size, RecordSize)
+	}
+	if size := binary.Size(Header{}); size != HeaderSize {
+		t.Errorf("Header size wrong! Got: %d Want: %d", size, HeaderSize)
+	}
+}
+
+func TestGenerateNetflowV5(t *testing.T) {
+	t.Parallel()
+	session := netflow.NewSession()
+	seq := NewSequence()
+	sourceID := 618
+
+	nf, err := GenerateNetflowV5(10, sourceID, "10.0.0.0/8", "192.168.0.0/16", utils.DNSPort, session, seq)
+	if err != nil {
+		t.Fatalf("GenerateNetflowV5 failed: %v", err)
+	}
+	if nf.Header.Version != Version {
+		t.Errorf("Header version wrong! Got: %d Want: %d", nf.Header.Version, Version)
+	}
+	if nf.Header.Count != 10 {
+		t.Errorf("Header count wrong! Got: %d Want: 10", nf.Header.Count)
+	}
+	if nf.Header.FlowSequence != 0 {
+		t.Errorf("First packet sequence wrong! Got: %d Want: 0", nf.Header.FlowSequence)
+	}
+	if got := int(nf.Header.EngineType)<<8 | int(nf.Header.EngineID); got != sourceID {
+		t.Errorf("Engine type/ID do not encode source ID! Got: %d Want: %d", got, sourceID)
+	}
+	for i, r := range nf.Records {
+		if r.DstPort != utils.DNSPort || r.Protocol != utils.UDPProto {
+			t.Errorf("record %d: wrong port/protocol %d/%d", i, r.DstPort, r.Protocol)
+		}
+		if r.First > r.Last {
+			t.Errorf("record %d: First %d after Last %d", i, r.First, r.Last)
+		}
+	}
+
+	buf, err := nf.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	if buf.Len() != HeaderSize+10*RecordSize {
+		t.Errorf("Packet length wrong! Got: %d Want: %d", buf.Len(), HeaderSize+10*RecordSize)
+	}
+	ok, err := IsValidNetFlowV5(buf.Bytes())
+	if !ok {
+		t.Errorf("Generated packet is not valid: %v", err)
+	}
+
+	// Next packet continues the flow sequence
+	nf2, err := GenerateNetflowV5(5, sourceID, "10.0.0.0/8", "10.0.0.0/8", 0, session, seq)
+	if err != nil {
+		t.Fatalf("GenerateNetflowV5 failed: %v", err)
+	}
+	if nf2.Header.FlowSequence != 10 {
+		t.Errorf("Second packet sequence wrong! Got: %d Want: 10", nf2.Header.FlowSequence)
+	}
+}
+
+func TestGenerateNetflowV5Errors(t *testing.T) {
+	t.Parallel()
+	session := netflow.NewSession()
+	tests := []struct {
+		name      string
+		flowCount int
+		srcRange  string
+	}{
+		{"zero flows", 0, "10.0.0.0/8"},
+		{"too many flows", MaxRecords + 1, "10.0.0.0/8"},
+		{"ipv6 range", 5, "2001:db8::/32"},
+		{"bad range", 5, "bogus"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := GenerateNetflowV5(tt.flowCount, 1, tt.srcRange, "10.0.0.0/8", 0, session, NewSequence())
+			if err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestIsValidNetFlowV5(t *testing.T) {
+	t.Parallel()
+	nf, err := GenerateNetflowV5(3, 1, "10.0.0.0/8", "10.0.0.0/8", 0, netflow.NewSession(), NewSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := nf.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	badVersion := bytes.Clone(valid)
+	binary.BigEndian.PutUint16(badVersion[0:2], 9)
+	zeroCount := bytes.Clone(valid)
+	binary.BigEndian.PutUint16(zeroCount[2:4], 0)
+	bigCount := bytes.Clone(valid)
+	binary.BigEndian.PutUint16(bigCount[2:4], MaxRecords+1)
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{"valid", valid, true},
+		{"short", valid[:10], false},
+		{"truncated record", valid[:len(valid)-1], false},
+		{"trailing bytes", append(bytes.Clone(valid), 0), false},
+		{"wrong version", badVersion, false},
+		{"zero count", zeroCount, false},
+		{"count too large", bigCount, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := IsValidNetFlowV5(tt.payload)
+			if got != tt.want {
+				t.Errorf("IsValidNetFlowV5() = %v, want %v (err: %v)", got, tt.want, err)
+			}
+			if !tt.want && err == nil {
+				t.Error("expected an error for invalid payload")
+			}
+		})
+	}
+}
+
+func TestUpdateTimeStamp(t *testing.T) {
+	t.Parallel()
+	payload := make([]byte, HeaderSize+RecordSize)
+	binary.BigEndian.PutUint16(payload[0:2], Version)
+	binary.BigEndian.PutUint16(payload[2:4], 1)
+
+	updated, err := UpdateTimeStamp(payload)
+	if err != nil {
+		t.Fatalf("UpdateTimeStamp failed: %v", err)
+	}
+	if binary.BigEndian.Uint32(updated[8:12]) == 0 {
+		t.Error("UnixSecs was not updated")
+	}
+	if binary.BigEndian.Uint32(payload[8:12]) != 0 {
+		t.Error("UpdateTimeStamp modified the input payload")
+	}
+	if _, err := UpdateTimeStamp(payload[:4]); err == nil {
+		t.Error("expected error for short payload")
+	}
+}
@@ -0,0 +1,291 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	t.Parallel()
+	datagrams := []Datagram{
+		{Src: netip.MustParseAddrPort("192.0.2.1:50000"), Dst: netip.MustParseAddrPort("198.51.100.7:2055"), Payload: []byte("netflow")},
+		{Src: netip.MustParseAddrPort("[2001:db8::1]:50001"), Dst: netip.MustParseAddrPort("[2001:db8::2]:4739"), Payload: []byte("ipfix!")},
+	}
+	times := []time.Time{time.Unix(1700000000, 123456789), time.Unix(1700000001, 42)}
+
+	for _, format := range []string{FormatPCAP, FormatPCAPNG} {
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, format)
+			if err != nil {
+				t.Fatalf("NewWriter: %v", err)
+			}
+			for i, d := range datagrams {
+				frame, err := EncodeUDP(d)
+				if err != nil {
+					t.Fatalf("EncodeUDP: %v", err)
+				}
+				if err := w.WriteFrame(times[i], frame); err != nil {
+					t.Fatalf("WriteFrame: %v", err)
+				}
+			}
+
+			r, err := NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			for i, want := range datagrams {
+				f, err := r.Next()
+				if err != nil {
+					t.Fatalf("Next: %v", err)
+				}
+				if !f.Timestamp.Equal(times[i]) {
+					t.Errorf("Got: time %v Want: %v", f.Timestamp, times[i])
+				}
+				got, err := DecodeUDP(f)
+				if err != nil {
+					t.Fatalf("DecodeUDP: %v", err)
+				}
+				if got.Src != want.Src || got.Dst != want.Dst || !bytes.Equal(got.Payload, want.Payload) {
+					t.Errorf("Got: %+v Want: %+v", got, want)
+				}
+			}
+			if _, err := r.Next(); err != io.EOF {
+				t.Errorf("Got: %v after the last packet Want: io.EOF", err)
+			}
+		})
+	}
+
+	if _, err := NewWriter(io.Discard, "erf"); err == nil {
+		t.Error("Got: nil error for unknown format Want: error")
+	}
+}
+
+func TestReaderBigEndianMicroseconds(t *testing.T) {
+	t.Parallel()
+	// Classic file as written on a big-endian host, raw IP link type
+	frame, err := EncodeUDP(Datagram{Src: netip.MustParseAddrPort("192.0.2.1:1"), Dst: netip.MustParseAddrPort("192.0.2.2:2"), Payload: []byte("x")})
+	if err != nil {
+		t.Fatalf("EncodeUDP: %v", err)
+	}
+	ip := frame[ethernetLength:]
+	var file []byte
+	file = binary.BigEndian.AppendUint32(file, magicMicroseconds)
+	file = append(file, 0, 2, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0)
+	file = binary.BigEndian.AppendUint32(file, 65535)
+	file = binary.BigEndian.AppendUint32(file, LinkTypeRaw)
+	file = binary.BigEndian.AppendUint32(file, 1700000000)
+	file = binary.BigEndian.AppendUint32(file, 250000)
+	file = binary.BigEndian.AppendUint32(file, uint32(len(ip)))
+	file = binary.BigEndian.AppendUint32(file, uint32(len(ip)))
+	file = append(file, ip...)
+
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	f, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if want := time.Unix(1700000000, 250_000_000); !f.Timestamp.Equal(want) {
+		t.Errorf("Got: time %v Want: %v", f.Timestamp, want)
+	}
+	if d, err := DecodeUDP(f); err != nil || string(d.Payload) != "x" {
+		t.Errorf("Got: %+v, %v Want: payload x", d, err)
+	}
+}
+
+func TestReaderPCAPNGBlocks(t *testing.T) {
+	t.Parallel()
+	frame, err := EncodeUDP(Datagram{Src: netip.MustParseAddrPort("192.0.2.1:1"), Dst: netip.MustParseAddrPort("192.0.2.2:2"), Payload: []byte("xyz")})
+	if err != nil {
+		t.Fatalf("EncodeUDP: %v", err)
+	}
+	padded := append(append([]byte(nil), frame...), make([]byte, (4-len(frame)%4)%4)...)
+
+	// Default microsecond resolution, an unknown block and a simple packet
+	shb := binary.LittleEndian.AppendUint32(nil, byteOrderMagic)
+	shb = append(shb, 1, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	file := appendBlock(nil, blockSectionHeader, shb)
+	file = appendBlock(file, blockInterfaceDescription, []byte{LinkTypeEthernet, 0, 0, 0, 0, 0, 0, 0})
+	file = appendBlock(file, 0x80000001, []byte{1, 2, 3, 4})
+	epb := binary.LittleEndian.AppendUint32(nil, 0)
+	epb = binary.LittleEndian.AppendUint32(epb, 0)
+	epb = binary.LittleEndian.AppendUint32(epb, 1_500_000)
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(frame)))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(frame)))
+	file = appendBlock(file, blockEnhancedPacket, append(epb, padded...))
+	spb := binary.LittleEndian.AppendUint32(nil, uint32(len(frame)))
+	file = appendBlock(file, blockSimplePacket, append(spb, padded...))
+
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	f, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if want := time.Unix(1, 500_000_000); !f.Timestamp.Equal(want) {
+		t.Errorf("Got: time %v Want: %v", f.Timestamp, want)
+	}
+	simple, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if !simple.Timestamp.IsZero() || !bytes.Equal(simple.Data, frame) {
+		t.Errorf("Got: %v %x Want: zero time and the frame", simple.Timestamp, simple.Data)
+	}
+}
+
+func TestReaderInvalid(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{name: "empty", file: nil},
+		{name: "unknown magic", file: make([]byte, 24)},
+		{name: "short header", file: []byte{0xd4, 0xc3, 0xb2, 0xa1, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := NewReader(bytes.NewReader(tt.file)); err == nil {
+				t.Error("Got: nil error Want: error")
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if _, err := NewWriter(&buf, FormatPCAP); err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	buf.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0, 100, 0, 0, 0, 100, 0, 0, 0, 1, 2})
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if _, err := r.Next(); err == nil || err == io.EOF {
+		t.Errorf("Got: %v for a truncated packet Want: error", err)
+	}
+}
+
+func TestDecodeUDP(t *testing.T) {
+	t.Parallel()
+	v4, err := EncodeUDP(Datagram{Src: netip.MustParseAddrPort("192.0.2.1:1000"), Dst: netip.MustParseAddrPort("192.0.2.2:2055"), Payload: []byte("flow")})
+	if err != nil {
+		t.Fatalf("EncodeUDP: %v", err)
+	}
+	v6, err := EncodeUDP(Datagram{Src: netip.MustParseAddrPort("[2001:db8::1]:1000"), Dst: netip.MustParseAddrPort("[2001:db8::2]:4739"), Payload: []byte("flow")})
+	if err != nil {
+		t.Fatalf("EncodeUDP: %v", err)
+	}
+
+	// VLAN tag inserted after the MAC addresses
+	tagged := append(append(append([]byte(nil), v4[:12]...), 0x81, 0x00, 0x00, 0x64), v4[12:]...)
+	// Ethernet padding after a short packet
+	padded := append(append([]byte(nil), v4...), 0, 0, 0, 0)
+	fragment := append([]byte(nil), v4...)
+	fragment[ethernetLength+6] |= 0x20 // more fragments
+	tcp := append([]byte(nil), v4...)
+	tcp[ethernetLength+9] = 6
+	// Destination options header ahead of UDP
+	withOptions := append(append([]byte(nil), v6[:ethernetLength+ipv6Length]...), protocolUDP, 0, 0, 0, 0, 0, 0, 0)
+	withOptions = append(withOptions, v6[ethernetLength+ipv6Length:]...)
+	withOptions[ethernetLength+6] = 60
+	binary.BigEndian.PutUint16(withOptions[ethernetLength+4:], binary.BigEndian.Uint16(v6[ethernetLength+4:])+8)
+	arp := append(append([]byte(nil), v4[:12]...), 0x08, 0x06, 0, 1)
+
+	tests := []struct {
+		name     string
+		frame    Frame
+		wantErr  error // nil for any error when wantFail
+		wantFail bool
+	}{
+		{name: "ipv4", frame: Frame{LinkType: LinkTypeEthernet, Data: v4}},
+		{name: "ipv6", frame: Frame{LinkType: LinkTypeEthernet, Data: v6}},
+		{name: "vlan", frame: Frame{LinkType: LinkTypeEthernet, Data: tagged}},
+		{name: "padded", frame: Frame{LinkType: LinkTypeEthernet, Data: padded}},
+		{name: "ipv6 extension header", frame: Frame{LinkType: LinkTypeEthernet, Data: withOptions}},
+		{name: "raw", frame: Frame{LinkType: LinkTypeRaw, Data: v4[ethernetLength:]}},
+		{name: "loopback", frame: Frame{LinkType: LinkTypeNull, Data: append([]byte{2, 0, 0, 0}, v4[ethernetLength:]...)}},
+		{name: "cooked", frame: Frame{LinkType: LinkTypeLinuxSLL, Data: append(make([]byte, 16), v4[ethernetLength:]...)}},
+		{name: "fragment", frame: Frame{LinkType: LinkTypeEthernet, Data: fragment}, wantErr: ErrFragment, wantFail: true},
+		{name: "tcp", frame: Frame{LinkType: LinkTypeEthernet, Data: tcp}, wantErr: ErrNotUDP, wantFail: true},
+		{name: "arp", frame: Frame{LinkType: LinkTypeEthernet, Data: arp}, wantErr: ErrNotUDP, wantFail: true},
+		{name: "truncated", frame: Frame{LinkType: LinkTypeEthernet, Data: v4[:30]}, wantFail: true},
+		{name: "unknown link type", frame: Frame{LinkType: 147, Data: v4}, wantFail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := DecodeUDP(tt.frame)
+			if tt.wantFail {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Errorf("Got: %v Want: error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeUDP: %v", err)
+			}
+			if string(got.Payload) != "flow" || got.Src.Port() != 1000 {
+				t.Errorf("Got: %+v Want: payload flow from port 1000", got)
+			}
+		})
+	}
+}
+
+func TestEncodeUDPChecksums(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		src, dst string
+		ipLength int
+		addrs    int // offset of the addresses in the IP header
+	}{
+		{name: "ipv4", src: "192.0.2.1:1000", dst: "192.0.2.2:2055", ipLength: ipv4Length, addrs: 12},
+		{name: "ipv4-mapped", src: "[::ffff:192.0.2.1]:1000", dst: "192.0.2.2:2055", ipLength: ipv4Length, addrs: 12},
+		{name: "ipv6", src: "[2001:db8::1]:1000", dst: "[2001:db8::2]:2055", ipLength: ipv6Length, addrs: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			frame, err := EncodeUDP(Datagram{Src: netip.MustParseAddrPort(tt.src), Dst: netip.MustParseAddrPort(tt.dst), Payload: []byte("odd")})
+			if err != nil {
+				t.Fatalf("EncodeUDP: %v", err)
+			}
+			ip := frame[ethernetLength:]
+			if tt.ipLength == ipv4Length && checksum(0, ip[:ipv4Length]) != 0 {
+				t.Error("Got: invalid IPv4 header checksum Want: valid")
+			}
+			// The UDP checksum verifies to zero over the pseudo-header and datagram
+			udp := ip[tt.ipLength:]
+			pseudo := append([]byte(nil), ip[tt.addrs:tt.ipLength]...)
+			pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(udp)))
+			pseudo = binary.BigEndian.AppendUint32(pseudo, protocolUDP)
+			if checksum(sum16(0, pseudo), udp) != 0 {
+				t.Error("Got: invalid UDP checksum Want: valid")
+			}
+		})
+	}
+
+	mixed := Datagram{Src: netip.MustParseAddrPort("192.0.2.1:1"), Dst: netip.MustParseAddrPort("[2001:db8::2]:2")}
+	if _, err := EncodeUDP(mixed); err == nil {
+		t.Error("Got: nil error for mixed address families Want: error")
+	}
+}
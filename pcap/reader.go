@@ -0,0 +1,252 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package pcap reads and writes packet capture files in the classic pcap and
+// pcapng formats, and encodes and decodes the Ethernet, IPv4, IPv6 and UDP
+// headers around flow datagrams, so captures can be exchanged with Wireshark
+// and tcpdump without libpcap.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+)
+
+// Link types, as listed in the tcpdump LINKTYPE registry.
+const (
+	LinkTypeNull     = 0   // BSD loopback: 4-byte address family in host byte order
+	LinkTypeEthernet = 1   // Ethernet II, optionally VLAN tagged
+	LinkTypeRaw      = 101 // raw IPv4 or IPv6
+	LinkTypeLinuxSLL = 113 // Linux "any" device cooked capture
+	LinkTypeIPv4     = 228 // raw IPv4
+	LinkTypeIPv6     = 229 // raw IPv6
+	LinkTypeSLL2     = 276 // Linux cooked capture v2
+)
+
+// Capture file formats.
+const (
+	FormatPCAP   = "pcap"
+	FormatPCAPNG = "pcapng"
+)
+
+// maxFrameLength bounds the captured length of a frame read from a file, so a
+// corrupt length can't exhaust memory.
+const maxFrameLength = 256 * 1024
+
+// Magic numbers of the classic format (microsecond and nanosecond timestamps)
+// and of the pcapng Section Header Block.
+const (
+	magicMicroseconds  = 0xa1b2c3d4
+	magicNanoseconds   = 0xa1b23c4d
+	blockSectionHeader = 0x0a0d0d0a
+	byteOrderMagic     = 0x1a2b3c4d
+)
+
+// pcapng block types read or written.
+const (
+	blockInterfaceDescription = 1
+	blockSimplePacket         = 3
+	blockEnhancedPacket       = 6
+)
+
+// Frame is one captured link-layer frame.
+type Frame struct {
+	Timestamp time.Time // zero for pcapng Simple Packet Blocks, which carry none
+	LinkType  uint16
+	Data      []byte
+}
+
+// iface is a pcapng interface: its link type and timestamp units per second.
+type iface struct {
+	linkType uint16
+	units    uint64
+}
+
+// Reader reads frames from a pcap or pcapng file.
+type Reader struct {
+	r     *bufio.Reader
+	ng    bool
+	order binary.ByteOrder
+
+	// classic format
+	linkType uint16
+	nanos    bool
+
+	// pcapng
+	ifaces []iface
+}
+
+// NewReader returns a Reader for the capture in r, detecting its format and
+// byte order from the file header.
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{r: bufio.NewReader(r)}
+	head, err := pr.r.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("read capture header: %w", err)
+	}
+	if binary.BigEndian.Uint32(head) == blockSectionHeader {
+		pr.ng = true
+		return pr, nil
+	}
+	var header [24]byte
+	if _, err := io.ReadFull(pr.r, header[:]); err != nil {
+		return nil, fmt.Errorf("read capture header: %w", err)
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header[0:4]) {
+		case magicMicroseconds:
+			pr.order = order
+		case magicNanoseconds:
+			pr.order, pr.nanos = order, true
+		default:
+			continue
+		}
+		// The upper bits of the link type field carry FCS information
+		pr.linkType = uint16(order.Uint32(header[20:24]) & 0x0FFFFFFF)
+		return pr, nil
+	}
+	return nil, fmt.Errorf("not a pcap or pcapng file: magic %#08x", binary.BigEndian.Uint32(header[0:4]))
+}
+
+// Next returns the next frame, or io.EOF when the capture ends.
+func (pr *Reader) Next() (Frame, error) {
+	if pr.ng {
+		return pr.nextBlock()
+	}
+	var header [16]byte
+	if _, err := io.ReadFull(pr.r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Frame{}, fmt.Errorf("truncated packet header: %w", err)
+		}
+		return Frame{}, err
+	}
+	sec, frac := pr.order.Uint32(header[0:4]), pr.order.Uint32(header[4:8])
+	length := pr.order.Uint32(header[8:12])
+	if length > maxFrameLength {
+		return Frame{}, fmt.Errorf("packet length %d exceeds %d bytes", length, maxFrameLength)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(pr.r, data); err != nil {
+		return Frame{}, fmt.Errorf("truncated packet data: %w", err)
+	}
+	if !pr.nanos {
+		frac *= 1000
+	}
+	return Frame{Timestamp: time.Unix(int64(sec), int64(frac)), LinkType: pr.linkType, Data: data}, nil
+}
+
+// nextBlock reads pcapng blocks until it finds a packet.
+func (pr *Reader) nextBlock() (Frame, error) {
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(pr.r, header[:]); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return Frame{}, fmt.Errorf("truncated block header: %w", err)
+			}
+			return Frame{}, err
+		}
+		blockType := binary.BigEndian.Uint32(header[0:4])
+		if blockType == blockSectionHeader {
+			// A new section sets the byte order and drops earlier interfaces
+			magic, err := pr.r.Peek(4)
+			if err != nil {
+				return Frame{}, fmt.Errorf("truncated section header: %w", err)
+			}
+			switch uint32(byteOrderMagic) {
+			case binary.BigEndian.Uint32(magic):
+				pr.order = binary.BigEndian
+			case binary.LittleEndian.Uint32(magic):
+				pr.order = binary.LittleEndian
+			default:
+				return Frame{}, fmt.Errorf("invalid section byte-order magic %#08x", binary.BigEndian.Uint32(magic))
+			}
+			pr.ifaces = nil
+		} else {
+			blockType = pr.order.Uint32(header[0:4])
+		}
+		length := pr.order.Uint32(header[4:8])
+		if length < 12 || length%4 != 0 || length > maxFrameLength {
+			return Frame{}, fmt.Errorf("invalid block length %d", length)
+		}
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(pr.r, body); err != nil {
+			return Frame{}, fmt.Errorf("truncated block: %w", err)
+		}
+		body = body[:len(body)-4] // trailing copy of the block length
+
+		switch blockType {
+		case blockInterfaceDescription:
+			if len(body) < 8 {
+				return Frame{}, fmt.Errorf("interface description block too short: %d bytes", len(body))
+			}
+			pr.ifaces = append(pr.ifaces, iface{linkType: pr.order.Uint16(body[0:2]), units: pr.tsUnits(body[8:])})
+		case blockEnhancedPacket:
+			if len(body) < 20 {
+				return Frame{}, fmt.Errorf("enhanced packet block too short: %d bytes", len(body))
+			}
+			id := pr.order.Uint32(body[0:4])
+			if int(id) >= len(pr.ifaces) {
+				return Frame{}, fmt.Errorf("packet on undeclared interface %d", id)
+			}
+			ts := uint64(pr.order.Uint32(body[4:8]))<<32 | uint64(pr.order.Uint32(body[8:12]))
+			captured := pr.order.Uint32(body[12:16])
+			if int(captured) > len(body)-20 {
+				return Frame{}, fmt.Errorf("packet length %d overruns its block", captured)
+			}
+			ifc := pr.ifaces[id]
+			return Frame{Timestamp: unitsTime(ts, ifc.units), LinkType: ifc.linkType, Data: body[20 : 20+captured]}, nil
+		case blockSimplePacket:
+			if len(pr.ifaces) == 0 {
+				return Frame{}, fmt.Errorf("simple packet block before any interface")
+			}
+			if len(body) < 4 {
+				return Frame{}, fmt.Errorf("simple packet block too short: %d bytes", len(body))
+			}
+			original := int(pr.order.Uint32(body[0:4]))
+			data := body[4:]
+			if original < len(data) {
+				data = data[:original]
+			}
+			return Frame{LinkType: pr.ifaces[0].linkType, Data: data}, nil
+		}
+	}
+}
+
+// tsUnits returns the timestamp units per second given by an interface's
+// if_tsresol option, microseconds by default.
+func (pr *Reader) tsUnits(options []byte) uint64 {
+	for len(options) >= 4 {
+		code, length := pr.order.Uint16(options[0:2]), int(pr.order.Uint16(options[2:4]))
+		if code == 0 || len(options) < 4+length {
+			break
+		}
+		if code == 9 && length == 1 {
+			// The high bit selects a power of 2 rather than of 10
+			res := options[4]
+			if res&0x80 != 0 {
+				return 1 << min(res&0x7F, 63)
+			}
+			units := uint64(1)
+			for range min(res, 19) {
+				units *= 10
+			}
+			return units
+		}
+		options = options[4+(length+3)/4*4:]
+	}
+	return 1_000_000
+}
+
+// unitsTime converts a timestamp in units per second since the epoch.
+func unitsTime(ts, units uint64) time.Time {
+	sec, frac := ts/units, ts%units
+	// frac < units, so the quotient fits
+	hi, lo := bits.Mul64(frac, uint64(time.Second))
+	nanos, _ := bits.Div64(hi, lo, units)
+	return time.Unix(int64(sec), int64(nanos))
+}
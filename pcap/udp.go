@@ -0,0 +1,247 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// ErrNotUDP is returned for frames that don't hold a UDP datagram.
+var ErrNotUDP = errors.New("not a UDP datagram")
+
+// ErrFragment is returned for frames holding an IP fragment. Flow datagrams
+// are rarely fragmented, and fragments are not reassembled.
+var ErrFragment = errors.New("IP fragment")
+
+// EtherTypes and IP protocol numbers handled.
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86DD
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88A8
+	protocolUDP   = 17
+)
+
+// Header lengths.
+const (
+	ethernetLength = 14
+	ipv4Length     = 20
+	ipv6Length     = 40
+	udpLength      = 8
+)
+
+// Synthetic MAC addresses of written frames, locally administered.
+var (
+	exporterMAC  = []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	collectorMAC = []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+// Datagram is a UDP datagram and its endpoints.
+type Datagram struct {
+	Src     netip.AddrPort
+	Dst     netip.AddrPort
+	Payload []byte
+}
+
+// DecodeUDP returns the UDP datagram carried by f. Ethernet (with any number
+// of VLAN tags), BSD loopback, raw IP and Linux cooked captures are supported.
+func DecodeUDP(f Frame) (Datagram, error) {
+	data := f.Data
+	switch f.LinkType {
+	case LinkTypeEthernet:
+		if len(data) < ethernetLength {
+			return Datagram{}, fmt.Errorf("ethernet frame too short: %d bytes", len(data))
+		}
+		etherType := binary.BigEndian.Uint16(data[12:14])
+		data = data[ethernetLength:]
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(data) < 4 {
+				return Datagram{}, fmt.Errorf("VLAN tag truncated")
+			}
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+		if etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+			return Datagram{}, ErrNotUDP
+		}
+	case LinkTypeNull:
+		if len(data) < 4 {
+			return Datagram{}, fmt.Errorf("loopback frame too short: %d bytes", len(data))
+		}
+		data = data[4:]
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return Datagram{}, fmt.Errorf("cooked frame too short: %d bytes", len(data))
+		}
+		data = data[16:]
+	case LinkTypeSLL2:
+		if len(data) < 20 {
+			return Datagram{}, fmt.Errorf("cooked frame too short: %d bytes", len(data))
+		}
+		data = data[20:]
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+	default:
+		return Datagram{}, fmt.Errorf("unsupported link type %d", f.LinkType)
+	}
+	if len(data) == 0 {
+		return Datagram{}, ErrNotUDP
+	}
+	switch data[0] >> 4 {
+	case 4:
+		return decodeIPv4(data)
+	case 6:
+		return decodeIPv6(data)
+	default:
+		return Datagram{}, ErrNotUDP
+	}
+}
+
+// decodeIPv4 decodes the UDP datagram in an IPv4 packet.
+func decodeIPv4(data []byte) (Datagram, error) {
+	if len(data) < ipv4Length {
+		return Datagram{}, fmt.Errorf("IPv4 header truncated: %d bytes", len(data))
+	}
+	headerLength := int(data[0]&0x0F) * 4
+	totalLength := int(binary.BigEndian.Uint16(data[2:4]))
+	if headerLength < ipv4Length || totalLength < headerLength || totalLength > len(data) {
+		return Datagram{}, fmt.Errorf("invalid IPv4 header or total length %d/%d", headerLength, totalLength)
+	}
+	// More fragments flag or a fragment offset
+	if binary.BigEndian.Uint16(data[6:8])&0x3FFF != 0 {
+		return Datagram{}, ErrFragment
+	}
+	if data[9] != protocolUDP {
+		return Datagram{}, ErrNotUDP
+	}
+	src, dst := netip.AddrFrom4([4]byte(data[12:16])), netip.AddrFrom4([4]byte(data[16:20]))
+	return decodeUDP(src, dst, data[headerLength:totalLength])
+}
+
+// decodeIPv6 decodes the UDP datagram in an IPv6 packet, skipping extension
+// headers.
+func decodeIPv6(data []byte) (Datagram, error) {
+	if len(data) < ipv6Length {
+		return Datagram{}, fmt.Errorf("IPv6 header truncated: %d bytes", len(data))
+	}
+	payloadLength := int(binary.BigEndian.Uint16(data[4:6]))
+	if ipv6Length+payloadLength > len(data) {
+		return Datagram{}, fmt.Errorf("IPv6 payload length %d overruns the frame", payloadLength)
+	}
+	src, dst := netip.AddrFrom16([16]byte(data[8:24])), netip.AddrFrom16([16]byte(data[24:40]))
+	next, payload := data[6], data[ipv6Length:ipv6Length+payloadLength]
+	for {
+		switch next {
+		case protocolUDP:
+			return decodeUDP(src, dst, payload)
+		case 44:
+			return Datagram{}, ErrFragment
+		case 0, 43, 60: // hop-by-hop, routing and destination options
+			if len(payload) < 8 || len(payload) < (int(payload[1])+1)*8 {
+				return Datagram{}, fmt.Errorf("IPv6 extension header truncated")
+			}
+			next, payload = payload[0], payload[(int(payload[1])+1)*8:]
+		default:
+			return Datagram{}, ErrNotUDP
+		}
+	}
+}
+
+// decodeUDP decodes a UDP header and its payload.
+func decodeUDP(src, dst netip.Addr, data []byte) (Datagram, error) {
+	if len(data) < udpLength {
+		return Datagram{}, fmt.Errorf("UDP header truncated: %d bytes", len(data))
+	}
+	length := int(binary.BigEndian.Uint16(data[4:6]))
+	if length < udpLength || length > len(data) {
+		return Datagram{}, fmt.Errorf("invalid UDP length %d", length)
+	}
+	return Datagram{
+		Src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(data[0:2])),
+		Dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:4])),
+		Payload: data[udpLength:length],
+	}, nil
+}
+
+// EncodeUDP returns an Ethernet frame carrying d in an IPv4 or IPv6 packet,
+// with valid checksums. Both endpoints must be of the same address family;
+// IPv4-mapped IPv6 addresses count as IPv4.
+func EncodeUDP(d Datagram) ([]byte, error) {
+	src, dst := d.Src.Addr().Unmap(), d.Dst.Addr().Unmap()
+	if !src.IsValid() || !dst.IsValid() || src.Is4() != dst.Is4() {
+		return nil, fmt.Errorf("endpoints %s and %s must be addresses of the same family", d.Src, d.Dst)
+	}
+	udpTotal := udpLength + len(d.Payload)
+	if udpTotal > 0xFFFF-ipv4Length {
+		return nil, fmt.Errorf("UDP payload of %d bytes too long", len(d.Payload))
+	}
+
+	frame := append(append([]byte(nil), collectorMAC...), exporterMAC...)
+	var pseudo []byte
+	if src.Is4() {
+		frame = binary.BigEndian.AppendUint16(frame, etherTypeIPv4)
+		ip := make([]byte, ipv4Length)
+		ip[0] = 0x45 // version 4, 5-word header
+		binary.BigEndian.PutUint16(ip[2:4], uint16(ipv4Length+udpTotal))
+		binary.BigEndian.PutUint16(ip[6:8], 0x4000) // don't fragment
+		ip[8] = 64                                  // TTL
+		ip[9] = protocolUDP
+		s, t := src.As4(), dst.As4()
+		copy(ip[12:16], s[:])
+		copy(ip[16:20], t[:])
+		binary.BigEndian.PutUint16(ip[10:12], checksum(0, ip))
+		frame = append(frame, ip...)
+		pseudo = append(append(pseudo, s[:]...), t[:]...)
+	} else {
+		frame = binary.BigEndian.AppendUint16(frame, etherTypeIPv6)
+		ip := make([]byte, ipv6Length)
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:6], uint16(udpTotal))
+		ip[6] = protocolUDP
+		ip[7] = 64 // hop limit
+		s, t := src.As16(), dst.As16()
+		copy(ip[8:24], s[:])
+		copy(ip[24:40], t[:])
+		frame = append(frame, ip...)
+		pseudo = append(append(pseudo, s[:]...), t[:]...)
+	}
+	pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(udpTotal))
+	pseudo = binary.BigEndian.AppendUint32(pseudo, protocolUDP)
+
+	udp := make([]byte, udpLength, udpTotal)
+	binary.BigEndian.PutUint16(udp[0:2], d.Src.Port())
+	binary.BigEndian.PutUint16(udp[2:4], d.Dst.Port())
+	binary.BigEndian.PutUint16(udp[4:6], uint16(udpTotal))
+	udp = append(udp, d.Payload...)
+	sum := checksum(sum16(0, pseudo), udp)
+	if sum == 0 {
+		// A zero UDP checksum means none was computed
+		sum = 0xFFFF
+	}
+	binary.BigEndian.PutUint16(udp[6:8], sum)
+	return append(frame, udp...), nil
+}
+
+// sum16 adds b to a running one's complement sum as 16-bit words.
+func sum16(sum uint32, b []byte) uint32 {
+	for len(b) >= 2 {
+		sum += uint32(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	return sum
+}
+
+// checksum returns the Internet checksum of b continuing the running sum.
+func checksum(sum uint32, b []byte) uint16 {
+	sum = sum16(sum, b)
+	for sum>>16 != 0 {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,97 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// snapLength is the snapshot length declared in written files: no frame is
+// truncated.
+const snapLength = 65535 + 128
+
+// Writer writes Ethernet frames to a pcap or pcapng file with nanosecond
+// timestamps. Multi-byte fields are written little-endian, which readers
+// detect from the file header.
+type Writer struct {
+	w  io.Writer
+	ng bool
+}
+
+// NewWriter writes the file header for format, FormatPCAP or FormatPCAPNG, to
+// w and returns a Writer for its frames.
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	pw := &Writer{w: w}
+	var header []byte
+	switch format {
+	case FormatPCAP:
+		header = binary.LittleEndian.AppendUint32(header, magicNanoseconds)
+		header = binary.LittleEndian.AppendUint16(header, 2) // version 2.4
+		header = binary.LittleEndian.AppendUint16(header, 4)
+		header = append(header, make([]byte, 8)...) // time zone and accuracy, unused
+		header = binary.LittleEndian.AppendUint32(header, snapLength)
+		header = binary.LittleEndian.AppendUint32(header, LinkTypeEthernet)
+	case FormatPCAPNG:
+		pw.ng = true
+		// Section Header Block: byte-order magic, version 1.0, unknown section length
+		shb := binary.LittleEndian.AppendUint32(nil, byteOrderMagic)
+		shb = binary.LittleEndian.AppendUint16(shb, 1)
+		shb = binary.LittleEndian.AppendUint16(shb, 0)
+		shb = binary.LittleEndian.AppendUint64(shb, ^uint64(0))
+		header = appendBlock(header, blockSectionHeader, shb)
+		// Interface Description Block with if_tsresol 9: nanoseconds
+		idb := binary.LittleEndian.AppendUint16(nil, LinkTypeEthernet)
+		idb = binary.LittleEndian.AppendUint16(idb, 0)
+		idb = binary.LittleEndian.AppendUint32(idb, snapLength)
+		idb = binary.LittleEndian.AppendUint16(idb, 9)
+		idb = binary.LittleEndian.AppendUint16(idb, 1)
+		idb = append(idb, 9, 0, 0, 0)
+		idb = append(idb, 0, 0, 0, 0) // opt_endofopt
+		header = appendBlock(header, blockInterfaceDescription, idb)
+	default:
+		return nil, fmt.Errorf("capture format must be %s or %s, got %q", FormatPCAP, FormatPCAPNG, format)
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("write capture header: %w", err)
+	}
+	return pw, nil
+}
+
+// WriteFrame writes an Ethernet frame captured at ts.
+func (pw *Writer) WriteFrame(ts time.Time, frame []byte) error {
+	var record []byte
+	if pw.ng {
+		nanos := uint64(ts.UnixNano())
+		epb := binary.LittleEndian.AppendUint32(nil, 0) // interface 0
+		epb = binary.LittleEndian.AppendUint32(epb, uint32(nanos>>32))
+		epb = binary.LittleEndian.AppendUint32(epb, uint32(nanos))
+		epb = binary.LittleEndian.AppendUint32(epb, uint32(len(frame)))
+		epb = binary.LittleEndian.AppendUint32(epb, uint32(len(frame)))
+		epb = append(epb, frame...)
+		epb = append(epb, make([]byte, (4-len(frame)%4)%4)...)
+		record = appendBlock(nil, blockEnhancedPacket, epb)
+	} else {
+		record = binary.LittleEndian.AppendUint32(nil, uint32(ts.Unix()))
+		record = binary.LittleEndian.AppendUint32(record, uint32(ts.Nanosecond()))
+		record = binary.LittleEndian.AppendUint32(record, uint32(len(frame)))
+		record = binary.LittleEndian.AppendUint32(record, uint32(len(frame)))
+		record = append(record, frame...)
+	}
+	if _, err := pw.w.Write(record); err != nil {
+		return fmt.Errorf("write packet: %w", err)
+	}
+	return nil
+}
+
+// appendBlock appends a pcapng block of blockType around a 4-byte aligned body.
+func appendBlock(b []byte, blockType uint32, body []byte) []byte {
+	length := uint32(12 + len(body))
+	b = binary.LittleEndian.AppendUint32(b, blockType)
+	b = binary.LittleEndian.AppendUint32(b, length)
+	b = append(b, body...)
+	return binary.LittleEndian.AppendUint32(b, length)
+}
@@ -0,0 +1,378 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package profiles turns user-defined profile configs into NetFlow v9 and IPFIX
+// flow profiles, validating each field against its protocol's field type table.
+package profiles
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/dmabry/flowgre/encoder"
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/models"
+	"github.com/dmabry/flowgre/netflow"
+)
+
+// Value generator names accepted in ProfileField.Value.
+const (
+	ValueDefault  = ""
+	ValueRandom   = "random"
+	ValueConstant = "constant"
+	ValueSequence = "sequence"
+	ValueCIDR     = "cidr"
+	ValueChoice   = "choice"
+)
+
+// listSemantics maps ProfileList.Semantic names to RFC 6313 list semantics.
+var listSemantics = map[string]uint8{
+	"":               ipfix.SemanticUndefined,
+	"undefined":      ipfix.SemanticUndefined,
+	"none-of":        ipfix.SemanticNoneOf,
+	"exactly-one-of": ipfix.SemanticExactlyOneOf,
+	"one-or-more-of": ipfix.SemanticOneOrMoreOf,
+	"all-of":         ipfix.SemanticAllOf,
+	"ordered":        ipfix.SemanticOrdered,
+}
+
+// NetFlow builds a NetFlow v9 profile from cfg.
+func NetFlow(cfg models.ProfileConfig) (*netflow.CustomProfile, error) {
+	templateID, err := templateID(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if templateID == netflow.SystemOptionsTemplateID || templateID == netflow.InterfaceOptionsTemplateID {
+		return nil, fmt.Errorf("profile %s: template-id %d is used by an options template", cfg.Name, templateID)
+	}
+	fields := make([]netflow.Field, len(cfg.Fields))
+	sources := make([]encoder.ValueSource, len(cfg.Fields))
+	for i, f := range cfg.Fields {
+		if f.Enterprise != 0 {
+			return nil, fmt.Errorf("profile %s field %d: enterprise-specific elements are only supported by IPFIX", cfg.Name, i)
+		}
+		if f.Length == ipfix.VariableLength || f.List != nil {
+			return nil, fmt.Errorf("profile %s field %d: variable-length and list fields are only supported by IPFIX", cfg.Name, i)
+		}
+		fieldType, length, err := resolveField(f)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s field %d: %w", cfg.Name, i, err)
+		}
+		if err := netflow.ValidateFieldLength(fieldType, length); err != nil {
+			return nil, fmt.Errorf("profile %s field %d: %w", cfg.Name, i, err)
+		}
+		if sources[i], err = valueSource(f, length); err != nil {
+			return nil, fmt.Errorf("profile %s field %d (%s): %w", cfg.Name, i, f.Type, err)
+		}
+		fields[i] = netflow.Field{Type: fieldType, Length: length}
+	}
+	return netflow.NewCustomProfile(cfg.Name, templateID, fields, sources), nil
+}
+
+// IPFIX builds an IPFIX profile from cfg.
+func IPFIX(cfg models.ProfileConfig) (*ipfix.CustomProfile, error) {
+	templateID, err := templateID(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if templateID == ipfix.OptionsTemplateID {
+		return nil, fmt.Errorf("profile %s: template-id %d is used by the options template", cfg.Name, templateID)
+	}
+	used := map[uint16]bool{templateID: true, ipfix.OptionsTemplateID: true}
+	fields := make([]ipfix.Field, len(cfg.Fields))
+	sources := make([]encoder.ValueSource, len(cfg.Fields))
+	for i, f := range cfg.Fields {
+		field, err := ipfixField(f)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s field %d: %w", cfg.Name, i, err)
+		}
+		if sources[i], err = ipfixValueSource(f, field, used); err != nil {
+			return nil, fmt.Errorf("profile %s field %d (%s): %w", cfg.Name, i, f.Type, err)
+		}
+		fields[i] = field
+	}
+	return ipfix.NewCustomProfile(cfg.Name, templateID, fields, sources), nil
+}
+
+// templateID returns the validated template ID for cfg.
+func templateID(cfg models.ProfileConfig) (uint16, error) {
+	if len(cfg.Fields) == 0 {
+		return 0, fmt.Errorf("profile %s has no fields", cfg.Name)
+	}
+	if cfg.TemplateID == 0 {
+		return netflow.DefaultTemplateID, nil
+	}
+	if cfg.TemplateID < 256 || cfg.TemplateID > 65535 {
+		return 0, fmt.Errorf("profile %s: template-id must be between 256 and 65535, got %d", cfg.Name, cfg.TemplateID)
+	}
+	return uint16(cfg.TemplateID), nil
+}
+
+// resolveField returns the numeric type and length of f. Types may be given as
+// a number, a NetFlow v9 field name or an IPFIX Information Element name; v9
+// field types and IPFIX element IDs share the same numbers below 128.
+func resolveField(f models.ProfileField) (uint16, uint16, error) {
+	if f.Length < 1 || f.Length > 65535 {
+		return 0, 0, fmt.Errorf("field %s: length must be between 1 and 65535, got %d", f.Type, f.Length)
+	}
+	if n, err := strconv.ParseUint(f.Type, 10, 16); err == nil {
+		if n == 0 {
+			return 0, 0, fmt.Errorf("field type 0 is reserved")
+		}
+		return uint16(n), uint16(f.Length), nil
+	}
+	if t, ok := netflow.FieldTypeByName(f.Type); ok {
+		return t, uint16(f.Length), nil
+	}
+	if id, ok := ipfix.ElementByName(f.Type); ok {
+		return id, uint16(f.Length), nil
+	}
+	return 0, 0, fmt.Errorf("unknown field type %q", f.Type)
+}
+
+// ipfixField returns the validated IPFIX template field for f. Enterprise-specific
+// elements must be given by number, since names resolve to IANA elements.
+func ipfixField(f models.ProfileField) (ipfix.Field, error) {
+	if f.Enterprise < 0 || f.Enterprise > math.MaxUint32 {
+		return ipfix.Field{}, fmt.Errorf("enterprise number must be between 0 and %d, got %d", uint32(math.MaxUint32), f.Enterprise)
+	}
+	if f.Enterprise != 0 {
+		if _, err := strconv.ParseUint(f.Type, 10, 16); err != nil {
+			return ipfix.Field{}, fmt.Errorf("enterprise %d field type %q must be an element number", f.Enterprise, f.Type)
+		}
+	}
+	id, length, err := resolveField(f)
+	if err != nil {
+		return ipfix.Field{}, err
+	}
+	field := ipfix.Field{Type: id, Length: length, EnterpriseNumber: uint32(f.Enterprise)}
+	return field, ipfix.ValidateField(field)
+}
+
+// ipfixValueSource returns the value source for f, resolved to field. The
+// contents of basicList and subTemplateList fields come from f.List, and the
+// IDs of their sub-templates are added to used, which they must not be in.
+func ipfixValueSource(f models.ProfileField, field ipfix.Field, used map[uint16]bool) (encoder.ValueSource, error) {
+	if field.EnterpriseNumber == 0 {
+		switch field.Type {
+		case ipfix.BasicList, ipfix.SubTemplateList:
+			return listSource(f, field, used)
+		case ipfix.SubTemplateMultiList:
+			return nil, fmt.Errorf("subTemplateMultiList fields cannot be generated")
+		}
+	}
+	if f.List != nil {
+		return nil, fmt.Errorf("list is only valid for basicList and subTemplateList fields")
+	}
+	return valueSource(f, field.Length)
+}
+
+// listSource returns the value source of a basicList or subTemplateList field.
+func listSource(f models.ProfileField, field ipfix.Field, used map[uint16]bool) (encoder.ValueSource, error) {
+	l := f.List
+	if l == nil {
+		return nil, fmt.Errorf("list is required")
+	}
+	if field.Length != ipfix.VariableLength {
+		return nil, fmt.Errorf("list fields must be variable-length")
+	}
+	if f.Value != ValueDefault {
+		return nil, fmt.Errorf("list fields take their values from the list's fields")
+	}
+	semantic, ok := listSemantics[strings.ToLower(l.Semantic)]
+	if !ok {
+		return nil, fmt.Errorf("unknown list semantic %q", l.Semantic)
+	}
+	if l.Count < 0 {
+		return nil, fmt.Errorf("list count must not be negative")
+	}
+	if field.Type == ipfix.BasicList {
+		if len(l.Fields) != 1 || l.TemplateID != 0 {
+			return nil, fmt.Errorf("basicList needs exactly one element field and no template-id")
+		}
+		element, err := ipfixField(l.Fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("list element: %w", err)
+		}
+		source, err := ipfixValueSource(l.Fields[0], element, used)
+		if err != nil {
+			return nil, fmt.Errorf("list element: %w", err)
+		}
+		return ipfix.BasicListSource(semantic, element, l.Count, source), nil
+	}
+	if len(l.Fields) == 0 {
+		return nil, fmt.Errorf("subTemplateList has no fields")
+	}
+	if l.TemplateID < 256 || l.TemplateID > 65535 {
+		return nil, fmt.Errorf("subTemplateList template-id must be between 256 and 65535, got %d", l.TemplateID)
+	}
+	templateID := uint16(l.TemplateID)
+	if used[templateID] {
+		return nil, fmt.Errorf("subTemplateList template-id %d is already in use", templateID)
+	}
+	used[templateID] = true
+	fields := make([]ipfix.Field, len(l.Fields))
+	sources := make([]encoder.ValueSource, len(l.Fields))
+	for i, lf := range l.Fields {
+		var err error
+		if fields[i], err = ipfixField(lf); err != nil {
+			return nil, fmt.Errorf("list field %d: %w", i, err)
+		}
+		if sources[i], err = ipfixValueSource(lf, fields[i], used); err != nil {
+			return nil, fmt.Errorf("list field %d (%s): %w", i, lf.Type, err)
+		}
+	}
+	return ipfix.SubTemplateListSource(semantic, ipfix.Template{TemplateID: templateID, Fields: fields}, l.Count, sources), nil
+}
+
+// valueSource returns the encoder value source for f. A nil source means the
+// profile falls back to the default generator for the field type.
+func valueSource(f models.ProfileField, length uint16) (encoder.ValueSource, error) {
+	if length == ipfix.VariableLength {
+		return variableSource(f)
+	}
+	switch strings.ToLower(f.Value) {
+	case ValueDefault:
+		return nil, nil
+	case ValueRandom:
+		if f.Min < 0 || f.Max < f.Min {
+			return nil, fmt.Errorf("random range %d-%d is invalid", f.Min, f.Max)
+		}
+		// The range is inclusive, so max+1 must not overflow
+		if f.Max == math.MaxInt64 {
+			return nil, fmt.Errorf("random max must be below %d", int64(math.MaxInt64))
+		}
+		if err := fitsUint(uint64(f.Max), length); err != nil {
+			return nil, err
+		}
+		return encoder.Random(f.Min, f.Max+1), nil
+	case ValueConstant:
+		return constantSource(f.Constant, length)
+	case ValueSequence:
+		if f.Start < 0 || f.Step < 0 {
+			return nil, fmt.Errorf("sequence start and step must not be negative")
+		}
+		if err := fitsUint(uint64(f.Start), length); err != nil {
+			return nil, err
+		}
+		return encoder.Sequence(uint64(f.Start), uint64(f.Step)), nil
+	case ValueCIDR:
+		_, ipNet, err := net.ParseCIDR(f.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", f.CIDR, err)
+		}
+		if want := addrLength(ipNet.IP); want != int(length) {
+			return nil, fmt.Errorf("cidr %s needs a %d-byte field, got %d", f.CIDR, want, length)
+		}
+		return encoder.CIDR(f.CIDR), nil
+	case ValueChoice:
+		return nil, fmt.Errorf("choice needs a variable-length field")
+	default:
+		return nil, fmt.Errorf("unknown value generator %q: must be random, constant, sequence, cidr or choice", f.Value)
+	}
+}
+
+// variableSource returns the value source of a variable-length field: a
+// constant or a random choice of values, each text or 0x-prefixed hex bytes.
+func variableSource(f models.ProfileField) (encoder.ValueSource, error) {
+	switch strings.ToLower(f.Value) {
+	case ValueDefault:
+		return nil, nil
+	case ValueConstant:
+		b, err := variableBytes(f.Constant)
+		if err != nil {
+			return nil, err
+		}
+		return encoder.Bytes(b), nil
+	case ValueChoice:
+		if len(f.Choices) == 0 {
+			return nil, fmt.Errorf("choices are required")
+		}
+		values := make([][]byte, len(f.Choices))
+		for i, c := range f.Choices {
+			var err error
+			if values[i], err = variableBytes(c); err != nil {
+				return nil, err
+			}
+		}
+		return encoder.Choice(values), nil
+	case ValueRandom, ValueSequence, ValueCIDR:
+		return nil, fmt.Errorf("%s needs a fixed-length field", f.Value)
+	default:
+		return nil, fmt.Errorf("unknown value generator %q: must be constant or choice for a variable-length field", f.Value)
+	}
+}
+
+// variableBytes returns the value of a variable-length field given as
+// 0x-prefixed hex bytes or text.
+func variableBytes(value string) ([]byte, error) {
+	b := []byte(value)
+	if hexStr, ok := strings.CutPrefix(strings.ToLower(value), "0x"); ok {
+		var err error
+		if b, err = hex.DecodeString(hexStr); err != nil {
+			return nil, fmt.Errorf("invalid hex value %q: %w", value, err)
+		}
+	}
+	if len(b) >= ipfix.VariableLength {
+		return nil, fmt.Errorf("value of %d bytes is too long for a variable-length field", len(b))
+	}
+	return b, nil
+}
+
+// constantSource parses a constant given as an IP address, 0x-prefixed hex
+// bytes or an unsigned integer.
+func constantSource(constant string, length uint16) (encoder.ValueSource, error) {
+	if constant == "" {
+		return nil, fmt.Errorf("constant value is required")
+	}
+	if ip := net.ParseIP(constant); ip != nil {
+		if want := addrLength(ip); want != int(length) {
+			return nil, fmt.Errorf("address %s needs a %d-byte field, got %d", constant, want, length)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+		return encoder.Bytes(ip), nil
+	}
+	if hexStr, ok := strings.CutPrefix(strings.ToLower(constant), "0x"); ok {
+		b, err := hex.DecodeString(hexStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex constant %q: %w", constant, err)
+		}
+		if len(b) != int(length) {
+			return nil, fmt.Errorf("hex constant is %d bytes, field length is %d", len(b), length)
+		}
+		return encoder.Bytes(b), nil
+	}
+	n, err := strconv.ParseUint(constant, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid constant %q: must be an unsigned integer, 0x-prefixed hex or IP address", constant)
+	}
+	if err := fitsUint(n, length); err != nil {
+		return nil, err
+	}
+	return encoder.Uint(n), nil
+}
+
+// fitsUint returns an error if v cannot be encoded as an unsigned integer of length bytes.
+func fitsUint(v uint64, length uint16) error {
+	if length > 8 {
+		return fmt.Errorf("numeric values need a field of at most 8 bytes, got %d", length)
+	}
+	if length < 8 && v>>(8*length) != 0 {
+		return fmt.Errorf("value %d does not fit in %d bytes", v, length)
+	}
+	return nil
+}
+
+// addrLength returns the field length needed for ip's address family.
+func addrLength(ip net.IP) int {
+	if ip.To4() != nil {
+		return net.IPv4len
+	}
+	return net.IPv6len
+}
@@ -0,0 +1,344 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package profiles
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/models"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/utils"
+)
+
+func vendorProfile() models.ProfileConfig {
+	return models.ProfileConfig{
+		Name:       "vendor",
+		TemplateID: 300,
+		Fields: []models.ProfileField{
+			{Type: "octetDeltaCount", Length: 4, Value: ValueRandom, Min: 64, Max: 1500},
+			{Type: "IPV4_SRC_ADDR", Length: 4, Value: ValueCIDR, CIDR: "192.0.2.0/24"},
+			{Type: "12", Length: 4},
+			{Type: "L4_DST_PORT", Length: 2, Value: ValueConstant, Constant: "8443"},
+			{Type: "protocolIdentifier", Length: 1},
+			{Type: "IN_PKTS", Length: 4, Value: ValueSequence, Start: 10, Step: 2},
+		},
+	}
+}
+
+func TestNetFlow(t *testing.T) {
+	t.Parallel()
+	p, err := NetFlow(vendorProfile())
+	if err != nil {
+		t.Fatalf("NetFlow failed: %v", err)
+	}
+	if p.TemplateID() != 300 {
+		t.Errorf("template ID wrong! Got: %d Want: 300", p.TemplateID())
+	}
+	if f := p.TemplateFields()[0]; f.Type != netflow.IN_BYTES || f.Length != 4 {
+		t.Errorf("field 0 wrong! Got: %+v", f)
+	}
+
+	session := netflow.NewSession()
+	tmpl := netflow.GenerateTemplateNetflow(1, session, p)
+	flow, err := netflow.GenerateDataNetflow(3, 1, "10.0.0.0/8", "10.0.0.0/8", 0, session, p)
+	if err != nil {
+		t.Fatalf("GenerateDataNetflow failed: %v", err)
+	}
+	if id := flow.DataFlowSets[0].FlowSetID; id != 300 {
+		t.Errorf("data FlowSetID wrong! Got: %d Want: 300", id)
+	}
+	for i, item := range flow.DataFlowSets[0].Items {
+		record := item.([]byte)
+		if bytes := binary.BigEndian.Uint32(record[0:4]); bytes < 64 || bytes > 1500 {
+			t.Errorf("item[%d]: bytes %d outside 64-1500", i, bytes)
+		}
+		if record[4] != 192 || record[5] != 0 || record[6] != 2 {
+			t.Errorf("item[%d]: src %v not in 192.0.2.0/24", i, record[4:8])
+		}
+		if record[8] != 10 {
+			t.Errorf("item[%d]: dst %v should use the default dst range", i, record[8:12])
+		}
+		if port := binary.BigEndian.Uint16(record[12:14]); port != 8443 {
+			t.Errorf("item[%d]: port %d, want 8443", i, port)
+		}
+		if pkts := binary.BigEndian.Uint32(record[15:19]); pkts != uint32(10+2*i) {
+			t.Errorf("item[%d]: packets %d, want %d", i, pkts, 10+2*i)
+		}
+	}
+	tBuf := tmpl.ToBytes()
+	dBuf := flow.ToBytes()
+	for name, pkt := range map[string][]byte{"template": tBuf.Bytes(), "data": dBuf.Bytes()} {
+		if ok, err := netflow.IsValidNetFlow(pkt, 9); !ok {
+			t.Errorf("%s packet invalid: %v", name, err)
+		}
+	}
+}
+
+func TestIPFIX(t *testing.T) {
+	t.Parallel()
+	p, err := IPFIX(vendorProfile())
+	if err != nil {
+		t.Fatalf("IPFIX failed: %v", err)
+	}
+	seq := ipfix.NewIPFIXSequence()
+	tmpl := ipfix.GenerateTemplateIPFIX(1, seq, p)
+	if id := tmpl.TemplateFlowSets[0].Templates[0].TemplateID; id != 300 {
+		t.Errorf("template ID wrong! Got: %d Want: 300", id)
+	}
+	flow, err := ipfix.GenerateDataIPFIX(5, 1, "10.0.0.0/8", "10.0.0.0/8", utils.DNSPort, seq, p)
+	if err != nil {
+		t.Fatalf("GenerateDataIPFIX failed: %v", err)
+	}
+	buf, err := flow.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := ipfix.IsValidIPFIX(buf.Bytes()); !ok {
+		t.Errorf("data packet invalid: %v", err)
+	}
+	if id := flow.DataFlowSets[0].FlowSetID; id != 300 {
+		t.Errorf("data FlowSetID wrong! Got: %d Want: 300", id)
+	}
+}
+
+// TestIPFIXEnterpriseFields tests that enterprise-specific fields are encoded
+// with the enterprise bit and PEN in the template and decode with their values.
+func TestIPFIXEnterpriseFields(t *testing.T) {
+	t.Parallel()
+	p, err := IPFIX(models.ProfileConfig{
+		Name:       "enterprise",
+		TemplateID: 310,
+		Fields: []models.ProfileField{
+			{Type: "octetDeltaCount", Length: 4},
+			{Type: "1", Length: 4, Enterprise: 29305, Value: ValueConstant, Constant: "0xdeadbeef"},
+			{Type: "8", Length: 2, Enterprise: 9},
+		},
+	})
+	if err != nil {
+		t.Fatalf("IPFIX failed: %v", err)
+	}
+	seq := ipfix.NewIPFIXSequence()
+	tmpl := ipfix.GenerateTemplateIPFIX(1, seq, p)
+	tBuf, err := tmpl.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow, err := ipfix.GenerateDataIPFIX(3, 1, "10.0.0.0/8", "10.0.0.0/8", 0, seq, p)
+	if err != nil {
+		t.Fatalf("GenerateDataIPFIX failed: %v", err)
+	}
+	dBuf, err := flow.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, pkt := range map[string][]byte{"template": tBuf.Bytes(), "data": dBuf.Bytes()} {
+		if ok, err := ipfix.IsValidIPFIX(pkt); !ok {
+			t.Errorf("%s packet invalid: %v", name, err)
+		}
+	}
+
+	d := decode.NewDecoder()
+	msg, err := d.Decode("exporter", tBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode template: %v", err)
+	}
+	want := []decode.Field{{Type: ipfix.OctetDeltaCount, Length: 4}, {Type: 1, Length: 4, EnterpriseNumber: 29305}, {Type: 8, Length: 2, EnterpriseNumber: 9}}
+	if got := msg.Templates[0].Fields; !slices.Equal(got, want) {
+		t.Errorf("Got: %+v Want: %+v", got, want)
+	}
+	msg, err = d.Decode("exporter", dBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode data: %v", err)
+	}
+	records := msg.DataSets[0].Records
+	if len(records) != 3 {
+		t.Fatalf("Got: %d records Want: 3", len(records))
+	}
+	for i, record := range records {
+		if got := record[1].Uint(); got != 0xdeadbeef {
+			t.Errorf("record %d: Got: %#x Want: 0xdeadbeef", i, got)
+		}
+		// Enterprise field 8 is not sourceIPv4Address, so it defaults to zeros
+		if got := record[2].Uint(); got != 0 {
+			t.Errorf("record %d: Got: %d Want: 0", i, got)
+		}
+	}
+}
+
+// TestIPFIXVariableLengthAndLists tests that variable-length fields and
+// basicList and subTemplateList fields are generated as declared and decode.
+func TestIPFIXVariableLengthAndLists(t *testing.T) {
+	t.Parallel()
+	p, err := IPFIX(models.ProfileConfig{
+		Name:       "lists",
+		TemplateID: 300,
+		Fields: []models.ProfileField{
+			{Type: "applicationName", Length: 65535, Value: ValueChoice, Choices: []string{"dns", "https"}},
+			{Type: "interfaceName", Length: 65535, Value: ValueConstant, Constant: "eth0"},
+			{Type: "basicList", Length: 65535, List: &models.ProfileList{
+				Semantic: "all-of",
+				Count:    3,
+				Fields:   []models.ProfileField{{Type: "ingressInterface", Length: 4, Value: ValueSequence, Start: 1, Step: 1}},
+			}},
+			{Type: "subTemplateList", Length: 65535, List: &models.ProfileList{
+				Semantic:   "exactly-one-of",
+				Count:      1,
+				TemplateID: 400,
+				Fields: []models.ProfileField{
+					{Type: "sourceIPv4Address", Length: 4},
+					{Type: "interfaceDescription", Length: 65535, Value: ValueConstant, Constant: "uplink"},
+				},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("IPFIX failed: %v", err)
+	}
+	seq := ipfix.NewIPFIXSequence()
+	tmpl := ipfix.GenerateTemplateIPFIX(1, seq, p)
+	tBuf, err := tmpl.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow, err := ipfix.GenerateDataIPFIX(2, 1, "10.0.0.0/8", "10.0.0.0/8", 0, seq, p)
+	if err != nil {
+		t.Fatalf("GenerateDataIPFIX failed: %v", err)
+	}
+	dBuf, err := flow.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := decode.NewDecoder()
+	msg, err := d.Decode("exporter", tBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode template: %v", err)
+	}
+	if got := len(msg.Templates); got != 3 || msg.Templates[0].ID != 400 || msg.Templates[1].ID != 300 {
+		t.Fatalf("Got: %+v Want: templates 400, 300 and the options template", msg.Templates)
+	}
+	msg, err = d.Decode("exporter", dBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode data: %v", err)
+	}
+	records := msg.DataSets[0].Records
+	if len(records) != 2 {
+		t.Fatalf("Got: %d records Want: 2", len(records))
+	}
+	for i, record := range records {
+		if app := string(record[0].Data); app != "dns" && app != "https" {
+			t.Errorf("record %d: Got: applicationName %q Want: dns or https", i, app)
+		}
+		if got := string(record[1].Data); got != "eth0" {
+			t.Errorf("record %d: Got: interfaceName %q Want: eth0", i, got)
+		}
+		list := record[2].Data
+		if len(list) != 5+3*4 || list[0] != ipfix.SemanticAllOf {
+			t.Fatalf("record %d: Got: basicList %x Want: allOf and three elements", i, list)
+		}
+		if got := binary.BigEndian.Uint32(list[13:17]); got != uint32(3*i+3) {
+			t.Errorf("record %d: Got: last element %d Want: %d", i, got, 3*i+3)
+		}
+		sub := record[3].Data
+		if len(sub) != 3+4+1+6 || binary.BigEndian.Uint16(sub[1:3]) != 400 || string(sub[8:]) != "uplink" {
+			t.Errorf("record %d: Got: subTemplateList %x Want: one record of template 400", i, sub)
+		}
+	}
+}
+
+func TestProfileValidation(t *testing.T) {
+	t.Parallel()
+	field := func(f models.ProfileField) models.ProfileConfig {
+		return models.ProfileConfig{Name: "bad", Fields: []models.ProfileField{f}}
+	}
+	tests := []struct {
+		name      string
+		cfg       models.ProfileConfig
+		netflowOK bool
+		ipfixOK   bool
+	}{
+		{"default template id", field(models.ProfileField{Type: "1", Length: 4}), true, true},
+		{"no fields", models.ProfileConfig{Name: "bad"}, false, false},
+		{"template id too low", models.ProfileConfig{Name: "bad", TemplateID: 255, Fields: []models.ProfileField{{Type: "1", Length: 4}}}, false, false},
+		{"options template id", models.ProfileConfig{Name: "bad", TemplateID: 257, Fields: []models.ProfileField{{Type: "1", Length: 4}}}, false, false},
+		{"interface options template id", models.ProfileConfig{Name: "bad", TemplateID: 258, Fields: []models.ProfileField{{Type: "1", Length: 4}}}, false, true},
+		{"unknown name", field(models.ProfileField{Type: "NOT_A_FIELD", Length: 4}), false, false},
+		{"zero type", field(models.ProfileField{Type: "0", Length: 4}), false, false},
+		{"zero length", field(models.ProfileField{Type: "1", Length: 0}), false, false},
+		{"ipv4 address too long", field(models.ProfileField{Type: "IPV4_SRC_ADDR", Length: 16}), false, false},
+		{"port too long", field(models.ProfileField{Type: "sourceTransportPort", Length: 4}), false, false},
+		{"counter too long", field(models.ProfileField{Type: "IN_BYTES", Length: 9}), false, false},
+		{"reduced size counter", field(models.ProfileField{Type: "IN_BYTES", Length: 2}), true, true},
+		{"random max overflows", field(models.ProfileField{Type: "IN_BYTES", Length: 8, Value: ValueRandom, Max: math.MaxInt64}), false, false},
+		{"timestamp wrong size", field(models.ProfileField{Type: "flowStartMilliseconds", Length: 4}), true, false},
+		{"enterprise element", field(models.ProfileField{Type: "40000", Length: 4}), true, false},
+		{"enterprise field", field(models.ProfileField{Type: "1", Length: 4, Enterprise: 29305}), false, true},
+		{"enterprise field any length", field(models.ProfileField{Type: "8", Length: 2, Enterprise: 9}), false, true},
+		{"enterprise field by name", field(models.ProfileField{Type: "octetDeltaCount", Length: 8, Enterprise: 29305}), false, false},
+		{"enterprise field id too high", field(models.ProfileField{Type: "40000", Length: 4, Enterprise: 29305}), false, false},
+		{"enterprise number too high", field(models.ProfileField{Type: "1", Length: 4, Enterprise: 1 << 32}), false, false},
+		{"random out of range", field(models.ProfileField{Type: "1", Length: 1, Value: ValueRandom, Max: 256}), false, false},
+		{"random reversed", field(models.ProfileField{Type: "1", Length: 4, Value: ValueRandom, Min: 5, Max: 1}), false, false},
+		{"constant too big", field(models.ProfileField{Type: "7", Length: 2, Value: ValueConstant, Constant: "65536"}), false, false},
+		{"constant hex", field(models.ProfileField{Type: "56", Length: 6, Value: ValueConstant, Constant: "0x001122334455"}), true, true},
+		{"constant hex wrong size", field(models.ProfileField{Type: "56", Length: 6, Value: ValueConstant, Constant: "0x0011"}), false, false},
+		{"constant address", field(models.ProfileField{Type: "8", Length: 4, Value: ValueConstant, Constant: "192.0.2.1"}), true, true},
+		{"constant address family", field(models.ProfileField{Type: "8", Length: 4, Value: ValueConstant, Constant: "2001:db8::1"}), false, false},
+		{"constant missing", field(models.ProfileField{Type: "1", Length: 4, Value: ValueConstant}), false, false},
+		{"cidr family", field(models.ProfileField{Type: "27", Length: 16, Value: ValueCIDR, CIDR: "10.0.0.0/8"}), false, false},
+		{"cidr invalid", field(models.ProfileField{Type: "8", Length: 4, Value: ValueCIDR, CIDR: "bogus"}), false, false},
+		{"sequence on wide field", field(models.ProfileField{Type: "27", Length: 16, Value: ValueSequence}), false, false},
+		{"unknown generator", field(models.ProfileField{Type: "1", Length: 4, Value: "gaussian"}), false, false},
+		{"variable-length string", field(models.ProfileField{Type: "interfaceName", Length: 65535}), false, true},
+		{"variable-length counter", field(models.ProfileField{Type: "octetDeltaCount", Length: 65535}), false, false},
+		{"variable-length random", field(models.ProfileField{Type: "applicationName", Length: 65535, Value: ValueRandom, Max: 10}), false, false},
+		{"variable-length hex", field(models.ProfileField{Type: "applicationId", Length: 65535, Value: ValueConstant, Constant: "0x0300"}), false, true},
+		{"choice without choices", field(models.ProfileField{Type: "applicationName", Length: 65535, Value: ValueChoice}), false, false},
+		{"choice on fixed field", field(models.ProfileField{Type: "interfaceName", Length: 8, Value: ValueChoice, Choices: []string{"eth0"}}), false, false},
+		{"list without list", field(models.ProfileField{Type: "basicList", Length: 65535}), false, false},
+		{"list on fixed field", field(models.ProfileField{Type: "basicList", Length: 16, List: &models.ProfileList{Count: 1, Fields: []models.ProfileField{{Type: "1", Length: 4}}}}), false, false},
+		{"list on other field", field(models.ProfileField{Type: "1", Length: 4, List: &models.ProfileList{Fields: []models.ProfileField{{Type: "1", Length: 4}}}}), false, false},
+		{"basicList two elements", field(models.ProfileField{Type: "basicList", Length: 65535, List: &models.ProfileList{Fields: []models.ProfileField{{Type: "1", Length: 4}, {Type: "2", Length: 4}}}}), false, false},
+		{"basicList unknown semantic", field(models.ProfileField{Type: "basicList", Length: 65535, List: &models.ProfileList{Semantic: "some-of", Fields: []models.ProfileField{{Type: "1", Length: 4}}}}), false, false},
+		{"subTemplateList without template id", field(models.ProfileField{Type: "subTemplateList", Length: 65535, List: &models.ProfileList{Fields: []models.ProfileField{{Type: "1", Length: 4}}}}), false, false},
+		{"subTemplateList reusing template id", field(models.ProfileField{Type: "subTemplateList", Length: 65535, List: &models.ProfileList{TemplateID: 256, Fields: []models.ProfileField{{Type: "1", Length: 4}}}}), false, false},
+		{"subTemplateList invalid field", field(models.ProfileField{Type: "subTemplateList", Length: 65535, List: &models.ProfileList{TemplateID: 400, Fields: []models.ProfileField{{Type: "8", Length: 2}}}}), false, false},
+		{"subTemplateMultiList", field(models.ProfileField{Type: "subTemplateMultiList", Length: 65535}), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := NetFlow(tt.cfg); (err == nil) != tt.netflowOK {
+				t.Errorf("NetFlow() error = %v, want ok %v", err, tt.netflowOK)
+			}
+			if _, err := IPFIX(tt.cfg); (err == nil) != tt.ipfixOK {
+				t.Errorf("IPFIX() error = %v, want ok %v", err, tt.ipfixOK)
+			}
+		})
+	}
+}
+
+func TestRandomMaxBoundary(t *testing.T) {
+	t.Parallel()
+	cfg := models.ProfileConfig{Name: "edge", Fields: []models.ProfileField{
+		{Type: "IN_BYTES", Length: 8, Value: ValueRandom, Min: math.MaxInt64 - 1, Max: math.MaxInt64 - 1},
+	}}
+	p, err := NetFlow(cfg)
+	if err != nil {
+		t.Fatalf("NetFlow() error: %v", err)
+	}
+	flow, err := netflow.GenerateDataNetflow(1, 1, "10.0.0.0/8", "10.0.0.0/8", 0, netflow.NewSession(), p)
+	if err != nil {
+		t.Fatalf("GenerateDataNetflow error: %v", err)
+	}
+	record := flow.DataFlowSets[0].Items[0].([]byte)
+	if got := binary.BigEndian.Uint64(record); got != math.MaxInt64-1 {
+		t.Errorf("Got: %d Want: %d", got, int64(math.MaxInt64-1))
+	}
+}
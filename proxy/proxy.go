@@ -15,10 +15,11 @@ import (
 	"sync"
 	"time"
 
-	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/anonymize"
+	"github.com/dmabry/flowgre/flowcheck"
 	"github.com/dmabry/flowgre/lifecycle"
-	"github.com/dmabry/flowgre/netflow"
 	"github.com/dmabry/flowgre/stats"
+	"github.com/dmabry/flowgre/transport"
 	"github.com/dmabry/flowgre/utils"
 	"golang.org/x/sync/errgroup"
 )
@@ -33,28 +34,30 @@ const (
 	maxTargets = 10
 )
 
+// datagram is a packet received by the listener and the address it came from.
+type datagram struct {
+	source  string
+	payload []byte
+}
+
 // Worker is the goroutine used to create workers
-func worker(id int, ctx context.Context, server string, port int, wg *sync.WaitGroup, workerChan <-chan []byte) {
+func worker(id int, ctx context.Context, dial transport.Dialer, server string, port int, wg *sync.WaitGroup, workerChan <-chan []byte) {
 	defer wg.Done()
-	if err := runWorker(id, ctx, server, port, workerChan); err != nil {
+	if err := runWorker(id, ctx, dial, server, port, workerChan); err != nil {
 		log.Printf("Worker [%2d] error: %v", id, err)
 	}
 }
 
-func runWorker(id int, ctx context.Context, server string, port int, workerChan <-chan []byte) error {
-	// Sent limiter to given delay
-	// Configure connection to use.  It looks like a listener, but it will be used to send packet.  Allows me to set the source port
+func runWorker(id int, ctx context.Context, dial transport.Dialer, server string, port int, workerChan <-chan []byte) error {
 	srcPort, err := utils.RandomNum(sourcePortMin, sourcePortMax)
 	if err != nil {
 		return fmt.Errorf("generate source port: %w", err)
 	}
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: srcPort})
+	t, err := dial.Dial(server, port, srcPort)
 	if err != nil {
-		return fmt.Errorf("listen on source port %d: %w", srcPort, err)
+		return fmt.Errorf("open transport from source port %d: %w", srcPort, err)
 	}
-	defer conn.Close()
-	// Convert given IP String to net.IP type
-	destIP := net.ParseIP(server)
+	defer t.Close()
 	log.Printf("Worker [%2d] Sending flows at %s:%d\n",
 		id, server, port)
 	//Infinite loop to keep slinging until we receive context done.
@@ -70,7 +73,7 @@ func runWorker(id int, ctx context.Context, server string, port int, workerChan
 			// length := len(payload)
 			//log.Printf("Worker [%2d] sending packet to %s:%d with length: %d\n", id, server, port, length)
 			// send packet here.
-			_, err = utils.SendPacket(conn, &net.UDPAddr{IP: destIP, Port: port}, payload, false)
+			_, err = t.Send(payload)
 			if err != nil {
 				return fmt.Errorf("send packet: %w", err)
 			}
@@ -113,14 +116,14 @@ func runReplicator(ctx context.Context, dataChan <-chan []byte, targets []chan [
 }
 
 // proxyListener is used to pull packets off the wire and put the byte payload on the data chan
-func proxyListener(ctx context.Context, wg *sync.WaitGroup, ip string, port int, proxyChan chan<- []byte, verbose bool) {
+func proxyListener(ctx context.Context, wg *sync.WaitGroup, ip string, port int, proxyChan chan<- datagram, verbose bool) {
 	defer wg.Done()
 	if err := runProxyListener(ctx, ip, port, proxyChan, verbose); err != nil {
 		log.Printf("Proxy listener error: %v", err)
 	}
 }
 
-func runProxyListener(ctx context.Context, ip string, port int, proxyChan chan<- []byte, verbose bool) error {
+func runProxyListener(ctx context.Context, ip string, port int, proxyChan chan<- datagram, verbose bool) error {
 	// Create UDP listener and setup db to catch files
 	listenIP := net.ParseIP(ip)
 	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: listenIP, Port: port})
@@ -163,7 +166,7 @@ func runProxyListener(ctx context.Context, ip string, port int, proxyChan chan<-
 			}
 			// Send payload to the proxyChan channel
 			select {
-			case proxyChan <- payload:
+			case proxyChan <- datagram{source: fromIP.String(), payload: payload}:
 			case <-ctx.Done():
 				return nil
 			default:
@@ -196,13 +199,14 @@ func runStatsPrinter(ctx context.Context, rStats *stats.RecordStat) error {
 	}
 }
 
-// parseNetflow validates that the payload is valid NetFlow v9 or IPFIX v10 and forwards it.
-func parseNetflow(ctx context.Context, wg *sync.WaitGroup, proxyChan <-chan []byte, dataChan chan<- []byte, rStats *stats.RecordStat, verbose bool) {
+// parseNetflow validates that the payload is valid NetFlow v5, v9, IPFIX v10 or sFlow v5 and forwards it.
+// When anon is set, addresses are rewritten first, and packets they can't be rewritten in are ignored.
+func parseNetflow(ctx context.Context, wg *sync.WaitGroup, proxyChan <-chan datagram, dataChan chan<- []byte, rStats *stats.RecordStat, anon *anonymize.Anonymizer, verbose bool) {
 	defer wg.Done()
-	_ = runParseNetflow(ctx, proxyChan, dataChan, rStats, verbose)
+	_ = runParseNetflow(ctx, proxyChan, dataChan, rStats, anon, verbose)
 }
 
-func runParseNetflow(ctx context.Context, proxyChan <-chan []byte, dataChan chan<- []byte, rStats *stats.RecordStat, verbose bool) error {
+func runParseNetflow(ctx context.Context, proxyChan <-chan datagram, dataChan chan<- []byte, rStats *stats.RecordStat, anon *anonymize.Anonymizer, verbose bool) error {
 
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
@@ -212,18 +216,23 @@ func runParseNetflow(ctx context.Context, proxyChan <-chan []byte, dataChan chan
 		case <-ctx.Done():
 			log.Println("Flow parser exiting due to signal")
 			return nil
-		case payload, ok := <-proxyChan:
+		case dg, ok := <-proxyChan:
 			if !ok {
 				return nil
 			}
-			ok, err := netflow.IsValidNetFlow(payload, 9)
+			payload := dg.payload
+			ok, err := flowcheck.IsValidFlow(payload)
 			if err != nil {
-				// Try IPFIX
-				ok, err = ipfix.IsValidIPFIX(payload)
-				if err != nil {
+				if verbose {
+					log.Printf("Skipping packet due to issue parsing: %v", err)
+				}
+			}
+			if ok && anon != nil {
+				if payload, err = anon.Packet(dg.source, payload); err != nil {
 					if verbose {
-						log.Printf("Skipping packet due to issue parsing: %v", err)
+						log.Printf("Skipping packet from %s, addresses not rewritten: %v", dg.source, err)
 					}
+					ok = false
 				}
 			}
 			if ok {
@@ -257,15 +266,20 @@ func Run(ip string, port int, verbose bool, targets []string) {
 	// Setup signal handling BEFORE starting goroutines to avoid missed signals
 	_ = mgr.SetupSignalHandler()
 
-	if err := RunCtx(mgr.Context(), ip, port, verbose, targets); err != nil {
+	if err := RunCtx(mgr.Context(), ip, port, verbose, targets, nil, nil); err != nil {
 		log.Printf("Proxy error: %v", err)
 	}
 	mgr.Wait()
 }
 
 // RunCtx starts the proxy with an externally managed context and propagates
-// startup and runtime failures from every pipeline component.
-func RunCtx(ctx context.Context, ip string, port int, verbose bool, targets []string) error {
+// startup and runtime failures from every pipeline component. When anon is
+// set, addresses are rewritten before flows are relayed. Each target is sent
+// to over its own Transport from dial, or over UDP if dial is nil.
+func RunCtx(ctx context.Context, ip string, port int, verbose bool, targets []string, anon *anonymize.Anonymizer, dial transport.Dialer) error {
+	if dial == nil {
+		dial = transport.Network{}
+	}
 	if len(targets) == 0 {
 		return fmt.Errorf("at least one target is required")
 	}
@@ -273,7 +287,7 @@ func RunCtx(ctx context.Context, ip string, port int, verbose bool, targets []st
 		return fmt.Errorf("can't have more than %d targets", maxTargets)
 	}
 
-	proxyChan := make(chan []byte, bufferSize)
+	proxyChan := make(chan datagram, bufferSize)
 	dataChan := make(chan []byte, bufferSize)
 	rStats := stats.RecordStat{
 		ValidCount:   0,
@@ -312,10 +326,10 @@ func RunCtx(ctx context.Context, ip string, port int, verbose bool, targets []st
 	for w, target := range parsedTargets {
 		id := w + 1
 		workerChan := workerChans[w]
-		eg.Go(func() error { return runWorker(id, egCtx, target.host, target.port, workerChan) })
+		eg.Go(func() error { return runWorker(id, egCtx, dial, target.host, target.port, workerChan) })
 	}
 	eg.Go(func() error { return runStatsPrinter(egCtx, &rStats) })
-	eg.Go(func() error { return runParseNetflow(egCtx, proxyChan, dataChan, &rStats, verbose) })
+	eg.Go(func() error { return runParseNetflow(egCtx, proxyChan, dataChan, &rStats, anon, verbose) })
 	eg.Go(func() error { return runReplicator(egCtx, dataChan, workerChans, verbose) })
 	eg.Go(func() error { return runProxyListener(egCtx, ip, port, proxyChan, verbose) })
 
@@ -14,8 +14,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dmabry/flowgre/anonymize"
+	"github.com/dmabry/flowgre/decode"
 	"github.com/dmabry/flowgre/netflow"
 	"github.com/dmabry/flowgre/stats"
+	"github.com/dmabry/flowgre/transport"
 )
 
 // TestProxyListener tests that the proxy listener can receive UDP packets.
@@ -196,7 +199,7 @@ func TestWorker(t *testing.T) {
 
 	// Start worker
 	wg.Add(1)
-	go worker(1, ctx, "127.0.0.1", port, &wg, workerChan)
+	go worker(1, ctx, transport.Network{}, "127.0.0.1", port, &wg, workerChan)
 
 	// Send test payload
 	workerChan <- []byte("worker test")
@@ -221,16 +224,16 @@ func TestParseNetflow(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	proxyChan := make(chan []byte, bufferSize)
+	proxyChan := make(chan datagram, bufferSize)
 	dataChan := make(chan []byte, bufferSize)
 	rStats := &stats.RecordStat{}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go parseNetflow(ctx, &wg, proxyChan, dataChan, rStats, false)
+	go parseNetflow(ctx, &wg, proxyChan, dataChan, rStats, nil, false)
 
 	// Send invalid payload (not NetFlow)
-	proxyChan <- []byte("invalid")
+	proxyChan <- datagram{payload: []byte("invalid")}
 
 	// Wait a bit for processing
 	time.Sleep(100 * time.Millisecond)
@@ -243,7 +246,7 @@ func TestParseNetflow(t *testing.T) {
 	session := netflow.NewSession()
 	flow := netflow.GenerateTemplateNetflow(100, session)
 	buf := flow.ToBytes()
-	proxyChan <- buf.Bytes()
+	proxyChan <- datagram{payload: buf.Bytes()}
 
 	// Wait for processing
 	select {
@@ -274,14 +277,14 @@ func TestParseNetflow_MalformedNetFlow(t *testing.T) {
 
 	var wg sync.WaitGroup
 
-	proxyChan := make(chan []byte, bufferSize)
+	proxyChan := make(chan datagram, bufferSize)
 	dataChan := make(chan []byte, bufferSize)
 	rStats := &stats.RecordStat{}
 
 	done := make(chan struct{})
 	wg.Add(1)
 	go func() {
-		parseNetflow(ctx, &wg, proxyChan, dataChan, rStats, false)
+		parseNetflow(ctx, &wg, proxyChan, dataChan, rStats, nil, false)
 		close(done)
 	}()
 
@@ -305,7 +308,7 @@ func TestParseNetflow_MalformedNetFlow(t *testing.T) {
 	}
 
 	// Send malformed packet — it should be counted as invalid and not forwarded
-	proxyChan <- malformed
+	proxyChan <- datagram{payload: malformed}
 
 	time.Sleep(100 * time.Millisecond)
 
@@ -325,7 +328,7 @@ func TestParseNetflow_MalformedNetFlow(t *testing.T) {
 	session := netflow.NewSession()
 	flow := netflow.GenerateTemplateNetflow(100, session)
 	flowBuf := flow.ToBytes()
-	proxyChan <- flowBuf.Bytes()
+	proxyChan <- datagram{payload: flowBuf.Bytes()}
 
 	select {
 	case <-dataChan:
@@ -344,6 +347,77 @@ func TestParseNetflow_MalformedNetFlow(t *testing.T) {
 	close(dataChan)
 }
 
+// TestParseNetflow_Anonymize verifies that addresses are rewritten before
+// forwarding, with templates learned per source, and that data which can't be
+// rewritten is ignored rather than relayed.
+func TestParseNetflow_Anonymize(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	anon, err := anonymize.New(anonymize.Rules{Remap: []anonymize.Remap{{From: "10.0.0.0/8", To: "172.0.0.0/8"}}})
+	if err != nil {
+		t.Fatalf("anonymize.New: %v", err)
+	}
+	proxyChan := make(chan datagram, bufferSize)
+	dataChan := make(chan []byte, bufferSize)
+	rStats := &stats.RecordStat{}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go parseNetflow(ctx, &wg, proxyChan, dataChan, rStats, anon, false)
+
+	session := netflow.NewSession()
+	tmpl := netflow.GenerateTemplateNetflow(100, session)
+	tmplBuf := tmpl.ToBytes()
+	data, err := netflow.GenerateDataNetflow(2, 100, "10.0.0.0/8", "10.0.0.0/8", 443, session)
+	if err != nil {
+		t.Fatalf("GenerateDataNetflow: %v", err)
+	}
+	dataBuf := data.ToBytes()
+
+	// Data ahead of its template is ignored
+	proxyChan <- datagram{source: "192.0.2.1:2055", payload: dataBuf.Bytes()}
+	proxyChan <- datagram{source: "192.0.2.1:2055", payload: tmplBuf.Bytes()}
+	proxyChan <- datagram{source: "192.0.2.1:2055", payload: dataBuf.Bytes()}
+
+	var forwarded [][]byte
+	for range 2 {
+		select {
+		case payload := <-dataChan:
+			forwarded = append(forwarded, payload)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timeout waiting for packets to be forwarded")
+		}
+	}
+	if rStats.LoadInvalid() != 1 {
+		t.Errorf("Expected 1 ignored packet, got %d", rStats.LoadInvalid())
+	}
+
+	d := decode.NewDecoder()
+	for _, payload := range forwarded {
+		msg, err := d.Decode("", payload)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		for _, ds := range msg.DataSets {
+			for _, record := range ds.Records {
+				for _, v := range record {
+					if v.Field.Type == netflow.IPV4_SRC_ADDR && v.Data[0] != 172 {
+						t.Errorf("Expected source in 172.0.0.0/8, got %v", v.Data)
+					}
+				}
+			}
+		}
+	}
+
+	cancel()
+	wg.Wait()
+	close(proxyChan)
+	close(dataChan)
+}
+
 // TestStatsPrinter tests that stats are printed periodically.
 func TestStatsPrinter(t *testing.T) {
 	t.Parallel()
@@ -561,7 +635,7 @@ func TestRunCtxReturnsListenerError(t *testing.T) {
 	defer blocker.Close()
 
 	port := blocker.LocalAddr().(*net.UDPAddr).Port
-	err = RunCtx(context.Background(), "127.0.0.1", port, false, []string{"127.0.0.1:9995"})
+	err = RunCtx(context.Background(), "127.0.0.1", port, false, []string{"127.0.0.1:9995"}, nil, nil)
 	if err == nil {
 		t.Fatal("expected listener error")
 	}
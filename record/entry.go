@@ -0,0 +1,109 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/dmabry/flowgre/flowcheck"
+)
+
+// Protocol names stored with recorded packets.
+const (
+	ProtocolNetFlowV5 = flowcheck.ProtocolNetFlowV5
+	ProtocolNetFlowV9 = flowcheck.ProtocolNetFlowV9
+	ProtocolIPFIX     = flowcheck.ProtocolIPFIX
+	ProtocolSFlow     = flowcheck.ProtocolSFlow
+)
+
+// EntryVersion is the version of the envelope format written by record.
+//
+// Version 1 layout, all integers big-endian:
+//
+//	magic        4 bytes  "FGRE"
+//	version      1 byte
+//	meta length  2 bytes  length of the metadata that follows
+//	received     8 bytes  arrival time, nanoseconds since the Unix epoch
+//	source       1-byte length + exporter IP:port
+//	listener     1-byte length + listener IP:port
+//	protocol     1-byte length + protocol name
+//	payload      the rest of the value
+//
+// Later versions may append metadata; readers skip what they don't know using
+// the meta length. Databases written before the envelope existed store the
+// bare payload, which always starts with a zero byte, so it can't be mistaken
+// for the magic.
+const EntryVersion = 1
+
+// entryMagic marks an enveloped record value.
+var entryMagic = []byte("FGRE")
+
+// entryHeaderLength is the size of the magic, version and meta length.
+const entryHeaderLength = 7
+
+// Entry is a recorded packet and the metadata captured when it arrived.
+type Entry struct {
+	Received time.Time // zero for records written without metadata
+	Source   string    // exporter IP:port; empty for records written without metadata
+	Listener string    // local IP:port the packet arrived on
+	Protocol string    // ProtocolNetFlowV5, ProtocolNetFlowV9, ProtocolIPFIX or ProtocolSFlow
+	Payload  []byte
+}
+
+// MarshalBinary encodes e in the current envelope format.
+func (e Entry) MarshalBinary() ([]byte, error) {
+	var meta bytes.Buffer
+	_ = binary.Write(&meta, binary.BigEndian, e.Received.UnixNano())
+	for _, s := range []string{e.Source, e.Listener, e.Protocol} {
+		if len(s) > 255 {
+			return nil, fmt.Errorf("entry metadata %q longer than 255 bytes", s)
+		}
+		meta.WriteByte(byte(len(s)))
+		meta.WriteString(s)
+	}
+
+	value := make([]byte, 0, entryHeaderLength+meta.Len()+len(e.Payload))
+	value = append(value, entryMagic...)
+	value = append(value, EntryVersion)
+	value = binary.BigEndian.AppendUint16(value, uint16(meta.Len()))
+	value = append(value, meta.Bytes()...)
+	return append(value, e.Payload...), nil
+}
+
+// UnmarshalEntry decodes a record value. Values written before the envelope
+// existed decode to an Entry holding only the payload and its detected protocol.
+func UnmarshalEntry(value []byte) (Entry, error) {
+	if !bytes.HasPrefix(value, entryMagic) {
+		return Entry{Payload: value, Protocol: flowcheck.DetectProtocol(value)}, nil
+	}
+	if len(value) < entryHeaderLength {
+		return Entry{}, fmt.Errorf("entry too short for envelope header: %d bytes", len(value))
+	}
+	if version := value[4]; version == 0 {
+		return Entry{}, fmt.Errorf("invalid entry version %d", version)
+	}
+	metaLength := int(binary.BigEndian.Uint16(value[5:7]))
+	if len(value) < entryHeaderLength+metaLength {
+		return Entry{}, fmt.Errorf("entry metadata length %d exceeds %d byte value", metaLength, len(value))
+	}
+	meta := value[entryHeaderLength : entryHeaderLength+metaLength]
+	if len(meta) < 8 {
+		return Entry{}, fmt.Errorf("entry metadata too short: %d bytes", len(meta))
+	}
+	e := Entry{
+		Received: time.Unix(0, int64(binary.BigEndian.Uint64(meta[0:8]))),
+		Payload:  value[entryHeaderLength+metaLength:],
+	}
+	meta = meta[8:]
+	for _, s := range []*string{&e.Source, &e.Listener, &e.Protocol} {
+		if len(meta) < 1 || len(meta) < 1+int(meta[0]) {
+			return Entry{}, fmt.Errorf("entry metadata truncated")
+		}
+		*s, meta = string(meta[1:1+int(meta[0])]), meta[1+int(meta[0]):]
+	}
+	return e, nil
+}
@@ -0,0 +1,111 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmabry/flowgre/netflow"
+)
+
+func TestEntryRoundTrip(t *testing.T) {
+	t.Parallel()
+	want := Entry{
+		Received: time.Unix(1700000000, 42),
+		Source:   "[2001:db8::1]:2055",
+		Listener: "[::]:9995",
+		Protocol: ProtocolIPFIX,
+		Payload:  []byte{0x00, 0x0a, 0x00, 0x10},
+	}
+	value, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got, err := UnmarshalEntry(value)
+	if err != nil {
+		t.Fatalf("UnmarshalEntry: %v", err)
+	}
+	if !got.Received.Equal(want.Received) || got.Source != want.Source || got.Listener != want.Listener ||
+		got.Protocol != want.Protocol || !bytes.Equal(got.Payload, want.Payload) {
+		t.Errorf("Got: %+v Want: %+v", got, want)
+	}
+}
+
+func TestUnmarshalEntryLegacy(t *testing.T) {
+	t.Parallel()
+	// Databases written before the envelope hold the bare payload
+	flow := netflow.GenerateTemplateNetflow(100, netflow.NewSession())
+	buf := flow.ToBytes()
+	got, err := UnmarshalEntry(buf.Bytes())
+	if err != nil {
+		t.Fatalf("UnmarshalEntry: %v", err)
+	}
+	if !bytes.Equal(got.Payload, buf.Bytes()) {
+		t.Error("Got: modified payload Want: the stored value")
+	}
+	if got.Protocol != ProtocolNetFlowV9 || !got.Received.IsZero() || got.Source != "" {
+		t.Errorf("Got: %+v Want: payload and detected protocol only", got)
+	}
+}
+
+func TestUnmarshalEntryNewerVersion(t *testing.T) {
+	t.Parallel()
+	// A later version appending metadata stays readable
+	value, err := Entry{Source: "192.0.2.1:2055", Protocol: ProtocolSFlow, Payload: []byte("payload")}.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	metaLength := binary.BigEndian.Uint16(value[5:7])
+	extended := append([]byte(nil), value[:entryHeaderLength+int(metaLength)]...)
+	extended = append(extended, 0xAA, 0xBB)
+	extended = append(extended, "payload"...)
+	extended[4] = EntryVersion + 1
+	binary.BigEndian.PutUint16(extended[5:7], metaLength+2)
+
+	got, err := UnmarshalEntry(extended)
+	if err != nil {
+		t.Fatalf("UnmarshalEntry: %v", err)
+	}
+	if got.Source != "192.0.2.1:2055" || got.Protocol != ProtocolSFlow || string(got.Payload) != "payload" {
+		t.Errorf("Got: %+v Want: version 1 fields and the payload", got)
+	}
+}
+
+func TestUnmarshalEntryErrors(t *testing.T) {
+	t.Parallel()
+	valid, err := Entry{Source: "192.0.2.1:2055", Payload: []byte("payload")}.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	zeroVersion := append([]byte(nil), valid...)
+	zeroVersion[4] = 0
+
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "short header", value: []byte("FGRE\x01")},
+		{name: "zero version", value: zeroVersion},
+		{name: "meta past end", value: valid[:entryHeaderLength+4]},
+		{name: "truncated string", value: append([]byte("FGRE\x01\x00\x0a"), 0, 0, 0, 0, 0, 0, 0, 0, 5, 'a')},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := UnmarshalEntry(tt.value); err == nil {
+				t.Error("Got: nil error Want: error")
+			}
+		})
+	}
+
+	long := Entry{Source: strings.Repeat("a", 256)}
+	if _, err := long.MarshalBinary(); err == nil {
+		t.Error("Got: nil error for 256-byte source Want: error")
+	}
+}
@@ -0,0 +1,207 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package record
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+	"github.com/dmabry/flowgre/flowcheck"
+	"github.com/dmabry/flowgre/pcap"
+	"golang.org/x/sync/errgroup"
+)
+
+// Documentation addresses standing in for endpoints a record doesn't carry:
+// the exporter of records written without metadata, and the collector of
+// records received on a wildcard listener.
+var (
+	unknownExporter4  = netip.MustParseAddr("192.0.2.1")
+	unknownCollector4 = netip.MustParseAddr("192.0.2.2")
+	unknownCollector6 = netip.MustParseAddr("2001:db8::2")
+)
+
+// collectorPorts are the well-known ports Wireshark decodes each protocol on,
+// used for records written without metadata.
+var collectorPorts = map[string]uint16{
+	ProtocolNetFlowV5: 2055,
+	ProtocolNetFlowV9: 2055,
+	ProtocolIPFIX:     4739,
+	ProtocolSFlow:     6343,
+}
+
+// ReadPCAP calls fn with each UDP datagram of a pcap or pcapng capture file in
+// capture order, as an Entry holding its capture time and endpoints but no
+// protocol. Frames that aren't UDP datagrams are skipped. It stops at the
+// first error fn returns and returns it.
+func ReadPCAP(path string, verbose bool, fn func(Entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open capture: %w", err)
+	}
+	defer f.Close()
+	r, err := pcap.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("capture %s: %w", path, err)
+	}
+	log.Printf("Reading from capture %s", path)
+	read, skipped := 0, 0
+	for {
+		frame, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("capture %s: %w", path, err)
+		}
+		dg, err := pcap.DecodeUDP(frame)
+		if err != nil {
+			if verbose {
+				log.Printf("Skipping frame %d: %v", read+skipped+1, err)
+			}
+			skipped++
+			continue
+		}
+		if err := fn(Entry{Received: frame.Timestamp, Source: dg.Src.String(), Listener: dg.Dst.String(), Payload: dg.Payload}); err != nil {
+			return err
+		}
+		read++
+	}
+	log.Printf("Read %d UDP datagrams from capture %s, skipped %d other frames", read, path, skipped)
+	return nil
+}
+
+// runPCAPIngest puts the UDP datagrams of a capture file on the data chan,
+// closing it at the end of the file.
+func runPCAPIngest(ctx context.Context, path string, data chan<- Entry, verbose bool) error {
+	defer close(data)
+	err := ReadPCAP(path, verbose, func(entry Entry) error {
+		select {
+		case data <- entry:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// RunPCAPCtx records the NetFlow, IPFIX and sFlow datagrams of a pcap or
+// pcapng capture file into the database in dbdir, as if they had arrived
+// at the times and from the exporters in the capture. It returns once the
+// whole file is read.
+func RunPCAPCtx(ctx context.Context, path string, dbdir string, verbose bool) error {
+	dataChan := make(chan Entry, 1024)
+	parseChan := make(chan Entry, 1024)
+	eg, egCtx := errgroup.WithContext(ctx)
+
+	eg.Go(func() error { return runPCAPIngest(egCtx, path, parseChan, verbose) })
+	eg.Go(func() error {
+		defer close(dataChan)
+		return runParseFlow(egCtx, parseChan, dataChan, verbose)
+	})
+	eg.Go(func() error { return runDBIngest(egCtx, dbdir, dataChan, verbose) })
+	if err := eg.Wait(); err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	return nil
+}
+
+// pcapEndpoints returns the exporter and collector a record is written to a
+// capture between. Records without metadata are given documentation
+// addresses, and a wildcard listener address is replaced by one, of the
+// exporter's address family.
+func pcapEndpoints(entry Entry, protocol string) (src, dst netip.AddrPort) {
+	port := collectorPorts[protocol]
+	src, err := netip.ParseAddrPort(entry.Source)
+	if err != nil {
+		src = netip.AddrPortFrom(unknownExporter4, port)
+	}
+	src = netip.AddrPortFrom(src.Addr().Unmap(), src.Port())
+	dst, err = netip.ParseAddrPort(entry.Listener)
+	if err == nil {
+		dst = netip.AddrPortFrom(dst.Addr().Unmap(), dst.Port())
+		port = dst.Port()
+	}
+	if err != nil || dst.Addr().IsUnspecified() || dst.Addr().Is4() != src.Addr().Is4() {
+		collector := unknownCollector4
+		if !src.Addr().Is4() {
+			collector = unknownCollector6
+		}
+		dst = netip.AddrPortFrom(collector, port)
+	}
+	return src, dst
+}
+
+// ExportPCAP writes every record of the database in dbdir to w as a capture
+// in format, pcap.FormatPCAP or pcap.FormatPCAPNG. Each record becomes an
+// Ethernet frame holding an IP/UDP datagram from its exporter to the address
+// it was received on, timestamped with its arrival time; records written
+// without metadata get documentation addresses and the Unix epoch. It returns
+// the number of packets written.
+func ExportPCAP(ctx context.Context, dbdir string, w io.Writer, format string) (count int, retErr error) {
+	pw, err := pcap.NewWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+	options := badger.DefaultOptions(dbdir)
+	options.Logger = nil
+	db, err := badger.Open(options)
+	if err != nil {
+		return 0, fmt.Errorf("open DB %s: %w", dbdir, err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil && retErr == nil {
+			retErr = fmt.Errorf("close DB: %w", err)
+		}
+	}()
+
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item := it.Item()
+			if len(item.Key()) != 4 {
+				continue
+			}
+			key := binary.BigEndian.Uint32(item.Key())
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return fmt.Errorf("read record %d: %w", key, err)
+			}
+			entry, err := UnmarshalEntry(value)
+			if err != nil {
+				return fmt.Errorf("decode record %d: %w", key, err)
+			}
+			src, dst := pcapEndpoints(entry, flowcheck.DetectProtocol(entry.Payload))
+			frame, err := pcap.EncodeUDP(pcap.Datagram{Src: src, Dst: dst, Payload: entry.Payload})
+			if err != nil {
+				return fmt.Errorf("encode record %d: %w", key, err)
+			}
+			received := entry.Received
+			if received.IsZero() {
+				received = time.Unix(0, 0)
+			}
+			if err := pw.WriteFrame(received, frame); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,242 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package record
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/pcap"
+)
+
+// readEntries returns the records of the database in dir in key order.
+func readEntries(t *testing.T, dir string) []Entry {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer db.Close()
+	var entries []Entry
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if len(it.Item().Key()) != 4 {
+				continue
+			}
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entry, err := UnmarshalEntry(value)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read database: %v", err)
+	}
+	return entries
+}
+
+// TestRunPCAPCtx tests that the flow datagrams of a capture are recorded with
+// their capture time and endpoints, and everything else is skipped.
+func TestRunPCAPCtx(t *testing.T) {
+	t.Parallel()
+
+	session := netflow.NewSession()
+	flow := netflow.GenerateTemplateNetflow(100, session)
+	flowBuf := flow.ToBytes()
+	v9 := flowBuf.Bytes()
+	exporter := netip.MustParseAddrPort("192.0.2.7:40000")
+	collector := netip.MustParseAddrPort("198.51.100.1:2055")
+	start := time.Unix(1700000000, 123456789)
+
+	var capture bytes.Buffer
+	pw, err := pcap.NewWriter(&capture, pcap.FormatPCAPNG)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	datagrams := []pcap.Datagram{
+		{Src: exporter, Dst: collector, Payload: v9},
+		{Src: exporter, Dst: collector, Payload: []byte("not a flow packet")},
+		{Src: netip.MustParseAddrPort("[2001:db8::7]:40001"), Dst: netip.MustParseAddrPort("[2001:db8::1]:4739"), Payload: v9},
+	}
+	for i, d := range datagrams {
+		frame, err := pcap.EncodeUDP(d)
+		if err != nil {
+			t.Fatalf("encode datagram %d: %v", i, err)
+		}
+		if err := pw.WriteFrame(start.Add(time.Duration(i)*time.Second), frame); err != nil {
+			t.Fatalf("write datagram %d: %v", i, err)
+		}
+	}
+	// An ARP frame, which carries no UDP datagram
+	arp := append(make([]byte, 12), 0x08, 0x06)
+	if err := pw.WriteFrame(start, append(arp, make([]byte, 28)...)); err != nil {
+		t.Fatalf("write ARP frame: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "flows.pcapng")
+	if err := os.WriteFile(path, capture.Bytes(), 0o600); err != nil {
+		t.Fatalf("write capture: %v", err)
+	}
+
+	dbdir := t.TempDir()
+	if err := RunPCAPCtx(context.Background(), path, dbdir, false); err != nil {
+		t.Fatalf("RunPCAPCtx: %v", err)
+	}
+	got := readEntries(t, dbdir)
+	want := []Entry{
+		{Received: start, Source: exporter.String(), Listener: collector.String(), Protocol: ProtocolNetFlowV9, Payload: v9},
+		{Received: start.Add(2 * time.Second), Source: "[2001:db8::7]:40001", Listener: "[2001:db8::1]:4739", Protocol: ProtocolNetFlowV9, Payload: v9},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got: %d records Want: %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Received.Equal(want[i].Received) || got[i].Source != want[i].Source || got[i].Listener != want[i].Listener ||
+			got[i].Protocol != want[i].Protocol || !bytes.Equal(got[i].Payload, want[i].Payload) {
+			t.Errorf("record %d Got: %+v Want: %+v", i+1, got[i], want[i])
+		}
+	}
+}
+
+// TestRunPCAPCtxInvalidFile tests that a missing or malformed capture is an error.
+func TestRunPCAPCtxInvalidFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pcap")
+	if err := os.WriteFile(garbage, bytes.Repeat([]byte{0xAB}, 64), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	for _, path := range []string{filepath.Join(dir, "missing.pcap"), garbage} {
+		if err := RunPCAPCtx(context.Background(), path, t.TempDir(), false); err == nil {
+			t.Errorf("RunPCAPCtx(%s): expected error, got nil", path)
+		}
+	}
+}
+
+// TestPCAPEndpoints tests the endpoints records are exported between.
+func TestPCAPEndpoints(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		entry    Entry
+		protocol string
+		src      string
+		dst      string
+	}{
+		{"recorded", Entry{Source: "192.0.2.7:40000", Listener: "198.51.100.1:9995"}, ProtocolNetFlowV9, "192.0.2.7:40000", "198.51.100.1:9995"},
+		{"no metadata", Entry{}, ProtocolIPFIX, "192.0.2.1:4739", "192.0.2.2:4739"},
+		{"wildcard listener", Entry{Source: "192.0.2.7:40000", Listener: "0.0.0.0:9995"}, ProtocolNetFlowV5, "192.0.2.7:40000", "192.0.2.2:9995"},
+		{"IPv6 exporter on IPv4 listener", Entry{Source: "[2001:db8::7]:40000", Listener: "127.0.0.1:9995"}, ProtocolSFlow, "[2001:db8::7]:40000", "[2001:db8::2]:9995"},
+		{"mapped exporter", Entry{Source: "[::ffff:192.0.2.7]:40000", Listener: "127.0.0.1:9995"}, ProtocolNetFlowV9, "192.0.2.7:40000", "127.0.0.1:9995"},
+		{"no listener", Entry{Source: "192.0.2.7:40000"}, ProtocolSFlow, "192.0.2.7:40000", "192.0.2.2:6343"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			src, dst := pcapEndpoints(tt.entry, tt.protocol)
+			if src.String() != tt.src || dst.String() != tt.dst {
+				t.Errorf("Got: %s -> %s Want: %s -> %s", src, dst, tt.src, tt.dst)
+			}
+		})
+	}
+}
+
+// TestExportPCAP tests that records are exported as UDP datagrams in key
+// order, in both capture formats.
+func TestExportPCAP(t *testing.T) {
+	t.Parallel()
+
+	session := netflow.NewSession()
+	flow := netflow.GenerateTemplateNetflow(100, session)
+	flowBuf := flow.ToBytes()
+	v9 := flowBuf.Bytes()
+	recorded, err := Entry{Received: time.Unix(1700000000, 5), Source: "192.0.2.7:40000", Listener: "198.51.100.1:2055", Protocol: ProtocolNetFlowV9, Payload: v9}.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal entry: %v", err)
+	}
+	// A bare payload, as written before records carried metadata
+	values := [][]byte{recorded, v9}
+	dbdir := t.TempDir()
+	db, err := badger.Open(badger.DefaultOptions(dbdir).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		for i, value := range values {
+			if err := txn.Set(binary.BigEndian.AppendUint32(nil, uint32(i+1)), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("write database: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close database: %v", err)
+	}
+
+	for _, format := range []string{pcap.FormatPCAP, pcap.FormatPCAPNG} {
+		var capture bytes.Buffer
+		count, err := ExportPCAP(context.Background(), dbdir, &capture, format)
+		if err != nil {
+			t.Fatalf("ExportPCAP(%s): %v", format, err)
+		}
+		if count != len(values) {
+			t.Errorf("%s Got: %d packets Want: %d", format, count, len(values))
+		}
+		r, err := pcap.NewReader(&capture)
+		if err != nil {
+			t.Fatalf("%s read header: %v", format, err)
+		}
+		want := []struct {
+			ts       time.Time
+			src, dst string
+		}{
+			{time.Unix(1700000000, 5), "192.0.2.7:40000", "198.51.100.1:2055"},
+			{time.Unix(0, 0), "192.0.2.1:2055", "192.0.2.2:2055"},
+		}
+		for i, w := range want {
+			frame, err := r.Next()
+			if err != nil {
+				t.Fatalf("%s packet %d: %v", format, i+1, err)
+			}
+			d, err := pcap.DecodeUDP(frame)
+			if err != nil {
+				t.Fatalf("%s packet %d: %v", format, i+1, err)
+			}
+			if !frame.Timestamp.Equal(w.ts) || d.Src.String() != w.src || d.Dst.String() != w.dst || !bytes.Equal(d.Payload, v9) {
+				t.Errorf("%s packet %d Got: %v %s -> %s Want: %v %s -> %s", format, i+1, frame.Timestamp, d.Src, d.Dst, w.ts, w.src, w.dst)
+			}
+		}
+		if _, err := r.Next(); !errors.Is(err, io.EOF) {
+			t.Errorf("%s Got: %v after the last packet Want: EOF", format, err)
+		}
+	}
+
+	// An unknown format is rejected before anything is written
+	var out bytes.Buffer
+	if _, err := ExportPCAP(context.Background(), dbdir, &out, "erf"); err == nil || out.Len() != 0 {
+		t.Errorf("ExportPCAP(erf): expected error and no output, got %v and %d bytes", err, out.Len())
+	}
+}
@@ -1,12 +1,14 @@
 // Use of this source code is governed by Apache License 2.0
 // that can be found in the LICENSE file.
 
-// Record is used to take netflow packets off the wire and store them in a badger db
+// Record is used to take netflow packets off the wire and store them in a badger db,
+// along with when and where each packet arrived
 
 package record
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -16,24 +18,23 @@ import (
 	"time"
 
 	badger "github.com/dgraph-io/badger/v3"
-	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/flowcheck"
 	"github.com/dmabry/flowgre/lifecycle"
-	"github.com/dmabry/flowgre/netflow"
 	"github.com/dmabry/flowgre/stats"
 	"golang.org/x/sync/errgroup"
 )
 
 const udpMaxBufferSize = 65507
 
-// netIngest is used to pull packets off the wire and put the byte payload on the data chan
-func netIngest(ctx context.Context, wg *sync.WaitGroup, ip string, port int, data chan<- []byte, verbose bool) {
+// netIngest is used to pull packets off the wire and put them on the data chan with their arrival metadata
+func netIngest(ctx context.Context, wg *sync.WaitGroup, ip string, port int, data chan<- Entry, verbose bool) {
 	defer wg.Done()
 	if err := runNetIngest(ctx, ip, port, data, verbose); err != nil {
 		log.Printf("Packet ingest error: %v", err)
 	}
 }
 
-func runNetIngest(ctx context.Context, ip string, port int, data chan<- []byte, verbose bool) error {
+func runNetIngest(ctx context.Context, ip string, port int, data chan<- Entry, verbose bool) error {
 	// Create UDP listener and setup db to catch files
 	listenIP := net.ParseIP(ip)
 	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: listenIP, Port: port})
@@ -42,6 +43,7 @@ func runNetIngest(ctx context.Context, ip string, port int, data chan<- []byte,
 	}
 	log.Printf("Listening on %s:%d", ip, port)
 	defer conn.Close()
+	listener := conn.LocalAddr().String()
 	stopCancelWakeup := context.AfterFunc(ctx, func() {
 		_ = conn.SetReadDeadline(time.Now())
 	})
@@ -59,7 +61,8 @@ func runNetIngest(ctx context.Context, ip string, port int, data chan<- []byte,
 			if err != nil {
 				return fmt.Errorf("set read deadline: %w", err)
 			}
-			length, fromIP, err := conn.ReadFromUDP(payload)
+			length, from, err := conn.ReadFromUDP(payload)
+			received := time.Now()
 			if err != nil {
 				if ctx.Err() != nil {
 					return nil
@@ -72,11 +75,12 @@ func runNetIngest(ctx context.Context, ip string, port int, data chan<- []byte,
 			}
 			payload = payload[:length]
 			if verbose {
-				log.Printf("Packet Received from %s with size of %d", fromIP.String(), length)
+				log.Printf("Packet Received from %s with size of %d", from.String(), length)
 			}
-			// Send payload to the data channel
+			entry := Entry{Received: received, Source: from.String(), Listener: listener, Payload: payload}
+			// Send the entry to the data channel
 			select {
-			case data <- payload:
+			case data <- entry:
 			case <-ctx.Done():
 				return nil
 			}
@@ -84,8 +88,8 @@ func runNetIngest(ctx context.Context, ip string, port int, data chan<- []byte,
 	}
 }
 
-// dbIngest pulls byte payload off the data chan and puts them in the badger db
-func dbIngest(ctx context.Context, wg *sync.WaitGroup, dbdir string, data <-chan []byte, verbose bool) {
+// dbIngest pulls entries off the data chan and puts them in the badger db
+func dbIngest(ctx context.Context, wg *sync.WaitGroup, dbdir string, data <-chan Entry, verbose bool) {
 	defer wg.Done()
 	if err := runDBIngest(ctx, dbdir, data, verbose); err != nil {
 		log.Printf("Database ingest error: %v", err)
@@ -121,25 +125,77 @@ func nextRecordID(db *badger.DB) (uint32, error) {
 	return next, nil
 }
 
-func runDBIngest(ctx context.Context, dbdir string, data <-chan []byte, verbose bool) (retErr error) {
-	// Create/Open DB for writing
+// Writer appends entries to a record database after the records already in
+// it, as record does. It is not safe for concurrent use.
+type Writer struct {
+	db     *badger.DB
+	nextID uint32
+	full   bool
+}
+
+// OpenWriter opens the record database in dbdir for appending, creating it if
+// it doesn't exist.
+func OpenWriter(dbdir string) (*Writer, error) {
 	options := badger.DefaultOptions(dbdir)
 	// Disable badger logging output
 	options.Logger = nil
 	db, err := badger.Open(options)
 	if err != nil {
-		return fmt.Errorf("open database %s: %w", dbdir, err)
+		return nil, fmt.Errorf("open database %s: %w", dbdir, err)
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			retErr = errors.Join(retErr, fmt.Errorf("close database: %w", err))
-		}
-	}()
-	log.Printf("Writing to database %s\n", dbdir)
 	nextID, err := nextRecordID(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Writer{db: db, nextID: nextID}, nil
+}
+
+// Write stores entry as the next record.
+func (w *Writer) Write(entry Entry) error {
+	if w.full {
+		return fmt.Errorf("record database key space exhausted")
+	}
+	value, err := entry.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("encode record %d: %w", w.nextID, err)
+	}
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, w.nextID)
+	err = w.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(key, value))
+	})
+	if err != nil {
+		return fmt.Errorf("write record %d: %w", w.nextID, err)
+	}
+	if w.nextID == ^uint32(0) {
+		w.full = true
+	} else {
+		w.nextID++
+	}
+	return nil
+}
+
+// Close closes the database.
+func (w *Writer) Close() error {
+	if err := w.db.Close(); err != nil {
+		return fmt.Errorf("close database: %w", err)
+	}
+	return nil
+}
+
+func runDBIngest(ctx context.Context, dbdir string, data <-chan Entry, verbose bool) (retErr error) {
+	// Create/Open DB for writing
+	w, err := OpenWriter(dbdir)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			retErr = errors.Join(retErr, err)
+		}
+	}()
+	log.Printf("Writing to database %s\n", dbdir)
 	// Start the loop
 	for {
 		// Check to see if context is done and return, otherwise pull payloads and write
@@ -147,34 +203,24 @@ func runDBIngest(ctx context.Context, dbdir string, data <-chan []byte, verbose
 		case <-ctx.Done():
 			log.Println("Database ingest exiting due to signal")
 			return nil
-		case payload, ok := <-data:
+		case entry, ok := <-data:
 			if !ok {
 				return nil
 			}
-			key := make([]byte, 4)
-			binary.BigEndian.PutUint32(key, nextID)
-			err := db.Update(func(txn *badger.Txn) error {
-				entry := badger.NewEntry(key, payload)
-				return txn.SetEntry(entry)
-			})
-			if err != nil {
-				return fmt.Errorf("write record %d: %w", nextID, err)
+			if err := w.Write(entry); err != nil {
+				return err
 			}
-			if nextID == ^uint32(0) {
-				return fmt.Errorf("record database key space exhausted")
-			}
-			nextID++
 		}
 	}
 }
 
-// parseFlow validates that the payload received is valid NetFlow v9 or IPFIX v10
-func parseFlow(ctx context.Context, wg *sync.WaitGroup, parseChan <-chan []byte, dataChan chan<- []byte, verbose bool) {
+// parseFlow validates that the payload received is valid NetFlow v5, v9, IPFIX v10 or sFlow v5
+func parseFlow(ctx context.Context, wg *sync.WaitGroup, parseChan <-chan Entry, dataChan chan<- Entry, verbose bool) {
 	defer wg.Done()
 	_ = runParseFlow(ctx, parseChan, dataChan, verbose)
 }
 
-func runParseFlow(ctx context.Context, parseChan <-chan []byte, dataChan chan<- []byte, verbose bool) error {
+func runParseFlow(ctx context.Context, parseChan <-chan Entry, dataChan chan<- Entry, verbose bool) error {
 	// Prep the loop
 	rStats := stats.RecordStat{
 		ValidCount:   0,
@@ -188,28 +234,27 @@ func runParseFlow(ctx context.Context, parseChan <-chan []byte, dataChan chan<-
 		case <-ctx.Done():
 			log.Println("Flow parser exiting due to signal")
 			return nil
-		case payload, ok := <-parseChan:
+		case entry, ok := <-parseChan:
 			if !ok {
+				log.Printf("Flow Packets: %d Ignored Packets: %d ",
+					rStats.LoadValid(), rStats.LoadInvalid())
 				return nil
 			}
-			// Decode first uint16 and see if it is a version 9 (NetFlow) or 10 (IPFIX)
-			ok, err := netflow.IsValidNetFlow(payload, 9)
+			// Decode the version and validate as NetFlow v5/v9, IPFIX v10 or sFlow v5
+			ok, err := flowcheck.IsValidFlow(entry.Payload)
 			if err != nil {
-				// Try IPFIX
-				ok, err = ipfix.IsValidIPFIX(payload)
-				if err != nil {
-					if verbose {
-						log.Printf("Skipping packet due to issue parsing: %v", err)
-					}
-					rStats.IncrInvalid()
-					continue
+				if verbose {
+					log.Printf("Skipping packet due to issue parsing: %v", err)
 				}
+				rStats.IncrInvalid()
+				continue
 			}
 			if ok {
-				// Valid NetFlow v9 or IPFIX v10 Packet send it on
+				// Valid NetFlow v5/v9, IPFIX v10 or sFlow v5 Packet send it on
 				rStats.IncrValid()
+				entry.Protocol = flowcheck.DetectProtocol(entry.Payload)
 				select {
-				case dataChan <- payload:
+				case dataChan <- entry:
 				case <-ctx.Done():
 					return nil
 				}
@@ -224,15 +269,23 @@ func runParseFlow(ctx context.Context, parseChan <-chan []byte, dataChan chan<-
 	}
 }
 
-// RunCtx starts the recording process with an external context.
+// RunCtx starts the recording process with an external context. Packets are
+// taken from UDP on ip:port, and IPFIX messages from TCP connections to it.
 // Cancelling ctx stops all workers cleanly. Use Run() for CLI usage
 // where OS signal handling is desired.
 func RunCtx(ctx context.Context, ip string, port int, dbdir string, verbose bool) error {
-	dataChan := make(chan []byte, 1024)
-	parseChan := make(chan []byte, 1024)
+	return RunTLSCtx(ctx, ip, port, dbdir, nil, verbose)
+}
+
+// RunTLSCtx records as RunCtx does, but when tlsConfig is set the TCP
+// connections carry IPFIX over TLS (RFC 7011 Section 11) instead.
+func RunTLSCtx(ctx context.Context, ip string, port int, dbdir string, tlsConfig *tls.Config, verbose bool) error {
+	dataChan := make(chan Entry, 1024)
+	parseChan := make(chan Entry, 1024)
 	eg, egCtx := errgroup.WithContext(ctx)
 
 	eg.Go(func() error { return runNetIngest(egCtx, ip, port, parseChan, verbose) })
+	eg.Go(func() error { return runTCPIngest(egCtx, ip, port, tlsConfig, parseChan, verbose) })
 	eg.Go(func() error { return runParseFlow(egCtx, parseChan, dataChan, verbose) })
 	eg.Go(func() error { return runDBIngest(egCtx, dbdir, dataChan, verbose) })
 	if err := eg.Wait(); err != nil {
@@ -23,7 +23,7 @@ func TestNetIngest(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	dataChan := make(chan []byte, 1024)
+	dataChan := make(chan Entry, 1024)
 	var wg sync.WaitGroup
 
 	// Bind to port 0 to get a free port, then pass it to netIngest
@@ -37,46 +37,41 @@ func TestNetIngest(t *testing.T) {
 	wg.Add(1)
 	go netIngest(ctx, &wg, "127.0.0.1", port, dataChan, false)
 
-	// Wait for the listener to be ready by probing the port
-	ready := make(chan struct{})
-	go func() {
-		for {
-			c, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: port})
-			if err == nil {
-				c.Close()
-				close(ready)
-				return
-			}
-			time.Sleep(10 * time.Millisecond)
-		}
-	}()
-	select {
-	case <-ready:
-	case <-time.After(5 * time.Second):
-		t.Fatal("Timeout waiting for listener to start")
-	}
-
-	// Send a test packet
 	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: port})
 	if err != nil {
 		t.Fatalf("Failed to dial: %v", err)
 	}
 	defer conn.Close()
 
+	// UDP has no handshake to tell when the listener is up, so resend the
+	// test packet until it is received
 	testPayload := []byte("test payload for record")
-	_, err = conn.Write(testPayload)
-	if err != nil {
-		t.Fatalf("Failed to send: %v", err)
-	}
-
-	// Wait for packet to be received
-	select {
-	case payload := <-dataChan:
-		if !bytes.Equal(payload, testPayload) {
-			t.Errorf("Received wrong payload: got %v, want %v", payload, testPayload)
+	before := time.Now()
+	var entry Entry
+	deadline := time.After(5 * time.Second)
+receive:
+	for {
+		// Writes fail with connection refused until the listener is bound
+		_, _ = conn.Write(testPayload)
+		select {
+		case entry = <-dataChan:
+			break receive
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Timeout waiting for packet")
 		}
-	case <-time.After(2 * time.Second):
-		t.Error("Timeout waiting for packet")
+	}
+	if !bytes.Equal(entry.Payload, testPayload) {
+		t.Errorf("Received wrong payload: got %v, want %v", entry.Payload, testPayload)
+	}
+	if entry.Source != conn.LocalAddr().String() {
+		t.Errorf("Received wrong source: got %s, want %s", entry.Source, conn.LocalAddr())
+	}
+	if entry.Listener != conn.RemoteAddr().String() {
+		t.Errorf("Received wrong listener: got %s, want %s", entry.Listener, conn.RemoteAddr())
+	}
+	if entry.Received.Before(before) || entry.Received.After(time.Now()) {
+		t.Errorf("Received time %v outside of the test", entry.Received)
 	}
 
 	// Cleanup
@@ -94,7 +89,7 @@ func TestDbIngest(t *testing.T) {
 
 	// Create a temporary directory for the test DB
 	tmpDir := t.TempDir()
-	dataChan := make(chan []byte, 1024)
+	dataChan := make(chan Entry, 1024)
 
 	done := make(chan struct{})
 	var wg sync.WaitGroup
@@ -104,9 +99,15 @@ func TestDbIngest(t *testing.T) {
 		dbIngest(ctx, &wg, tmpDir, dataChan, false)
 	}()
 
-	// Send test payload; dbIngest will process it once the DB is open
-	testPayload := []byte("test db ingest payload")
-	dataChan <- testPayload
+	// Send test entry; dbIngest will process it once the DB is open
+	want := Entry{
+		Received: time.Unix(1700000000, 123456789),
+		Source:   "192.0.2.1:2055",
+		Listener: "127.0.0.1:9995",
+		Protocol: ProtocolNetFlowV9,
+		Payload:  []byte("test db ingest payload"),
+	}
+	dataChan <- want
 
 	// Wait a bit for processing
 	time.Sleep(200 * time.Millisecond)
@@ -116,6 +117,33 @@ func TestDbIngest(t *testing.T) {
 	wg.Wait()
 	<-done
 	close(dataChan)
+
+	// The entry is stored with its metadata under the first key
+	db, err := badger.Open(badger.DefaultOptions(tmpDir).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer db.Close()
+	var got Entry
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte{0, 0, 0, 1})
+		if err != nil {
+			return err
+		}
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		got, err = UnmarshalEntry(value)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("read record 1: %v", err)
+	}
+	if !got.Received.Equal(want.Received) || got.Source != want.Source || got.Listener != want.Listener ||
+		got.Protocol != want.Protocol || !bytes.Equal(got.Payload, want.Payload) {
+		t.Errorf("stored entry = %+v, want %+v", got, want)
+	}
 }
 
 // TestParseFlow tests that valid NetFlow and IPFIX packets are accepted and invalid ones rejected.
@@ -125,15 +153,15 @@ func TestParseFlow(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	parseChan := make(chan []byte, 1024)
-	dataChan := make(chan []byte, 1024)
+	parseChan := make(chan Entry, 1024)
+	dataChan := make(chan Entry, 1024)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go parseFlow(ctx, &wg, parseChan, dataChan, false)
 
 	// Send invalid payload (not NetFlow)
-	parseChan <- []byte("invalid")
+	parseChan <- Entry{Payload: []byte("invalid")}
 
 	// Wait a bit for processing
 	time.Sleep(100 * time.Millisecond)
@@ -142,12 +170,15 @@ func TestParseFlow(t *testing.T) {
 	session := netflow.NewSession()
 	flow := netflow.GenerateTemplateNetflow(100, session)
 	buf := flow.ToBytes()
-	parseChan <- buf.Bytes()
+	parseChan <- Entry{Payload: buf.Bytes()}
 
 	// Wait for processing
 	select {
-	case <-dataChan:
-		// Good, valid packet was forwarded
+	case entry := <-dataChan:
+		// Good, valid packet was forwarded with its protocol
+		if entry.Protocol != ProtocolNetFlowV9 {
+			t.Errorf("forwarded protocol = %q, want %q", entry.Protocol, ProtocolNetFlowV9)
+		}
 	case <-time.After(2 * time.Second):
 		t.Error("Timeout waiting for valid packet to be forwarded")
 	}
@@ -169,8 +200,8 @@ func TestParseFlow_MalformedNetFlow(t *testing.T) {
 
 	var wg sync.WaitGroup
 
-	parseChan := make(chan []byte, 1024)
-	dataChan := make(chan []byte, 1024)
+	parseChan := make(chan Entry, 1024)
+	dataChan := make(chan Entry, 1024)
 
 	done := make(chan struct{})
 	wg.Add(1)
@@ -199,7 +230,7 @@ func TestParseFlow_MalformedNetFlow(t *testing.T) {
 	}
 
 	// Send malformed packet — it should not appear on dataChan
-	parseChan <- malformed
+	parseChan <- Entry{Payload: malformed}
 
 	select {
 	case <-dataChan:
@@ -212,7 +243,7 @@ func TestParseFlow_MalformedNetFlow(t *testing.T) {
 	session := netflow.NewSession()
 	flow := netflow.GenerateTemplateNetflow(100, session)
 	flowBuf := flow.ToBytes()
-	parseChan <- flowBuf.Bytes()
+	parseChan <- Entry{Payload: flowBuf.Bytes()}
 
 	select {
 	case <-dataChan:
@@ -241,8 +272,8 @@ func TestRunIntegration(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	dataChan := make(chan []byte, 1024)
-	parseChan := make(chan []byte, 1024)
+	dataChan := make(chan Entry, 1024)
+	parseChan := make(chan Entry, 1024)
 	var wg sync.WaitGroup
 
 	// Bind to port 0 to get a free port
@@ -315,7 +346,7 @@ func TestNetIngestContextCancellation(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	dataChan := make(chan []byte, 1024)
+	dataChan := make(chan Entry, 1024)
 	var wg sync.WaitGroup
 
 	// Bind to port 0 to get a free port
@@ -357,7 +388,7 @@ func TestDbIngestContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	tmpDir := t.TempDir()
-	dataChan := make(chan []byte, 1024)
+	dataChan := make(chan Entry, 1024)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
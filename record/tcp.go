@@ -0,0 +1,129 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package record
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dmabry/flowgre/ipfix"
+)
+
+// runTCPIngest accepts IPFIX over TCP (RFC 7011 Section 10.4), or over TLS
+// when tlsConfig is set, on ip:port and puts each message on the data chan as
+// UDP ingest does with datagrams. Each connection is read by its own
+// goroutine until it closes or ctx is done.
+func runTCPIngest(ctx context.Context, ip string, port int, tlsConfig *tls.Config, data chan<- Entry, verbose bool) error {
+	var ln net.Listener
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP(ip), Port: port})
+	if err != nil {
+		return fmt.Errorf("listen on %s:%d/tcp: %w", ip, port, err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+		log.Printf("Listening on %s:%d/tcp for IPFIX over TLS", ip, port)
+	} else {
+		log.Printf("Listening on %s:%d/tcp for IPFIX", ip, port)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	conns := make(map[net.Conn]struct{})
+	stop := context.AfterFunc(ctx, func() {
+		_ = ln.Close()
+	})
+	// Closing the connections unblocks their readers
+	defer func() {
+		stop()
+		_ = ln.Close()
+		mu.Lock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Println("TCP ingest exiting due to signal")
+				return nil
+			}
+			return fmt.Errorf("accept TCP connection: %w", err)
+		}
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(conns, conn)
+				mu.Unlock()
+				_ = conn.Close()
+			}()
+			if verbose {
+				log.Printf("IPFIX connection from %s", conn.RemoteAddr())
+			}
+			err := readIPFIXStream(ctx, conn, data, verbose)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("IPFIX connection from %s: %v", conn.RemoteAddr(), err)
+			} else if verbose {
+				log.Printf("IPFIX connection from %s closed", conn.RemoteAddr())
+			}
+		}()
+	}
+}
+
+// readIPFIXStream splits the stream of conn into IPFIX messages by the length
+// in each message header. It returns nil once the peer closes the connection
+// between messages.
+func readIPFIXStream(ctx context.Context, conn net.Conn, data chan<- Entry, verbose bool) error {
+	source := conn.RemoteAddr().String()
+	listener := conn.LocalAddr().String()
+	r := bufio.NewReader(conn)
+	for {
+		header := make([]byte, ipfix.HeaderSize)
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("read message header: %w", err)
+		}
+		if version := binary.BigEndian.Uint16(header[0:2]); version != ipfix.Version {
+			return fmt.Errorf("unexpected version %d on IPFIX stream", version)
+		}
+		length := int(binary.BigEndian.Uint16(header[2:4]))
+		if length < ipfix.HeaderSize {
+			return fmt.Errorf("message length %d shorter than its header", length)
+		}
+		payload := make([]byte, length)
+		copy(payload, header)
+		if _, err := io.ReadFull(r, payload[ipfix.HeaderSize:]); err != nil {
+			return fmt.Errorf("read message body: %w", err)
+		}
+		received := time.Now()
+		if verbose {
+			log.Printf("Packet Received from %s with size of %d", source, length)
+		}
+		entry := Entry{Received: received, Source: source, Listener: listener, Payload: payload}
+		select {
+		case data <- entry:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package record
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dmabry/flowgre/ipfix"
+)
+
+// TestTCPIngest tests that IPFIX messages sent back to back on a TCP
+// connection are split apart and put on the data chan with their addresses.
+func TestTCPIngest(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	probe, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+	port := probe.Addr().(*net.TCPAddr).Port
+	probe.Close()
+
+	dataChan := make(chan Entry, 16)
+	done := make(chan error, 1)
+	go func() { done <- runTCPIngest(ctx, "127.0.0.1", port, nil, dataChan, false) }()
+
+	// Dial until the listener is up
+	var conn net.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for conn == nil {
+		conn, err = net.Dial("tcp", probe.Addr().String())
+		if err != nil {
+			if time.Now().After(deadline) {
+				t.Fatalf("Failed to dial: %v", err)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	defer conn.Close()
+
+	seq := ipfix.NewIPFIXSequence()
+	template := ipfix.GenerateTemplateIPFIX(100, seq)
+	tmplBuf, err := template.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	tmpl := tmplBuf.Bytes()
+	data, err := ipfix.GenerateDataIPFIX(3, 100, "10.0.0.0/8", "10.0.0.0/8", 2055, seq)
+	if err != nil {
+		t.Fatalf("GenerateDataIPFIX failed: %v", err)
+	}
+	buf, err := data.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	dataBuf := buf.Bytes()
+	// Split the writes off the message boundaries
+	stream := append(append([]byte{}, tmpl...), dataBuf...)
+	for _, part := range [][]byte{stream[:5], stream[5 : len(tmpl)+3], stream[len(tmpl)+3:]} {
+		if _, err := conn.Write(part); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, want := range [][]byte{tmpl, dataBuf} {
+		select {
+		case entry := <-dataChan:
+			if !bytes.Equal(entry.Payload, want) {
+				t.Errorf("Got: %x Want: %x", entry.Payload, want)
+			}
+			if entry.Source != conn.LocalAddr().String() {
+				t.Errorf("Got: source %s Want: %s", entry.Source, conn.LocalAddr())
+			}
+			if entry.Listener != conn.RemoteAddr().String() {
+				t.Errorf("Got: listener %s Want: %s", entry.Listener, conn.RemoteAddr())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for message")
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Got: %v Want: nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for TCP ingest to exit")
+	}
+}
+
+// selfSignedTLS returns a server tls.Config with a self-signed certificate
+// for 127.0.0.1 and a client tls.Config trusting it.
+func selfSignedTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "record test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: pool}
+}
+
+// TestTCPIngestTLS tests that IPFIX messages are taken from TLS connections
+// when the listener has a TLS config.
+func TestTCPIngestTLS(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	probe, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+	addr := probe.Addr().String()
+	probe.Close()
+
+	serverTLS, clientTLS := selfSignedTLS(t)
+	dataChan := make(chan Entry, 16)
+	go func() {
+		_ = runTCPIngest(ctx, "127.0.0.1", probe.Addr().(*net.TCPAddr).Port, serverTLS, dataChan, false)
+	}()
+
+	// Dial until the listener is up
+	var conn *tls.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for conn == nil {
+		conn, err = tls.Dial("tcp", addr, clientTLS)
+		if err != nil {
+			if time.Now().After(deadline) {
+				t.Fatalf("Failed to dial: %v", err)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	defer conn.Close()
+
+	template := ipfix.GenerateTemplateIPFIX(100, ipfix.NewIPFIXSequence())
+	buf, err := template.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	select {
+	case entry := <-dataChan:
+		if !bytes.Equal(entry.Payload, buf.Bytes()) {
+			t.Errorf("Got: %x Want: %x", entry.Payload, buf.Bytes())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+}
+
+// TestReadIPFIXStreamRejectsOtherVersions tests that a connection carrying
+// something other than IPFIX is given up on.
+func TestReadIPFIXStreamRejectsOtherVersions(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		_, _ = client.Write([]byte{0, 9, 0, 16, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	}()
+	err := readIPFIXStream(context.Background(), server, make(chan Entry, 1), false)
+	if err == nil {
+		t.Fatal("expected an error for a NetFlow v9 header")
+	}
+}
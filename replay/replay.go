@@ -1,23 +1,31 @@
 // Use of this source code is governed by Apache License 2.0
 // that can be found in the LICENSE file.
 
-// Replay is used to send netflow packets recorded off the wire and stored in a db at a specified target
+// Replay is used to send netflow packets recorded off the wire and stored in a db, or read from a
+// capture file, at a specified target
 
 package replay
 
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
-	"net"
+	"math"
+	"net/netip"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	badger "github.com/dgraph-io/badger/v3"
-	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/anonymize"
+	"github.com/dmabry/flowgre/flowcheck"
 	"github.com/dmabry/flowgre/lifecycle"
-	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/record"
+	"github.com/dmabry/flowgre/transport"
 	"github.com/dmabry/flowgre/utils"
 	"golang.org/x/sync/errgroup"
 )
@@ -31,38 +39,175 @@ func netflowVersion(payload []byte) uint16 {
 	return binary.BigEndian.Uint16(payload[0:2])
 }
 
-// updateTimestamp updates the timestamp in a flow packet, dispatching to the
-// correct protocol-specific updater based on the version field.
-func updateTimestamp(payload []byte) ([]byte, error) {
-	version := netflowVersion(payload)
-	switch version {
-	case 9:
-		return netflow.UpdateTimeStamp(payload)
-	case 10:
-		return ipfix.UpdateTimeStamp(payload)
+// Timing modes.
+const (
+	TimingFixed    = "fixed"    // wait Options.Delay between packets on each worker
+	TimingOriginal = "original" // reproduce the recorded inter-arrival gaps, scaled by Options.Speed
+	TimingFast     = "fast"     // send as fast as possible
+)
+
+// Options configures a replay.
+type Options struct {
+	Server   string
+	Port     int
+	Delay    int // milliseconds between packets per worker with TimingFixed
+	DBDir    string
+	Loop     bool
+	Workers  int
+	UpdateTS bool
+	Verbose  bool
+	Timing   string  // TimingFixed, TimingOriginal or TimingFast; "" is TimingFixed
+	Speed    float64 // TimingOriginal speed multiplier; 2 replays twice as fast, 0 is 1
+	Renumber bool    // renumber sequences continuously per stream, across loop passes
+	Domains  DomainMap
+	// Anonymizer, when set, rewrites addresses, ports and AS numbers. Packets
+	// it can't rewrite, sFlow or data without a recorded template, are dropped.
+	Anonymizer *anonymize.Anonymizer
+	// PCAP, when set, replays the flow datagrams of this pcap or pcapng
+	// capture file instead of the database in DBDir.
+	PCAP string
+	// FilterPort and FilterSource, when set, only replay packets sent to this
+	// UDP port or from an exporter in this prefix. Records without arrival
+	// metadata never match.
+	FilterPort   int
+	FilterSource netip.Prefix
+	// Dialer opens the Transport each worker sends over. Nil sends over UDP.
+	Dialer transport.Dialer
+}
+
+// matches reports whether entry passes the FilterPort and FilterSource filters.
+func (o Options) matches(entry record.Entry) bool {
+	if o.FilterPort != 0 {
+		listener, err := netip.ParseAddrPort(entry.Listener)
+		if err != nil || int(listener.Port()) != o.FilterPort {
+			return false
+		}
+	}
+	if o.FilterSource.IsValid() {
+		source, err := netip.ParseAddrPort(entry.Source)
+		if err != nil || !o.FilterSource.Contains(source.Addr().Unmap()) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSourceFilter parses an exporter address or CIDR prefix to filter
+// replayed packets by. An empty filter is the zero Prefix, matching all.
+func ParseSourceFilter(s string) (netip.Prefix, error) {
+	if s == "" {
+		return netip.Prefix{}, nil
+	}
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid source filter %q: expected an IP address or CIDR prefix", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ParseSpeed parses a speed multiplier such as "2", "0.5x" or "10x".
+func ParseSpeed(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "x"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid speed %q: expected a multiplier such as 0.5x, 2x or 10x", s)
+	}
+	if v <= 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("speed must be positive, got %q", s)
+	}
+	return v, nil
+}
+
+// exporterOf returns the key packets are sharded across workers by, so
+// packets from one exporter always go out in order through one worker. It is
+// the recorded exporter address, or for records without arrival metadata the
+// source ID or observation domain in the packet header.
+func exporterOf(entry record.Entry) string {
+	if entry.Source != "" {
+		return entry.Source
+	}
+	payload := entry.Payload
+	switch {
+	case entry.Protocol == record.ProtocolNetFlowV9 && len(payload) >= 20:
+		return fmt.Sprintf("v9/%d", binary.BigEndian.Uint32(payload[16:20]))
+	case entry.Protocol == record.ProtocolIPFIX && len(payload) >= 16:
+		return fmt.Sprintf("ipfix/%d", binary.BigEndian.Uint32(payload[12:16]))
 	default:
-		return nil, fmt.Errorf("unsupported flow version %d for timestamp update", version)
+		return entry.Protocol
+	}
+}
+
+// shardOf returns the worker index, in [0, n), that sends packets of exporter.
+func shardOf(exporter string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(exporter))
+	return int(h.Sum32() % uint32(n))
+}
+
+// pacer holds packets back so they leave with the gaps they were recorded
+// with, divided by speed. Gaps are measured from the first packet of the pass
+// rather than the previous one, so send delays don't accumulate into drift.
+type pacer struct {
+	speed float64
+	first time.Time // arrival time of the first paced packet
+	start time.Time // when the first paced packet was sent
+}
+
+// wait blocks until the packet received at received is due. Packets without
+// an arrival time, or due already, return immediately. It returns false if
+// ctx is cancelled first.
+func (p *pacer) wait(ctx context.Context, received time.Time) bool {
+	if received.IsZero() {
+		return true
+	}
+	if p.first.IsZero() {
+		p.first, p.start = received, time.Now()
+		return true
+	}
+	offset := time.Duration(float64(received.Sub(p.first)) / p.speed)
+	d := time.Until(p.start.Add(offset))
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
-// Worker is the goroutine used to create workers
-func worker(id int, ctx context.Context, server string, port int, delay int, loop bool, dataChan <-chan []byte) error {
-	limiter := time.NewTicker(time.Millisecond * time.Duration(delay))
-	defer limiter.Stop()
+// Worker is the goroutine used to create workers. A delay of 0 sends packets
+// as soon as they arrive on dataChan.
+func worker(id int, ctx context.Context, dial transport.Dialer, server string, port int, delay int, loop bool, dataChan <-chan []byte) error {
+	var limit <-chan time.Time
+	if delay > 0 {
+		limiter := time.NewTicker(time.Millisecond * time.Duration(delay))
+		defer limiter.Stop()
+		limit = limiter.C
+	}
 
 	srcPort, err := utils.RandomNum(10000, 15000)
 	if err != nil {
 		return fmt.Errorf("replay worker %d generate source port: %w", id, err)
 	}
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: srcPort})
+	t, err := dial.Dial(server, port, srcPort)
 	if err != nil {
-		return fmt.Errorf("replay worker %d listen: %w", id, err)
+		return fmt.Errorf("replay worker %d: %w", id, err)
 	}
-	defer conn.Close()
+	defer t.Close()
 
-	destIP := net.ParseIP(server)
-	log.Printf("Worker [%2d] Slinging packets at %s:%d with delay of %dms \n",
-		id, server, port, delay)
+	if delay > 0 {
+		log.Printf("Worker [%2d] Slinging packets at %s:%d with delay of %dms \n",
+			id, server, port, delay)
+	} else {
+		log.Printf("Worker [%2d] Slinging packets at %s:%d without delay \n", id, server, port)
+	}
 
 	for {
 		select {
@@ -76,12 +221,15 @@ func worker(id int, ctx context.Context, server string, port int, delay int, loo
 			}
 			length := len(payload)
 			log.Printf("Worker [%2d] sending packet with length: %d\n", id, length)
-			_, err = utils.SendPacket(conn, &net.UDPAddr{IP: destIP, Port: port}, payload, false)
+			_, err = t.Send(payload)
 			if err != nil {
 				return fmt.Errorf("replay worker %d send: %w", id, err)
 			}
+			if limit == nil {
+				continue
+			}
 			select {
-			case <-limiter.C:
+			case <-limit:
 			case <-ctx.Done():
 				return nil
 			}
@@ -89,69 +237,87 @@ func worker(id int, ctx context.Context, server string, port int, delay int, loo
 	}
 }
 
-// dbReader pulls byte payload out of the database and puts it on the data chan.
-// In non-loop mode, it closes dataChan after the final pass to signal workers.
-func dbReader(ctx context.Context, dbdir string, dataChan chan<- []byte, loop bool, updateTS bool, verbose bool) error {
-	if !loop {
-		defer close(dataChan)
-	}
+// errStopped stops a pass when the context is cancelled.
+var errStopped = errors.New("reader stopped")
 
-	options := badger.DefaultOptions(dbdir)
-	options.Logger = nil
-	db, err := badger.Open(options)
-	if err != nil {
-		return fmt.Errorf("open DB %s: %w", dbdir, err)
-	}
-	defer db.Close()
-	log.Printf("Reading from database %s\n", dbdir)
+// passFunc reads one pass over the packets to replay, calling send with each
+// in order and returning the first error send returns.
+type passFunc func(send func(record.Entry) error) error
 
-	count := 0
-	itOptions := badger.DefaultIteratorOptions
-	itOptions.PrefetchSize = runtime.GOMAXPROCS(0)
+// readPasses puts the packets of each pass on the data chan of the worker
+// that owns their exporter, repeating passes with Options.Loop. With
+// TimingOriginal it holds each packet back until it is due. name prefixes
+// its log lines.
+func readPasses(ctx context.Context, opts Options, dataChans []chan []byte, name string, pass passFunc) error {
+	speed := opts.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	warnedUntimed := false
+	rw := newRewriter(opts)
+	count, dropped, filtered := 0, 0, 0
 	for {
 		recordsThisPass := 0
+		pace := &pacer{speed: speed}
 		select {
 		case <-ctx.Done():
-			log.Println("DB Reader exiting due to signal")
+			log.Printf("%s exiting due to signal\n", name)
 			return nil
 		default:
-			err = db.View(func(txn *badger.Txn) error {
-				it := txn.NewIterator(itOptions)
-				defer it.Close()
-				for it.Rewind(); it.Valid(); it.Next() {
-					select {
-					case <-ctx.Done():
-						log.Println("DB Reader exiting due to signal, finishing read")
-						return nil
-					default:
-						item := it.Item()
-						value, verr := item.ValueCopy(nil)
-						if verr != nil {
-							return fmt.Errorf("read value: %w", verr)
-						}
-						if updateTS {
-							newValue, verr := updateTimestamp(value)
-							if verr != nil {
-								return fmt.Errorf("update timestamp: %w", verr)
-							}
-							value = newValue
-						}
-						select {
-						case dataChan <- value:
-						case <-ctx.Done():
-							return nil
-						}
-						count++
-						recordsThisPass++
+		}
+		err := pass(func(entry record.Entry) error {
+			select {
+			case <-ctx.Done():
+				log.Printf("%s exiting due to signal, finishing read\n", name)
+				return errStopped
+			default:
+			}
+			if !opts.matches(entry) {
+				filtered++
+				return nil
+			}
+			if opts.Timing == TimingOriginal {
+				if entry.Received.IsZero() && !warnedUntimed {
+					log.Printf("%s found records without arrival times, sending them without delay\n", name)
+					warnedUntimed = true
+				}
+				if !pace.wait(ctx, entry.Received) {
+					return errStopped
+				}
+			}
+			exporter := exporterOf(entry)
+			shard := shardOf(exporter, len(dataChans))
+			value := entry.Payload
+			if rw != nil {
+				newValue, err := rw.rewrite(exporter, shard, value)
+				if errors.Is(err, anonymize.ErrUnsupported) || errors.Is(err, anonymize.ErrMissingTemplate) {
+					if opts.Verbose {
+						log.Printf("%s dropping packet from %s: %v\n", name, exporter, err)
 					}
+					dropped++
+					return nil
 				}
-				return nil
-			})
-			if err != nil {
-				return fmt.Errorf("DB view: %w", err)
+				if err != nil {
+					return fmt.Errorf("rewrite packet: %w", err)
+				}
+				value = newValue
+			}
+			select {
+			case dataChans[shard] <- value:
+			case <-ctx.Done():
+				return errStopped
 			}
+			count++
+			recordsThisPass++
+			return nil
+		})
+		if errors.Is(err, errStopped) {
+			return nil
 		}
-		if !loop {
+		if err != nil {
+			return err
+		}
+		if !opts.Loop {
 			break
 		}
 		if recordsThisPass == 0 {
@@ -166,26 +332,133 @@ func dbReader(ctx context.Context, dbdir string, dataChan chan<- []byte, loop bo
 			}
 		}
 	}
-	log.Printf("DB Reader read %d payloads from the database\n", count)
+	log.Printf("%s read %d payloads\n", name, count)
+	if filtered > 0 {
+		log.Printf("%s skipped %d packets not matching the port or source filter\n", name, filtered)
+	}
+	if rw != nil && rw.missing > 0 {
+		log.Printf("%s could not retime or renumber %d data sets: their template was not recorded before them\n", name, rw.missing)
+	}
+	if dropped > 0 {
+		log.Printf("%s dropped %d packets whose addresses could not be rewritten\n", name, dropped)
+	}
 	return nil
 }
 
+// dbReader pulls byte payload out of the database and puts it on the data
+// chan of the worker that owns its exporter. In non-loop mode, it closes
+// dataChans after the final pass to signal workers.
+func dbReader(ctx context.Context, opts Options, dataChans []chan []byte) error {
+	if !opts.Loop {
+		defer closeAll(dataChans)
+	}
+
+	options := badger.DefaultOptions(opts.DBDir)
+	options.Logger = nil
+	db, err := badger.Open(options)
+	if err != nil {
+		return fmt.Errorf("open DB %s: %w", opts.DBDir, err)
+	}
+	defer db.Close()
+	log.Printf("Reading from database %s\n", opts.DBDir)
+
+	itOptions := badger.DefaultIteratorOptions
+	itOptions.PrefetchSize = runtime.GOMAXPROCS(0)
+	return readPasses(ctx, opts, dataChans, "DB Reader", func(send func(record.Entry) error) error {
+		err := db.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(itOptions)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				stored, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return fmt.Errorf("read value: %w", err)
+				}
+				entry, err := record.UnmarshalEntry(stored)
+				if err != nil {
+					return fmt.Errorf("decode record: %w", err)
+				}
+				if err := send(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopped) {
+			return fmt.Errorf("DB view: %w", err)
+		}
+		return err
+	})
+}
+
+// pcapReader puts the NetFlow, IPFIX and sFlow datagrams of a capture file on
+// the data chan of the worker that owns their exporter, as dbReader does for
+// a database. Other UDP datagrams are ignored.
+func pcapReader(ctx context.Context, opts Options, dataChans []chan []byte) error {
+	if !opts.Loop {
+		defer closeAll(dataChans)
+	}
+
+	ignored := 0
+	err := readPasses(ctx, opts, dataChans, "PCAP Reader", func(send func(record.Entry) error) error {
+		return record.ReadPCAP(opts.PCAP, opts.Verbose, func(entry record.Entry) error {
+			if ok, err := flowcheck.IsValidFlow(entry.Payload); !ok {
+				if opts.Verbose {
+					log.Printf("PCAP Reader ignoring datagram from %s: not a valid flow packet: %v\n", entry.Source, err)
+				}
+				ignored++
+				return nil
+			}
+			entry.Protocol = flowcheck.DetectProtocol(entry.Payload)
+			return send(entry)
+		})
+	})
+	if ignored > 0 {
+		log.Printf("PCAP Reader ignored %d datagrams that aren't NetFlow, IPFIX or sFlow\n", ignored)
+	}
+	return err
+}
+
+// closeAll closes the data chans to signal workers that reading is done.
+func closeAll(dataChans []chan []byte) {
+	for _, c := range dataChans {
+		close(c)
+	}
+}
+
 // RunCtx replays netflow packets from a db with an external context.
 // Cancelling ctx stops all workers cleanly. In non-loop mode, the function
 // returns when all packets have been sent. Use Run() for CLI usage where
 // OS signal handling is desired.
-func RunCtx(ctx context.Context, server string, port int, delay int, dbdir string, loop bool, workers int, updateTS bool, verbose bool) error {
-	dataChan := make(chan []byte, 1024)
+//
+// Packets are sharded across workers by exporter, so each exporter's packets
+// are sent in the order they were recorded whatever the number of workers.
+func RunCtx(ctx context.Context, opts Options) error {
+	// Workers only rate limit with fixed timing; otherwise the reader paces
+	delay := 0
+	if opts.Timing == TimingFixed || opts.Timing == "" {
+		delay = opts.Delay
+	}
+	dial := opts.Dialer
+	if dial == nil {
+		dial = transport.Network{}
+	}
+	dataChans := make([]chan []byte, opts.Workers)
+	for i := range dataChans {
+		dataChans[i] = make(chan []byte, 1024)
+	}
 
 	eg, egCtx := errgroup.WithContext(ctx)
 
 	eg.Go(func() error {
-		return dbReader(egCtx, dbdir, dataChan, loop, updateTS, verbose)
+		if opts.PCAP != "" {
+			return pcapReader(egCtx, opts, dataChans)
+		}
+		return dbReader(egCtx, opts, dataChans)
 	})
 
-	for w := 1; w <= workers; w++ {
+	for w := 1; w <= opts.Workers; w++ {
 		eg.Go(func() error {
-			return worker(w, egCtx, server, port, delay, loop, dataChan)
+			return worker(w, egCtx, dial, opts.Server, opts.Port, delay, opts.Loop, dataChans[w-1])
 		})
 	}
 
@@ -202,13 +475,13 @@ func RunCtx(ctx context.Context, server string, port int, delay int, dbdir strin
 // Run Replay. Kicks off the replay of netflow packets from a db.
 // It sets up OS signal handling (SIGINT/SIGTERM) for clean shutdown.
 // Use RunCtx() when you need to control the lifecycle via context.
-func Run(server string, port int, delay int, dbdir string, loop bool, workers int, updateTS bool, verbose bool) {
+func Run(opts Options) {
 	mgr := lifecycle.New()
 	defer mgr.Cancel()
 
 	_ = mgr.SetupSignalHandler()
 
-	if err := RunCtx(mgr.Context(), server, port, delay, dbdir, loop, workers, updateTS, verbose); err != nil {
+	if err := RunCtx(mgr.Context(), opts); err != nil {
 		log.Printf("Replay error: %v", err)
 	}
 }
@@ -7,14 +7,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"fmt"
 	"net"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	badger "github.com/dgraph-io/badger/v3"
 	"github.com/dmabry/flowgre/ipfix"
 	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/pcap"
+	"github.com/dmabry/flowgre/record"
+	"github.com/dmabry/flowgre/transport"
 	"github.com/dmabry/flowgre/utils"
 )
 
@@ -66,7 +74,7 @@ func TestWorker(t *testing.T) {
 	// Start worker
 	done := make(chan struct{})
 	go func() {
-		worker(1, ctx, "127.0.0.1", port, 100, false, dataChan)
+		worker(1, ctx, transport.Network{}, "127.0.0.1", port, 100, false, dataChan)
 		close(done)
 	}()
 
@@ -119,7 +127,7 @@ func TestDbReader(t *testing.T) {
 	// Now read from the DB
 	done := make(chan struct{})
 	go func() {
-		dbReader(ctx, tmpDir, dataChan, false, false, false)
+		dbReader(ctx, Options{DBDir: tmpDir}, []chan []byte{dataChan})
 		close(done)
 	}()
 
@@ -139,6 +147,382 @@ func TestDbReader(t *testing.T) {
 	// dataChan is closed by dbReader in non-loop mode
 }
 
+// TestDbReaderEnvelope tests that dbReader sends the payload of records
+// stored with their arrival metadata.
+func TestDbReaderEnvelope(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tmpDir := t.TempDir()
+	dataChan := make(chan []byte, 1024)
+
+	options := badger.DefaultOptions(tmpDir)
+	options.Logger = nil
+	db, err := badger.Open(options)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	testPayload := []byte("test enveloped payload")
+	value, err := record.Entry{Received: time.Now(), Source: "192.0.2.1:2055", Payload: testPayload}.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to encode entry: %v", err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte{0, 0, 0, 1}, value))
+	})
+	if err != nil {
+		t.Fatalf("Failed to write to DB: %v", err)
+	}
+	db.Close()
+
+	done := make(chan struct{})
+	go func() {
+		dbReader(ctx, Options{DBDir: tmpDir}, []chan []byte{dataChan})
+		close(done)
+	}()
+
+	select {
+	case payload := <-dataChan:
+		if !bytes.Equal(payload, testPayload) {
+			t.Errorf("Received wrong payload: got %q, want %q", payload, testPayload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Timeout waiting for payload")
+	}
+
+	cancel()
+	<-done
+}
+
+// writeEntries stores entries in a new database under keys counting from 1,
+// the way record does, and returns its directory.
+func writeEntries(t *testing.T, entries []record.Entry) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	options := badger.DefaultOptions(tmpDir)
+	options.Logger = nil
+	db, err := badger.Open(options)
+	if err != nil {
+		t.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+	err = db.Update(func(txn *badger.Txn) error {
+		for i, entry := range entries {
+			value, err := entry.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(i+1))
+			if err := txn.Set(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to write to DB: %v", err)
+	}
+	return tmpDir
+}
+
+// TestDbReaderShardsByExporter tests that every packet of an exporter goes to
+// the same worker, in recorded order.
+func TestDbReaderShardsByExporter(t *testing.T) {
+	t.Parallel()
+
+	exporters := []string{"192.0.2.1:2055", "192.0.2.2:2055", "192.0.2.3:2055", "192.0.2.4:2055"}
+	var entries []record.Entry
+	for i := range 40 {
+		source := exporters[i%len(exporters)]
+		entries = append(entries, record.Entry{Source: source, Payload: []byte(fmt.Sprintf("%s/%02d", source, i))})
+	}
+	tmpDir := writeEntries(t, entries)
+
+	dataChans := make([]chan []byte, 3)
+	for i := range dataChans {
+		dataChans[i] = make(chan []byte, len(entries))
+	}
+	if err := dbReader(context.Background(), Options{DBDir: tmpDir, Timing: TimingFast}, dataChans); err != nil {
+		t.Fatalf("dbReader: %v", err)
+	}
+
+	shardOfExporter := make(map[string]int)
+	last := make(map[string]string)
+	for shard, c := range dataChans {
+		for payload := range c {
+			source, _, _ := strings.Cut(string(payload), "/")
+			if s, ok := shardOfExporter[source]; ok && s != shard {
+				t.Errorf("Got: %s on workers %d and %d Want: one worker", source, s, shard)
+			}
+			shardOfExporter[source] = shard
+			if string(payload) < last[source] {
+				t.Errorf("Got: %s after %s Want: recorded order", payload, last[source])
+			}
+			last[source] = string(payload)
+		}
+	}
+	if len(shardOfExporter) != len(exporters) {
+		t.Errorf("Got: %d exporters Want: %d", len(shardOfExporter), len(exporters))
+	}
+}
+
+// TestDbReaderOriginalTiming tests that TimingOriginal reproduces the
+// recorded gaps, scaled by the speed multiplier.
+func TestDbReaderOriginalTiming(t *testing.T) {
+	t.Parallel()
+
+	base := time.Unix(1700000000, 0)
+	offsets := []time.Duration{0, 400 * time.Millisecond, 800 * time.Millisecond}
+	var entries []record.Entry
+	for _, offset := range offsets {
+		entries = append(entries, record.Entry{Received: base.Add(offset), Source: "192.0.2.1:2055", Payload: []byte("payload")})
+	}
+	tmpDir := writeEntries(t, entries)
+
+	dataChan := make(chan []byte, len(entries))
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		done <- dbReader(context.Background(), Options{DBDir: tmpDir, Timing: TimingOriginal, Speed: 2}, []chan []byte{dataChan})
+	}()
+
+	for i, offset := range offsets {
+		<-dataChan
+		elapsed := time.Since(start)
+		// 2x speed halves the recorded gaps
+		want := offset / 2
+		if elapsed < want || elapsed > want+150*time.Millisecond {
+			t.Errorf("Got: packet %d after %v Want: about %v", i, elapsed, want)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("dbReader: %v", err)
+	}
+}
+
+// capturedDatagram is a UDP datagram written to a test capture.
+type capturedDatagram struct {
+	offset   time.Duration
+	src, dst string
+	payload  []byte
+}
+
+// writeCapture writes datagrams to a new pcap file, timestamped at their
+// offsets from a fixed time, and returns its path.
+func writeCapture(t *testing.T, datagrams []capturedDatagram) string {
+	t.Helper()
+	var capture bytes.Buffer
+	pw, err := pcap.NewWriter(&capture, pcap.FormatPCAP)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	base := time.Unix(1700000000, 0)
+	for i, d := range datagrams {
+		frame, err := pcap.EncodeUDP(pcap.Datagram{Src: netip.MustParseAddrPort(d.src), Dst: netip.MustParseAddrPort(d.dst), Payload: d.payload})
+		if err != nil {
+			t.Fatalf("encode datagram %d: %v", i, err)
+		}
+		if err := pw.WriteFrame(base.Add(d.offset), frame); err != nil {
+			t.Fatalf("write datagram %d: %v", i, err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "flows.pcap")
+	if err := os.WriteFile(path, capture.Bytes(), 0o600); err != nil {
+		t.Fatalf("write capture: %v", err)
+	}
+	return path
+}
+
+// TestPCAPReader tests that pcapReader sends the flow datagrams of a capture
+// matching the filters, in capture order, and ignores everything else.
+func TestPCAPReader(t *testing.T) {
+	t.Parallel()
+
+	packets := make([][]byte, 3)
+	for i := range packets {
+		session := netflow.NewSession()
+		flow := netflow.GenerateTemplateNetflow(100+i, session)
+		buf := flow.ToBytes()
+		packets[i] = buf.Bytes()
+	}
+	path := writeCapture(t, []capturedDatagram{
+		{src: "192.0.2.1:5000", dst: "198.51.100.1:2055", payload: packets[0]},
+		{src: "192.0.2.1:5000", dst: "198.51.100.1:2055", payload: []byte("not a flow packet")},
+		{src: "192.0.2.9:5000", dst: "198.51.100.1:2055", payload: packets[1]},
+		{src: "192.0.2.1:5000", dst: "198.51.100.1:9999", payload: packets[2]},
+	})
+
+	tests := []struct {
+		name   string
+		port   int
+		source string
+		want   [][]byte
+	}{
+		{"no filter", 0, "", packets},
+		{"port", 2055, "", packets[:2]},
+		{"source", 0, "192.0.2.0/29", [][]byte{packets[0], packets[2]}},
+		{"port and source", 2055, "192.0.2.9", packets[1:2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			source, err := ParseSourceFilter(tt.source)
+			if err != nil {
+				t.Fatalf("ParseSourceFilter: %v", err)
+			}
+			dataChan := make(chan []byte, 8)
+			opts := Options{PCAP: path, Timing: TimingFast, FilterPort: tt.port, FilterSource: source}
+			if err := pcapReader(context.Background(), opts, []chan []byte{dataChan}); err != nil {
+				t.Fatalf("pcapReader: %v", err)
+			}
+			var got [][]byte
+			for payload := range dataChan {
+				got = append(got, payload)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Got: %d packets Want: %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("Got: packet %d differs Want: capture order", i)
+				}
+			}
+		})
+	}
+}
+
+// TestPCAPReaderOriginalTiming tests that TimingOriginal paces a capture by
+// its timestamps.
+func TestPCAPReaderOriginalTiming(t *testing.T) {
+	t.Parallel()
+
+	session := netflow.NewSession()
+	flow := netflow.GenerateTemplateNetflow(100, session)
+	buf := flow.ToBytes()
+	offsets := []time.Duration{0, 300 * time.Millisecond}
+	var datagrams []capturedDatagram
+	for _, offset := range offsets {
+		datagrams = append(datagrams, capturedDatagram{offset: offset, src: "192.0.2.1:5000", dst: "198.51.100.1:2055", payload: buf.Bytes()})
+	}
+	path := writeCapture(t, datagrams)
+
+	dataChan := make(chan []byte, len(offsets))
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		done <- pcapReader(context.Background(), Options{PCAP: path, Timing: TimingOriginal, Speed: 1}, []chan []byte{dataChan})
+	}()
+	for i, offset := range offsets {
+		<-dataChan
+		if elapsed := time.Since(start); elapsed < offset || elapsed > offset+150*time.Millisecond {
+			t.Errorf("Got: packet %d after %v Want: about %v", i, elapsed, offset)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("pcapReader: %v", err)
+	}
+}
+
+// TestPCAPReaderMissingFile tests that an unreadable capture is an error.
+func TestPCAPReaderMissingFile(t *testing.T) {
+	t.Parallel()
+
+	dataChan := make(chan []byte, 1)
+	opts := Options{PCAP: filepath.Join(t.TempDir(), "missing.pcap")}
+	if err := pcapReader(context.Background(), opts, []chan []byte{dataChan}); err == nil {
+		t.Error("Got: nil Want: error for a missing capture")
+	}
+}
+
+func TestOptionsMatches(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		opts  Options
+		entry record.Entry
+		want  bool
+	}{
+		{"no filters", Options{}, record.Entry{}, true},
+		{"port match", Options{FilterPort: 2055}, record.Entry{Listener: "0.0.0.0:2055"}, true},
+		{"port mismatch", Options{FilterPort: 2055}, record.Entry{Listener: "0.0.0.0:9995"}, false},
+		{"port without metadata", Options{FilterPort: 2055}, record.Entry{}, false},
+		{"source match", Options{FilterSource: netip.MustParsePrefix("10.0.0.0/8")}, record.Entry{Source: "10.1.2.3:5000"}, true},
+		{"mapped source match", Options{FilterSource: netip.MustParsePrefix("10.0.0.0/8")}, record.Entry{Source: "[::ffff:10.1.2.3]:5000"}, true},
+		{"source mismatch", Options{FilterSource: netip.MustParsePrefix("10.0.0.0/8")}, record.Entry{Source: "192.0.2.1:5000"}, false},
+		{"IPv6 source match", Options{FilterSource: netip.MustParsePrefix("2001:db8::/32")}, record.Entry{Source: "[2001:db8::1]:5000"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.opts.matches(tt.entry); got != tt.want {
+				t.Errorf("Got: %v Want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSourceFilter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "", want: "invalid Prefix"},
+		{spec: "192.0.2.1", want: "192.0.2.1/32"},
+		{spec: "::ffff:192.0.2.1", want: "192.0.2.1/32"},
+		{spec: "192.0.2.77/24", want: "192.0.2.0/24"},
+		{spec: "2001:db8::1", want: "2001:db8::1/128"},
+		{spec: "exporter1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseSourceFilter(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Got: error %v Want: error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("Got: %s Want: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSpeed(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		spec    string
+		want    float64
+		wantErr bool
+	}{
+		{spec: "1x", want: 1},
+		{spec: "0.5x", want: 0.5},
+		{spec: "10", want: 10},
+		{spec: " 2x ", want: 2},
+		{spec: "0x", wantErr: true},
+		{spec: "-2x", wantErr: true},
+		{spec: "fast", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseSpeed(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Got: error %v Want: error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Got: %g Want: %g", got, tt.want)
+			}
+		})
+	}
+}
+
 // TestDbReaderContextCancellation tests that dbReader responds to context cancellation.
 func TestDbReaderContextCancellation(t *testing.T) {
 	t.Parallel()
@@ -150,7 +534,7 @@ func TestDbReaderContextCancellation(t *testing.T) {
 
 	done := make(chan struct{})
 	go func() {
-		dbReader(ctx, tmpDir, dataChan, false, false, false)
+		dbReader(ctx, Options{DBDir: tmpDir}, []chan []byte{dataChan})
 		close(done)
 	}()
 
@@ -187,7 +571,7 @@ func TestWorkerContextCancellation(t *testing.T) {
 	// Start worker
 	done := make(chan struct{})
 	go func() {
-		worker(1, ctx, "127.0.0.1", port, 100, false, dataChan)
+		worker(1, ctx, transport.Network{}, "127.0.0.1", port, 100, false, dataChan)
 		close(done)
 	}()
 
@@ -212,7 +596,7 @@ func TestWorkerCancellationInterruptsRateLimitWait(t *testing.T) {
 
 	done := make(chan error, 1)
 	go func() {
-		done <- worker(1, ctx, "127.0.0.1", 9995, 10_000, false, dataChan)
+		done <- worker(1, ctx, transport.Network{}, "127.0.0.1", 9995, 10_000, false, dataChan)
 	}()
 
 	time.Sleep(100 * time.Millisecond)
@@ -291,7 +675,7 @@ func TestRunIntegration(t *testing.T) {
 	replayDone := make(chan struct{})
 	go func() {
 		defer close(replayDone)
-		Run("127.0.0.1", port, 100, tmpDir, false, 1, false, false)
+		Run(Options{Server: "127.0.0.1", Port: port, Delay: 100, DBDir: tmpDir, Workers: 1})
 	}()
 
 	// Wait for packet to be received
@@ -306,6 +690,35 @@ func TestRunIntegration(t *testing.T) {
 	<-replayDone
 }
 
+// TestRunCtxDialer tests that packets are replayed over the Transport the
+// Dialer opens, in recorded order.
+func TestRunCtxDialer(t *testing.T) {
+	t.Parallel()
+
+	var entries []record.Entry
+	for i := range 5 {
+		entries = append(entries, record.Entry{Source: "192.0.2.1:2055", Payload: []byte(fmt.Sprintf("packet %d", i))})
+	}
+	tmpDir := writeEntries(t, entries)
+
+	c := transport.NewChan(len(entries))
+	opts := Options{Server: "127.0.0.1", Port: 9995, DBDir: tmpDir, Workers: 2, Timing: TimingFast, Dialer: transport.Shared(c)}
+	if err := RunCtx(context.Background(), opts); err != nil {
+		t.Fatalf("RunCtx: %v", err)
+	}
+	c.Close()
+	i := 0
+	for payload := range c.Packets() {
+		if want := fmt.Sprintf("packet %d", i); string(payload) != want {
+			t.Errorf("Got: %q Want: %q", payload, want)
+		}
+		i++
+	}
+	if i != len(entries) {
+		t.Errorf("Got: %d packets Want: %d", i, len(entries))
+	}
+}
+
 // TestSendPacket verifies that SendPacket works correctly.
 func TestSendPacket(t *testing.T) {
 	// Start a receiver
@@ -372,7 +785,7 @@ func TestSendPacket(t *testing.T) {
 	}
 }
 
-// TestUpdateTimestampNetFlow tests that updateTimestamp correctly updates NetFlow v9 timestamps.
+// TestUpdateTimestampNetFlow tests that rewrite correctly updates NetFlow v9 timestamps.
 func TestUpdateTimestampNetFlow(t *testing.T) {
 	t.Parallel()
 
@@ -382,7 +795,7 @@ func TestUpdateTimestampNetFlow(t *testing.T) {
 	payload := buf.Bytes()
 
 	before := uint32(time.Now().Unix())
-	result, err := updateTimestamp(payload)
+	result, err := newRewriter(Options{UpdateTS: true}).rewrite("", 0, payload)
 	if err != nil {
 		t.Fatalf("updateTimestamp failed: %v", err)
 	}
@@ -400,7 +813,7 @@ func TestUpdateTimestampNetFlow(t *testing.T) {
 	}
 }
 
-// TestUpdateTimestampIPFIX tests that updateTimestamp correctly updates IPFIX timestamps.
+// TestUpdateTimestampIPFIX tests that rewrite correctly updates IPFIX timestamps.
 func TestUpdateTimestampIPFIX(t *testing.T) {
 	t.Parallel()
 
@@ -413,7 +826,7 @@ func TestUpdateTimestampIPFIX(t *testing.T) {
 	payloadBytes := payload.Bytes()
 
 	before := uint32(time.Now().Unix())
-	result, err := updateTimestamp(payloadBytes)
+	result, err := newRewriter(Options{UpdateTS: true}).rewrite("", 0, payloadBytes)
 	if err != nil {
 		t.Fatalf("updateTimestamp failed: %v", err)
 	}
@@ -432,3 +845,35 @@ func TestUpdateTimestampIPFIX(t *testing.T) {
 		t.Errorf("IPFIX Sequence Number corrupted: got %d, want %d", newSeqNum, origSeqNum)
 	}
 }
+
+// TestUpdateTimestampNetFlowV5 tests that rewrite correctly updates NetFlow v5 timestamps.
+func TestUpdateTimestampNetFlowV5(t *testing.T) {
+	t.Parallel()
+
+	nf, err := netflowv5.GenerateNetflowV5(5, 100, "10.0.0.0/8", "10.0.0.0/8", 0, netflow.NewSession(), netflowv5.NewSequence())
+	if err != nil {
+		t.Fatalf("GenerateNetflowV5 failed: %v", err)
+	}
+	buf, err := nf.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes failed: %v", err)
+	}
+	payload := buf.Bytes()
+	binary.BigEndian.PutUint32(payload[8:12], 0)
+
+	before := uint32(time.Now().Unix())
+	result, err := newRewriter(Options{UpdateTS: true}).rewrite("", 0, payload)
+	if err != nil {
+		t.Fatalf("updateTimestamp failed: %v", err)
+	}
+	after := uint32(time.Now().Unix())
+
+	// Verify UnixSecs was updated (bytes 8-11 for NetFlow v5)
+	newTS := binary.BigEndian.Uint32(result[8:12])
+	if newTS < before || newTS > after {
+		t.Errorf("NetFlow v5 timestamp not updated: got %d, expected in [%d, %d]", newTS, before, after)
+	}
+	if len(result) != len(payload) {
+		t.Errorf("payload length changed: got %d, want %d", len(result), len(payload))
+	}
+}
@@ -0,0 +1,88 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+)
+
+// systemInitTimeMilliseconds is the IPFIX Information Element holding the
+// exporter's boot time.
+const systemInitTimeMilliseconds = 160
+
+// retime shifts every time-bearing header and record field of a decoded
+// NetFlow v9 or IPFIX message, held in payload, by the same whole number of
+// seconds, the gap between its export time and now, so flow start and end
+// times keep their place relative to the export time. The exporter is treated as
+// having stayed up all along: uptimes grow by the offset and the boot time is
+// left alone. Data sets whose template hasn't been seen keep their timestamps.
+func retime(msg *decode.Message, payload []byte, now time.Time) {
+	secs := now.Unix() - msg.ExportTime.Unix()
+	if msg.Version == decode.VersionNetFlow {
+		binary.BigEndian.PutUint32(payload[4:8], msg.SysUptime+uint32(secs*1000))
+		binary.BigEndian.PutUint32(payload[8:12], uint32(now.Unix()))
+	} else {
+		binary.BigEndian.PutUint32(payload[4:8], uint32(now.Unix()))
+	}
+	for _, ds := range msg.DataSets {
+		for _, record := range ds.Records {
+			for _, v := range record {
+				shiftValue(v, secs)
+			}
+		}
+	}
+}
+
+// shiftValue moves a time-bearing NetFlow v9 or IPFIX field forward by secs,
+// in place. NetFlow v9 shares IPFIX's numbering for the fields handled here.
+// Other fields, and fields with an unexpected length, are left alone.
+func shiftValue(v decode.Value, secs int64) {
+	if v.Field.EnterpriseNumber != 0 {
+		return
+	}
+	switch v.Field.Type {
+	case netflow.FIRST_SWITCHED, netflow.LAST_SWITCHED:
+		// Milliseconds of uptime, wrapping like SysUptime
+		if len(v.Data) == 4 {
+			binary.BigEndian.PutUint32(v.Data, binary.BigEndian.Uint32(v.Data)+uint32(secs*1000))
+		}
+		return
+	case systemInitTimeMilliseconds:
+		return
+	}
+	if len(v.Data) != int(v.Field.Length) {
+		return
+	}
+	switch ipfix.ElementDataType(v.Field.Type) {
+	case "dateTimeSeconds":
+		binary.BigEndian.PutUint32(v.Data, binary.BigEndian.Uint32(v.Data)+uint32(secs))
+	case "dateTimeMilliseconds":
+		binary.BigEndian.PutUint64(v.Data, binary.BigEndian.Uint64(v.Data)+uint64(secs*1000))
+	case "dateTimeMicroseconds", "dateTimeNanoseconds":
+		// NTP format: whole seconds in the upper 32 bits
+		binary.BigEndian.PutUint64(v.Data, binary.BigEndian.Uint64(v.Data)+uint64(secs)<<32)
+	}
+}
+
+// retimeNetFlowV5 moves the export time, uptime and record First/Last
+// uptimes of a validated NetFlow v5 packet forward to now, in place.
+func retimeNetFlowV5(payload []byte, now time.Time) {
+	count := int(binary.BigEndian.Uint16(payload[2:4]))
+	secs := now.Unix() - int64(binary.BigEndian.Uint32(payload[8:12]))
+	ms := uint32(secs * 1000)
+	binary.BigEndian.PutUint32(payload[4:8], binary.BigEndian.Uint32(payload[4:8])+ms)
+	binary.BigEndian.PutUint32(payload[8:12], uint32(now.Unix()))
+	for i := range count {
+		// First and Last follow the addresses, interfaces and counters
+		first := netflowv5.HeaderSize + i*netflowv5.RecordSize + 24
+		binary.BigEndian.PutUint32(payload[first:], binary.BigEndian.Uint32(payload[first:])+ms)
+		binary.BigEndian.PutUint32(payload[first+4:], binary.BigEndian.Uint32(payload[first+4:])+ms)
+	}
+}
@@ -0,0 +1,210 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+)
+
+// fieldValues decodes data after template and returns the values of field
+// type across its data records.
+func fieldValues(t *testing.T, template, data []byte, fieldType uint16) []uint64 {
+	t.Helper()
+	d := decode.NewDecoder()
+	if _, err := d.Decode("", template); err != nil {
+		t.Fatalf("Decode template: %v", err)
+	}
+	msg, err := d.Decode("", data)
+	if err != nil {
+		t.Fatalf("Decode data: %v", err)
+	}
+	var values []uint64
+	for _, ds := range msg.DataSets {
+		for _, record := range ds.Records {
+			for _, v := range record {
+				if v.Field.Type == fieldType {
+					values = append(values, v.Uint())
+				}
+			}
+		}
+	}
+	if len(values) == 0 {
+		t.Fatalf("Got: no field %d Want: one per record", fieldType)
+	}
+	return values
+}
+
+// shifted returns values each moved forward by delta.
+func shifted(values []uint64, delta uint64) []uint64 {
+	out := make([]uint64, len(values))
+	for i, v := range values {
+		out[i] = v + delta
+	}
+	return out
+}
+
+func TestRetimeNetFlow(t *testing.T) {
+	t.Parallel()
+	session := netflow.NewSession()
+	tmpl := netflow.GenerateTemplateNetflow(7, session)
+	tmplBuf := tmpl.ToBytes()
+	data, err := netflow.GenerateDataNetflow(5, 7, "10.0.0.0/8", "10.0.0.0/8", 443, session)
+	if err != nil {
+		t.Fatalf("GenerateDataNetflow: %v", err)
+	}
+	dataBuf := data.ToBytes()
+	template, payload := tmplBuf.Bytes(), dataBuf.Bytes()
+
+	exported := binary.BigEndian.Uint32(payload[8:12])
+	r := newRewriter(Options{UpdateTS: true})
+	r.now = func() time.Time { return time.Unix(int64(exported)+3600, 0) }
+	if _, err := r.rewrite("192.0.2.1:2055", 0, template); err != nil {
+		t.Fatalf("rewrite template: %v", err)
+	}
+	result, err := r.rewrite("192.0.2.1:2055", 0, payload)
+	if err != nil {
+		t.Fatalf("rewrite data: %v", err)
+	}
+
+	if got := binary.BigEndian.Uint32(result[8:12]); got != exported+3600 {
+		t.Errorf("Got: UnixSec %d Want: %d", got, exported+3600)
+	}
+	if got, want := binary.BigEndian.Uint32(result[4:8]), binary.BigEndian.Uint32(payload[4:8])+3600_000; got != want {
+		t.Errorf("Got: SysUptime %d Want: %d", got, want)
+	}
+	for _, field := range []uint16{netflow.FIRST_SWITCHED, netflow.LAST_SWITCHED} {
+		got := fieldValues(t, template, result, field)
+		want := shifted(fieldValues(t, template, payload, field), 3600_000)
+		if !slices.Equal(got, want) {
+			t.Errorf("Got: field %d %v Want: %v", field, got, want)
+		}
+	}
+	if !bytes.Equal(result[12:20], payload[12:20]) {
+		t.Error("Got: sequence or source ID changed Want: unchanged")
+	}
+	if r.missing != 0 {
+		t.Errorf("Got: %d data sets without template Want: 0", r.missing)
+	}
+}
+
+func TestRetimeIPFIX(t *testing.T) {
+	t.Parallel()
+	seq := ipfix.NewIPFIXSequence()
+	tmpl := ipfix.GenerateTemplateIPFIX(8, seq)
+	tmplBuf, err := tmpl.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes: %v", err)
+	}
+	data, err := ipfix.GenerateDataIPFIX(4, 8, "2001:db8::/64", "2001:db8::/64", 443, seq)
+	if err != nil {
+		t.Fatalf("GenerateDataIPFIX: %v", err)
+	}
+	dataBuf, err := data.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes: %v", err)
+	}
+	template, payload := tmplBuf.Bytes(), dataBuf.Bytes()
+
+	exported := binary.BigEndian.Uint32(payload[4:8])
+	r := newRewriter(Options{UpdateTS: true})
+	r.now = func() time.Time { return time.Unix(int64(exported)-60, 0) }
+
+	// Without the template the records can't be located
+	unchanged, err := r.rewrite("192.0.2.1:4739", 0, payload)
+	if err != nil {
+		t.Fatalf("rewrite data: %v", err)
+	}
+	if !bytes.Equal(unchanged[8:], payload[8:]) || r.missing != 1 {
+		t.Errorf("Got: records changed or %d data sets without template Want: unchanged records and 1", r.missing)
+	}
+
+	if _, err := r.rewrite("192.0.2.1:4739", 0, template); err != nil {
+		t.Fatalf("rewrite template: %v", err)
+	}
+	result, err := r.rewrite("192.0.2.1:4739", 0, payload)
+	if err != nil {
+		t.Fatalf("rewrite data: %v", err)
+	}
+	if got := binary.BigEndian.Uint32(result[4:8]); got != exported-60 {
+		t.Errorf("Got: export time %d Want: %d", got, exported-60)
+	}
+	for _, field := range []uint16{ipfix.FlowStartMilliseconds, ipfix.FlowEndMilliseconds} {
+		got := fieldValues(t, template, result, field)
+		want := shifted(fieldValues(t, template, payload, field), ^uint64(60_000)+1)
+		if !slices.Equal(got, want) {
+			t.Errorf("Got: field %d %v Want: %v", field, got, want)
+		}
+	}
+}
+
+func TestRetimeNetFlowV5(t *testing.T) {
+	t.Parallel()
+	nf, err := netflowv5.GenerateNetflowV5(3, 1, "10.0.0.0/8", "10.0.0.0/8", 443, netflow.NewSession(), netflowv5.NewSequence())
+	if err != nil {
+		t.Fatalf("GenerateNetflowV5: %v", err)
+	}
+	buf, err := nf.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes: %v", err)
+	}
+	payload := buf.Bytes()
+
+	exported := binary.BigEndian.Uint32(payload[8:12])
+	r := newRewriter(Options{UpdateTS: true})
+	r.now = func() time.Time { return time.Unix(int64(exported)+10, 0) }
+	result, err := r.rewrite("", 0, payload)
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if got := binary.BigEndian.Uint32(result[8:12]); got != exported+10 {
+		t.Errorf("Got: UnixSecs %d Want: %d", got, exported+10)
+	}
+	for i := range 3 {
+		first := netflowv5.HeaderSize + i*netflowv5.RecordSize + 24
+		for _, off := range []int{first, first + 4} {
+			if got, want := binary.BigEndian.Uint32(result[off:]), binary.BigEndian.Uint32(payload[off:])+10_000; got != want {
+				t.Errorf("Got: record %d uptime %d Want: %d", i, got, want)
+			}
+		}
+	}
+}
+
+func TestShiftValue(t *testing.T) {
+	t.Parallel()
+	u32 := func(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+	u64 := func(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+	tests := []struct {
+		name  string
+		field decode.Field
+		data  []byte
+		want  []byte
+	}{
+		{name: "dateTimeSeconds", field: decode.Field{Type: 150, Length: 4}, data: u32(1000), want: u32(1010)},
+		{name: "dateTimeMilliseconds", field: decode.Field{Type: 153, Length: 8}, data: u64(1000), want: u64(11000)},
+		{name: "dateTimeNanoseconds", field: decode.Field{Type: 156, Length: 8}, data: u64(5<<32 | 7), want: u64(15<<32 | 7)},
+		{name: "uptime wraps", field: decode.Field{Type: 22, Length: 4}, data: u32(0xFFFFFFFF), want: u32(9999)},
+		{name: "boot time kept", field: decode.Field{Type: 160, Length: 8}, data: u64(1000), want: u64(1000)},
+		{name: "enterprise kept", field: decode.Field{Type: 150, Length: 4, EnterpriseNumber: 9}, data: u32(1000), want: u32(1000)},
+		{name: "counter kept", field: decode.Field{Type: 1, Length: 4}, data: u32(1000), want: u32(1000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			shiftValue(decode.Value{Field: tt.field, Data: tt.data}, 10)
+			if !bytes.Equal(tt.data, tt.want) {
+				t.Errorf("Got: %x Want: %x", tt.data, tt.want)
+			}
+		})
+	}
+}
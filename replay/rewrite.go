@@ -0,0 +1,237 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmabry/flowgre/anonymize"
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/ipfix"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/sflow"
+)
+
+// DomainMap rewrites NetFlow v9 source IDs and IPFIX observation domain IDs.
+// IDs listed in IDs are replaced by their mapping; all others have Offset
+// added, wrapping at 2^32.
+type DomainMap struct {
+	Offset uint32
+	IDs    map[uint32]uint32
+}
+
+// Map returns the ID that replaces id.
+func (m DomainMap) Map(id uint32) uint32 {
+	if to, ok := m.IDs[id]; ok {
+		return to
+	}
+	return id + m.Offset
+}
+
+// isIdentity reports whether m leaves every ID unchanged.
+func (m DomainMap) isIdentity() bool {
+	return m.Offset == 0 && len(m.IDs) == 0
+}
+
+// LoadDomainMap reads a domain ID map file. Each line maps one source ID or
+// observation domain ID to another as "<from> <to>"; blank lines and lines
+// starting with # are ignored.
+func LoadDomainMap(path string) (map[uint32]uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open domain map: %w", err)
+	}
+	defer f.Close()
+
+	ids := make(map[uint32]uint32)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("domain map %s line %d: expected \"<from> <to>\", got %q", path, line, text)
+		}
+		var pair [2]uint32
+		for i, field := range fields {
+			id, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("domain map %s line %d: invalid domain ID %q", path, line, field)
+			}
+			pair[i] = uint32(id)
+		}
+		if _, ok := ids[pair[0]]; ok {
+			return nil, fmt.Errorf("domain map %s line %d: domain ID %d mapped twice", path, line, pair[0])
+		}
+		ids[pair[0]] = pair[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read domain map %s: %w", path, err)
+	}
+	return ids, nil
+}
+
+// streamKey identifies a sequence number stream as the collector sees it: the
+// worker sending it, the flow version and the (mapped) domain ID.
+type streamKey struct {
+	worker   int
+	version  uint16
+	domainID uint32
+}
+
+// rewriter applies the header and record rewrites selected in Options to
+// replayed packets. NetFlow v9 and IPFIX packets are decoded once, with
+// templates learned per recorded exporter, and rewritten in place on a copy.
+type rewriter struct {
+	decoder   *decode.Decoder
+	now       func() time.Time
+	retimes   bool
+	renumbers bool
+	domains   DomainMap
+	anonymize *anonymize.Anonymizer
+	sequences map[streamKey]uint32 // next sequence number of each stream
+	missing   int                  // data sets not retimed or counted for lack of a template
+}
+
+// newRewriter returns a rewriter for opts, or nil if opts selects no rewrite.
+func newRewriter(opts Options) *rewriter {
+	if !opts.UpdateTS && !opts.Renumber && opts.Domains.isIdentity() && opts.Anonymizer == nil {
+		return nil
+	}
+	return &rewriter{
+		decoder:   decode.NewDecoder(),
+		now:       time.Now,
+		retimes:   opts.UpdateTS,
+		renumbers: opts.Renumber,
+		domains:   opts.Domains,
+		anonymize: opts.Anonymizer,
+		sequences: make(map[streamKey]uint32),
+	}
+}
+
+// rewrite returns a rewritten copy of payload, recorded from exporter and to
+// be sent by worker. sFlow datagrams are returned unchanged. When addresses
+// are rewritten, packets they can't be rewritten in fail with an error
+// wrapping anonymize.ErrUnsupported or anonymize.ErrMissingTemplate, and
+// must be dropped.
+func (r *rewriter) rewrite(exporter string, worker int, payload []byte) ([]byte, error) {
+	if sflow.HasSFlowHeader(payload) {
+		if r.anonymize != nil {
+			return nil, fmt.Errorf("sFlow: %w", anonymize.ErrUnsupported)
+		}
+		return payload, nil
+	}
+	version := netflowVersion(payload)
+	switch version {
+	case netflowv5.Version:
+		if _, err := netflowv5.IsValidNetFlowV5(payload); err != nil {
+			return nil, err
+		}
+	case decode.VersionNetFlow, decode.VersionIPFIX:
+	default:
+		return nil, fmt.Errorf("unsupported flow version %d for rewrite", version)
+	}
+
+	result := make([]byte, len(payload))
+	copy(result, payload)
+	if version == netflowv5.Version {
+		if r.anonymize != nil {
+			r.anonymize.NetFlowV5(result)
+		}
+		if r.retimes {
+			retimeNetFlowV5(result, r.now())
+		}
+		if r.renumbers {
+			r.renumberNetFlowV5(worker, result)
+		}
+		return result, nil
+	}
+
+	msg, err := r.decoder.Decode(exporter, result)
+	if err != nil {
+		return nil, err
+	}
+	if r.anonymize != nil {
+		if err := r.anonymize.Message(msg); err != nil {
+			return nil, err
+		}
+	}
+	if r.retimes || r.renumbers {
+		r.missing += msg.MissingTemplates()
+	}
+	if r.retimes {
+		retime(msg, result, r.now())
+	}
+	domainID := msg.DomainID
+	if !r.domains.isIdentity() {
+		domainID = r.remapDomain(msg, result)
+	}
+	if r.renumbers {
+		r.renumber(streamKey{worker, version, domainID}, msg, result)
+	}
+	return result, nil
+}
+
+// remapDomain rewrites the source ID or observation domain ID of a decoded
+// message held in payload, along with any observationDomainId fields of IPFIX
+// records, and returns the new header ID.
+func (r *rewriter) remapDomain(msg *decode.Message, payload []byte) uint32 {
+	domainID := r.domains.Map(msg.DomainID)
+	if msg.Version == decode.VersionNetFlow {
+		binary.BigEndian.PutUint32(payload[16:20], domainID)
+		return domainID
+	}
+	binary.BigEndian.PutUint32(payload[12:16], domainID)
+	for _, ds := range msg.DataSets {
+		for _, record := range ds.Records {
+			for _, v := range record {
+				if v.Field.Type == ipfix.ObservationDomainId && v.Field.EnterpriseNumber == 0 && len(v.Data) == 4 {
+					binary.BigEndian.PutUint32(v.Data, r.domains.Map(binary.BigEndian.Uint32(v.Data)))
+				}
+			}
+		}
+	}
+	return domainID
+}
+
+// renumber replaces the sequence number of a decoded message held in payload
+// with the next one of its stream, so sequences run on across loop passes and
+// across exporters merged into one stream. A stream starts at the sequence
+// number of its first packet. NetFlow v9 sequence numbers count packets; IPFIX
+// sequence numbers count data records, so records of data sets whose template
+// hasn't been seen can't be counted.
+func (r *rewriter) renumber(key streamKey, msg *decode.Message, payload []byte) {
+	next, ok := r.sequences[key]
+	if !ok {
+		next = msg.Sequence
+	}
+	if msg.Version == decode.VersionNetFlow {
+		binary.BigEndian.PutUint32(payload[12:16], next)
+		r.sequences[key] = next + 1
+		return
+	}
+	binary.BigEndian.PutUint32(payload[8:12], next)
+	r.sequences[key] = next + uint32(msg.DataRecords(true)+msg.DataRecords(false))
+}
+
+// renumberNetFlowV5 replaces the flow sequence of a validated NetFlow v5
+// packet with the next one of its stream. NetFlow v5 sequence numbers count
+// flows, and streams are told apart by engine type and ID.
+func (r *rewriter) renumberNetFlowV5(worker int, payload []byte) {
+	key := streamKey{worker, netflowv5.Version, uint32(binary.BigEndian.Uint16(payload[20:22]))}
+	next, ok := r.sequences[key]
+	if !ok {
+		next = binary.BigEndian.Uint32(payload[16:20])
+	}
+	binary.BigEndian.PutUint32(payload[16:20], next)
+	r.sequences[key] = next + uint32(binary.BigEndian.Uint16(payload[2:4]))
+}
@@ -0,0 +1,257 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/dmabry/flowgre/anonymize"
+	"github.com/dmabry/flowgre/decode"
+	"github.com/dmabry/flowgre/decode/decodetest"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/sflow"
+)
+
+// rewriteAll rewrites packets passes times, as a looping replay would, and
+// returns the rewritten packets in send order.
+func rewriteAll(t *testing.T, r *rewriter, worker int, packets [][]byte, passes int) [][]byte {
+	t.Helper()
+	var out [][]byte
+	for range passes {
+		for _, p := range packets {
+			result, err := r.rewrite("192.0.2.1:2055", worker, p)
+			if err != nil {
+				t.Fatalf("rewrite: %v", err)
+			}
+			out = append(out, result)
+		}
+	}
+	return out
+}
+
+// sequences returns the header field at offset of every packet.
+func sequences(packets [][]byte, offset int) []uint32 {
+	seqs := make([]uint32, len(packets))
+	for i, p := range packets {
+		seqs[i] = binary.BigEndian.Uint32(p[offset:])
+	}
+	return seqs
+}
+
+func TestRewriteRenumber(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		packets [][]byte
+		offset  int // sequence number offset in the header
+		span    func(first, last uint32) uint32
+	}{
+		// One sequence number per packet
+		{name: "netflow v9", packets: decodetest.NetFlow(t, 7, "10.0.0.0/8", 3, 3), offset: 12, span: func(first, last uint32) uint32 { return last + 1 - first }},
+		// The last message carries 3 data records
+		{name: "ipfix", packets: decodetest.IPFIX(t, 8, "10.0.0.0/8", 4, 3), offset: 8, span: func(first, last uint32) uint32 { return last + 3 - first }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			original := sequences(tt.packets, tt.offset)
+			got := sequences(rewriteAll(t, newRewriter(Options{Renumber: true}), 0, tt.packets, 3), tt.offset)
+
+			span := tt.span(original[0], original[len(original)-1])
+			var want []uint32
+			for pass := range uint32(3) {
+				for _, seq := range original {
+					want = append(want, seq+pass*span)
+				}
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("Got: %v Want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRewriteRenumberStreams(t *testing.T) {
+	t.Parallel()
+	r := newRewriter(Options{Renumber: true})
+	packets := decodetest.NetFlow(t, 7, "10.0.0.0/8", 3, 3)
+
+	// Workers send from their own address, so each is its own stream
+	first := sequences(rewriteAll(t, r, 0, packets, 1), 12)
+	other := sequences(rewriteAll(t, r, 1, packets, 1), 12)
+	if !slices.Equal(first, other) {
+		t.Errorf("Got: %v on worker 1 Want: %v", other, first)
+	}
+	// The same capture under another source ID starts its own stream too
+	remapped := newRewriter(Options{Renumber: true, Domains: DomainMap{Offset: 1}})
+	rewriteAll(t, remapped, 0, packets, 1)
+	if got := len(remapped.sequences); got != 1 {
+		t.Errorf("Got: %d streams Want: 1", got)
+	}
+	for key := range remapped.sequences {
+		if key.domainID != 8 {
+			t.Errorf("Got: stream of domain %d Want: mapped domain 8", key.domainID)
+		}
+	}
+}
+
+func TestRewriteRenumberNetFlowV5(t *testing.T) {
+	t.Parallel()
+	var packets [][]byte
+	seq := netflowv5.NewSequence()
+	session := netflow.NewSession()
+	for range 2 {
+		nf, err := netflowv5.GenerateNetflowV5(5, 1, "10.0.0.0/8", "10.0.0.0/8", 443, session, seq)
+		if err != nil {
+			t.Fatalf("GenerateNetflowV5: %v", err)
+		}
+		buf, err := nf.ToBytes()
+		if err != nil {
+			t.Fatalf("ToBytes: %v", err)
+		}
+		packets = append(packets, buf.Bytes())
+	}
+	got := sequences(rewriteAll(t, newRewriter(Options{Renumber: true}), 0, packets, 2), 16)
+	base := binary.BigEndian.Uint32(packets[0][16:20])
+	if want := []uint32{base, base + 5, base + 10, base + 15}; !slices.Equal(got, want) {
+		t.Errorf("Got: %v Want: %v", got, want)
+	}
+}
+
+func TestRewriteDomains(t *testing.T) {
+	t.Parallel()
+	domains := DomainMap{Offset: 1000, IDs: map[uint32]uint32{8: 42}}
+	tests := []struct {
+		name     string
+		packets  [][]byte
+		offset   int // domain ID offset in the header
+		original uint32
+		want     uint32
+	}{
+		{name: "netflow v9 offset", packets: decodetest.NetFlow(t, 7, "10.0.0.0/8", 3, 3), offset: 16, original: 7, want: 1007},
+		{name: "ipfix mapped", packets: decodetest.IPFIX(t, 8, "10.0.0.0/8", 4, 3), offset: 12, original: 8, want: 42},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := newRewriter(Options{Domains: domains})
+			got := rewriteAll(t, r, 0, tt.packets, 1)
+			for i, id := range sequences(got, tt.offset) {
+				if id != tt.want {
+					t.Errorf("Got: packet %d domain %d Want: %d", i, id, tt.want)
+				}
+			}
+			// Templates stay keyed by the recorded ID, so data still decodes
+			d := decode.NewDecoder()
+			for _, p := range got {
+				msg, err := d.Decode("", p)
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				if msg.MissingTemplates() != 0 {
+					t.Error("Got: data set without template Want: templates rewritten with data")
+				}
+			}
+			if !bytes.Equal(tt.packets[0][tt.offset:tt.offset+4], binary.BigEndian.AppendUint32(nil, tt.original)) {
+				t.Error("Got: recorded packet modified Want: rewritten copy")
+			}
+		})
+	}
+}
+
+func TestRewriteAnonymize(t *testing.T) {
+	t.Parallel()
+	a, err := anonymize.New(anonymize.Rules{Remap: []anonymize.Remap{{From: "10.0.0.0/8", To: "172.0.0.0/8"}}})
+	if err != nil {
+		t.Fatalf("anonymize.New: %v", err)
+	}
+	r := newRewriter(Options{Anonymizer: a, Renumber: true})
+	packets := decodetest.NetFlow(t, 7, "10.0.0.0/8", 3, 3)
+
+	// Data ahead of its template can't be rewritten, so it isn't sent
+	if _, err := r.rewrite("192.0.2.1:2055", 0, packets[1]); !errors.Is(err, anonymize.ErrMissingTemplate) {
+		t.Errorf("Got: %v Want: ErrMissingTemplate", err)
+	}
+	got := rewriteAll(t, r, 0, packets, 1)
+	d := decode.NewDecoder()
+	for _, p := range got {
+		msg, err := d.Decode("", p)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		for _, ds := range msg.DataSets {
+			for _, record := range ds.Records {
+				for _, v := range record {
+					if v.Field.Type == netflow.IPV4_SRC_ADDR && v.Data[0] != 172 {
+						t.Errorf("Got: source %v Want: address in 172.0.0.0/8", v.Data)
+					}
+				}
+			}
+		}
+	}
+	// The dropped packet doesn't take a sequence number
+	if seqs := sequences(got, 12); seqs[0] != binary.BigEndian.Uint32(packets[0][12:16]) {
+		t.Errorf("Got: first sequence %d Want: %d", seqs[0], binary.BigEndian.Uint32(packets[0][12:16]))
+	}
+
+	dg, err := sflow.GenerateDatagram(1, 1, "10.0.0.0/8", "10.0.0.0/8", 443, netflow.NewSession(), sflow.NewAgent())
+	if err != nil {
+		t.Fatalf("GenerateDatagram: %v", err)
+	}
+	buf, err := dg.ToBytes()
+	if err != nil {
+		t.Fatalf("ToBytes: %v", err)
+	}
+	if _, err := r.rewrite("192.0.2.1:6343", 0, buf.Bytes()); !errors.Is(err, anonymize.ErrUnsupported) {
+		t.Errorf("Got: %v for sFlow Want: ErrUnsupported", err)
+	}
+}
+
+func TestLoadDomainMap(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		content string
+		want    map[uint32]uint32
+		wantErr bool
+	}{
+		{name: "pairs and comments", content: "# lab exporters\n1 101\n\n  2   102\n", want: map[uint32]uint32{1: 101, 2: 102}},
+		{name: "empty", content: "", want: map[uint32]uint32{}},
+		{name: "missing target", content: "1\n", wantErr: true},
+		{name: "not a number", content: "1 abc\n", wantErr: true},
+		{name: "out of range", content: "1 4294967296\n", wantErr: true},
+		{name: "mapped twice", content: "1 101\n1 102\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "domains.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			got, err := LoadDomainMap(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Got: error %v Want: error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("Got: %v Want: %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadDomainMap(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Got: nil error for missing file Want: error")
+	}
+}
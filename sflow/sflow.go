@@ -0,0 +1,494 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// sFlow v5 funcs and structs used for generating sFlow datagrams to be put on the wire.
+// Datagrams carry flow samples with sampled raw packet headers and counter samples
+// with generic interface counters, as described at https://sflow.org/sflow_version_5.txt
+
+package sflow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/utils"
+)
+
+// sFlow datagram version and address types.
+const (
+	Version     = 5
+	AddressIPv4 = 1
+	AddressIPv6 = 2
+)
+
+// Standard (enterprise 0) sample and record formats.
+const (
+	FlowSampleFormat               = 1
+	CounterSampleFormat            = 2
+	RawPacketHeaderFormat          = 1
+	GenericInterfaceCountersFormat = 1
+	// HeaderProtocolEthernet is the header_protocol value for ISO 8802-3 Ethernet.
+	HeaderProtocolEthernet = 1
+)
+
+const (
+	// DefaultSamplingRate is the 1-in-N packet sampling rate reported in flow samples.
+	DefaultSamplingRate = 1024
+	// NumInterfaces is the number of simulated switch ports per agent.
+	NumInterfaces = 4
+	// fcsLength is the Ethernet frame check sequence stripped from sampled headers.
+	fcsLength = 4
+	// genericCountersSize is the encoded size of GenericInterfaceCounters.
+	genericCountersSize = 88
+)
+
+// RawPacketHeader is a flow record carrying the leading bytes of a sampled packet.
+type RawPacketHeader struct {
+	HeaderProtocol uint32
+	FrameLength    uint32
+	Stripped       uint32
+	Header         []byte
+}
+
+// FlowSample is a standard (non-expanded) sFlow flow sample.
+type FlowSample struct {
+	SequenceNumber uint32
+	SourceID       uint32 // source_id type (0 = ifIndex) in the top byte, index below
+	SamplingRate   uint32
+	SamplePool     uint32
+	Drops          uint32
+	Input          uint32
+	Output         uint32
+	Records        []RawPacketHeader
+}
+
+// GenericInterfaceCounters is the fixed 88-byte generic interface counters record.
+// Field order is the wire order; binary.Write serializes in struct field order.
+type GenericInterfaceCounters struct {
+	IfIndex            uint32
+	IfType             uint32
+	IfSpeed            uint64
+	IfDirection        uint32
+	IfStatus           uint32
+	IfInOctets         uint64
+	IfInUcastPkts      uint32
+	IfInMulticastPkts  uint32
+	IfInBroadcastPkts  uint32
+	IfInDiscards       uint32
+	IfInErrors         uint32
+	IfInUnknownProtos  uint32
+	IfOutOctets        uint64
+	IfOutUcastPkts     uint32
+	IfOutMulticastPkts uint32
+	IfOutBroadcastPkts uint32
+	IfOutDiscards      uint32
+	IfOutErrors        uint32
+	IfPromiscuousMode  uint32
+}
+
+// CounterSample is a standard (non-expanded) sFlow counter sample.
+type CounterSample struct {
+	SequenceNumber uint32
+	SourceID       uint32
+	Counters       GenericInterfaceCounters
+}
+
+// Datagram is a complete sFlow v5 datagram.
+type Datagram struct {
+	AgentAddress   net.IP
+	SubAgentID     uint32
+	SequenceNumber uint32
+	SysUptime      uint32
+	FlowSamples    []FlowSample
+	CounterSamples []CounterSample
+}
+
+// ToBytes converts the Datagram to a bytes buffer that can be written to the wire.
+// Flow samples are encoded before counter samples.
+func (d *Datagram) ToBytes() (bytes.Buffer, error) {
+	var buf bytes.Buffer
+	addrType, addr, err := encodeAddress(d.AgentAddress)
+	if err != nil {
+		return buf, err
+	}
+	writeUint32s(&buf, Version, addrType)
+	buf.Write(addr)
+	writeUint32s(&buf, d.SubAgentID, d.SequenceNumber, d.SysUptime, uint32(len(d.FlowSamples)+len(d.CounterSamples)))
+
+	for i := range d.FlowSamples {
+		fs := &d.FlowSamples[i]
+		var body bytes.Buffer
+		writeUint32s(&body, fs.SequenceNumber, fs.SourceID, fs.SamplingRate, fs.SamplePool,
+			fs.Drops, fs.Input, fs.Output, uint32(len(fs.Records)))
+		for _, r := range fs.Records {
+			var rec bytes.Buffer
+			writeUint32s(&rec, r.HeaderProtocol, r.FrameLength, r.Stripped, uint32(len(r.Header)))
+			rec.Write(r.Header)
+			rec.Write(make([]byte, pad4(len(r.Header))))
+			writeOpaque(&body, RawPacketHeaderFormat, rec.Bytes())
+		}
+		writeOpaque(&buf, FlowSampleFormat, body.Bytes())
+	}
+	for i := range d.CounterSamples {
+		cs := &d.CounterSamples[i]
+		var body bytes.Buffer
+		writeUint32s(&body, cs.SequenceNumber, cs.SourceID, 1)
+		var rec bytes.Buffer
+		if err := binary.Write(&rec, binary.BigEndian, &cs.Counters); err != nil {
+			return bytes.Buffer{}, fmt.Errorf("write counter sample %d: %w", i, err)
+		}
+		writeOpaque(&body, GenericInterfaceCountersFormat, rec.Bytes())
+		writeOpaque(&buf, CounterSampleFormat, body.Bytes())
+	}
+	return buf, nil
+}
+
+// encodeAddress returns the sFlow address type and raw bytes for ip.
+func encodeAddress(ip net.IP) (uint32, []byte, error) {
+	if v4 := ip.To4(); v4 != nil {
+		return AddressIPv4, v4, nil
+	}
+	if v6 := ip.To16(); v6 != nil {
+		return AddressIPv6, v6, nil
+	}
+	return 0, nil, fmt.Errorf("invalid agent address %v", ip)
+}
+
+// writeUint32s appends each value to buf in network byte order.
+func writeUint32s(buf *bytes.Buffer, values ...uint32) {
+	var b [4]byte
+	for _, v := range values {
+		binary.BigEndian.PutUint32(b[:], v)
+		buf.Write(b[:])
+	}
+}
+
+// writeOpaque appends an sFlow data_format/length/body structure to buf.
+func writeOpaque(buf *bytes.Buffer, format uint32, body []byte) {
+	writeUint32s(buf, format, uint32(len(body)))
+	buf.Write(body)
+}
+
+// pad4 returns the number of bytes needed to pad n to a 4-byte boundary.
+func pad4(n int) int {
+	return (4 - n%4) % 4
+}
+
+// Agent holds the per-exporter state of a simulated sFlow agent: its address,
+// sequence numbers and cumulative interface counters. Each barrage worker uses
+// its own Agent so that every worker looks like a separate switch.
+type Agent struct {
+	mu          sync.Mutex
+	address     net.IP
+	datagramSeq uint32
+	flowSeq     uint32
+	counterSeq  uint32
+	counters    [NumInterfaces]GenericInterfaceCounters
+}
+
+// NewAgent creates a new agent. The agent address is picked from the source
+// range on the first generated datagram.
+func NewAgent() *Agent {
+	a := &Agent{}
+	for i := range a.counters {
+		a.counters[i] = GenericInterfaceCounters{
+			IfIndex:     uint32(i + 1),
+			IfType:      6, // ethernetCsmacd
+			IfSpeed:     10_000_000_000,
+			IfDirection: 1, // full-duplex
+			IfStatus:    3, // admin up, oper up
+		}
+	}
+	return a
+}
+
+// Address returns the agent address, or nil if no datagram has been generated yet.
+func (a *Agent) Address() net.IP {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.address
+}
+
+// GenerateDatagram generates an sFlow v5 datagram with flowCount flow samples and one
+// counter sample for a random interface. The sourceID is used as the sub-agent ID.
+// If flowSrcPort is 0 a random well-known port is picked for every sampled packet.
+func GenerateDatagram(flowCount int, sourceID int, srcRange string, dstRange string, flowSrcPort int, session *netflow.Session, agent *Agent) (Datagram, error) {
+	if flowCount < 1 {
+		return Datagram{}, fmt.Errorf("sFlow flow sample count must be at least 1, got %d", flowCount)
+	}
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	if agent.address == nil {
+		addr, err := utils.RandomIPCIDR(srcRange)
+		if err != nil {
+			return Datagram{}, fmt.Errorf("failed to generate agent address: %w", err)
+		}
+		agent.address = addr
+	}
+
+	samples := make([]FlowSample, flowCount)
+	for i := range flowCount {
+		srcIP, err := utils.RandomIPCIDR(srcRange)
+		if err != nil {
+			return Datagram{}, fmt.Errorf("failed to generate src IP for flow %d: %w", i, err)
+		}
+		dstIP, err := utils.RandomIPCIDR(dstRange)
+		if err != nil {
+			return Datagram{}, fmt.Errorf("failed to generate dst IP for flow %d: %w", i, err)
+		}
+		port := flowSrcPort
+		if port == 0 {
+			idx, err := utils.RandomNum(0, len(utils.ProtoPorts))
+			if err != nil {
+				return Datagram{}, fmt.Errorf("select random port for flow %d: %w", i, err)
+			}
+			port = utils.ProtoPorts[idx]
+		}
+		record, err := generateRawPacketHeader(srcIP, dstIP, port)
+		if err != nil {
+			return Datagram{}, fmt.Errorf("generate packet header for flow %d: %w", i, err)
+		}
+		input, err := utils.RandomNum(1, NumInterfaces+1)
+		if err != nil {
+			return Datagram{}, fmt.Errorf("select input interface for flow %d: %w", i, err)
+		}
+		output := input%NumInterfaces + 1
+
+		agent.flowSeq++
+		samples[i] = FlowSample{
+			SequenceNumber: agent.flowSeq,
+			SourceID:       uint32(input),
+			SamplingRate:   DefaultSamplingRate,
+			SamplePool:     agent.flowSeq * DefaultSamplingRate,
+			Input:          uint32(input),
+			Output:         uint32(output),
+			Records:        []RawPacketHeader{record},
+		}
+		// Account the sampled traffic on the interface counters
+		c := &agent.counters[input-1]
+		c.IfInOctets += uint64(record.FrameLength) * DefaultSamplingRate
+		c.IfInUcastPkts += DefaultSamplingRate
+		o := &agent.counters[output-1]
+		o.IfOutOctets += uint64(record.FrameLength) * DefaultSamplingRate
+		o.IfOutUcastPkts += DefaultSamplingRate
+	}
+
+	ifIdx, err := utils.RandomNum(0, NumInterfaces)
+	if err != nil {
+		return Datagram{}, fmt.Errorf("select counter interface: %w", err)
+	}
+	agent.counterSeq++
+	counter := CounterSample{
+		SequenceNumber: agent.counterSeq,
+		SourceID:       uint32(ifIdx + 1),
+		Counters:       agent.counters[ifIdx],
+	}
+
+	agent.datagramSeq++
+	now := time.Now().UnixNano()
+	return Datagram{
+		AgentAddress:   agent.address,
+		SubAgentID:     uint32(sourceID),
+		SequenceNumber: agent.datagramSeq,
+		SysUptime:      uint32((now-session.StartTime())/int64(time.Millisecond)) + 1000,
+		FlowSamples:    samples,
+		CounterSamples: []CounterSample{counter},
+	}, nil
+}
+
+// generateRawPacketHeader synthesizes the Ethernet, IP and TCP/UDP headers of a
+// sampled packet from srcIP to dstIP on the given well-known port.
+func generateRawPacketHeader(srcIP net.IP, dstIP net.IP, flowPort int) (RawPacketHeader, error) {
+	dstPort, proto := utils.ResolvePortProtocol(flowPort)
+	srcPort, err := utils.RandomNum(10000, 65536)
+	if err != nil {
+		return RawPacketHeader{}, fmt.Errorf("generate source port: %w", err)
+	}
+	payloadLen, err := utils.RandomNum(0, 1400)
+	if err != nil {
+		return RawPacketHeader{}, fmt.Errorf("generate payload length: %w", err)
+	}
+
+	var l4 []byte
+	if proto == utils.UDPProto {
+		l4 = make([]byte, 8)
+		binary.BigEndian.PutUint16(l4[0:2], uint16(srcPort))
+		binary.BigEndian.PutUint16(l4[2:4], dstPort)
+		binary.BigEndian.PutUint16(l4[4:6], uint16(8+payloadLen))
+	} else {
+		l4 = make([]byte, 20)
+		binary.BigEndian.PutUint16(l4[0:2], uint16(srcPort))
+		binary.BigEndian.PutUint16(l4[2:4], dstPort)
+		seq, err := utils.GenerateRand32(1 << 30)
+		if err != nil {
+			return RawPacketHeader{}, fmt.Errorf("generate TCP sequence: %w", err)
+		}
+		binary.BigEndian.PutUint32(l4[4:8], seq)
+		l4[12] = 5 << 4 // data offset
+		l4[13] = 0x18   // PSH, ACK
+		binary.BigEndian.PutUint16(l4[14:16], 65535)
+	}
+
+	var ip []byte
+	var etherType uint16
+	if v4src, v4dst := srcIP.To4(), dstIP.To4(); v4src != nil && v4dst != nil {
+		etherType = 0x0800
+		ip = make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(l4)+payloadLen))
+		ip[8] = 64
+		ip[9] = proto
+		copy(ip[12:16], v4src)
+		copy(ip[16:20], v4dst)
+		binary.BigEndian.PutUint16(ip[10:12], ipv4Checksum(ip))
+	} else {
+		etherType = 0x86DD
+		ip = make([]byte, 40)
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:6], uint16(len(l4)+payloadLen))
+		ip[6] = proto
+		ip[7] = 64
+		copy(ip[8:24], srcIP.To16())
+		copy(ip[24:40], dstIP.To16())
+	}
+
+	eth := make([]byte, 14)
+	for i := range 12 {
+		b, err := utils.RandomNum(0, 256)
+		if err != nil {
+			return RawPacketHeader{}, fmt.Errorf("generate MAC address: %w", err)
+		}
+		eth[i] = byte(b)
+	}
+	// Clear the multicast bit and set the locally administered bit on both MACs
+	eth[0] = eth[0]&0xfe | 0x02
+	eth[6] = eth[6]&0xfe | 0x02
+	binary.BigEndian.PutUint16(eth[12:14], etherType)
+
+	header := make([]byte, 0, len(eth)+len(ip)+len(l4))
+	header = append(header, eth...)
+	header = append(header, ip...)
+	header = append(header, l4...)
+	return RawPacketHeader{
+		HeaderProtocol: HeaderProtocolEthernet,
+		FrameLength:    uint32(len(header) + payloadLen + fcsLength),
+		Stripped:       fcsLength,
+		Header:         header,
+	}, nil
+}
+
+// ipv4Checksum computes the IPv4 header checksum with the checksum field zeroed.
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		if i == 10 {
+			continue
+		}
+		sum += uint32(binary.BigEndian.Uint16(header[i : i+2]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// HasSFlowHeader reports whether the payload starts with the 32-bit sFlow v5 version.
+// NetFlow and IPFIX use a 16-bit version, so their first 32 bits never equal 5.
+func HasSFlowHeader(payload []byte) bool {
+	return len(payload) >= 4 && binary.BigEndian.Uint32(payload[0:4]) == Version
+}
+
+// IsValidSFlow validates the given payload as a structurally correct sFlow v5 datagram.
+// Every sample and every flow/counter record length must fit exactly within its parent.
+// Samples and records in non-standard formats are length-checked but not inspected.
+func IsValidSFlow(payload []byte) (bool, error) {
+	if len(payload) < 8 {
+		return false, fmt.Errorf("payload too short for sFlow header: %d bytes", len(payload))
+	}
+	if version := binary.BigEndian.Uint32(payload[0:4]); version != Version {
+		return false, fmt.Errorf("header version doesn't match: got %d, expected %d", version, Version)
+	}
+	offset := 8
+	switch addrType := binary.BigEndian.Uint32(payload[4:8]); addrType {
+	case AddressIPv4:
+		offset += 4
+	case AddressIPv6:
+		offset += 16
+	default:
+		return false, fmt.Errorf("unknown agent address type %d", addrType)
+	}
+	if len(payload) < offset+16 {
+		return false, fmt.Errorf("payload too short for sFlow header: %d bytes", len(payload))
+	}
+	numSamples := binary.BigEndian.Uint32(payload[offset+12 : offset+16])
+	offset += 16
+
+	samples, err := walkStructures(payload[offset:], numSamples)
+	if err != nil {
+		return false, fmt.Errorf("samples: %w", err)
+	}
+	for i, s := range samples {
+		if s.format>>12 != 0 {
+			continue // enterprise-specific sample
+		}
+		var headerLen int
+		switch s.format {
+		case FlowSampleFormat:
+			headerLen = 32
+		case CounterSampleFormat:
+			headerLen = 12
+		default:
+			continue
+		}
+		if len(s.body) < headerLen {
+			return false, fmt.Errorf("sample %d too short: %d bytes", i, len(s.body))
+		}
+		numRecords := binary.BigEndian.Uint32(s.body[headerLen-4 : headerLen])
+		if _, err := walkStructures(s.body[headerLen:], numRecords); err != nil {
+			return false, fmt.Errorf("sample %d records: %w", i, err)
+		}
+	}
+	return true, nil
+}
+
+// opaque is a data_format/body pair decoded from an sFlow datagram.
+type opaque struct {
+	format uint32
+	body   []byte
+}
+
+// walkStructures splits data into exactly count data_format/length/body structures.
+func walkStructures(data []byte, count uint32) ([]opaque, error) {
+	// Each structure needs at least 8 bytes, which bounds count before allocating
+	if uint64(count)*8 > uint64(len(data)) {
+		return nil, fmt.Errorf("count %d exceeds remaining %d bytes", count, len(data))
+	}
+	out := make([]opaque, 0, count)
+	offset := 0
+	for i := range count {
+		if len(data)-offset < 8 {
+			return nil, fmt.Errorf("structure %d: truncated header", i)
+		}
+		format := binary.BigEndian.Uint32(data[offset : offset+4])
+		length := int(binary.BigEndian.Uint32(data[offset+4 : offset+8]))
+		offset += 8
+		if length%4 != 0 {
+			return nil, fmt.Errorf("structure %d: length %d is not 4-byte aligned", i, length)
+		}
+		if length > len(data)-offset {
+			return nil, fmt.Errorf("structure %d: length %d exceeds remaining %d bytes", i, length, len(data)-offset)
+		}
+		out = append(out, opaque{format: format, body: data[offset : offset+length]})
+		offset += length
+	}
+	if offset != len(data) {
+		return nil, fmt.Errorf("%d trailing bytes", len(data)-offset)
+	}
+	return out, nil
+}
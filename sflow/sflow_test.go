@@ -0,0 +1,202 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package sflow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/utils"
+)
+
+func TestGenericInterfaceCountersSize(t *testing.T) {
+	t.Parallel()
+	if size := binary.Size(GenericInterfaceCounters{}); size != genericCountersSize {
+		t.Errorf("GenericInterfaceCounters size wrong! Got: %d Want: %d", size, genericCountersSize)
+	}
+}
+
+func TestGenerateDatagram(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		srcRange  string
+		dstRange  string
+		addrType  uint32
+		etherType uint16
+	}{
+		{"ipv4", "10.0.0.0/8", "192.168.0.0/16", AddressIPv4, 0x0800},
+		{"ipv6", "2001:db8:1::/48", "2001:db8:2::/48", AddressIPv6, 0x86DD},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			session := netflow.NewSession()
+			agent := NewAgent()
+
+			d, err := GenerateDatagram(10, 618, tt.srcRange, tt.dstRange, utils.DNSPort, session, agent)
+			if err != nil {
+				t.Fatalf("GenerateDatagram failed: %v", err)
+			}
+			if len(d.FlowSamples) != 10 || len(d.CounterSamples) != 1 {
+				t.Fatalf("sample counts wrong! Got: %d flow, %d counter", len(d.FlowSamples), len(d.CounterSamples))
+			}
+			if d.SubAgentID != 618 {
+				t.Errorf("SubAgentID wrong! Got: %d Want: 618", d.SubAgentID)
+			}
+			for i, fs := range d.FlowSamples {
+				if fs.SequenceNumber != uint32(i+1) {
+					t.Errorf("flow sample %d: sequence %d, want %d", i, fs.SequenceNumber, i+1)
+				}
+				hdr := fs.Records[0].Header
+				if got := binary.BigEndian.Uint16(hdr[12:14]); got != tt.etherType {
+					t.Errorf("flow sample %d: ethertype %#x, want %#x", i, got, tt.etherType)
+				}
+				if fs.Records[0].FrameLength < uint32(len(hdr)) {
+					t.Errorf("flow sample %d: frame length %d shorter than header %d", i, fs.Records[0].FrameLength, len(hdr))
+				}
+			}
+
+			buf, err := d.ToBytes()
+			if err != nil {
+				t.Fatalf("ToBytes failed: %v", err)
+			}
+			payload := buf.Bytes()
+			if got := binary.BigEndian.Uint32(payload[4:8]); got != tt.addrType {
+				t.Errorf("agent address type wrong! Got: %d Want: %d", got, tt.addrType)
+			}
+			if ok, err := IsValidSFlow(payload); !ok {
+				t.Errorf("generated datagram is not valid: %v", err)
+			}
+
+			// The agent keeps its address and advances its sequences
+			d2, err := GenerateDatagram(3, 618, tt.srcRange, tt.dstRange, 0, session, agent)
+			if err != nil {
+				t.Fatalf("GenerateDatagram failed: %v", err)
+			}
+			if !d2.AgentAddress.Equal(d.AgentAddress) {
+				t.Errorf("agent address changed: %s -> %s", d.AgentAddress, d2.AgentAddress)
+			}
+			if d2.SequenceNumber != 2 || d2.FlowSamples[0].SequenceNumber != 11 || d2.CounterSamples[0].SequenceNumber != 2 {
+				t.Errorf("sequences not advanced: datagram %d flow %d counter %d",
+					d2.SequenceNumber, d2.FlowSamples[0].SequenceNumber, d2.CounterSamples[0].SequenceNumber)
+			}
+		})
+	}
+}
+
+func TestGenerateDatagramErrors(t *testing.T) {
+	t.Parallel()
+	session := netflow.NewSession()
+	if _, err := GenerateDatagram(0, 1, "10.0.0.0/8", "10.0.0.0/8", 0, session, NewAgent()); err == nil {
+		t.Error("expected error for zero flows")
+	}
+	if _, err := GenerateDatagram(5, 1, "bogus", "10.0.0.0/8", 0, session, NewAgent()); err == nil {
+		t.Error("expected error for invalid range")
+	}
+}
+
+func TestRawPacketHeaderIPv4Checksum(t *testing.T) {
+	t.Parallel()
+	rec, err := generateRawPacketHeader([]byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}, utils.HTTPSPort)
+	if err != nil {
+		t.Fatalf("generateRawPacketHeader failed: %v", err)
+	}
+	ip := rec.Header[14:34]
+	// Summing a header including its checksum yields 0xffff
+	var sum uint32
+	for i := 0; i < len(ip); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(ip[i : i+2]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	if sum != 0xffff {
+		t.Errorf("IPv4 header checksum invalid: sum %#x", sum)
+	}
+	if ip[9] != utils.TCPProto {
+		t.Errorf("protocol wrong! Got: %d Want: %d", ip[9], utils.TCPProto)
+	}
+}
+
+func TestIsValidSFlow(t *testing.T) {
+	t.Parallel()
+	d, err := GenerateDatagram(3, 1, "10.0.0.0/8", "10.0.0.0/8", 0, netflow.NewSession(), NewAgent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := d.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	badVersion := bytes.Clone(valid)
+	binary.BigEndian.PutUint32(badVersion[0:4], 4)
+	badAddrType := bytes.Clone(valid)
+	binary.BigEndian.PutUint32(badAddrType[4:8], 3)
+	extraSamples := bytes.Clone(valid)
+	binary.BigEndian.PutUint32(extraSamples[24:28], 5)
+	hugeSamples := bytes.Clone(valid)
+	binary.BigEndian.PutUint32(hugeSamples[24:28], 0xffffffff)
+	badSampleLen := bytes.Clone(valid)
+	binary.BigEndian.PutUint32(badSampleLen[32:36], 6)
+	badRecordCount := bytes.Clone(valid)
+	// num records of the first flow sample: header(28) + format/len(8) + 28
+	binary.BigEndian.PutUint32(badRecordCount[64:68], 2)
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{"valid", valid, true},
+		{"short", valid[:6], false},
+		{"truncated", valid[:len(valid)-4], false},
+		{"trailing bytes", append(bytes.Clone(valid), 0, 0, 0, 0), false},
+		{"wrong version", badVersion, false},
+		{"bad address type", badAddrType, false},
+		{"sample count too large", extraSamples, false},
+		{"sample count huge", hugeSamples, false},
+		{"unaligned sample length", badSampleLen, false},
+		{"record count mismatch", badRecordCount, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := IsValidSFlow(tt.payload)
+			if got != tt.want {
+				t.Errorf("IsValidSFlow() = %v, want %v (err: %v)", got, tt.want, err)
+			}
+			if !tt.want && err == nil {
+				t.Error("expected an error for invalid payload")
+			}
+		})
+	}
+}
+
+func TestHasSFlowHeader(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		payload []byte
+		want    bool
+	}{
+		{"sflow", []byte{0, 0, 0, 5, 0, 0, 0, 1}, true},
+		{"netflow v5", []byte{0, 5, 0, 10}, false},
+		{"netflow v9", []byte{0, 9, 0, 1}, false},
+		{"ipfix", []byte{0, 10, 0, 64}, false},
+		{"short", []byte{0, 0, 0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := HasSFlowHeader(tt.payload); got != tt.want {
+				t.Errorf("HasSFlowHeader() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,11 +10,12 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
-	"net"
 	"os"
 
 	"github.com/dmabry/flowgre/lifecycle"
 	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/netflowv5"
+	"github.com/dmabry/flowgre/transport"
 	"github.com/dmabry/flowgre/utils"
 )
 
@@ -27,12 +28,67 @@ const (
 	sourceIDMax = 10000
 )
 
+// packet is a generated packet and the size summary printed before it's sent.
+type packet struct {
+	bytes []byte
+	sizes string
+}
+
+// generator sets up packet generation for the random source ID of a run. It
+// returns the template sent ahead of the data packets, nil if the protocol has
+// none, and a func generating each data packet.
+type generator func(sourceID int) (template *packet, data func() (packet, error))
+
 // RunCtx creates the given number of Netflow packets, including the required
 // Template, for a Single run with an external context. Cancelling ctx stops
-// packet generation cleanly. Use Run() for CLI usage where OS signal handling
+// packet generation cleanly. Packets are sent over the Transport dial opens,
+// or over UDP if dial is nil. Use Run() for CLI usage where OS signal handling
 // is desired.
-func RunCtx(ctx context.Context, collectorIP string, destPort int, srcPort int, count int, srcRange string, dstRange string, hexDump bool) error {
-	// Configure connection to use. It looks like a listener, but it will be used to send packet. Allows setting the source port.
+func RunCtx(ctx context.Context, collectorIP string, destPort int, srcPort int, count int, srcRange string, dstRange string, hexDump bool, dial transport.Dialer) error {
+	return run(ctx, collectorIP, destPort, srcPort, count, hexDump, dial, "Data Flows", func(sourceID int) (*packet, func() (packet, error)) {
+		// Create new session for flow generation
+		session := netflow.NewSession()
+		tFlow := netflow.GenerateTemplateNetflow(sourceID, session)
+		tBuf := tFlow.ToBytes()
+		template := &packet{bytes: tBuf.Bytes(), sizes: netflow.GetNetFlowSizes(tFlow)}
+		return template, func() (packet, error) {
+			flow, err := netflow.GenerateDataNetflow(10, sourceID, srcRange, dstRange, 0, session)
+			if err != nil {
+				return packet{}, fmt.Errorf("GenerateDataNetflow failed: %w", err)
+			}
+			buf := flow.ToBytes()
+			return packet{bytes: buf.Bytes(), sizes: netflow.GetNetFlowSizes(flow)}, nil
+		}
+	})
+}
+
+// RunV5Ctx creates the given number of NetFlow v5 packets for a Single run
+// with an external context. NetFlow v5 has no templates, so only data packets
+// are sent. Cancelling ctx stops packet generation cleanly. Packets are sent
+// over the Transport dial opens, or over UDP if dial is nil. Use RunV5() for
+// CLI usage where OS signal handling is desired.
+func RunV5Ctx(ctx context.Context, collectorIP string, destPort int, srcPort int, count int, srcRange string, dstRange string, hexDump bool, dial transport.Dialer) error {
+	return run(ctx, collectorIP, destPort, srcPort, count, hexDump, dial, "NetFlow v5 Data Flows", func(sourceID int) (*packet, func() (packet, error)) {
+		// The sourceID is carried in the v5 engine type/ID bytes
+		session := netflow.NewSession()
+		seq := netflowv5.NewSequence()
+		return nil, func() (packet, error) {
+			flow, err := netflowv5.GenerateNetflowV5(10, sourceID, srcRange, dstRange, 0, session, seq)
+			if err != nil {
+				return packet{}, fmt.Errorf("GenerateNetflowV5 failed: %w", err)
+			}
+			buf, err := flow.ToBytes()
+			if err != nil {
+				return packet{}, fmt.Errorf("NetFlow v5 ToBytes: %w", err)
+			}
+			return packet{bytes: buf.Bytes(), sizes: netflowv5.GetNetFlowV5Sizes(flow)}, nil
+		}
+	})
+}
+
+// run sends the template and count data packets gen makes to the collector,
+// stopping early when ctx is cancelled. name describes the data packets.
+func run(ctx context.Context, collectorIP string, destPort int, srcPort int, count int, hexDump bool, dial transport.Dialer, name string, gen generator) error {
 	if srcPort == 0 {
 		// Pick random source port between 10000 and 15000
 		var err error
@@ -47,34 +103,26 @@ func RunCtx(ctx context.Context, collectorIP string, destPort int, srcPort int,
 		return fmt.Errorf("generate source ID: %w", err)
 	}
 
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: srcPort})
-	if err != nil {
-		return fmt.Errorf("listen: %w", err)
+	if dial == nil {
+		dial = transport.Network{}
 	}
-	defer conn.Close()
-	// Convert given IP String to net.IP type
-	destIP := net.ParseIP(collectorIP)
-	if destIP == nil {
-		return fmt.Errorf("failed to parse destination IP %s", collectorIP)
-	}
-	// Create new session for flow generation
-	session := netflow.NewSession()
-
-	// Generate and send first Template Flow(s)
-	tFlow := netflow.GenerateTemplateNetflow(sourceID, session)
-	tBuf := tFlow.ToBytes()
-	fmt.Printf("\nSending Template Flow\n\n")
-	fmt.Println(netflow.GetNetFlowSizes(tFlow))
-	if hexDump {
-		fmt.Printf("%s", hex.Dump(tBuf.Bytes()))
-	}
-	_, err = utils.SendPacket(conn, &net.UDPAddr{IP: destIP, Port: destPort}, tBuf.Bytes(), true)
+	t, err := dial.Dial(collectorIP, destPort, srcPort)
 	if err != nil {
-		return fmt.Errorf("flowgre had an issue sending packet: %w", err)
+		return err
+	}
+	defer t.Close()
+
+	template, data := gen(sourceID)
+	// Send first Template Flow(s)
+	if template != nil {
+		fmt.Printf("\nSending Template Flow\n\n")
+		if err := send(t, *template, hexDump); err != nil {
+			return err
+		}
 	}
 
 	// Generate and send Data Flow(s)
-	fmt.Printf("\nSending Data Flows\n\n")
+	fmt.Printf("\nSending %s\n\n", name)
 	for i := 1; i <= count; i++ {
 		select {
 		case <-ctx.Done():
@@ -82,23 +130,29 @@ func RunCtx(ctx context.Context, collectorIP string, destPort int, srcPort int,
 			return nil
 		default:
 		}
-		flow, err := netflow.GenerateDataNetflow(10, sourceID, srcRange, dstRange, 0, session)
+		p, err := data()
 		if err != nil {
-			return fmt.Errorf("GenerateDataNetflow failed: %w", err)
+			return err
 		}
-		buf := flow.ToBytes()
-		fmt.Println(netflow.GetNetFlowSizes(flow))
-		if hexDump {
-			fmt.Printf("%s", hex.Dump(buf.Bytes()))
-		}
-		_, err = utils.SendPacket(conn, &net.UDPAddr{IP: destIP, Port: destPort}, buf.Bytes(), true)
-		if err != nil {
-			return fmt.Errorf("flowgre had an issue sending packet: %w", err)
+		if err := send(t, p, hexDump); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// send prints the packet's sizes, and its hex dump if asked, then sends it.
+func send(t transport.Transport, p packet, hexDump bool) error {
+	fmt.Println(p.sizes)
+	if hexDump {
+		fmt.Printf("%s", hex.Dump(p.bytes))
+	}
+	if _, err := t.Send(p.bytes); err != nil {
+		return fmt.Errorf("flowgre had an issue sending packet: %w", err)
+	}
+	return nil
+}
+
 // Run Creates the given number of Netflow packets, including the required
 // Template, for a Single run. Creates the packets and puts them on the wire to
 // the targeted host. Sets up OS signal handling (SIGINT/SIGTERM) for clean
@@ -110,7 +164,25 @@ func Run(collectorIP string, destPort int, srcPort int, count int, srcRange stri
 	// Setup signal handling via lifecycle manager
 	_ = mgr.SetupSignalHandler()
 
-	if err := RunCtx(mgr.Context(), collectorIP, destPort, srcPort, count, srcRange, dstRange, hexDump); err != nil {
+	if err := RunCtx(mgr.Context(), collectorIP, destPort, srcPort, count, srcRange, dstRange, hexDump, transport.Network{Verbose: true}); err != nil {
+		fmt.Fprintf(os.Stderr, "single error: %v\n", err)
+		os.Exit(1)
+	}
+	mgr.Wait()
+}
+
+// RunV5 creates the given number of NetFlow v5 packets for a Single run and
+// puts them on the wire to the targeted host. Sets up OS signal handling
+// (SIGINT/SIGTERM) for clean shutdown. Use RunV5Ctx() when you need to control
+// the lifecycle via context.
+func RunV5(collectorIP string, destPort int, srcPort int, count int, srcRange string, dstRange string, hexDump bool) {
+	mgr := lifecycle.New()
+	defer mgr.Cancel()
+
+	// Setup signal handling via lifecycle manager
+	_ = mgr.SetupSignalHandler()
+
+	if err := RunV5Ctx(mgr.Context(), collectorIP, destPort, srcPort, count, srcRange, dstRange, hexDump, transport.Network{Verbose: true}); err != nil {
 		fmt.Fprintf(os.Stderr, "single error: %v\n", err)
 		os.Exit(1)
 	}
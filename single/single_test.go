@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/transport"
 )
 
 const udpMaxBufferSize = 65507
@@ -124,3 +125,27 @@ func TestRun(t *testing.T) {
 	cancel()
 	wg.Wait()
 }
+
+// TestRunCtxDialer tests that the template and data packets go out over the
+// Transport the Dialer opens.
+func TestRunCtxDialer(t *testing.T) {
+	origStdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull) // hide all stdout from single
+	defer func() { os.Stdout = origStdout }()
+
+	c := transport.NewChan(16)
+	if err := RunCtx(context.Background(), "127.0.0.1", 9995, 0, 5, "10.10.10.0/28", "10.11.11.0/28", false, transport.Shared(c)); err != nil {
+		t.Fatalf("RunCtx failed! Got: %v", err)
+	}
+	c.Close()
+	packets := 0
+	for payload := range c.Packets() {
+		if ok, err := netflow.IsValidNetFlow(payload, 9); !ok {
+			t.Errorf("Invalid NetFlow Packet: %v", err)
+		}
+		packets++
+	}
+	if packets != 6 {
+		t.Errorf("Packets sent wrong! Got: %d Want: 6", packets)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/dmabry/flowgre/loadshape"
 	"github.com/dmabry/flowgre/models"
 	"github.com/dmabry/flowgre/web/templates"
 	"html/template"
@@ -37,6 +38,11 @@ type Collector struct {
 	Config      *models.Config
 	StartTime   time.Time             // when the barrage started
 	History     []models.StatSnapshot // rolling history of stat snapshots
+	Shape       loadshape.Shape       // optional load shape applied to the rate target
+
+	rate      models.RateStat // achieved vs target rate over the last interval
+	rateSince time.Time       // start of the current rate interval
+	rateCount uint64          // rate counter at rateSince
 }
 
 // Run starts the stat collection loop. It reads from StatsChan and aggregates totals.
@@ -47,10 +53,13 @@ func (sc *Collector) Run(wg *sync.WaitGroup, ctx context.Context) {
 	sizeLabel := "bytes"
 	var sizeOut uint64
 
-	// Periodic ticker for periodic logging/heartbeat (unused here but keeps
-	// the loop from blocking indefinitely when no stats arrive).
+	// Periodic ticker for rate reporting; it also keeps the loop from
+	// blocking indefinitely when no stats arrive.
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
+	sc.mu.Lock()
+	sc.updateRate(time.Now())
+	sc.mu.Unlock()
 
 	for {
 		select {
@@ -69,20 +78,9 @@ func (sc *Collector) Run(wg *sync.WaitGroup, ctx context.Context) {
 				default:
 					sizeOut = stat.BytesSent
 				}
-				log.Printf("Worker [%2d] SourceID: %4d Cycles: %d Flows Sent: %d Bytes Sent: %d %s\n",
-					stat.WorkerID, stat.SourceID, stat.Cycles, stat.FlowsSent, sizeOut, sizeLabel)
-				sc.mu.Lock()
-				sc.StatsMap[stat.WorkerID] = stat
-				// Recalculate totals from map to avoid double-counting cumulative stats
-				sc.StatsTotals = models.StatTotals{}
-				for _, s := range sc.StatsMap {
-					sc.StatsTotals.Cycles += s.Cycles
-					sc.StatsTotals.FlowsSent += s.FlowsSent
-					sc.StatsTotals.BytesSent += s.BytesSent
-				}
-				// Append a history snapshot
-				sc.appendSnapshot()
-				sc.mu.Unlock()
+				log.Printf("%sWorker [%2d] SourceID: %4d Cycles: %d Flows Sent: %d Bytes Sent: %d %s\n",
+					sc.logPrefix(), stat.WorkerID, stat.SourceID, stat.Cycles, stat.FlowsSent, sizeOut, sizeLabel)
+				sc.record(stat)
 			} else {
 				log.Println("Stats Channel Closed!")
 				return
@@ -90,13 +88,47 @@ func (sc *Collector) Run(wg *sync.WaitGroup, ctx context.Context) {
 		case <-ctx.Done():
 			log.Printf("Stats Collector Exiting due to signal\n")
 			return
-		case <-ticker.C:
-			// Periodic tick — nothing to do, just keeps the loop alive
-			// so it doesn't block forever when no stats arrive.
+		case now := <-ticker.C:
+			sc.mu.Lock()
+			sc.updateRate(now)
+			sc.mu.Unlock()
 		}
 	}
 }
 
+// name returns the target name, or "default" for an unnamed target.
+func (sc *Collector) name() string {
+	if sc.Config == nil || sc.Config.Name == "" {
+		return "default"
+	}
+	return sc.Config.Name
+}
+
+// logPrefix returns the target name followed by a space for named targets,
+// so the logs of several targets can be told apart.
+func (sc *Collector) logPrefix() string {
+	if sc.Config == nil || sc.Config.Name == "" {
+		return ""
+	}
+	return sc.Config.Name + " "
+}
+
+// record stores the latest cumulative stat for a worker and updates the totals.
+func (sc *Collector) record(stat models.WorkerStat) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.StatsMap[stat.WorkerID] = stat
+	// Recalculate totals from map to avoid double-counting cumulative stats
+	sc.StatsTotals = models.StatTotals{}
+	for _, s := range sc.StatsMap {
+		sc.StatsTotals.Cycles += s.Cycles
+		sc.StatsTotals.FlowsSent += s.FlowsSent
+		sc.StatsTotals.BytesSent += s.BytesSent
+	}
+	// Append a history snapshot
+	sc.appendSnapshot()
+}
+
 // appendSnapshot appends a point-in-time snapshot to the rolling history buffer.
 // Must be called with sc.mu held (write lock).
 func (sc *Collector) appendSnapshot() {
@@ -104,10 +136,13 @@ func (sc *Collector) appendSnapshot() {
 	for k, v := range sc.StatsMap {
 		workersCopy[k] = v
 	}
+	now := time.Now()
+	target, unit := sc.targetAt(now)
 	snapshot := models.StatSnapshot{
-		Timestamp: time.Now(),
+		Timestamp: now,
 		Totals:    sc.StatsTotals,
 		Workers:   workersCopy,
+		Rate:      models.RateStat{Unit: unit, Target: target, Achieved: sc.rate.Achieved},
 	}
 	sc.History = append(sc.History, snapshot)
 	if len(sc.History) > MaxHistory {
@@ -123,12 +158,15 @@ func (sc *Collector) StatsHandler(w http.ResponseWriter, r *http.Request) {
 		statsCopy[k] = v
 	}
 	totalsCopy := sc.StatsTotals
+	rateCopy := sc.rate
+	rateCopy.Target, rateCopy.Unit = sc.targetAt(time.Now())
 	sc.mu.RUnlock()
 
-	// Return both per-worker stats and totals in a single response for the dashboard
+	// Return per-worker stats, totals and the send rate in a single response for the dashboard
 	response := map[string]any{
 		"workers": statsCopy,
 		"totals":  totalsCopy,
+		"rate":    rateCopy,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -159,20 +197,7 @@ func (sc *Collector) HistoryHandler(w http.ResponseWriter, r *http.Request) {
 // request to avoid repeated template parsing overhead.
 var dashboardTmpl = func() *template.Template {
 	t, err := template.New("dashboard").Funcs(template.FuncMap{
-		"formatBytes": func(bytes uint64) string {
-			if bytes == 0 {
-				return "0 B"
-			}
-			const unit = 1024
-			const units = "BKMG"
-			i := 0
-			f := float64(bytes)
-			for f >= unit && i < len(units)-1 {
-				f /= unit
-				i++
-			}
-			return fmt.Sprintf("%.1f %sB", f, string(units[i]))
-		},
+		"formatBytes": formatBytes,
 	}).Parse(templates.DashboardTpl)
 	if err != nil {
 		log.Printf("[WARN] Failed to parse dashboard template: %v", err)
@@ -225,9 +250,45 @@ func (sc *Collector) DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Stop closes the stats channel gracefully.
+// Stop closes the stats channel gracefully. Call it once all workers have
+// exited; stats still queued in the channel are added to the totals.
 func (sc *Collector) Stop() {
 	close(sc.StatsChan)
+	for stat := range sc.StatsChan {
+		sc.record(stat)
+	}
+}
+
+// Summary describes the totals sent since StartTime, for printing when a barrage ends.
+func (sc *Collector) Summary() string {
+	sc.mu.RLock()
+	totals := sc.StatsTotals
+	sc.mu.RUnlock()
+
+	elapsed := time.Since(sc.StartTime)
+	summary := fmt.Sprintf("Sent %d packets, %d flows and %s in %s",
+		totals.Cycles, totals.FlowsSent, formatBytes(totals.BytesSent), elapsed.Round(time.Millisecond))
+	if secs := elapsed.Seconds(); secs > 0 {
+		summary += fmt.Sprintf(" (%.1f packets/s, %.1f flows/s)",
+			float64(totals.Cycles)/secs, float64(totals.FlowsSent)/secs)
+	}
+	return summary
+}
+
+// formatBytes formats a byte count with a binary unit suffix.
+func formatBytes(bytes uint64) string {
+	if bytes == 0 {
+		return "0 B"
+	}
+	const unit = 1024
+	const units = "BKMG"
+	i := 0
+	f := float64(bytes)
+	for f >= unit && i < len(units)-1 {
+		f /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %sB", f, string(units[i]))
 }
 
 // humanizeDuration formats a duration as a human-readable string.
@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dmabry/flowgre/loadshape"
 	"github.com/dmabry/flowgre/models"
 )
 
@@ -384,3 +385,98 @@ func TestHumanizeDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestRateTarget(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		cfg    *models.Config
+		target float64
+		unit   string
+	}{
+		{"nil config", nil, 0, UnitPackets},
+		{"delay", &models.Config{Delay: 100}, 0, UnitPackets},
+		{"flows", &models.Config{FlowsPerSecond: 1000}, 1000, UnitFlows},
+		{"packets", &models.Config{PacketsPerSecond: 50}, 50, UnitPackets},
+		{"bits", &models.Config{BitsPerSecond: 1_000_000}, 1_000_000, UnitBits},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			target, unit := RateTarget(tt.cfg)
+			if target != tt.target || unit != tt.unit {
+				t.Errorf("RateTarget() = %v %s, want %v %s", target, unit, tt.target, tt.unit)
+			}
+		})
+	}
+}
+
+func TestCollector_UpdateRate(t *testing.T) {
+	t.Parallel()
+
+	sc := newTestCollector()
+	sc.Config.FlowsPerSecond = 1000
+	start := time.Now()
+	sc.updateRate(start)
+	sc.StatsTotals = models.StatTotals{FlowsSent: 4000, Cycles: 200, BytesSent: 100000}
+	sc.updateRate(start.Add(5 * time.Second))
+
+	rate := sc.Rate()
+	if rate.Unit != UnitFlows || rate.Target != 1000 || rate.Achieved != 800 {
+		t.Errorf("rate wrong! Got: %+v Want: 800 of 1000 flows/s", rate)
+	}
+}
+
+func TestCollector_ShapedTarget(t *testing.T) {
+	t.Parallel()
+
+	sc := newTestCollector()
+	sc.Config.Workers = 4
+	sc.Config.Delay = 100
+	sc.Shape = loadshape.Ramp{From: 10, To: 100, Over: 10 * time.Second}
+
+	// Delay mode with a shape targets workers * 1000/delay packets/s at 100%
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+	}{
+		{0, 4},
+		{5 * time.Second, 22},
+		{time.Minute, 40},
+	}
+	for _, tt := range tests {
+		target, unit := sc.targetAt(sc.StartTime.Add(tt.elapsed))
+		if unit != UnitPackets || target != tt.want {
+			t.Errorf("target at %v wrong! Got: %v %s Want: %v %s", tt.elapsed, target, unit, tt.want, UnitPackets)
+		}
+	}
+
+	// Snapshots carry the target curve alongside the achieved rate
+	sc.rate.Achieved = 3
+	sc.appendSnapshot()
+	rate := sc.History[len(sc.History)-1].Rate
+	if rate.Unit != UnitPackets || rate.Target < 4 || rate.Target > 5 || rate.Achieved != 3 {
+		t.Errorf("snapshot rate wrong! Got: %+v Want: ~4 target, 3 achieved packets/s", rate)
+	}
+}
+
+func TestCollector_StopAndSummary(t *testing.T) {
+	t.Parallel()
+
+	sc := newTestCollector()
+	sc.StartTime = time.Now().Add(-2 * time.Second)
+	// Stats still queued when the collector is stopped count towards the totals
+	sc.StatsChan <- models.WorkerStat{WorkerID: 1, Cycles: 10, FlowsSent: 100, BytesSent: 2048}
+	sc.StatsChan <- models.WorkerStat{WorkerID: 2, Cycles: 30, FlowsSent: 300, BytesSent: 1024}
+	sc.Stop()
+
+	if sc.StatsTotals.Cycles != 40 || sc.StatsTotals.FlowsSent != 400 {
+		t.Errorf("totals wrong! Got: %+v Want: 40 cycles, 400 flows", sc.StatsTotals)
+	}
+	summary := sc.Summary()
+	for _, want := range []string{"40 packets", "400 flows", "3.0 KB", "flows/s"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q! Got: %s", want, summary)
+		}
+	}
+}
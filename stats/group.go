@@ -0,0 +1,152 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dmabry/flowgre/models"
+)
+
+// Group serves the stats of several barrage targets, one Collector each, as a
+// single web API and dashboard with a per-target breakdown. Targets are
+// identified by their Config.Name.
+type Group struct {
+	Targets []*Collector
+}
+
+// targetStats returns the per-target breakdown, the combined totals and the
+// combined worker stats keyed by "target/worker".
+func (g *Group) targetStats() ([]models.TargetStat, models.StatTotals, map[string]models.WorkerStat) {
+	targets := make([]models.TargetStat, 0, len(g.Targets))
+	var totals models.StatTotals
+	workers := make(map[string]models.WorkerStat)
+	now := time.Now()
+	for _, sc := range g.Targets {
+		sc.mu.RLock()
+		ts := models.TargetStat{
+			Totals: sc.StatsTotals,
+			Rate:   sc.rate,
+		}
+		ts.Rate.Target, ts.Rate.Unit = sc.targetAt(now)
+		for id, w := range sc.StatsMap {
+			workers[fmt.Sprintf("%s/%d", sc.name(), id)] = w
+		}
+		sc.mu.RUnlock()
+		if sc.Config != nil {
+			ts.Name = sc.Config.Name
+			ts.Server = sc.Config.Server
+			ts.DstPort = sc.Config.DstPort
+			ts.Protocol = sc.Config.Protocol
+			ts.Profile = sc.Config.Profile
+			ts.Workers = sc.Config.Workers
+		}
+		totals.Cycles += ts.Totals.Cycles
+		totals.FlowsSent += ts.Totals.FlowsSent
+		totals.BytesSent += ts.Totals.BytesSent
+		targets = append(targets, ts)
+	}
+	return targets, totals, workers
+}
+
+// combinedRate sums the target rates when they share a unit, as they must to
+// be charted together. Otherwise it returns a zero rate.
+func combinedRate(targets []models.TargetStat) models.RateStat {
+	var rate models.RateStat
+	for i, ts := range targets {
+		if i > 0 && ts.Rate.Unit != rate.Unit {
+			return models.RateStat{}
+		}
+		rate.Unit = ts.Rate.Unit
+		rate.Target += ts.Rate.Target
+		rate.Achieved += ts.Rate.Achieved
+	}
+	return rate
+}
+
+// StatsHandler emits combined and per-target stats as JSON for the web API.
+func (g *Group) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	targets, totals, workers := g.targetStats()
+	response := map[string]any{
+		"workers": workers,
+		"totals":  totals,
+		"rate":    combinedRate(targets),
+		"targets": targets,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Printf("Web server had an issue: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HistoryHandler returns each target's time-series stats keyed by target name.
+func (g *Group) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	history := make(map[string][]models.StatSnapshot, len(g.Targets))
+	for _, sc := range g.Targets {
+		sc.mu.RLock()
+		history[sc.name()] = slices.Clone(sc.History)
+		sc.mu.RUnlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(history)
+	if err != nil {
+		log.Printf("Web server had an issue: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// DashboardHandler renders the dashboard HTML page with a per-target breakdown.
+func (g *Group) DashboardHandler(w http.ResponseWriter, r *http.Request) {
+	targets, totals, _ := g.targetStats()
+
+	// The summary cards show every worker; the per-target table replaces the config section
+	config := &models.Config{}
+	var protocols []string
+	var start time.Time
+	for i, sc := range g.Targets {
+		if sc.Config != nil {
+			config.Workers += sc.Config.Workers
+			if !slices.Contains(protocols, sc.Config.Protocol) {
+				protocols = append(protocols, sc.Config.Protocol)
+			}
+		}
+		if i == 0 || sc.StartTime.Before(start) {
+			start = sc.StartTime
+		}
+	}
+	var uptimeStr string
+	if !start.IsZero() {
+		uptimeStr = humanizeDuration(time.Since(start))
+	}
+
+	d := models.DashboardPage{
+		Title:   "Flowgre Dashboard",
+		Comment: "Basic metrics about flowgre",
+		HealthOut: models.Health{
+			Status:  "OK",
+			Message: "Flowgre is Flinging Packets!",
+		},
+		ConfigOut:  config,
+		StatsTotal: totals,
+		Protocol:   strings.Join(protocols, ", "),
+		StartTime:  start,
+		Uptime:     uptimeStr,
+		Targets:    targets,
+	}
+
+	err := dashboardTmpl.Execute(w, d)
+	if err != nil {
+		log.Printf("Web server had issue: %v\n", err)
+	}
+}
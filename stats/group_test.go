@@ -0,0 +1,120 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package stats
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dmabry/flowgre/models"
+)
+
+// newTestGroup creates a Group of two targets with stats from one worker each.
+func newTestGroup() *Group {
+	primary := newTestCollector()
+	primary.Config = &models.Config{Name: "primary", Server: "192.0.2.1", DstPort: 2055, Protocol: "netflow", Workers: 2}
+	primary.StatsMap[1] = models.WorkerStat{WorkerID: 1, FlowsSent: 100, Cycles: 10, BytesSent: 2048}
+	primary.StatsTotals = models.StatTotals{FlowsSent: 100, Cycles: 10, BytesSent: 2048}
+
+	standby := newTestCollector()
+	standby.Config = &models.Config{Name: "standby", Server: "192.0.2.2", DstPort: 4739, Protocol: "ipfix", Profile: "minimal", Workers: 3}
+	standby.StatsMap[1] = models.WorkerStat{WorkerID: 1, FlowsSent: 30, Cycles: 3, BytesSent: 1024}
+	standby.StatsTotals = models.StatTotals{FlowsSent: 30, Cycles: 3, BytesSent: 1024}
+
+	return &Group{Targets: []*Collector{primary, standby}}
+}
+
+func TestGroup_StatsHandler(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	newTestGroup().StatsHandler(rec, httptest.NewRequest("GET", "/stats", nil))
+
+	var response struct {
+		Workers map[string]models.WorkerStat `json:"workers"`
+		Totals  models.StatTotals            `json:"totals"`
+		Targets []models.TargetStat          `json:"targets"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to unmarshal stats: %v", err)
+	}
+	if response.Totals.FlowsSent != 130 || response.Totals.Cycles != 13 {
+		t.Errorf("combined totals wrong! Got: %+v Want: 130 flows, 13 cycles", response.Totals)
+	}
+	if _, ok := response.Workers["primary/1"]; !ok || len(response.Workers) != 2 {
+		t.Errorf("workers should be keyed by target, got %v", response.Workers)
+	}
+	if len(response.Targets) != 2 {
+		t.Fatalf("expected 2 targets, got %d", len(response.Targets))
+	}
+	standby := response.Targets[1]
+	if standby.Name != "standby" || standby.Protocol != "ipfix" || standby.Profile != "minimal" ||
+		standby.Workers != 3 || standby.Totals.FlowsSent != 30 {
+		t.Errorf("standby target wrong! Got: %+v", standby)
+	}
+}
+
+func TestGroup_HistoryHandler(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGroup()
+	for _, sc := range g.Targets {
+		sc.appendSnapshot()
+	}
+	rec := httptest.NewRecorder()
+	g.HistoryHandler(rec, httptest.NewRequest("GET", "/stats/history", nil))
+
+	var history map[string][]models.StatSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to unmarshal history: %v", err)
+	}
+	if len(history["primary"]) != 1 || len(history["standby"]) != 1 {
+		t.Errorf("expected one snapshot per target, got %v", history)
+	}
+}
+
+func TestGroup_DashboardHandler(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	newTestGroup().DashboardHandler(rec, httptest.NewRequest("GET", "/dashboard", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{"targetTable", "standby", "192.0.2.2:4739", "ipfix (minimal)", "netflow, ipfix"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dashboard missing %q", want)
+		}
+	}
+	if strings.Contains(body, "Target Server") {
+		t.Error("dashboard should show the target table instead of a single target's config")
+	}
+}
+
+func TestCombinedRate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		targets []models.TargetStat
+		want    models.RateStat
+	}{
+		{"same unit", []models.TargetStat{
+			{Rate: models.RateStat{Unit: UnitFlows, Target: 100, Achieved: 90}},
+			{Rate: models.RateStat{Unit: UnitFlows, Target: 50, Achieved: 50}},
+		}, models.RateStat{Unit: UnitFlows, Target: 150, Achieved: 140}},
+		{"mixed units", []models.TargetStat{
+			{Rate: models.RateStat{Unit: UnitFlows, Target: 100}},
+			{Rate: models.RateStat{Unit: UnitBits, Target: 1000}},
+		}, models.RateStat{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := combinedRate(tt.targets); got != tt.want {
+				t.Errorf("combined rate wrong! Got: %+v Want: %+v", got, tt.want)
+			}
+		})
+	}
+}
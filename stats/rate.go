@@ -0,0 +1,99 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package stats
+
+import (
+	"log"
+	"time"
+
+	"github.com/dmabry/flowgre/models"
+)
+
+// Rate units reported by the collector.
+const (
+	UnitFlows   = "flows/s"
+	UnitPackets = "packets/s"
+	UnitBits    = "bits/s"
+)
+
+// rateShortfall is the fraction of the target below which the collector warns
+// that the generator, not the pacer, is limiting the send rate.
+const rateShortfall = 0.95
+
+// RateTarget returns the configured aggregate send rate and its unit. Configs
+// without a rate target are paced by delay and report packets/s with a zero target.
+func RateTarget(cfg *models.Config) (float64, string) {
+	switch {
+	case cfg == nil:
+		return 0, UnitPackets
+	case cfg.FlowsPerSecond > 0:
+		return float64(cfg.FlowsPerSecond), UnitFlows
+	case cfg.PacketsPerSecond > 0:
+		return float64(cfg.PacketsPerSecond), UnitPackets
+	case cfg.BitsPerSecond > 0:
+		return float64(cfg.BitsPerSecond), UnitBits
+	default:
+		return 0, UnitPackets
+	}
+}
+
+// targetAt returns the aggregate send rate the barrage aims for at t, with the
+// load shape applied. A shaped barrage paced by delay targets the packets/s its
+// workers would send at 100% load.
+func (sc *Collector) targetAt(t time.Time) (float64, string) {
+	target, unit := RateTarget(sc.Config)
+	if sc.Shape == nil {
+		return target, unit
+	}
+	if target == 0 && sc.Config != nil {
+		target = float64(max(sc.Config.Workers, 1)) * 1000 / float64(max(sc.Config.Delay, 1))
+	}
+	return target * sc.Shape.Percent(t.Sub(sc.StartTime)) / 100, unit
+}
+
+// rateCount returns the running total measured in unit.
+func rateCount(totals models.StatTotals, unit string) uint64 {
+	switch unit {
+	case UnitFlows:
+		return totals.FlowsSent
+	case UnitBits:
+		return totals.BytesSent * 8
+	default:
+		return totals.Cycles
+	}
+}
+
+// updateRate measures the achieved rate since the previous call and logs it
+// against the target. Must be called with sc.mu held (write lock).
+func (sc *Collector) updateRate(now time.Time) {
+	_, unit := RateTarget(sc.Config)
+	count := rateCount(sc.StatsTotals, unit)
+	if !sc.rateSince.IsZero() {
+		if elapsed := now.Sub(sc.rateSince).Seconds(); elapsed > 0 {
+			// Compare against the target midway through the interval so a changing shape is averaged
+			target, _ := sc.targetAt(sc.rateSince.Add(now.Sub(sc.rateSince) / 2))
+			sc.rate = models.RateStat{
+				Unit:     unit,
+				Target:   target,
+				Achieved: float64(count-sc.rateCount) / elapsed,
+			}
+			if target > 0 {
+				log.Printf("%sRate: %.1f %s achieved of %.1f %s target (%.1f%%)\n",
+					sc.logPrefix(), sc.rate.Achieved, unit, target, unit, 100*sc.rate.Achieved/target)
+				if sc.rate.Achieved < target*rateShortfall {
+					log.Printf("[WARN] %sAchieved rate is below target; the generator may be the bottleneck\n", sc.logPrefix())
+				}
+			}
+		}
+	}
+	sc.rateSince = now
+	sc.rateCount = count
+}
+
+// Rate returns the most recent achieved vs target rate measurement.
+func (sc *Collector) Rate() models.RateStat {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.rate
+}
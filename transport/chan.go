@@ -0,0 +1,63 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned when sending on a closed Transport.
+var ErrClosed = errors.New("transport closed")
+
+// Chan is an in-memory Transport handing each packet to a channel, for
+// testing code that sends flows without a network.
+type Chan struct {
+	counters
+	packets   chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.RWMutex // held for reading by sends, for writing to close packets
+}
+
+// NewChan returns a Chan whose channel buffers up to buffer packets.
+func NewChan(buffer int) *Chan {
+	return &Chan{packets: make(chan []byte, buffer), done: make(chan struct{})}
+}
+
+// Packets returns the channel packets are delivered on. It is closed once the
+// Chan is closed and every packet sent has been delivered.
+func (c *Chan) Packets() <-chan []byte {
+	return c.packets
+}
+
+// Send puts a copy of payload on the channel, blocking while it is full.
+func (c *Chan) Send(payload []byte) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	select {
+	case <-c.done:
+		return c.count(0, ErrClosed)
+	default:
+	}
+	select {
+	case c.packets <- bytes.Clone(payload):
+		return c.count(len(payload), nil)
+	case <-c.done:
+		return c.count(0, ErrClosed)
+	}
+}
+
+// Close stops further sends, unblocking any waiting on a full channel, and
+// closes the channel.
+func (c *Chan) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		close(c.packets)
+		c.mu.Unlock()
+	})
+	return nil
+}
@@ -0,0 +1,149 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package transport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmabry/flowgre/flowcheck"
+	"github.com/dmabry/flowgre/pcap"
+	"github.com/dmabry/flowgre/record"
+)
+
+// Sink stores flow packets, with the addresses they were sent between, as
+// they are sent. Sinks are safe for concurrent use.
+type Sink interface {
+	Write(src, dst netip.AddrPort, payload []byte) error
+	Close() error
+}
+
+// OpenSink opens the sink at path: a pcap or pcapng capture file, chosen by a
+// .pcap or .pcapng extension, which is created or truncated, or otherwise a
+// record database directory, which is appended to as record does.
+func OpenSink(path string) (Sink, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pcap":
+		return openCaptureSink(path, pcap.FormatPCAP)
+	case ".pcapng":
+		return openCaptureSink(path, pcap.FormatPCAPNG)
+	default:
+		w, err := record.OpenWriter(path)
+		if err != nil {
+			return nil, err
+		}
+		return &dbSink{w: w}, nil
+	}
+}
+
+// captureSink writes packets to a capture file as IP/UDP datagrams in
+// Ethernet frames, timestamped when they are written.
+type captureSink struct {
+	mu sync.Mutex
+	f  *os.File
+	bw *bufio.Writer
+	pw *pcap.Writer
+}
+
+func openCaptureSink(path string, format string) (*captureSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create capture: %w", err)
+	}
+	bw := bufio.NewWriter(f)
+	pw, err := pcap.NewWriter(bw, format)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &captureSink{f: f, bw: bw, pw: pw}, nil
+}
+
+func (s *captureSink) Write(src, dst netip.AddrPort, payload []byte) error {
+	frame, err := pcap.EncodeUDP(pcap.Datagram{Src: src, Dst: dst, Payload: payload})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pw.WriteFrame(time.Now(), frame)
+}
+
+func (s *captureSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.bw.Flush(); err != nil {
+		_ = s.f.Close()
+		return fmt.Errorf("write capture: %w", err)
+	}
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("close capture: %w", err)
+	}
+	return nil
+}
+
+// dbSink writes packets to a record database with the metadata record
+// stores, the destination standing in for the listener.
+type dbSink struct {
+	mu sync.Mutex
+	w  *record.Writer
+}
+
+func (s *dbSink) Write(src, dst netip.AddrPort, payload []byte) error {
+	entry := record.Entry{
+		Received: time.Now(),
+		Source:   src.String(),
+		Listener: dst.String(),
+		Protocol: flowcheck.DetectProtocol(payload),
+		Payload:  payload,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return errors.New("write to closed sink")
+	}
+	return s.w.Write(entry)
+}
+
+func (s *dbSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return nil
+	}
+	err := s.w.Close()
+	s.w = nil
+	return err
+}
+
+// sinkTransport stores the packets of one exporter in a shared Sink.
+type sinkTransport struct {
+	counters
+	sink     Sink
+	src, dst netip.AddrPort
+}
+
+// SinkTransport returns a Transport storing packets in sink as sent from src
+// to dst. Closing it leaves sink open.
+func SinkTransport(sink Sink, src, dst netip.AddrPort) Transport {
+	return &sinkTransport{sink: sink, src: src, dst: dst}
+}
+
+func (s *sinkTransport) Send(payload []byte) (int, error) {
+	if err := s.sink.Write(s.src, s.dst, payload); err != nil {
+		return s.count(0, err)
+	}
+	return s.count(len(payload), nil)
+}
+
+func (s *sinkTransport) Close() error {
+	return nil
+}
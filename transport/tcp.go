@@ -0,0 +1,286 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package transport
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dmabry/flowgre/ipfix"
+)
+
+// Reconnect backoff of a TCP transport: the delay starts at reconnectMin and
+// doubles up to reconnectMax, giving up after reconnectAttempts dials.
+const (
+	reconnectMin      = 100 * time.Millisecond
+	reconnectMax      = 5 * time.Second
+	reconnectAttempts = 8
+)
+
+// ErrFraming is returned when sending something other than exactly one IPFIX
+// message over TCP, which would leave the collector unable to find where the
+// next message starts.
+var ErrFraming = errors.New("payload is not one IPFIX message")
+
+// templateSet is a template or options template set as last sent, keyed by
+// the first template it defines.
+type templateSet struct {
+	setID, templateID uint16
+	data              []byte
+}
+
+// TCP is a Transport sending IPFIX messages over a TCP connection as RFC 7011
+// Section 10.4 describes: back to back, each framed by the length in its
+// header. The template sets sent are remembered per observation domain; when
+// the connection is lost TCP reconnects with backoff, and as the RFC requires
+// sends the domain's templates again on the new connection ahead of its next
+// message.
+type TCP struct {
+	counters
+	addr    string
+	tls     *tls.Config // secures each connection when set
+	verbose bool
+	done    chan struct{}
+	once    sync.Once
+
+	mu        sync.Mutex // guards the fields below and serializes writes
+	conn      net.Conn
+	local     *net.TCPAddr
+	templates map[uint32][]templateSet // by observation domain
+	current   map[uint32]bool          // domains whose templates this connection has
+	closed    bool
+}
+
+// NewTCP connects from local port srcPort, or one the system picks if it is
+// 0, to the collector at server:port. Reconnections come from a port the
+// system picks.
+func NewTCP(server string, port int, srcPort int, verbose bool) (*TCP, error) {
+	return newTCP(server, port, srcPort, nil, verbose)
+}
+
+func newTCP(server string, port int, srcPort int, config *tls.Config, verbose bool) (*TCP, error) {
+	if net.ParseIP(server) == nil {
+		return nil, fmt.Errorf("failed to parse destination IP %s", server)
+	}
+	t := &TCP{
+		addr:      net.JoinHostPort(server, strconv.Itoa(port)),
+		tls:       config,
+		verbose:   verbose,
+		done:      make(chan struct{}),
+		templates: make(map[uint32][]templateSet),
+	}
+	conn, err := t.dial(srcPort)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	t.use(conn)
+	return t, nil
+}
+
+// LocalAddr returns the local address of the first connection.
+func (t *TCP) LocalAddr() *net.TCPAddr {
+	return t.local
+}
+
+// Send writes payload, which must be one IPFIX message, to the connection,
+// reconnecting first if it was lost. A failed write is retried once on a new
+// connection.
+func (t *TCP) Send(payload []byte) (int, error) {
+	domain, sets, err := splitTemplates(payload)
+	if err != nil {
+		return t.count(0, err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if t.closed {
+			return t.count(0, ErrClosed)
+		}
+		if t.conn == nil {
+			conn, err := t.reconnect()
+			if err != nil {
+				return t.count(0, err)
+			}
+			t.use(conn)
+		}
+		err = t.write(domain, payload)
+		if err == nil {
+			break
+		}
+		t.drop(t.conn)
+		if attempt == 1 {
+			return t.count(0, fmt.Errorf("send: %w", err))
+		}
+		log.Printf("IPFIX connection to %s lost: %v", t.addr, err)
+	}
+	for _, set := range sets {
+		t.remember(domain, set)
+	}
+	if t.verbose {
+		fmt.Println("Sent", len(payload), "bytes", t.conn.LocalAddr(), "->", t.conn.RemoteAddr())
+	}
+	return t.count(len(payload), nil)
+}
+
+// write sends the templates of domain first if this connection lacks them,
+// then payload.
+func (t *TCP) write(domain uint32, payload []byte) error {
+	if !t.current[domain] && len(t.templates[domain]) > 0 {
+		if _, err := t.conn.Write(t.templateMessage(domain, payload)); err != nil {
+			return err
+		}
+	}
+	t.current[domain] = true
+	_, err := t.conn.Write(payload)
+	return err
+}
+
+// templateMessage builds a message holding the remembered template sets of
+// domain, with the export time and sequence number of the message it goes
+// ahead of so the collector sees no gap.
+func (t *TCP) templateMessage(domain uint32, next []byte) []byte {
+	msg := make([]byte, ipfix.HeaderSize, ipfix.HeaderSize+512)
+	copy(msg, next[:ipfix.HeaderSize])
+	for _, set := range t.templates[domain] {
+		msg = append(msg, set.data...)
+	}
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(msg)))
+	return msg
+}
+
+// remember keeps set as the latest definition of its template.
+func (t *TCP) remember(domain uint32, set templateSet) {
+	sets := t.templates[domain]
+	for i := range sets {
+		if sets[i].setID == set.setID && sets[i].templateID == set.templateID {
+			sets[i] = set
+			return
+		}
+	}
+	t.templates[domain] = append(sets, set)
+}
+
+// reconnect dials the collector again, backing off between failures. Close
+// cancels the wait.
+func (t *TCP) reconnect() (net.Conn, error) {
+	delay := reconnectMin
+	for attempt := 1; ; attempt++ {
+		conn, err := t.dial(0)
+		if err == nil {
+			log.Printf("IPFIX connection to %s re-established", t.addr)
+			return conn, nil
+		}
+		if attempt == reconnectAttempts {
+			return nil, fmt.Errorf("reconnect to %s after %d attempts: %w", t.addr, attempt, err)
+		}
+		log.Printf("Reconnect to %s failed, retrying in %v: %v", t.addr, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-t.done:
+			return nil, ErrClosed
+		}
+		delay = min(delay*2, reconnectMax)
+	}
+}
+
+func (t *TCP) dial(srcPort int) (net.Conn, error) {
+	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{Port: srcPort}, Timeout: reconnectMax}
+	if t.tls != nil {
+		return (&tls.Dialer{NetDialer: dialer, Config: t.tls}).Dial("tcp", t.addr)
+	}
+	return dialer.Dial("tcp", t.addr)
+}
+
+// use makes conn the connection, which has none of the templates yet, and
+// watches it for the collector closing it.
+func (t *TCP) use(conn net.Conn) {
+	if t.local == nil {
+		t.local = conn.LocalAddr().(*net.TCPAddr)
+	}
+	t.conn = conn
+	t.current = make(map[uint32]bool)
+	go t.watch(conn)
+}
+
+// watch reads conn, on which collectors send nothing, so a close by the
+// collector is noticed before the next write rather than after it.
+func (t *TCP) watch(conn net.Conn) {
+	buf := make([]byte, 512)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			t.mu.Lock()
+			if t.conn == conn && !t.closed {
+				log.Printf("IPFIX connection to %s closed: %v", t.addr, err)
+			}
+			t.drop(conn)
+			t.mu.Unlock()
+			return
+		}
+	}
+}
+
+// drop closes conn and, if it is the connection, forgets it. t.mu is held.
+func (t *TCP) drop(conn net.Conn) {
+	_ = conn.Close()
+	if t.conn == conn {
+		t.conn = nil
+	}
+}
+
+// Close closes the connection, cancelling any reconnect in progress.
+func (t *TCP) Close() error {
+	t.once.Do(func() { close(t.done) })
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// splitTemplates checks payload is one IPFIX message, its header length
+// matching its size and its sets filling it exactly, and returns its
+// observation domain and its template and options template sets.
+func splitTemplates(payload []byte) (uint32, []templateSet, error) {
+	if len(payload) < ipfix.HeaderSize {
+		return 0, nil, fmt.Errorf("%w: %d bytes is shorter than the header", ErrFraming, len(payload))
+	}
+	if version := binary.BigEndian.Uint16(payload[0:2]); version != ipfix.Version {
+		return 0, nil, fmt.Errorf("%w: version %d", ErrFraming, version)
+	}
+	if length := int(binary.BigEndian.Uint16(payload[2:4])); length != len(payload) {
+		return 0, nil, fmt.Errorf("%w: header length %d for %d bytes", ErrFraming, length, len(payload))
+	}
+	domain := binary.BigEndian.Uint32(payload[12:16])
+	var sets []templateSet
+	for off := ipfix.HeaderSize; off < len(payload); {
+		if len(payload)-off < 4 {
+			return 0, nil, fmt.Errorf("%w: truncated set header at offset %d", ErrFraming, off)
+		}
+		setID := binary.BigEndian.Uint16(payload[off : off+2])
+		length := int(binary.BigEndian.Uint16(payload[off+2 : off+4]))
+		if length < 4 || off+length > len(payload) {
+			return 0, nil, fmt.Errorf("%w: set length %d at offset %d", ErrFraming, length, off)
+		}
+		if (setID == ipfix.SetIDTemplate || setID == ipfix.SetIDOptionsTemplate) && length >= 6 {
+			sets = append(sets, templateSet{
+				setID:      setID,
+				templateID: binary.BigEndian.Uint16(payload[off+4 : off+6]),
+				data:       append([]byte(nil), payload[off:off+length]...),
+			})
+		}
+		off += length
+	}
+	return domain, sets, nil
+}
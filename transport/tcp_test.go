@@ -0,0 +1,224 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dmabry/flowgre/ipfix"
+)
+
+// ipfixMessage builds an IPFIX message for domain with sequence number seq
+// holding one set of setID with the given body.
+func ipfixMessage(domain, seq uint32, setID uint16, body []byte) []byte {
+	msg := make([]byte, ipfix.HeaderSize+4, ipfix.HeaderSize+4+len(body))
+	binary.BigEndian.PutUint16(msg[0:2], ipfix.Version)
+	binary.BigEndian.PutUint32(msg[4:8], 1700000000)
+	binary.BigEndian.PutUint32(msg[8:12], seq)
+	binary.BigEndian.PutUint32(msg[12:16], domain)
+	binary.BigEndian.PutUint16(msg[16:18], setID)
+	msg = append(msg, body...)
+	binary.BigEndian.PutUint16(msg[18:20], uint16(4+len(body)))
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(msg)))
+	return msg
+}
+
+// readMessage reads one IPFIX message from r by the length in its header.
+func readMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, ipfix.HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(header[2:4]))
+	copy(msg, header)
+	_, err := io.ReadFull(r, msg[ipfix.HeaderSize:])
+	return msg, err
+}
+
+// template is the body of a template set defining template 256 with one
+// four byte field.
+var template = []byte{0x01, 0x00, 0x00, 0x01, 0x00, 0x08, 0x00, 0x04}
+
+// TestNetworkTCP tests that IPFIX messages are written back to back on a TCP
+// connection and counted, and that anything else is refused.
+func TestNetworkTCP(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	tr, err := Network{Network: NetworkTCP}.Dial("127.0.0.1", ln.Addr().(*net.TCPAddr).Port, 0)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	messages := [][]byte{
+		ipfixMessage(1, 0, ipfix.SetIDTemplate, template),
+		ipfixMessage(1, 0, 256, []byte{0, 0, 0, 1}),
+	}
+	for _, msg := range messages {
+		if _, err := tr.Send(msg); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	truncated := messages[1][:len(messages[1])-1]
+	for _, bad := range [][]byte{[]byte("first"), truncated} {
+		if _, err := tr.Send(bad); !errors.Is(err, ErrFraming) {
+			t.Errorf("Got: %v Want: %v", err, ErrFraming)
+		}
+	}
+	stats := tr.Stats()
+	if err := tr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case data := <-received:
+		if want := bytes.Join(messages, nil); !bytes.Equal(data, want) {
+			t.Errorf("Got: %x Want: %x", data, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the stream")
+	}
+	if want := (Stats{Packets: 2, Bytes: uint64(len(messages[0]) + len(messages[1])), Errors: 2}); stats != want {
+		t.Errorf("Got: %+v Want: %+v", stats, want)
+	}
+}
+
+// TestTCPReconnect tests that a TCP transport reconnects once the collector
+// drops the connection and sends its templates again, ahead of the next
+// message and with its sequence number, before anything else.
+func TestTCPReconnect(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	tr, err := NewTCP("127.0.0.1", ln.Addr().(*net.TCPAddr).Port, 0, false)
+	if err != nil {
+		t.Fatalf("NewTCP: %v", err)
+	}
+	defer tr.Close()
+	if _, err := tr.Send(ipfixMessage(7, 0, ipfix.SetIDTemplate, template)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	first := <-conns
+	if msg, err := readMessage(first); err != nil || binary.BigEndian.Uint16(msg[16:18]) != ipfix.SetIDTemplate {
+		t.Fatalf("Got: %x, %v on the first connection Want: the template", msg, err)
+	}
+	first.Close()
+
+	// Writes to a connection the collector has closed may still succeed, so
+	// keep sending until the new connection is up
+	var second net.Conn
+	for seq := uint32(1); second == nil; seq++ {
+		if seq > 100 {
+			t.Fatal("timed out waiting for the transport to reconnect")
+		}
+		if _, err := tr.Send(ipfixMessage(7, seq, 256, []byte{0, 0, 0, 1})); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		select {
+		case second = <-conns:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	defer second.Close()
+	r := bufio.NewReader(second)
+	msg, err := readMessage(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got := binary.BigEndian.Uint16(msg[16:18]); got != ipfix.SetIDTemplate {
+		t.Fatalf("Got: set %d first on the new connection Want: %d", got, ipfix.SetIDTemplate)
+	}
+	if got := binary.BigEndian.Uint32(msg[12:16]); got != 7 {
+		t.Errorf("Got: domain %d Want: 7", got)
+	}
+	next, err := readMessage(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got, want := binary.BigEndian.Uint32(msg[8:12]), binary.BigEndian.Uint32(next[8:12]); got != want {
+		t.Errorf("Got: template sequence %d Want: %d", got, want)
+	}
+	if !bytes.Equal(msg[ipfix.HeaderSize:], ipfixMessage(7, 0, ipfix.SetIDTemplate, template)[ipfix.HeaderSize:]) {
+		t.Errorf("Got: %x Want: the template set", msg[ipfix.HeaderSize:])
+	}
+}
+
+// TestTCPCloseCancelsReconnect tests that Close stops a transport waiting to
+// reconnect to a collector that has gone away.
+func TestTCPCloseCancelsReconnect(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	tr, err := NewTCP("127.0.0.1", ln.Addr().(*net.TCPAddr).Port, 0, false)
+	if err != nil {
+		t.Fatalf("NewTCP: %v", err)
+	}
+	ln.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := tr.Send(ipfixMessage(1, 0, 256, []byte{0, 0, 0, 1})); err != nil {
+				errs <- err
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	time.Sleep(300 * time.Millisecond)
+	if err := tr.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Got: %v Want: %v", err, ErrClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send still blocked after Close")
+	}
+}
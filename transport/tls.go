@@ -0,0 +1,95 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrDTLSUnsupported is returned when dialing NetworkDTLS. The Go standard
+// library has no DTLS, so IPFIX over DTLS (RFC 7011 Section 11) isn't
+// available; IPFIX over TLS on TCP is.
+var ErrDTLSUnsupported = errors.New("DTLS is not supported: use tls (IPFIX over TLS on TCP) instead")
+
+// TLSOptions are the files and names an IPFIX exporter or collector uses to
+// secure its connections (RFC 7011 Section 11).
+type TLSOptions struct {
+	// CertFile and KeyFile hold the PEM certificate and key presented to the
+	// peer: the client certificate of an exporter, which is optional, or the
+	// server certificate of a collector, which is required.
+	CertFile string
+	KeyFile  string
+	// CAFile holds PEM CA certificates. An exporter trusts only these for the
+	// collector's certificate instead of the system roots. A collector
+	// requires clients to present a certificate issued by one of them.
+	CAFile string
+	// ServerName is sent by an exporter as SNI and checked against the
+	// collector's certificate. It defaults to the collector's address.
+	ServerName string
+}
+
+// ClientConfig returns the tls.Config an exporter dials with.
+func (o TLSOptions) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: o.ServerName}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load TLS client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if o.CAFile != "" {
+		pool, err := loadCertPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// ServerConfig returns the tls.Config a collector listens with.
+func (o TLSOptions) ServerConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS server certificate: %w", err)
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	if o.CAFile != "" {
+		pool, err := loadCertPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// loadCertPool reads the PEM certificates of path into a pool.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read TLS CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates in TLS CA file %s", path)
+	}
+	return pool, nil
+}
+
+// NewTLS connects as NewTCP does, then secures the connection with config;
+// nil verifies the collector against the system roots. Every reconnection
+// makes a new TLS handshake.
+func NewTLS(server string, port int, srcPort int, config *tls.Config, verbose bool) (*TCP, error) {
+	if config == nil {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return newTCP(server, port, srcPort, config, verbose)
+}
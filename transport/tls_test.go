@@ -0,0 +1,231 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package transport
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmabry/flowgre/ipfix"
+)
+
+// testCA is a certificate authority issuing certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+// newTestCA creates a CA and writes its certificate to ca.pem in a temporary
+// directory.
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "flowgre test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	writePEM(t, filepath.Join(ca.dir, "ca.pem"), "CERTIFICATE", der)
+	return ca
+}
+
+// issue writes a certificate and key for name, valid for 127.0.0.1 and usage,
+// and returns their paths.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(ca.dir, name+".pem")
+	keyPath := filepath.Join(ca.dir, name+"-key.pem")
+	writePEM(t, certPath, "CERTIFICATE", der)
+	writePEM(t, keyPath, "EC PRIVATE KEY", keyDER)
+	return certPath, keyPath
+}
+
+func (ca *testCA) file() string {
+	return filepath.Join(ca.dir, "ca.pem")
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tlsCollector listens for one TLS connection and delivers everything sent
+// on it along with the connection state.
+func tlsCollector(t *testing.T, opts TLSOptions) (int, <-chan []byte, <-chan tls.ConnectionState) {
+	t.Helper()
+	cfg, err := opts.ServerConfig()
+	if err != nil {
+		t.Fatalf("ServerConfig: %v", err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan []byte, 1)
+	states := make(chan tls.ConnectionState, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		states <- tlsConn.ConnectionState()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, received, states
+}
+
+// TestNetworkTLS tests that IPFIX messages are sent over TLS with a client
+// certificate, a pinned CA and SNI.
+func TestNetworkTLS(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "collector.example", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "exporter.example", x509.ExtKeyUsageClientAuth)
+	port, received, states := tlsCollector(t, TLSOptions{CertFile: serverCert, KeyFile: serverKey, CAFile: ca.file()})
+
+	cfg, err := TLSOptions{CertFile: clientCert, KeyFile: clientKey, CAFile: ca.file(), ServerName: "collector.example"}.ClientConfig()
+	if err != nil {
+		t.Fatalf("ClientConfig: %v", err)
+	}
+	tr, err := Network{Network: NetworkTLS, TLS: cfg}.Dial("127.0.0.1", port, 0)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	msg := ipfixMessage(1, 0, ipfix.SetIDTemplate, template)
+	if _, err := tr.Send(msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	select {
+	case state := <-states:
+		if state.ServerName != "collector.example" {
+			t.Errorf("Got: SNI %q Want: %q", state.ServerName, "collector.example")
+		}
+		if len(state.PeerCertificates) == 0 || state.PeerCertificates[0].Subject.CommonName != "exporter.example" {
+			t.Error("Got: no client certificate Want: exporter.example")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the handshake")
+	}
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, msg) {
+			t.Errorf("Got: %x Want: %x", data, msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the stream")
+	}
+}
+
+// TestNetworkTLSPinnedCA tests that a collector whose certificate isn't
+// issued by the pinned CA is refused.
+func TestNetworkTLSPinnedCA(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "collector.example", x509.ExtKeyUsageServerAuth)
+	port, _, _ := tlsCollector(t, TLSOptions{CertFile: serverCert, KeyFile: serverKey})
+
+	other := newTestCA(t)
+	cfg, err := TLSOptions{CAFile: other.file()}.ClientConfig()
+	if err != nil {
+		t.Fatalf("ClientConfig: %v", err)
+	}
+	if tr, err := (Network{Network: NetworkTLS, TLS: cfg}).Dial("127.0.0.1", port, 0); err == nil {
+		tr.Close()
+		t.Fatal("expected an error for a collector certificate from another CA")
+	}
+}
+
+// TestNetworkDTLS tests that DTLS is refused with a clear error.
+func TestNetworkDTLS(t *testing.T) {
+	t.Parallel()
+
+	_, err := Network{Network: NetworkDTLS}.Dial("127.0.0.1", 4740, 0)
+	if !errors.Is(err, ErrDTLSUnsupported) {
+		t.Errorf("Got: %v Want: %v", err, ErrDTLSUnsupported)
+	}
+}
+
+// TestTLSOptionsInvalid tests that unreadable files are reported.
+func TestTLSOptionsInvalid(t *testing.T) {
+	t.Parallel()
+
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := (TLSOptions{CAFile: missing}).ClientConfig(); err == nil {
+		t.Error("expected an error for a missing CA file")
+	}
+	if _, err := (TLSOptions{CertFile: missing, KeyFile: missing}).ClientConfig(); err == nil {
+		t.Error("expected an error for a missing client certificate")
+	}
+	if _, err := (TLSOptions{}).ServerConfig(); err == nil {
+		t.Error("expected an error for a server without a certificate")
+	}
+}
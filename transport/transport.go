@@ -0,0 +1,211 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+// Package transport puts generated flow packets where they are going: over UDP
+// or TCP to a collector, into a capture file or record database, or onto an
+// in-memory channel for tests.
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync/atomic"
+)
+
+// Networks a Network dials over.
+const (
+	NetworkUDP  = "udp"
+	NetworkTCP  = "tcp"
+	NetworkTLS  = "tls"  // TCP secured with TLS
+	NetworkDTLS = "dtls" // UDP secured with DTLS; not supported
+)
+
+// Transport sends the flow packets of one exporter to one collector.
+// Transports are safe for concurrent use.
+type Transport interface {
+	// Send sends payload as one packet and returns the number of bytes sent.
+	Send(payload []byte) (int, error)
+	// Close releases the resources the Transport holds.
+	Close() error
+	// Stats returns the running totals of packets sent.
+	Stats() Stats
+}
+
+// Stats are the running totals of a Transport.
+type Stats struct {
+	Packets uint64 // packets sent
+	Bytes   uint64 // bytes sent
+	Errors  uint64 // failed sends
+}
+
+// counters keeps the Stats of a Transport.
+type counters struct {
+	packets, bytes, errors atomic.Uint64
+}
+
+// count adds the outcome of one send and passes it through.
+func (c *counters) count(n int, err error) (int, error) {
+	if err != nil {
+		c.errors.Add(1)
+		return n, err
+	}
+	c.packets.Add(1)
+	c.bytes.Add(uint64(n))
+	return n, nil
+}
+
+// Stats returns the totals counted so far.
+func (c *counters) Stats() Stats {
+	return Stats{Packets: c.packets.Load(), Bytes: c.bytes.Load(), Errors: c.errors.Load()}
+}
+
+// Dialer opens the Transport an exporter sending from local port srcPort uses
+// to reach the collector at server:port. A srcPort of 0 lets the system pick.
+type Dialer interface {
+	Dial(server string, port int, srcPort int) (Transport, error)
+}
+
+// DialerFunc adapts a function to a Dialer.
+type DialerFunc func(server string, port int, srcPort int) (Transport, error)
+
+// Dial calls f.
+func (f DialerFunc) Dial(server string, port int, srcPort int) (Transport, error) {
+	return f(server, port, srcPort)
+}
+
+// Output selects where senders put their packets besides the network.
+type Output struct {
+	// Sink, if set, also stores every packet sent. It is shared by all the
+	// senders of a run and closed by whoever opened it.
+	Sink Sink
+	// SinkOnly stores packets in Sink without sending them over the network.
+	SinkOnly bool
+}
+
+// Network is the Dialer the modes use: it sends over UDP or TCP, and stores
+// packets in Output.Sink as well or instead. The zero Network sends over UDP.
+// TCP and TLS carry IPFIX only; see TCP.
+type Network struct {
+	Network string // NetworkUDP, NetworkTCP or NetworkTLS; "" is NetworkUDP
+	// TLS configures NetworkTLS connections; nil verifies the collector
+	// against the system roots. See TLSOptions.ClientConfig.
+	TLS     *tls.Config
+	Output  Output
+	Verbose bool // print every packet sent over the network
+}
+
+// Dial opens the Transport for one exporter. Packets stored in the sink are
+// addressed from srcPort on the loopback address of the collector's family.
+func (n Network) Dial(server string, port int, srcPort int) (Transport, error) {
+	if n.Output.SinkOnly && n.Output.Sink == nil {
+		return nil, errors.New("sink-only output needs a sink")
+	}
+	var parts []Transport
+	if !n.Output.SinkOnly {
+		var t Transport
+		var err error
+		switch n.Network {
+		case "", NetworkUDP:
+			var udp *UDP
+			udp, err = NewUDP(server, port, srcPort, n.Verbose)
+			if err == nil {
+				t, srcPort = udp, udp.LocalAddr().Port
+			}
+		case NetworkTCP, NetworkTLS:
+			var tcp *TCP
+			if n.Network == NetworkTLS {
+				tcp, err = NewTLS(server, port, srcPort, n.TLS, n.Verbose)
+			} else {
+				tcp, err = NewTCP(server, port, srcPort, n.Verbose)
+			}
+			if err == nil {
+				t, srcPort = tcp, tcp.LocalAddr().Port
+			}
+		case NetworkDTLS:
+			err = ErrDTLSUnsupported
+		default:
+			err = fmt.Errorf("unsupported network %q: must be %s, %s or %s", n.Network, NetworkUDP, NetworkTCP, NetworkTLS)
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, t)
+	}
+	if n.Output.Sink != nil {
+		dst, err := netip.ParseAddr(server)
+		if err != nil {
+			_ = closeAll(parts)
+			return nil, fmt.Errorf("failed to parse destination IP %s", server)
+		}
+		dst = dst.Unmap()
+		src := netip.IPv6Loopback()
+		if dst.Is4() {
+			src = netip.AddrFrom4([4]byte{127, 0, 0, 1})
+		}
+		parts = append(parts, SinkTransport(n.Output.Sink, netip.AddrPortFrom(src, uint16(srcPort)), netip.AddrPortFrom(dst, uint16(port))))
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return Tee(parts...), nil
+}
+
+// shared hands out one Transport to every sender, leaving it open when they
+// close it.
+type shared struct {
+	Transport
+}
+
+func (s shared) Close() error {
+	return nil
+}
+
+// Shared returns a Dialer giving every sender t, whatever collector it dials,
+// so all the packets of a run go through one Transport, such as a Chan. The
+// caller closes t once the run is over.
+func Shared(t Transport) Dialer {
+	return DialerFunc(func(string, int, int) (Transport, error) {
+		return shared{t}, nil
+	})
+}
+
+// tee sends each packet over every one of its Transports in turn.
+type tee struct {
+	counters
+	parts []Transport
+}
+
+// Tee returns a Transport sending each packet over all of ts, stopping at the
+// first error. Send reports the bytes sent by the first.
+func Tee(ts ...Transport) Transport {
+	return &tee{parts: ts}
+}
+
+func (t *tee) Send(payload []byte) (int, error) {
+	sent := 0
+	for i, part := range t.parts {
+		n, err := part.Send(payload)
+		if err != nil {
+			return t.count(0, err)
+		}
+		if i == 0 {
+			sent = n
+		}
+	}
+	return t.count(sent, nil)
+}
+
+func (t *tee) Close() error {
+	return closeAll(t.parts)
+}
+
+// closeAll closes every Transport of ts and returns their errors joined.
+func closeAll(ts []Transport) error {
+	var errs []error
+	for _, t := range ts {
+		errs = append(errs, t.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,322 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+	"github.com/dmabry/flowgre/netflow"
+	"github.com/dmabry/flowgre/pcap"
+	"github.com/dmabry/flowgre/record"
+)
+
+// sent is a packet stored in a memorySink.
+type sent struct {
+	src, dst netip.AddrPort
+	payload  []byte
+}
+
+// memorySink keeps the packets written to it.
+type memorySink struct {
+	mu      sync.Mutex
+	packets []sent
+}
+
+func (s *memorySink) Write(src, dst netip.AddrPort, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.packets = append(s.packets, sent{src, dst, bytes.Clone(payload)})
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+// TestNetworkSinkOnly tests that a sink-only Transport addresses its packets from
+// the source port on the loopback address of the collector's family.
+func TestNetworkSinkOnly(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		server string
+		src    string
+		dst    string
+	}{
+		{"192.0.2.10", "127.0.0.1:12000", "192.0.2.10:9995"},
+		{"::ffff:192.0.2.10", "127.0.0.1:12000", "192.0.2.10:9995"},
+		{"2001:db8::10", "[::1]:12000", "[2001:db8::10]:9995"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			t.Parallel()
+			sink := &memorySink{}
+			tr, err := Network{Output: Output{Sink: sink, SinkOnly: true}}.Dial(tt.server, 9995, 12000)
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer tr.Close()
+			n, err := tr.Send([]byte("flow"))
+			if err != nil || n != 4 {
+				t.Fatalf("Send Got: %d, %v Want: 4, nil", n, err)
+			}
+			if len(sink.packets) != 1 {
+				t.Fatalf("Got: %d packets Want: 1", len(sink.packets))
+			}
+			p := sink.packets[0]
+			if p.src.String() != tt.src || p.dst.String() != tt.dst || string(p.payload) != "flow" {
+				t.Errorf("Got: %s -> %s %q Want: %s -> %s \"flow\"", p.src, p.dst, p.payload, tt.src, tt.dst)
+			}
+		})
+	}
+}
+
+// TestNetworkTee tests that packets are both sent over UDP and stored in the sink.
+func TestNetworkTee(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	sink := &memorySink{}
+	tr, err := Network{Output: Output{Sink: sink}}.Dial("127.0.0.1", port, 0)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer tr.Close()
+	if _, err := tr.Send([]byte("flow")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, from, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if string(buf[:n]) != "flow" {
+		t.Errorf("Got: %q over UDP Want: \"flow\"", buf[:n])
+	}
+	if len(sink.packets) != 1 {
+		t.Fatalf("Got: %d packets in sink Want: 1", len(sink.packets))
+	}
+	// The source port the system picked for UDP is the one stored
+	if got := sink.packets[0].src.Port(); int(got) != from.Port {
+		t.Errorf("Got: source port %d in sink Want: %d", got, from.Port)
+	}
+	if got, want := tr.Stats(), (Stats{Packets: 1, Bytes: 4}); got != want {
+		t.Errorf("Got: %+v Want: %+v", got, want)
+	}
+}
+
+// TestChan tests that packets sent on a Chan are delivered as copies, and
+// that sends after Close fail.
+func TestChan(t *testing.T) {
+	t.Parallel()
+
+	c := NewChan(2)
+	payload := []byte("flow")
+	if _, err := c.Send(payload); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	payload[0] = 'F'
+	if got := <-c.Packets(); string(got) != "flow" {
+		t.Errorf("Got: %q Want: \"flow\"", got)
+	}
+
+	// A send blocked on a full channel is released by Close
+	_, _ = c.Send(payload)
+	_, _ = c.Send(payload)
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := c.Send(payload)
+		blocked <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := <-blocked; !errors.Is(err, ErrClosed) {
+		t.Errorf("Got: %v from blocked send Want: %v", err, ErrClosed)
+	}
+	if _, err := c.Send(payload); !errors.Is(err, ErrClosed) {
+		t.Errorf("Got: %v after Close Want: %v", err, ErrClosed)
+	}
+	// The buffered packets are still delivered before the channel closes
+	delivered := 0
+	for range c.Packets() {
+		delivered++
+	}
+	if delivered != 2 {
+		t.Errorf("Got: %d packets after Close Want: 2", delivered)
+	}
+	if got, want := c.Stats(), (Stats{Packets: 3, Bytes: 12, Errors: 2}); got != want {
+		t.Errorf("Got: %+v Want: %+v", got, want)
+	}
+}
+
+// TestShared tests that every sender dialing a Shared Dialer gets the one
+// Transport, which stays open when they close it.
+func TestShared(t *testing.T) {
+	t.Parallel()
+
+	c := NewChan(2)
+	dial := Shared(c)
+	for _, server := range []string{"192.0.2.1", "2001:db8::1"} {
+		tr, err := dial.Dial(server, 9995, 0)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		if _, err := tr.Send([]byte(server)); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if err := tr.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+	if got := c.Stats().Packets; got != 2 {
+		t.Errorf("Got: %d packets Want: 2", got)
+	}
+}
+
+// TestNetworkInvalid tests that Transports that can't work are refused.
+func TestNetworkInvalid(t *testing.T) {
+	t.Parallel()
+
+	if _, err := (Network{Output: Output{SinkOnly: true}}).Dial("127.0.0.1", 9995, 0); err == nil {
+		t.Error("sink-only without a sink: expected error, got nil")
+	}
+	if _, err := (Network{Output: Output{Sink: &memorySink{}, SinkOnly: true}}).Dial("collector", 9995, 0); err == nil {
+		t.Error("invalid server: expected error, got nil")
+	}
+	if _, err := (Network{Network: "sctp"}).Dial("127.0.0.1", 9995, 0); err == nil {
+		t.Error("unknown network: expected error, got nil")
+	}
+}
+
+// TestOpenSinkCapture tests that packets written to a capture sink read back
+// as the UDP datagrams they were sent as, in both capture formats.
+func TestOpenSinkCapture(t *testing.T) {
+	t.Parallel()
+
+	src := netip.MustParseAddrPort("127.0.0.1:12000")
+	dst := netip.MustParseAddrPort("192.0.2.10:9995")
+	for _, name := range []string{"flows.pcap", "flows.PCAPNG"} {
+		path := filepath.Join(t.TempDir(), name)
+		sink, err := OpenSink(path)
+		if err != nil {
+			t.Fatalf("OpenSink(%s): %v", name, err)
+		}
+		payloads := [][]byte{[]byte("first"), []byte("second")}
+		for _, p := range payloads {
+			if err := sink.Write(src, dst, p); err != nil {
+				t.Fatalf("%s write: %v", name, err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("%s close: %v", name, err)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := pcap.NewReader(f)
+		if err != nil {
+			t.Fatalf("%s read header: %v", name, err)
+		}
+		for i, want := range payloads {
+			frame, err := r.Next()
+			if err != nil {
+				t.Fatalf("%s packet %d: %v", name, i+1, err)
+			}
+			d, err := pcap.DecodeUDP(frame)
+			if err != nil {
+				t.Fatalf("%s packet %d: %v", name, i+1, err)
+			}
+			if d.Src != src || d.Dst != dst || !bytes.Equal(d.Payload, want) {
+				t.Errorf("%s packet %d Got: %s -> %s %q Want: %s -> %s %q", name, i+1, d.Src, d.Dst, d.Payload, src, dst, want)
+			}
+		}
+		if _, err := r.Next(); !errors.Is(err, io.EOF) {
+			t.Errorf("%s Got: %v after the last packet Want: EOF", name, err)
+		}
+		f.Close()
+	}
+}
+
+// TestOpenSinkDatabase tests that packets written to a database sink are
+// recorded as record would, appending to the records already there.
+func TestOpenSinkDatabase(t *testing.T) {
+	t.Parallel()
+
+	session := netflow.NewSession()
+	flow := netflow.GenerateTemplateNetflow(100, session)
+	flowBuf := flow.ToBytes()
+	v9 := flowBuf.Bytes()
+	src := netip.MustParseAddrPort("127.0.0.1:12000")
+	dst := netip.MustParseAddrPort("192.0.2.10:9995")
+	dbdir := t.TempDir()
+	// Two runs writing to the same database
+	for range 2 {
+		sink, err := OpenSink(dbdir)
+		if err != nil {
+			t.Fatalf("OpenSink: %v", err)
+		}
+		if err := sink.Write(src, dst, v9); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+
+	db, err := badger.Open(badger.DefaultOptions(dbdir).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer db.Close()
+	var keys []string
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, string(it.Item().Key()))
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entry, err := record.UnmarshalEntry(value)
+			if err != nil {
+				return err
+			}
+			if entry.Received.IsZero() || entry.Source != src.String() || entry.Listener != dst.String() ||
+				entry.Protocol != record.ProtocolNetFlowV9 || !bytes.Equal(entry.Payload, v9) {
+				t.Errorf("Got: %+v Want: %s -> %s %s", entry, src, dst, record.ProtocolNetFlowV9)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read database: %v", err)
+	}
+	want := []string{"\x00\x00\x00\x01", "\x00\x00\x00\x02"}
+	if len(keys) != len(want) || keys[0] != want[0] || keys[1] != want[1] {
+		t.Errorf("Got: keys %q Want: %q", keys, want)
+	}
+}
@@ -0,0 +1,49 @@
+// Use of this source code is governed by Apache License 2.0
+// that can be found in the LICENSE file.
+
+package transport
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/dmabry/flowgre/utils"
+)
+
+// UDP is a Transport sending datagrams from a local UDP port.
+type UDP struct {
+	counters
+	conn    *net.UDPConn
+	addr    *net.UDPAddr
+	verbose bool
+}
+
+// NewUDP opens local UDP port srcPort, or one the system picks if it is 0, for
+// sending to the collector at server:port.
+func NewUDP(server string, port int, srcPort int, verbose bool) (*UDP, error) {
+	destIP := net.ParseIP(server)
+	if destIP == nil {
+		return nil, fmt.Errorf("failed to parse destination IP %s", server)
+	}
+	// It looks like a listener, but it is used to send packets. Allows setting the source port.
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: srcPort})
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	return &UDP{conn: conn, addr: &net.UDPAddr{IP: destIP, Port: port}, verbose: verbose}, nil
+}
+
+// LocalAddr returns the local address packets are sent from.
+func (u *UDP) LocalAddr() *net.UDPAddr {
+	return u.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// Send sends payload to the collector as one datagram.
+func (u *UDP) Send(payload []byte) (int, error) {
+	return u.count(utils.SendPacket(u.conn, u.addr, payload, u.verbose))
+}
+
+// Close closes the local port.
+func (u *UDP) Close() error {
+	return u.conn.Close()
+}
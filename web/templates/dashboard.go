@@ -363,6 +363,41 @@ tr:hover {
     </div>
   </div>
 
+  {{if .Targets}}
+  <!-- Target details -->
+  <div class="table-section">
+    <h3><i class="fa-solid fa-bullseye"></i> Targets</h3>
+    <table>
+      <thead>
+        <tr>
+          <th>Target</th>
+          <th>Collector</th>
+          <th>Protocol</th>
+          <th>Workers</th>
+          <th>Flows Sent</th>
+          <th>Cycles</th>
+          <th>Bytes Sent</th>
+          <th>Rate</th>
+        </tr>
+      </thead>
+      <tbody id="targetTable">
+        {{ range .Targets }}
+        <tr>
+          <td><i class="fa-solid fa-bullseye" style="color: var(--accent-blue)"></i> {{.Name}}</td>
+          <td>{{.Server}}:{{.DstPort}}</td>
+          <td>{{.Protocol}}{{if .Profile}} ({{.Profile}}){{end}}</td>
+          <td>{{.Workers}}</td>
+          <td>{{.Totals.FlowsSent}}</td>
+          <td>{{.Totals.Cycles}}</td>
+          <td>{{formatBytes .Totals.BytesSent}}</td>
+          <td>-</td>
+        </tr>
+        {{end}}
+      </tbody>
+    </table>
+  </div>
+  {{end}}
+
   <!-- Worker details -->
   <div class="table-section">
     <h3><i class="fa-solid fa-gears"></i> Worker Details</h3>
@@ -396,6 +431,7 @@ tr:hover {
     </table>
   </div>
 
+  {{if not .Targets}}
   <!-- Config details -->
   <div class="config-section">
     <h3><i class="fa-solid fa-wrench"></i> Configuration</h3>
@@ -434,6 +470,7 @@ tr:hover {
       </div>
     </div>
   </div>
+  {{end}}
 </div>
 
 <!-- Footer -->
@@ -490,7 +527,9 @@ let previousTotals = null;
 let chartData = {
   labels: [],
   flows: [],
-  bytes: []
+  bytes: [],
+  target: [],
+  achieved: []
 };
 
 function initChart() {
@@ -519,6 +558,27 @@ function initChart() {
           backgroundColor: 'rgba(102, 187, 106, 0.1)',
           tension: 0.3,
           fill: true
+        },
+        {
+          label: 'Target',
+          data: chartData.target,
+          borderColor: '#ffa726',
+          borderDash: [6, 4],
+          pointRadius: 0,
+          tension: 0,
+          fill: false,
+          yAxisID: 'rate',
+          hidden: true
+        },
+        {
+          label: 'Achieved',
+          data: chartData.achieved,
+          borderColor: '#ef5350',
+          pointRadius: 0,
+          tension: 0.3,
+          fill: false,
+          yAxisID: 'rate',
+          hidden: true
         }
       ]
     },
@@ -544,6 +604,13 @@ function initChart() {
           beginAtZero: true,
           ticks: { color: textColor },
           grid: { color: gridColor }
+        },
+        rate: {
+          position: 'right',
+          display: false,
+          beginAtZero: true,
+          ticks: { color: textColor },
+          grid: { drawOnChartArea: false }
         }
       }
     }
@@ -588,12 +655,17 @@ async function updateDashboard() {
     chartData.labels.push(timeLabel);
     chartData.flows.push(flowsPerSec);
     chartData.bytes.push(bytesPerSec / (1024 * 1024)); // Convert to MB
+    const rate = data.rate || { target: 0, achieved: 0, unit: '' };
+    chartData.target.push(rate.target);
+    chartData.achieved.push(rate.achieved);
     
     // Keep only last 60 data points (2 minutes at 2-second intervals)
     if (chartData.labels.length > 60) {
       chartData.labels.shift();
       chartData.flows.shift();
       chartData.bytes.shift();
+      chartData.target.shift();
+      chartData.achieved.shift();
     }
     
     // Update chart
@@ -601,11 +673,23 @@ async function updateDashboard() {
       flowRateChart.data.labels = chartData.labels;
       flowRateChart.data.datasets[0].data = chartData.flows;
       flowRateChart.data.datasets[1].data = chartData.bytes;
+      // Target vs achieved rate, shown on its own axis once a rate target or load shape is set
+      const paced = rate.target > 0;
+      flowRateChart.data.datasets[2].data = chartData.target;
+      flowRateChart.data.datasets[2].label = 'Target ' + rate.unit;
+      flowRateChart.data.datasets[2].hidden = !paced;
+      flowRateChart.data.datasets[3].data = chartData.achieved;
+      flowRateChart.data.datasets[3].label = 'Achieved ' + rate.unit;
+      flowRateChart.data.datasets[3].hidden = !paced;
+      flowRateChart.options.scales.rate.display = paced;
       flowRateChart.update('none');
     }
     
     // Update worker table
     updateWorkerTable(workers, timeDiff);
+    if (data.targets) {
+      updateTargetTable(data.targets);
+    }
     
   } catch (error) {
     console.error('Failed to update dashboard:', error);
@@ -614,7 +698,8 @@ async function updateDashboard() {
 
 function updateWorkerTable(workers, timeDiff) {
   const tbody = document.getElementById('workerTable');
-  const workerIds = Object.keys(workers).sort((a, b) => parseInt(a) - parseInt(b));
+  // Keys are worker IDs, or "target/worker" when several targets share the dashboard
+  const workerIds = Object.keys(workers).sort((a, b) => a.localeCompare(b, undefined, { numeric: true }));
   
   if (workerIds.length === 0) {
     tbody.innerHTML = '<tr><td colspan="6" style="text-align: center; color: var(--text-secondary);">No worker stats yet</td></tr>';
@@ -631,7 +716,7 @@ function updateWorkerTable(workers, timeDiff) {
     }
     
     html += '<tr>';
-    html += '<td><i class="fa-solid fa-user" style="color: var(--accent-blue)"></i> #' + id + '</td>';
+    html += '<td><i class="fa-solid fa-user" style="color: var(--accent-blue)"></i> #' + escapeHTML(id) + '</td>';
     html += '<td>' + w.source_id + '</td>';
     html += '<td>' + formatNumber(w.flows_sent) + '</td>';
     html += '<td>' + formatNumber(w.cycles) + '</td>';
@@ -643,6 +728,42 @@ function updateWorkerTable(workers, timeDiff) {
   tbody.innerHTML = html;
 }
 
+function updateTargetTable(targets) {
+  const tbody = document.getElementById('targetTable');
+  if (!tbody) return;
+
+  let html = '';
+  targets.forEach(t => {
+    let rate = '-';
+    if (t.rate && t.rate.unit) {
+      rate = formatNumber(Math.round(t.rate.achieved)) + ' ' + t.rate.unit;
+      if (t.rate.target > 0) {
+        rate += ' of ' + formatNumber(Math.round(t.rate.target));
+      }
+    }
+
+    html += '<tr>';
+    html += '<td><i class="fa-solid fa-bullseye" style="color: var(--accent-blue)"></i> ' + escapeHTML(t.name) + '</td>';
+    html += '<td>' + escapeHTML(t.server) + ':' + t.dst_port + '</td>';
+    html += '<td>' + escapeHTML(t.protocol) + (t.profile ? ' (' + escapeHTML(t.profile) + ')' : '') + '</td>';
+    html += '<td>' + t.workers + '</td>';
+    html += '<td>' + formatNumber(t.totals.flows_sent) + '</td>';
+    html += '<td>' + formatNumber(t.totals.cycles) + '</td>';
+    html += '<td>' + formatBytes(t.totals.bytes_sent) + '</td>';
+    html += '<td>' + rate + '</td>';
+    html += '</tr>';
+  });
+
+  tbody.innerHTML = html;
+}
+
+// Escape text from the config before inserting it as HTML
+function escapeHTML(text) {
+  const div = document.createElement('div');
+  div.textContent = text;
+  return div.innerHTML;
+}
+
 // Initialize
 document.addEventListener('DOMContentLoaded', function() {
   initChart();
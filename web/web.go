@@ -24,7 +24,6 @@ import (
 	"time"
 
 	"github.com/dmabry/flowgre/models"
-	"github.com/dmabry/flowgre/stats"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -125,11 +124,19 @@ func ValidateWebBinding(ip, tlsCert, tlsKey string) error {
 	return nil
 }
 
+// StatsSource serves the stats API and dashboard. Both *stats.Collector and
+// *stats.Group implement it.
+type StatsSource interface {
+	StatsHandler(w http.ResponseWriter, r *http.Request)
+	HistoryHandler(w http.ResponseWriter, r *http.Request)
+	DashboardHandler(w http.ResponseWriter, r *http.Request)
+}
+
 // RunWebServer is used to start the web server goroutine.
 // If tlsCert and tlsKey are empty, the server uses plain HTTP and requires
 // a loopback bind address. Non-loopback addresses require TLS to protect
 // credentials in transit.
-func RunWebServer(ip string, port int, wg *sync.WaitGroup, ctx context.Context, sc *stats.Collector, username, hashedPassword, tlsCert, tlsKey string) {
+func RunWebServer(ip string, port int, wg *sync.WaitGroup, ctx context.Context, sc StatsSource, username, hashedPassword, tlsCert, tlsKey string) {
 	defer wg.Done()
 
 	// Enforce loopback-only for non-TLS to protect credentials